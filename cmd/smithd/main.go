@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/sorenmh/deploysmith/internal/smithd/api"
 	"github.com/sorenmh/deploysmith/internal/smithd/config"
@@ -16,7 +21,15 @@ var (
 	date    = "unknown"
 )
 
+// shutdownTimeout is how long requests and deployments in progress get to
+// finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// Log as key=value pairs so request IDs can be searched for; plain log
+	// calls go through the same handler
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
 	log.Printf("smithd %s (commit: %s, built: %s)\n", version, commit, date)
 
 	// Load configuration
@@ -24,6 +37,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	for _, key := range cfg.APIKeys {
+		if key.Plaintext {
+			log.Printf("Warning: API key %s is configured in plaintext, which is deprecated; give its SHA-256 hash as %s:sha256:<hash> instead", key.Name, key.Name)
+		}
+	}
 
 	// Ensure database directory exists
 	dbDir := filepath.Dir(cfg.DBPath)
@@ -43,9 +61,31 @@ func main() {
 	// Create HTTP server
 	server := api.NewServer(cfg, database)
 
+	// Shut down on SIGINT or SIGTERM, giving requests and queued deployments
+	// time to finish before those still running are cancelled
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown did not finish cleanly: %v", err)
+		}
+	}()
+
 	// Start server
-	log.Printf("Starting smithd on port %s", cfg.Port)
+	if cfg.TLSEnabled() {
+		log.Printf("Starting smithd on port %s with TLS", cfg.Port)
+	} else {
+		log.Printf("Starting smithd on port %s without TLS", cfg.Port)
+	}
 	if err := server.Start(); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
+	<-shutdownDone
 }
@@ -80,7 +80,7 @@ func (c *Client) CreateDraftVersion(appID string, req DraftVersionRequest) (*Dra
 
 	if resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var draftResp DraftVersionResponse
@@ -98,9 +98,88 @@ type PublishVersionRequest struct {
 
 // PublishVersionResponse is the response from publishing a version
 type PublishVersionResponse struct {
-	VersionID        string   `json:"versionId"`
-	Status           string   `json:"status"`
-	AutoDeployments  []string `json:"autoDeployments,omitempty"`
+	VersionID       string           `json:"versionId"`
+	Status          string           `json:"status"`
+	AutoDeployments []AutoDeployment `json:"autoDeployments,omitempty"`
+}
+
+// AutoDeployment is a deployment started by an auto-deploy policy on publish
+type AutoDeployment struct {
+	DeploymentID string `json:"deploymentId"`
+	Environment  string `json:"environment"`
+	Status       string `json:"status"`
+}
+
+// ValidationIssue is a problem found while validating a draft version
+type ValidationIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by PublishVersion when smithd rejects the
+// draft's manifests
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d validation error(s): %s", len(e.Issues), e.Issues[0].Message)
+}
+
+// errorResponse is the body of a smithd error response
+type errorResponse struct {
+	Error struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Details []ValidationIssue `json:"details"`
+	} `json:"error"`
+}
+
+// APIError is an error response from smithd. Code is smithd's
+// machine-readable error code, such as not_found, storage_error or
+// gitops_push_rejected, and is empty when the body wasn't a smithd error.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// newAPIError builds an APIError from a response body
+func newAPIError(status int, body []byte) *APIError {
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Code == "" {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	return &APIError{StatusCode: status, Code: errResp.Error.Code, Message: errResp.Error.Message}
+}
+
+// ValidateVersionResponse is the response from a dry-run publish
+type ValidateVersionResponse struct {
+	VersionID     string            `json:"versionId"`
+	Valid         bool              `json:"valid"`
+	ManifestFiles []string          `json:"manifestFiles"`
+	AssetFiles    []string          `json:"assetFiles,omitempty"`
+	Errors        []ValidationIssue `json:"errors"`
+	Warnings      []ValidationIssue `json:"warnings"`
+}
+
+// Version is a version as returned by smithd
+type Version struct {
+	VersionID     string          `json:"versionId"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	PublishedAt   *time.Time      `json:"publishedAt,omitempty"`
+	Metadata      VersionMetadata `json:"metadata"`
+	ManifestFiles []string        `json:"manifestFiles"`
+	DeployedTo    []string        `json:"deployedTo,omitempty"`
 }
 
 // AppInfo represents basic app information
@@ -109,14 +188,9 @@ type AppInfo struct {
 	Name string `json:"name"`
 }
 
-// ListAppsResponse represents the response from listing apps
-type ListAppsResponse struct {
-	Apps []AppInfo `json:"apps"`
-}
-
 // GetAppIDByName looks up an app ID by name
 func (c *Client) GetAppIDByName(appName string) (string, error) {
-	url := c.joinURL("api/v1/apps")
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s", appName))
 
 	httpReq, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -131,33 +205,20 @@ func (c *Client) GetAppIDByName(appName string) (string, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("application '%s' not found", appName)
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", newAPIError(resp.StatusCode, body)
 	}
 
-	var listResp ListAppsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+	var app AppInfo
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Find app by name
-	for _, app := range listResp.Apps {
-		if app.Name == appName {
-			return app.ID, nil
-		}
-	}
-
-	return "", fmt.Errorf("application '%s' not found", appName)
-}
-
-// CreateDraftVersionByName creates a new draft version using app name
-func (c *Client) CreateDraftVersionByName(appName string, req DraftVersionRequest) (*DraftVersionResponse, error) {
-	appID, err := c.GetAppIDByName(appName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve app name '%s': %w", appName, err)
-	}
-	return c.CreateDraftVersion(appID, req)
+	return app.ID, nil
 }
 
 // PublishVersion publishes a draft version
@@ -189,7 +250,11 @@ func (c *Client) PublishVersion(appName, versionID string, noValidate bool) (*Pu
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		var errResp errorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error.Code == "validation_failed" && len(errResp.Error.Details) > 0 {
+			return nil, &ValidationError{Issues: errResp.Error.Details}
+		}
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var publishResp PublishVersionResponse
@@ -199,3 +264,63 @@ func (c *Client) PublishVersion(appName, versionID string, noValidate bool) (*Pu
 
 	return &publishResp, nil
 }
+
+// ValidateVersion validates a draft version server-side without publishing it
+func (c *Client) ValidateVersion(appName, versionID string) (*ValidateVersionResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/publish?dryRun=true", appName, versionID))
+
+	httpReq, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var validateResp ValidateVersionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&validateResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &validateResp, nil
+}
+
+// GetVersion gets a version of an application
+func (c *Client) GetVersion(appID, versionID string) (*Version, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s", appID, versionID))
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var version Version
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &version, nil
+}
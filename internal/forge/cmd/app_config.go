@@ -88,6 +88,9 @@ type VersionInfo struct {
 	App     string `json:"app"`
 	AppID   string `json:"appId"`
 	Version string `json:"version"`
+
+	// GitMetadata is what forge init sent with the draft
+	GitMetadata
 }
 
 // LoadVersionInfo loads version information from .forge/version-info
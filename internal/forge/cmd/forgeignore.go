@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// forgeIgnoreFile lists files forge upload skips in a directory, in
+// gitignore syntax
+const forgeIgnoreFile = ".forgeignore"
+
+// ignoreRule is one pattern of a .forgeignore file or --exclude flag
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList decides which paths under an uploaded directory are skipped.
+// Like gitignore, the last matching rule wins and ! re-includes a path.
+type ignoreList []ignoreRule
+
+// parseIgnoreRule parses a gitignore line. Blank lines and comments give
+// ok false.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// Patterns with a slash before the end match from the directory root
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	rule.pattern = line
+	return rule, line != ""
+}
+
+// loadIgnoreList reads .forgeignore from dir, if it exists, followed by the
+// exclude patterns
+func loadIgnoreList(dir string, excludes []string) (ignoreList, error) {
+	var rules ignoreList
+
+	f, err := os.Open(filepath.Join(dir, forgeIgnoreFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", forgeIgnoreFile, err)
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", forgeIgnoreFile, err)
+		}
+	}
+
+	for _, exclude := range excludes {
+		rule, ok := parseIgnoreRule(exclude)
+		if !ok {
+			continue
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", exclude, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// ignored reports whether rel, a slash-separated path relative to the
+// uploaded directory, is skipped
+func (l ignoreList) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if !rule.anchored {
+			name = path.Base(rel)
+		}
+		if matchGlob(rule.pattern, name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchGlob matches a slash-separated name against a pattern where each
+// segment is a path.Match pattern and ** matches any number of segments
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+	ok, err := path.Match(pattern[0], name[0])
+	return ok && err == nil && matchSegments(pattern[1:], name[1:])
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreList(t *testing.T) {
+	dir := t.TempDir()
+	forgeignore := `# Kustomize fragments aren't deployed on their own
+kustomization.yaml
+tests/
+/overlays/*/patch-*.yaml
+**/fixtures/**
+!fixtures/keep.yaml
+`
+	if err := os.WriteFile(filepath.Join(dir, forgeIgnoreFile), []byte(forgeignore), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", forgeIgnoreFile, err)
+	}
+
+	ignore, err := loadIgnoreList(dir, []string{"*.secret.yaml"})
+	if err != nil {
+		t.Fatalf("failed to load ignore list: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"deployment.yaml", false, false},
+		{"kustomization.yaml", false, true},
+		{"base/kustomization.yaml", false, true},
+		{"tests", true, true},
+		{"tests", false, false},
+		{"overlays/prod/patch-replicas.yaml", false, true},
+		{"base/overlays/prod/patch-replicas.yaml", false, false},
+		{"a/fixtures/b/c.yaml", false, true},
+		{"fixtures/keep.yaml", false, false},
+		{"db.secret.yaml", false, true},
+	}
+	for _, tt := range tests {
+		if got := ignore.ignored(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestIgnoreList_InvalidExclude(t *testing.T) {
+	if _, err := loadIgnoreList(t.TempDir(), []string{"[a-"}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
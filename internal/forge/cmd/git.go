@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GitMetadata is the git commit a version is built from
+type GitMetadata struct {
+	SHA       string `json:"gitSha,omitempty"`
+	Branch    string `json:"gitBranch,omitempty"`
+	Committer string `json:"gitCommitter,omitempty"`
+}
+
+// branchEnvVars are CI variables naming the branch being built, checked when
+// the checkout is a detached HEAD
+var branchEnvVars = []string{
+	"GITHUB_HEAD_REF",    // GitHub Actions pull requests
+	"GITHUB_REF_NAME",    // GitHub Actions
+	"CI_COMMIT_REF_NAME", // GitLab CI
+	"BRANCH_NAME",        // Jenkins
+	"GIT_BRANCH",         // Jenkins git plugin
+}
+
+// detectGitMetadata reads the commit checked out in dir, or the working
+// directory if dir is empty. Fields git can't provide are left empty.
+func detectGitMetadata(dir string) GitMetadata {
+	meta := GitMetadata{
+		SHA:       gitOutput(dir, "rev-parse", "HEAD"),
+		Branch:    gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD"),
+		Committer: gitOutput(dir, "log", "-1", "--format=%ce"),
+	}
+
+	if meta.Branch == "" || meta.Branch == "HEAD" {
+		meta.Branch = ""
+		for _, name := range branchEnvVars {
+			if branch := os.Getenv(name); branch != "" {
+				meta.Branch = strings.TrimPrefix(branch, "origin/")
+				break
+			}
+		}
+	}
+
+	return meta
+}
+
+// gitOutput runs git in dir and returns its trimmed output, or "" if it
+// fails
+func gitOutput(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// mergeGitMetadata fills the empty fields of meta from fallback
+func mergeGitMetadata(meta, fallback GitMetadata) GitMetadata {
+	if meta.SHA == "" {
+		meta.SHA = fallback.SHA
+	}
+	if meta.Branch == "" {
+		meta.Branch = fallback.Branch
+	}
+	if meta.Committer == "" {
+		meta.Committer = fallback.Committer
+	}
+	return meta
+}
+
+// complete reports whether every field is set
+func (m GitMetadata) complete() bool {
+	return m.SHA != "" && m.Branch != "" && m.Committer != ""
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// newTestRepo creates a git repository with one commit on main
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=Dev", "-c", "user.email=dev@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	return dir
+}
+
+func TestDetectGitMetadata(t *testing.T) {
+	dir := newTestRepo(t)
+
+	meta := detectGitMetadata(dir)
+	if len(meta.SHA) != 40 || meta.Branch != "main" || meta.Committer != "dev@example.com" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+
+	// A detached HEAD takes the branch from CI
+	cmd := exec.Command("git", "checkout", "-q", "--detach")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git checkout failed: %v\n%s", err, out)
+	}
+	for _, name := range branchEnvVars {
+		t.Setenv(name, "")
+	}
+	t.Setenv("GIT_BRANCH", "origin/release")
+	if meta := detectGitMetadata(dir); meta.Branch != "release" {
+		t.Errorf("expected branch from GIT_BRANCH, got %q", meta.Branch)
+	}
+}
+
+func TestDetectGitMetadata_NotARepo(t *testing.T) {
+	for _, name := range branchEnvVars {
+		t.Setenv(name, "")
+	}
+	if meta := detectGitMetadata(t.TempDir()); meta != (GitMetadata{}) {
+		t.Errorf("expected no metadata outside a repository, got %+v", meta)
+	}
+}
+
+func TestGenerateVersionYML(t *testing.T) {
+	info := &VersionInfo{
+		Version:     "v1.0.0",
+		GitMetadata: GitMetadata{SHA: "abc123", Branch: "main", Committer: "dev@example.com"},
+	}
+
+	data, err := generateVersionYML(info, GitMetadata{Branch: "hotfix"})
+	if err != nil {
+		t.Fatalf("failed to generate version.yml: %v", err)
+	}
+
+	var got struct {
+		Version  string            `yaml:"version"`
+		Metadata map[string]string `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to parse version.yml: %v", err)
+	}
+	if got.Version != "v1.0.0" || got.Metadata["gitSha"] != "abc123" || got.Metadata["gitBranch"] != "hotfix" ||
+		got.Metadata["gitCommitter"] != "dev@example.com" || got.Metadata["timestamp"] == "" {
+		t.Errorf("unexpected version.yml:\n%s", data)
+	}
+}
@@ -28,7 +28,12 @@ var initCmd = &cobra.Command{
 
 The presigned URL is saved to .forge/upload-url for use by the upload command.
 
+The git SHA, branch and committer are read from the repository in the working
+directory unless given as flags. On a detached HEAD the branch comes from the
+CI environment (GITHUB_REF_NAME, CI_COMMIT_REF_NAME, BRANCH_NAME, ...).
+
 Example:
+  forge init --app my-app --version v1.0.0
   forge init --app my-app --version v1.0.0 --git-sha abc123 --git-branch main`,
 	RunE: runInit,
 }
@@ -38,9 +43,9 @@ func init() {
 
 	initCmd.Flags().StringVar(&initApp, "app", "", "Application name (optional if .deploysmith/app.yaml exists)")
 	initCmd.Flags().StringVar(&initVersion, "version", "", "Version identifier (required)")
-	initCmd.Flags().StringVar(&initGitSHA, "git-sha", "", "Git commit SHA")
-	initCmd.Flags().StringVar(&initGitBranch, "git-branch", "", "Git branch name")
-	initCmd.Flags().StringVar(&initGitCommitter, "git-committer", "", "Git committer email")
+	initCmd.Flags().StringVar(&initGitSHA, "git-sha", "", "Git commit SHA (default: detected from git)")
+	initCmd.Flags().StringVar(&initGitBranch, "git-branch", "", "Git branch name (default: detected from git)")
+	initCmd.Flags().StringVar(&initGitCommitter, "git-committer", "", "Git committer email (default: detected from git)")
 	initCmd.Flags().IntVar(&initBuildNumber, "build-number", 0, "CI build number")
 
 	initCmd.MarkFlagRequired("version")
@@ -58,13 +63,19 @@ func runInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Fill git metadata not given as flags from the working directory
+	git := GitMetadata{SHA: initGitSHA, Branch: initGitBranch, Committer: initGitCommitter}
+	if !git.complete() {
+		git = mergeGitMetadata(git, detectGitMetadata(""))
+	}
+
 	// Set defaults for required fields if not provided
-	gitSHA := initGitSHA
+	gitSHA := git.SHA
 	if gitSHA == "" {
 		gitSHA = "unknown"
 	}
 
-	gitBranch := initGitBranch
+	gitBranch := git.Branch
 	if gitBranch == "" {
 		gitBranch = "unknown"
 	}
@@ -73,7 +84,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 	metadata := client.VersionMetadata{
 		GitSHA:       gitSHA,
 		GitBranch:    gitBranch,
-		GitCommitter: initGitCommitter,
+		GitCommitter: git.Committer,
 		Timestamp:    time.Now().UTC().Format("2006-01-02T15:04:05Z07:00"),
 	}
 
@@ -107,10 +118,15 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	// Save version info for later commands
 	versionFile := filepath.Join(forgeDir, "version-info")
-	versionInfo := map[string]string{
-		"app":     appName,
-		"appId":   appID,
-		"version": initVersion,
+	versionInfo := VersionInfo{
+		App:     appName,
+		AppID:   appID,
+		Version: initVersion,
+		GitMetadata: GitMetadata{
+			SHA:       gitSHA,
+			Branch:    gitBranch,
+			Committer: git.Committer,
+		},
 	}
 	versionJSON, _ := json.Marshal(versionInfo)
 	if err := os.WriteFile(versionFile, versionJSON, 0644); err != nil {
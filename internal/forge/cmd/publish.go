@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/sorenmh/deploysmith/internal/forge/client"
 	"github.com/spf13/cobra"
@@ -12,6 +14,7 @@ var (
 	publishApp        string
 	publishVersion    string
 	publishNoValidate bool
+	publishDryRun     bool
 )
 
 var publishCmd = &cobra.Command{
@@ -22,10 +25,15 @@ var publishCmd = &cobra.Command{
 This moves the manifests from draft to published state and triggers
 any matching auto-deploy policies.
 
+With --dry-run, smithd validates the draft and reports errors and
+warnings without publishing it. The command exits non-zero if the
+draft has errors, so CI can gate on it before the real publish.
+
 Examples:
   forge publish                                      # Uses app and version from init
   forge publish --version v1.0.0                    # Uses app from binding or init
-  forge publish --app my-app --version v1.0.0       # Explicit app and version`,
+  forge publish --app my-app --version v1.0.0       # Explicit app and version
+  forge publish --dry-run                            # Validate only`,
 	RunE: runPublish,
 }
 
@@ -35,6 +43,7 @@ func init() {
 	publishCmd.Flags().StringVar(&publishApp, "app", "", "Application name (optional if app is bound)")
 	publishCmd.Flags().StringVar(&publishVersion, "version", "", "Version identifier (optional if init was run)")
 	publishCmd.Flags().BoolVar(&publishNoValidate, "no-validate", false, "Skip manifest validation")
+	publishCmd.Flags().BoolVar(&publishDryRun, "dry-run", false, "Validate the draft without publishing it")
 }
 
 func runPublish(cmd *cobra.Command, args []string) error {
@@ -49,11 +58,22 @@ func runPublish(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+
+	if publishDryRun {
+		fmt.Printf("Validating version %s for app %s (ID: %s)...\n", version, appName, appID)
+		return validateDraft(c, appID, version)
+	}
+
 	fmt.Printf("Publishing version %s for app %s (ID: %s)...\n", version, appName, appID)
 
 	// Call smithd API
-	c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
 	resp, err := c.PublishVersion(appID, version, publishNoValidate)
+	var validationErr *client.ValidationError
+	if errors.As(err, &validationErr) {
+		printIssues("✗", validationErr.Issues)
+		return fmt.Errorf("version %s has %d validation error(s)", version, len(validationErr.Issues))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to publish version: %w", err)
 	}
@@ -61,9 +81,14 @@ func runPublish(cmd *cobra.Command, args []string) error {
 	fmt.Println("  ✓ Version published")
 
 	// Show auto-deployment status
-	if len(resp.AutoDeployments) > 0 {
-		for _, env := range resp.AutoDeployments {
-			fmt.Printf("  ✓ Auto-deployment triggered for %s\n", env)
+	for _, d := range resp.AutoDeployments {
+		switch d.Status {
+		case "failed":
+			fmt.Printf("  ✗ Auto-deployment to %s failed (deployment %s)\n", d.Environment, d.DeploymentID)
+		case "pending_approval":
+			fmt.Printf("  ✓ Auto-deployment to %s is waiting for approval (deployment %s)\n", d.Environment, d.DeploymentID)
+		default:
+			fmt.Printf("  ✓ Auto-deployment triggered for %s (deployment %s)\n", d.Environment, d.DeploymentID)
 		}
 	}
 
@@ -77,3 +102,39 @@ func runPublish(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// validateDraft asks smithd to validate a draft, prints the result and
+// returns an error if the draft would fail to publish
+func validateDraft(c *client.Client, appID, version string) error {
+	resp, err := c.ValidateVersion(appID, version)
+	if err != nil {
+		return fmt.Errorf("failed to validate version: %w", err)
+	}
+
+	printIssues("!", resp.Warnings)
+	printIssues("✗", resp.Errors)
+
+	if !resp.Valid {
+		return fmt.Errorf("version %s has %d validation error(s)", version, len(resp.Errors))
+	}
+
+	fmt.Printf("  ✓ %d manifest(s) valid\n", len(resp.ManifestFiles))
+	if len(resp.AssetFiles) > 0 {
+		fmt.Printf("  ✓ %d asset file(s) bundled\n", len(resp.AssetFiles))
+	}
+	fmt.Printf("\nVersion %s is ready to publish\n", version)
+
+	return nil
+}
+
+// printIssues prints validation issues as a list, adding the line smithd
+// reported when the message doesn't already include it
+func printIssues(marker string, issues []client.ValidationIssue) {
+	for _, issue := range issues {
+		message := issue.Message
+		if issue.Line > 0 && !strings.Contains(message, fmt.Sprintf("line %d", issue.Line)) {
+			message = fmt.Sprintf("%s (line %d)", message, issue.Line)
+		}
+		fmt.Printf("  %s %s\n", marker, message)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/forge/client"
+)
+
+// newFakeValidateServer serves a fixed dry-run publish result
+func newFakeValidateServer(t *testing.T, result client.ValidateVersionResponse) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/apps/app-123/versions/v1.0.0/publish" || r.URL.Query().Get("dryRun") != "true" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(server.Close)
+
+	return client.NewClient(server.URL, "test-key")
+}
+
+func TestValidateDraft_Valid(t *testing.T) {
+	c := newFakeValidateServer(t, client.ValidateVersionResponse{
+		VersionID:     "v1.0.0",
+		Valid:         true,
+		ManifestFiles: []string{"deployment.yaml"},
+		AssetFiles:    []string{"app.properties"},
+	})
+
+	if err := validateDraft(c, "app-123", "v1.0.0"); err != nil {
+		t.Errorf("expected valid draft to pass, got %v", err)
+	}
+}
+
+func TestValidateDraft_Errors(t *testing.T) {
+	c := newFakeValidateServer(t, client.ValidateVersionResponse{
+		VersionID: "v1.0.0",
+		Valid:     false,
+		Errors: []client.ValidationIssue{
+			{File: "service.yaml", Message: "Invalid YAML in service.yaml: yaml: line 1: did not find expected ',' or ']'"},
+		},
+	})
+
+	err := validateDraft(c, "app-123", "v1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "1 validation error") {
+		t.Errorf("expected validation error, got %v", err)
+	}
+}
+
+func TestPublishVersion_ValidationDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":"validation_failed","message":"Invalid manifest deployment.yaml: document 1: kind is required","details":[` +
+			`{"file":"deployment.yaml","line":1,"message":"Invalid manifest deployment.yaml: document 1: kind is required"},` +
+			`{"file":"service.yaml","line":4,"message":"Invalid YAML in service.yaml: yaml: line 4: mapping values are not allowed in this context"}]}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := client.NewClient(server.URL, "test-key").PublishVersion("app-123", "v1.0.0", false)
+	var validationErr *client.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Issues) != 2 || validationErr.Issues[1].File != "service.yaml" || validationErr.Issues[1].Line != 4 {
+		t.Errorf("expected both issues with their lines, got %+v", validationErr.Issues)
+	}
+}
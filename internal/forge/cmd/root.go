@@ -15,10 +15,15 @@ Configuration:
   Environment variables:
     SMITHD_URL          - smithd API endpoint (required)
     SMITHD_API_KEY      - smithd API authentication key (required)
+    SMITHD_CONTEXT      - config file context to use
 
   Config file (~/.deploysmith/config.yaml):
     url: https://smithd.example.com
     apiKey: sk_live_abc123
+    contexts:
+      staging:
+        url: https://smithd.staging.example.com
+        apiKey: sk_live_def456
 
   CLI flags override environment variables and config file.
 
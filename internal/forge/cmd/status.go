@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sorenmh/deploysmith/internal/forge/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusVersion string
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a version is drafted or published",
+	Long: `Show the state of a version in smithd: its status, manifest files and the
+environments it is deployed to.
+
+Drafts are validated the same way as 'forge publish --dry-run'. The command
+exits non-zero if a draft would fail to publish, so CI can confirm an upload
+before publishing.
+
+Examples:
+  forge status                    # Uses app and version from init
+  forge status --version v1.0.0   # Uses app from binding or init`,
+	RunE: runStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVar(&statusVersion, "version", "", "Version identifier (optional if init was run)")
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	// Validate required config
+	if err := ValidateConfig(); err != nil {
+		return err
+	}
+
+	// Resolve app ID and version from flags or files
+	appID, appName, version, err := ResolveVersion(statusVersion)
+	if err != nil {
+		return err
+	}
+
+	c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+	return printVersionStatus(c, appID, appName, version)
+}
+
+// printVersionStatus prints a version's state, validating it if it is still
+// a draft. It returns an error if the draft would fail to publish.
+func printVersionStatus(c *client.Client, appID, appName, version string) error {
+	v, err := c.GetVersion(appID, version)
+	if err != nil {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+
+	fmt.Printf("Version %s of %s (ID: %s)\n\n", v.VersionID, appName, appID)
+	fmt.Printf("  Status: %s\n", v.Status)
+	if v.Metadata.GitSHA != "" {
+		fmt.Printf("  Commit: %s (%s)\n", v.Metadata.GitSHA, v.Metadata.GitBranch)
+	}
+
+	if v.Status == "draft" {
+		fmt.Println()
+		return validateDraft(c, appID, version)
+	}
+
+	if len(v.ManifestFiles) > 0 {
+		fmt.Println("  Manifests:")
+		for _, file := range v.ManifestFiles {
+			fmt.Printf("    - %s\n", file)
+		}
+	}
+
+	if len(v.DeployedTo) > 0 {
+		fmt.Printf("  Deployed to: %s\n", strings.Join(v.DeployedTo, ", "))
+	} else {
+		fmt.Println("  Deployed to: (none)")
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/forge/client"
+)
+
+// newFakeStatusServer serves one version of app-123 and a dry-run publish
+// result for it
+func newFakeStatusServer(t *testing.T, version client.Version, result client.ValidateVersionResponse) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/apps/app-123/versions/v1.0.0":
+			json.NewEncoder(w).Encode(version)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/apps/app-123/versions/v1.0.0/publish" && r.URL.Query().Get("dryRun") == "true":
+			json.NewEncoder(w).Encode(result)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return client.NewClient(server.URL, "test-key")
+}
+
+func TestPrintVersionStatus_Published(t *testing.T) {
+	c := newFakeStatusServer(t, client.Version{
+		VersionID:     "v1.0.0",
+		Status:        "published",
+		ManifestFiles: []string{"deployment.yaml"},
+		DeployedTo:    []string{"staging"},
+	}, client.ValidateVersionResponse{})
+
+	if err := printVersionStatus(c, "app-123", "my-app", "v1.0.0"); err != nil {
+		t.Errorf("expected published version to succeed, got %v", err)
+	}
+}
+
+func TestPrintVersionStatus_InvalidDraft(t *testing.T) {
+	c := newFakeStatusServer(t, client.Version{VersionID: "v1.0.0", Status: "draft"}, client.ValidateVersionResponse{
+		VersionID: "v1.0.0",
+		Valid:     false,
+		Errors:    []client.ValidationIssue{{Message: "No manifest files uploaded"}},
+	})
+
+	err := printVersionStatus(c, "app-123", "my-app", "v1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "1 validation error") {
+		t.Errorf("expected invalid draft to fail, got %v", err)
+	}
+}
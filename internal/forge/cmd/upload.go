@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,12 +14,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sorenmh/deploysmith/internal/shared/manifest"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
 
 var (
-	uploadURLOverride string
+	uploadURLOverride  string
+	uploadGitSHA       string
+	uploadGitBranch    string
+	uploadGitCommitter string
+	uploadRetries      int
+	uploadExcludes     []string
+	uploadValidateK8s  bool
+	uploadDryRun       bool
+	uploadIncludes     []string
 )
 
 var uploadCmd = &cobra.Command{
@@ -31,7 +42,30 @@ You can upload a directory:
 Or specific files:
   forge upload deployment.yaml service.yaml
 
-If version.yml is not present, it will be auto-generated.`,
+Only .yaml and .yml files are bundled unless --include names more
+extensions. Included files are assets: they are not validated and are
+written to the gitops repository as they are, for example to build a
+ConfigMap from a .properties file:
+  forge upload manifests/ --include .properties --include .json
+
+Files in a directory are skipped if they match a pattern in its .forgeignore
+file (gitignore syntax) or an --exclude flag:
+  forge upload manifests/ --exclude kustomization.yaml --exclude 'tests/'
+
+If version.yml is not present, it will be auto-generated with the git
+metadata forge init recorded, falling back to the repository in the working
+directory. Use --git-sha, --git-branch and --git-committer to override it.
+
+Every file must be a Kubernetes object with apiVersion, kind and
+metadata.name. With --validate-k8s, Deployments, Services, ConfigMaps and
+other built-in kinds are also checked for misspelled fields and values of
+the wrong type. All problems are reported before anything is uploaded.
+
+With --dry-run, forge collects, validates and archives the files and prints
+what it would upload, without needing an upload URL or sending anything.
+
+The archive is sent with a Content-MD5 header and checked against the ETag
+storage returns. Network errors and 5xx responses are retried.`,
 	RunE: runUpload,
 }
 
@@ -39,6 +73,14 @@ func init() {
 	rootCmd.AddCommand(uploadCmd)
 
 	uploadCmd.Flags().StringVar(&uploadURLOverride, "upload-url", "", "Override upload URL (otherwise reads from .forge/upload-url)")
+	uploadCmd.Flags().StringArrayVar(&uploadIncludes, "include", nil, "Also bundle files with these extensions as assets, e.g. --include .properties,.json (repeatable)")
+	uploadCmd.Flags().StringArrayVar(&uploadExcludes, "exclude", nil, "Skip files matching a gitignore-style pattern when uploading a directory (repeatable)")
+	uploadCmd.Flags().BoolVar(&uploadValidateK8s, "validate-k8s", false, "Also check built-in Kubernetes kinds for unknown fields and wrong types")
+	uploadCmd.Flags().BoolVar(&uploadDryRun, "dry-run", false, "Collect, validate and archive the files without uploading them")
+	uploadCmd.Flags().IntVar(&uploadRetries, "retries", 3, "Times to retry the upload after a network error or 5xx response")
+	uploadCmd.Flags().StringVar(&uploadGitSHA, "git-sha", "", "Git commit SHA for the generated version.yml")
+	uploadCmd.Flags().StringVar(&uploadGitBranch, "git-branch", "", "Git branch name for the generated version.yml")
+	uploadCmd.Flags().StringVar(&uploadGitCommitter, "git-committer", "", "Git committer email for the generated version.yml")
 }
 
 func runUpload(cmd *cobra.Command, args []string) error {
@@ -46,9 +88,9 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no files or directory specified")
 	}
 
-	// Get upload URL
+	// Get upload URL, which a dry run doesn't need
 	uploadURL := uploadURLOverride
-	if uploadURL == "" {
+	if uploadURL == "" && !uploadDryRun {
 		data, err := os.ReadFile(".forge/upload-url")
 		if err != nil {
 			return fmt.Errorf("failed to read upload URL from .forge/upload-url: %w\nDid you run 'forge init' first?", err)
@@ -56,6 +98,8 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		uploadURL = strings.TrimSpace(string(data))
 	}
 
+	includes := normalizeExtensions(uploadIncludes)
+
 	// Collect files to upload
 	files := []string{}
 	for _, arg := range args {
@@ -65,12 +109,34 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		}
 
 		if info.IsDir() {
-			// Walk directory and find all YAML files
-			err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			ignore, err := loadIgnoreList(arg, uploadExcludes)
+			if err != nil {
+				return err
+			}
+
+			// Walk directory and find all YAML and included files not ignored
+			err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return err
 				}
-				if !info.IsDir() && (strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) {
+
+				rel, err := filepath.Rel(arg, path)
+				if err != nil || rel == "." {
+					return err
+				}
+				bundled := isBundledFile(path, includes)
+				if ignore.ignored(filepath.ToSlash(rel), info.IsDir()) {
+					if info.IsDir() {
+						fmt.Printf("  - skipped %s/ (excluded)\n", path)
+						return filepath.SkipDir
+					}
+					if bundled {
+						fmt.Printf("  - skipped %s (excluded)\n", path)
+					}
+					return nil
+				}
+
+				if !info.IsDir() && bundled {
 					files = append(files, path)
 				}
 				return nil
@@ -79,14 +145,29 @@ func runUpload(cmd *cobra.Command, args []string) error {
 				return fmt.Errorf("failed to walk directory %s: %w", arg, err)
 			}
 		} else {
+			if !isBundledFile(arg, includes) {
+				return fmt.Errorf("%s is not a YAML file (use --include %s to bundle it as an asset)", arg, filepath.Ext(arg))
+			}
 			files = append(files, arg)
 		}
 	}
 
-	if len(files) == 0 {
+	manifestCount := 0
+	for _, f := range files {
+		if isYAMLFile(f) {
+			manifestCount++
+		}
+	}
+	if manifestCount == 0 {
 		return fmt.Errorf("no YAML files found")
 	}
 
+	// Files are archived by name, so two with the same name would overwrite
+	// each other
+	if err := checkUniqueNames(files); err != nil {
+		return err
+	}
+
 	// Check if version.yml exists in files
 	hasVersionYML := false
 	for _, f := range files {
@@ -100,114 +181,272 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	var versionYMLContent []byte
 	if !hasVersionYML {
 		versionInfo, err := LoadVersionInfo()
-		if err != nil {
+		switch {
+		case err != nil && uploadDryRun:
+			// Let dry runs lint manifests before forge init
+			fmt.Printf("  ! version.yml not generated: %v\n", err)
+		case err != nil:
 			return fmt.Errorf("failed to load version info: %w", err)
-		}
-
-		versionData := map[string]interface{}{
-			"version": versionInfo.Version,
-			"metadata": map[string]interface{}{
-				"timestamp": time.Now().Format(time.RFC3339),
-			},
-		}
-
-		versionYMLContent, err = yaml.Marshal(versionData)
-		if err != nil {
-			return fmt.Errorf("failed to generate version.yml: %w", err)
+		default:
+			versionYMLContent, err = generateVersionYML(versionInfo, GitMetadata{
+				SHA:       uploadGitSHA,
+				Branch:    uploadGitBranch,
+				Committer: uploadGitCommitter,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to generate version.yml: %w", err)
+			}
 		}
 	}
 
 	fmt.Println("Creating manifest archive...")
 
-	// Validate all files are valid YAML
+	// Validate all files are valid Kubernetes manifests, reporting every
+	// problem before giving up
+	problems := 0
 	for _, file := range files {
-		if err := validateYAML(file); err != nil {
-			return fmt.Errorf("validation failed for %s: %w", file, err)
+		if !isYAMLFile(file) {
+			// Assets are bundled as they are
+			continue
+		}
+		for _, err := range validateManifest(file, uploadValidateK8s) {
+			fmt.Printf("  ✗ %v\n", err)
+			problems++
 		}
 	}
+	if problems > 0 {
+		return fmt.Errorf("validation failed: %d problem(s) found", problems)
+	}
 
-	// Create tar.gz archive
-	var buf bytes.Buffer
-	gzWriter := gzip.NewWriter(&buf)
-	tarWriter := tar.NewWriter(gzWriter)
+	// Stream the tar.gz archive to a temporary file, hashing it on the way,
+	// so memory use doesn't grow with the bundle
+	archive, err := os.CreateTemp("", "forge-manifests-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
 
-	totalSize := int64(0)
 	startTime := time.Now()
-
-	// Add all files to archive
-	for _, file := range files {
-		if err := addFileToArchive(tarWriter, file); err != nil {
-			return fmt.Errorf("failed to add %s to archive: %w", file, err)
-		}
-
-		info, err := os.Stat(file)
-		if err != nil {
-			return fmt.Errorf("failed to stat %s: %w", file, err)
-		}
-		totalSize += info.Size()
-		fmt.Printf("  ✓ %s (%.1f KB)\n", filepath.Base(file), float64(info.Size())/1024)
+	hash := md5.New()
+	totalSize, err := writeArchive(io.MultiWriter(archive, hash), files, versionYMLContent)
+	if err != nil {
+		return err
 	}
 
-	// Add auto-generated version.yml if needed
-	if !hasVersionYML && versionYMLContent != nil {
-		if err := addContentToArchive(tarWriter, "version.yml", versionYMLContent); err != nil {
-			return fmt.Errorf("failed to add version.yml to archive: %w", err)
-		}
-		totalSize += int64(len(versionYMLContent))
-		fmt.Printf("  ✓ version.yml (%.1f KB)\n", float64(len(versionYMLContent))/1024)
+	archiveInfo, err := archive.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat archive: %w", err)
 	}
+	archiveSize := archiveInfo.Size()
 
-	// Close archive
-	if err := tarWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close tar writer: %w", err)
+	fileCount := len(files)
+	if versionYMLContent != nil {
+		fileCount++
 	}
-	if err := gzWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close gzip writer: %w", err)
+
+	if uploadDryRun {
+		fmt.Printf("\nDry run: would upload %d files (%.1f KB) as archive (%.1f KB)\n", fileCount, float64(totalSize)/1024, float64(archiveSize)/1024)
+		return nil
 	}
 
 	// Upload archive
 	fmt.Println("Uploading manifest archive...")
-	if err := uploadContent(uploadURL, "manifests.tar.gz", buf.Bytes()); err != nil {
+	var sum [md5.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	if err := uploadContent(uploadURL, "manifests.tar.gz", archive, archiveSize, sum); err != nil {
 		return fmt.Errorf("failed to upload archive: %w", err)
 	}
 
 	duration := time.Since(startTime)
-	fileCount := len(files)
-	if !hasVersionYML {
-		fileCount++
-	}
-	archiveSize := len(buf.Bytes())
 
 	fmt.Printf("\nUploaded %d files (%.1f KB) as archive (%.1f KB) in %.1fs\n", fileCount, float64(totalSize)/1024, float64(archiveSize)/1024, duration.Seconds())
 	return nil
 }
 
+// generateVersionYML builds version.yml for a version. Git metadata not given
+// in overrides comes from forge init, then from the working directory.
+func generateVersionYML(versionInfo *VersionInfo, overrides GitMetadata) ([]byte, error) {
+	git := mergeGitMetadata(overrides, versionInfo.GitMetadata)
+	if !git.complete() {
+		git = mergeGitMetadata(git, detectGitMetadata(""))
+	}
+
+	metadata := map[string]interface{}{
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	if git.SHA != "" {
+		metadata["gitSha"] = git.SHA
+	}
+	if git.Branch != "" {
+		metadata["gitBranch"] = git.Branch
+	}
+	if git.Committer != "" {
+		metadata["gitCommitter"] = git.Committer
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"version":  versionInfo.Version,
+		"metadata": metadata,
+	})
+}
 
-func validateYAML(filePath string) error {
+// isYAMLFile reports whether a file is a YAML manifest
+func isYAMLFile(path string) bool {
+	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+}
+
+// isBundledFile reports whether a file is a manifest or has one of the
+// extensions included as assets
+func isBundledFile(path string, includes []string) bool {
+	if isYAMLFile(path) {
+		return true
+	}
+	for _, ext := range includes {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExtensions turns --include values such as "json" or ".json" into
+// ".json"
+func normalizeExtensions(values []string) []string {
+	var exts []string
+	for _, value := range values {
+		for _, ext := range strings.Split(value, ",") {
+			ext = strings.TrimSpace(ext)
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// checkUniqueNames fails if two files would be archived under the same name
+func checkUniqueNames(files []string) error {
+	seen := make(map[string]string, len(files))
+	for _, file := range files {
+		name := filepath.Base(file)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s would both be uploaded as %s", other, file, name)
+		}
+		seen[name] = file
+	}
+	return nil
+}
+
+// validateManifest returns the problems found in a manifest file. With
+// checkSchema, objects of known kinds are also checked against the bundled
+// Kubernetes schemas.
+func validateManifest(filePath string, checkSchema bool) []error {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return []error{err}
 	}
 
 	var content interface{}
 	if err := yaml.Unmarshal(data, &content); err != nil {
-		return fmt.Errorf("invalid YAML: %w", err)
+		return []error{fmt.Errorf("%s: invalid YAML: %w", filePath, err)}
 	}
 
-	return nil
+	// Apply the same Kubernetes object checks smithd runs on publish
+	var errs []error
+	if err := manifest.Validate(filePath, data); err != nil {
+		errs = append(errs, err)
+	}
+	if checkSchema {
+		errs = append(errs, manifest.ValidateSchema(filePath, data)...)
+	}
+	return errs
 }
 
-func addFileToArchive(tarWriter *tar.Writer, filePath string) error {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+// archiveReadAhead is how many files writeArchive reads concurrently
+const archiveReadAhead = 8
+
+// archiveFile is a file read for the archive
+type archiveFile struct {
+	data []byte
+	info os.FileInfo
+	err  error
+}
+
+// writeArchive writes files, and version.yml if given, to w as a tar.gz
+// archive in order, printing each one. Up to archiveReadAhead files are read
+// concurrently ahead of the writer. It returns the total size of the files.
+func writeArchive(w io.Writer, files []string, versionYML []byte) (int64, error) {
+	gzWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	// Start reading files in order, never holding more than archiveReadAhead
+	// that haven't been written yet
+	results := make([]chan archiveFile, len(files))
+	for i := range results {
+		results[i] = make(chan archiveFile, 1)
 	}
+	slots := make(chan struct{}, archiveReadAhead)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i, file := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, file string) {
+				data, err := os.ReadFile(file)
+				var info os.FileInfo
+				if err == nil {
+					info, err = os.Stat(file)
+				}
+				results[i] <- archiveFile{data: data, info: info, err: err}
+			}(i, file)
+		}
+	}()
 
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return err
+	totalSize := int64(0)
+	for i, file := range files {
+		f := <-results[i]
+		<-slots
+		if f.err != nil {
+			return 0, fmt.Errorf("failed to add %s to archive: %w", file, f.err)
+		}
+
+		if err := addFileToArchive(tarWriter, file, f.info, f.data); err != nil {
+			return 0, fmt.Errorf("failed to add %s to archive: %w", file, err)
+		}
+		totalSize += int64(len(f.data))
+		fmt.Printf("  ✓ %s (%.1f KB)\n", filepath.Base(file), float64(len(f.data))/1024)
+	}
+
+	// Add auto-generated version.yml if needed
+	if versionYML != nil {
+		if err := addContentToArchive(tarWriter, "version.yml", versionYML); err != nil {
+			return 0, fmt.Errorf("failed to add version.yml to archive: %w", err)
+		}
+		totalSize += int64(len(versionYML))
+		fmt.Printf("  ✓ version.yml (%.1f KB)\n", float64(len(versionYML))/1024)
+	}
+
+	// Close archive
+	if err := tarWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close gzip writer: %w", err)
 	}
 
+	return totalSize, nil
+}
+
+func addFileToArchive(tarWriter *tar.Writer, filePath string, info os.FileInfo, data []byte) error {
 	header := &tar.Header{
 		Name:    filepath.Base(filePath),
 		Mode:    int64(info.Mode()),
@@ -219,7 +458,7 @@ func addFileToArchive(tarWriter *tar.Writer, filePath string) error {
 		return err
 	}
 
-	_, err = tarWriter.Write(data)
+	_, err := tarWriter.Write(data)
 	return err
 }
 
@@ -239,12 +478,47 @@ func addContentToArchive(tarWriter *tar.Writer, filename string, content []byte)
 	return err
 }
 
-func uploadContent(presignedURL, filename string, content []byte) error {
-	// For S3 presigned URLs, send the content directly as PUT request body
-	req, err := http.NewRequest("PUT", presignedURL, bytes.NewReader(content))
+// uploadBackoff is the wait before the first upload retry, doubling after
+// each further failure
+var uploadBackoff = time.Second
+
+// uploadContent PUTs size bytes of content to a presigned URL. sum, the
+// content's MD5, is sent as Content-MD5 so S3 rejects a corrupted body, and
+// checked against the returned ETag. Network errors and 5xx responses are
+// retried from the start of content.
+func uploadContent(presignedURL, filename string, content io.ReadSeeker, size int64, sum [md5.Size]byte) error {
+	backoff := uploadBackoff
+	var err error
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(os.Stderr, "Upload failed (%v), retrying in %s...\n", err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = putContent(presignedURL, filename, content, size, sum)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// putContent makes one upload attempt, reporting whether a failure may be
+// retried
+func putContent(presignedURL, filename string, content io.ReadSeeker, size int64, sum [md5.Size]byte) (bool, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	// For S3 presigned URLs, send the content directly as PUT request body.
+	// S3 needs the length up front, so the body can't be chunked.
+	req, err := http.NewRequest("PUT", presignedURL, io.NopCloser(content))
 	if err != nil {
-		return err
+		return false, err
 	}
+	req.ContentLength = size
 
 	// Set appropriate content type based on file extension
 	contentType := "application/octet-stream"
@@ -254,18 +528,26 @@ func uploadContent(presignedURL, filename string, content []byte) error {
 		contentType = "application/gzip"
 	}
 	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return true, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+		return resp.StatusCode >= 500, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	// S3 returns the MD5 as the ETag of objects uploaded in one PUT without
+	// KMS encryption. Other ETags can't be compared.
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if len(etag) == 2*md5.Size && !strings.EqualFold(etag, hex.EncodeToString(sum[:])) {
+		return false, fmt.Errorf("checksum mismatch: uploaded %x but storage reports %s", sum, etag)
+	}
+
+	return false, nil
 }
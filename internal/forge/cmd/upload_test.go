@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFakeUploadServer accepts PUTs after failures 503 responses, checking
+// Content-MD5 and returning etag, or the body's MD5 if etag is empty
+func newFakeUploadServer(t *testing.T, failures int, etag string) (string, *int) {
+	t.Helper()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if etag == "" {
+			etag = hex.EncodeToString(sum[:])
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}))
+	t.Cleanup(server.Close)
+
+	backoff, retries := uploadBackoff, uploadRetries
+	uploadBackoff, uploadRetries = 0, 3
+	t.Cleanup(func() { uploadBackoff, uploadRetries = backoff, retries })
+	return server.URL, &calls
+}
+
+// uploadTestArchive uploads a small archive to url
+func uploadTestArchive(url string) error {
+	data := []byte("archive")
+	return uploadContent(url, "manifests.tar.gz", bytes.NewReader(data), int64(len(data)), md5.Sum(data))
+}
+
+func TestUploadContent_Retries(t *testing.T) {
+	url, calls := newFakeUploadServer(t, 2, "")
+
+	if err := uploadTestArchive(url); err != nil {
+		t.Fatalf("expected upload to succeed after retries, got %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", *calls)
+	}
+}
+
+func TestUploadContent_GivesUp(t *testing.T) {
+	url, calls := newFakeUploadServer(t, 10, "")
+
+	if err := uploadTestArchive(url); err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("expected the last 503, got %v", err)
+	}
+	if *calls != 4 {
+		t.Errorf("expected 4 attempts, got %d", *calls)
+	}
+}
+
+func TestUploadContent_ChecksumMismatch(t *testing.T) {
+	url, calls := newFakeUploadServer(t, 0, "0123456789abcdef0123456789abcdef")
+
+	if err := uploadTestArchive(url); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected a mismatch not to be retried, got %d attempts", *calls)
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "service.yaml")
+	data := "apiVersion: v1\nkind: Service\nmetadata:\n  name: my-api\nspec:\n  port: 80\n  selector:\n    app: my-api\n"
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	if errs := validateManifest(file, false); len(errs) != 0 {
+		t.Errorf("expected no problems without --validate-k8s, got %v", errs)
+	}
+
+	errs := validateManifest(file, true)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "spec.port is not a known field") {
+		t.Errorf("expected unknown field spec.port, got %v", errs)
+	}
+}
+
+func TestWriteArchive_LargeSet(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	want := map[string]int{}
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("configmap-%03d.yaml", i)
+		data := fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config-%d\ndata:\n  value: %q\n", i, strings.Repeat("x", i*40))
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		files = append(files, path)
+		want[name] = len(data)
+	}
+
+	var buf bytes.Buffer
+	totalSize, err := writeArchive(&buf, files, []byte("version: v1.0.0\n"))
+	if err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	var sum int64
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive entry: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if size, ok := want[header.Name]; ok && size != len(data) {
+			t.Errorf("%s: expected %d bytes, got %d", header.Name, size, len(data))
+		}
+		names = append(names, header.Name)
+		sum += int64(len(data))
+	}
+
+	// Files keep their order, with version.yml last
+	if len(names) != 501 || names[0] != "configmap-000.yaml" || names[499] != "configmap-499.yaml" || names[500] != "version.yml" {
+		t.Errorf("unexpected archive entries: %d, first %q, last %q", len(names), names[0], names[len(names)-1])
+	}
+	if sum != totalSize {
+		t.Errorf("expected total size %d, got %d", sum, totalSize)
+	}
+}
+
+func TestWriteArchive_MissingFile(t *testing.T) {
+	files := []string{filepath.Join(t.TempDir(), "missing.yaml")}
+	if _, err := writeArchive(io.Discard, files, nil); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+}
+
+func TestIsBundledFile(t *testing.T) {
+	includes := normalizeExtensions([]string{"properties", ".json,.conf"})
+
+	for _, name := range []string{"deployment.yaml", "svc.yml", "config/app.properties", "data.json", "nginx.conf"} {
+		if !isBundledFile(name, includes) {
+			t.Errorf("expected %s to be bundled", name)
+		}
+	}
+	for _, name := range []string{"README.md", "notes.txt", "json"} {
+		if isBundledFile(name, includes) {
+			t.Errorf("expected %s not to be bundled", name)
+		}
+	}
+}
+
+func TestCheckUniqueNames(t *testing.T) {
+	if err := checkUniqueNames([]string{"a/deployment.yaml", "a/app.properties", "b/service.yaml"}); err != nil {
+		t.Errorf("expected distinct names to pass, got %v", err)
+	}
+
+	err := checkUniqueNames([]string{"a/deployment.yaml", "b/deployment.yaml"})
+	if err == nil || !strings.Contains(err.Error(), "both be uploaded as deployment.yaml") {
+		t.Errorf("expected a name clash error, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,6 +18,7 @@ var (
 	cfgFile      string
 	smithdURL    string
 	smithdAPIKey string
+	contextName  string
 )
 
 // InitConfig initializes the shared configuration system
@@ -29,12 +31,26 @@ func AddFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ~/.deploysmith/config.yaml)")
 	cmd.PersistentFlags().StringVar(&smithdURL, "url", "", "smithd API endpoint")
 	cmd.PersistentFlags().StringVar(&smithdAPIKey, "api-key", "", "smithd API key")
+	cmd.PersistentFlags().StringVar(&contextName, "context", "", "config file context to use (default is currentContext in the config file)")
 
 	// Bind flags to viper
 	viper.BindPFlag("url", cmd.PersistentFlags().Lookup("url"))
 	viper.BindPFlag("apiKey", cmd.PersistentFlags().Lookup("api-key"))
 }
 
+// AddClientFlags adds flags controlling how requests to smithd are sent.
+// They can also be set as timeout, retries and retryUnsafe in the config
+// file.
+func AddClientFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Duration("timeout", 30*time.Second, "timeout for each request to smithd")
+	cmd.PersistentFlags().Int("retries", 3, "times to retry a request after a network error or 5xx response")
+	cmd.PersistentFlags().Bool("retry-unsafe", false, "also retry requests that are not idempotent, such as deploys")
+
+	viper.BindPFlag("timeout", cmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("retries", cmd.PersistentFlags().Lookup("retries"))
+	viper.BindPFlag("retryUnsafe", cmd.PersistentFlags().Lookup("retry-unsafe"))
+}
+
 // loadConfig loads configuration from file and environment
 func loadConfig() {
 	if cfgFile != "" {
@@ -68,24 +84,43 @@ func loadConfig() {
 	}
 }
 
-// GetSmithdURL returns the configured smithd URL
+// GetSmithdURL returns the configured smithd URL of the active context
 func GetSmithdURL() string {
 	if smithdURL != "" {
 		return smithdURL
 	}
-	return viper.GetString("url")
+	return contextValue("url", "SMITHD_URL")
 }
 
-// GetSmithdAPIKey returns the configured smithd API key
+// GetSmithdAPIKey returns the configured smithd API key of the active context
 func GetSmithdAPIKey() string {
 	if smithdAPIKey != "" {
 		return smithdAPIKey
 	}
-	return viper.GetString("apiKey")
+	return contextValue("apiKey", "SMITHD_API_KEY")
+}
+
+// GetTimeout returns the timeout for each request to smithd
+func GetTimeout() time.Duration {
+	return viper.GetDuration("timeout")
+}
+
+// GetRetries returns how many times a failed request to smithd is retried
+func GetRetries() int {
+	return viper.GetInt("retries")
+}
+
+// GetRetryUnsafe reports whether requests that are not idempotent may be
+// retried
+func GetRetryUnsafe() bool {
+	return viper.GetBool("retryUnsafe")
 }
 
 // ValidateConfig validates that required configuration is present
 func ValidateConfig() error {
+	if name := CurrentContext(); !contextExists(name) {
+		return fmt.Errorf("context %q not found in config file", name)
+	}
 	if GetSmithdURL() == "" {
 		return fmt.Errorf("smithd URL is required (set SMITHD_URL env var, --url flag, or url in config file)")
 	}
@@ -171,9 +206,16 @@ func SaveConfig(req ConfigureRequest) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Set values in viper
-	viper.Set("url", req.URL)
-	viper.Set("apiKey", req.APIKey)
+	// Set values in viper, under the active context unless it is the default
+	prefix := ""
+	if name := CurrentContext(); name != DefaultContext {
+		if err := ValidateContextName(name); err != nil {
+			return err
+		}
+		prefix = "contexts." + name + "."
+	}
+	viper.Set(prefix+"url", req.URL)
+	viper.Set(prefix+"apiKey", req.APIKey)
 
 	// Write config file
 	if err := viper.WriteConfigAs(configFile); err != nil {
@@ -182,8 +224,21 @@ func SaveConfig(req ConfigureRequest) error {
 
 	fmt.Printf("Configuration saved to %s\n", configFile)
 	fmt.Println("\nConfiguration:")
+	fmt.Printf("  Context: %s\n", CurrentContext())
 	fmt.Printf("  URL: %s\n", req.URL)
-	fmt.Printf("  API Key: %s...%s\n", req.APIKey[:8], req.APIKey[len(req.APIKey)-4:])
+	fmt.Printf("  API Key: %s\n", MaskAPIKey(req.APIKey))
 
 	return nil
+}
+
+// MaskAPIKey shows only the first 8 and last 4 characters of an API key.
+// Keys too short to mask that way are hidden entirely.
+func MaskAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 12 {
+		return "****"
+	}
+	return key[:8] + "..." + key[len(key)-4:]
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestMaskAPIKey(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"short":                "****",
+		"sk_live_abcdefgh1234": "sk_live_...1234",
+	}
+	for key, want := range tests {
+		if got := MaskAPIKey(key); got != want {
+			t.Errorf("MaskAPIKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultContext is the context stored in the flat url and apiKey keys of
+// the config file, as written before contexts existed
+const DefaultContext = "default"
+
+// Context is a named smithd instance in the config file
+type Context struct {
+	Name   string `json:"name" yaml:"name"`
+	URL    string `json:"url" yaml:"url"`
+	APIKey string `json:"-" yaml:"-"`
+}
+
+// CurrentContext returns the name of the active context: the --context flag,
+// then SMITHD_CONTEXT, then currentContext in the config file
+func CurrentContext() string {
+	if contextName != "" {
+		return contextName
+	}
+	if name := os.Getenv("SMITHD_CONTEXT"); name != "" {
+		return name
+	}
+	if name := viper.GetString("currentContext"); name != "" {
+		return name
+	}
+	return DefaultContext
+}
+
+// contextValue reads a setting of the active context. The setting's
+// environment variable overrides every context.
+func contextValue(key, envVar string) string {
+	if value := os.Getenv(envVar); value != "" {
+		return value
+	}
+	name := CurrentContext()
+	if name == DefaultContext {
+		return viper.GetString(key)
+	}
+	return viper.GetString("contexts." + name + "." + key)
+}
+
+// contextExists reports whether the named context is in the config file.
+// The default context always exists.
+func contextExists(name string) bool {
+	return name == DefaultContext || viper.IsSet("contexts."+name)
+}
+
+// ListContexts returns the contexts in the config file, sorted by name. The
+// default context is included when it has a URL.
+func ListContexts() []Context {
+	var contexts []Context
+	if url := viper.GetString("url"); url != "" {
+		contexts = append(contexts, Context{Name: DefaultContext, URL: url, APIKey: viper.GetString("apiKey")})
+	}
+	for name := range viper.GetStringMap("contexts") {
+		contexts = append(contexts, Context{
+			Name:   name,
+			URL:    viper.GetString("contexts." + name + ".url"),
+			APIKey: viper.GetString("contexts." + name + ".apiKey"),
+		})
+	}
+	sort.Slice(contexts, func(i, j int) bool { return contexts[i].Name < contexts[j].Name })
+	return contexts
+}
+
+// ValidateContextName checks a context name can be used as a config key
+func ValidateContextName(name string) error {
+	if name == "" || strings.ContainsAny(name, ". \t") {
+		return fmt.Errorf("invalid context name %q: must be non-empty without dots or spaces", name)
+	}
+	return nil
+}
+
+// UseContext makes name the current context in the config file. Only
+// currentContext is changed; the rest of the file is kept as it is.
+func UseContext(name string) error {
+	if err := ValidateContextName(name); err != nil {
+		return err
+	}
+	if !contextExists(name) {
+		return fmt.Errorf("context %q not found in config file", name)
+	}
+
+	path, err := ConfigFilePath()
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+
+	settings["currentContext"] = name
+	data, err = yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	viper.Set("currentContext", name)
+	return nil
+}
+
+// ConfigFilePath returns the config file in use: the --config flag or
+// ~/.deploysmith/config.yaml
+func ConfigFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".deploysmith", "config.yaml"), nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testContextsConfig = `url: https://smithd.example.com
+apiKey: sk_default
+contexts:
+  staging:
+    url: https://smithd.staging.example.com
+    apiKey: sk_staging
+`
+
+// useTestConfig loads contents as the config file, resetting the flags and
+// environment variables that select a context
+func useTestConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	t.Setenv("SMITHD_URL", "")
+	t.Setenv("SMITHD_API_KEY", "")
+	t.Setenv("SMITHD_CONTEXT", "")
+	viper.Reset()
+	cfgFile, smithdURL, smithdAPIKey, contextName = path, "", "", ""
+	t.Cleanup(func() {
+		viper.Reset()
+		cfgFile, contextName = "", ""
+	})
+
+	loadConfig()
+	return path
+}
+
+func TestContexts_Resolution(t *testing.T) {
+	useTestConfig(t, testContextsConfig)
+
+	// The flat keys are the default context
+	if got := GetSmithdURL(); got != "https://smithd.example.com" {
+		t.Errorf("expected default context URL, got %q", got)
+	}
+
+	t.Setenv("SMITHD_CONTEXT", "staging")
+	if got := GetSmithdURL(); got != "https://smithd.staging.example.com" {
+		t.Errorf("expected staging URL from SMITHD_CONTEXT, got %q", got)
+	}
+	if got := GetSmithdAPIKey(); got != "sk_staging" {
+		t.Errorf("expected staging API key, got %q", got)
+	}
+
+	// The flag wins over the environment
+	contextName = DefaultContext
+	if got := GetSmithdAPIKey(); got != "sk_default" {
+		t.Errorf("expected --context to override SMITHD_CONTEXT, got %q", got)
+	}
+
+	// SMITHD_URL overrides every context
+	contextName = "staging"
+	t.Setenv("SMITHD_URL", "https://override.example.com")
+	if got := GetSmithdURL(); got != "https://override.example.com" {
+		t.Errorf("expected SMITHD_URL to override the context, got %q", got)
+	}
+
+	contextName = "missing"
+	if err := ValidateConfig(); err == nil || !strings.Contains(err.Error(), `context "missing" not found`) {
+		t.Errorf("expected missing context error, got %v", err)
+	}
+}
+
+func TestListContexts(t *testing.T) {
+	useTestConfig(t, testContextsConfig)
+
+	contexts := ListContexts()
+	if len(contexts) != 2 || contexts[0].Name != DefaultContext || contexts[1].Name != "staging" {
+		t.Fatalf("expected default and staging contexts, got %+v", contexts)
+	}
+	if contexts[1].URL != "https://smithd.staging.example.com" {
+		t.Errorf("expected staging URL, got %q", contexts[1].URL)
+	}
+}
+
+func TestUseContext(t *testing.T) {
+	path := useTestConfig(t, testContextsConfig)
+
+	if err := UseContext("staging"); err != nil {
+		t.Fatalf("failed to switch context: %v", err)
+	}
+	if got := GetSmithdURL(); got != "https://smithd.staging.example.com" {
+		t.Errorf("expected staging URL after switching, got %q", got)
+	}
+
+	// Only currentContext is written; the contexts are kept
+	loadConfig()
+	if got := CurrentContext(); got != "staging" {
+		t.Errorf("expected currentContext to be saved, got %q", got)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config file: %v", err)
+	}
+	for _, want := range []string{"apiKey: sk_default", "apiKey: sk_staging"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected config file to keep %q, got:\n%s", want, data)
+		}
+	}
+
+	if err := UseContext("production"); err == nil {
+		t.Error("expected switching to an unknown context to fail")
+	}
+}
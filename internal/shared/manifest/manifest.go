@@ -0,0 +1,109 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// apiVersionPattern matches "v1" and "group/v1", "group/v1beta2", ...
+var apiVersionPattern = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?v[0-9]+((alpha|beta)[0-9]+)?$`)
+
+// Error describes a manifest that is not a valid Kubernetes object
+type Error struct {
+	File     string
+	Document int // 1-based index of the YAML document in the file
+	Line     int // 1-based line in the file, or 0 if unknown
+	Field    string
+	Message  string
+}
+
+func (e *Error) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: document %d: %s", e.File, e.Document, e.Message)
+	}
+	return fmt.Sprintf("%s: document %d: %s %s", e.File, e.Document, e.Field, e.Message)
+}
+
+// object holds the fields every Kubernetes object must have
+type object struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+}
+
+// Validate checks that every YAML document in a manifest file is a Kubernetes
+// object with apiVersion, kind and metadata.name. version.yml is not a
+// Kubernetes object and is skipped, and Kustomization files need no name.
+func Validate(filename string, data []byte) error {
+	if path.Base(filename) == "version.yml" {
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for document := 1; ; document++ {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return &Error{File: filename, Document: document, Line: ErrorLine(err), Message: fmt.Sprintf("invalid YAML: %v", err)}
+		}
+
+		// Skip empty documents, such as a trailing "---"
+		if len(node.Content) == 0 || (node.Content[0].Kind == yaml.ScalarNode && node.Content[0].Tag == "!!null") {
+			continue
+		}
+
+		root := node.Content[0]
+		var obj object
+		if err := node.Decode(&obj); err != nil {
+			return &Error{File: filename, Document: document, Line: root.Line, Message: fmt.Sprintf("is not a Kubernetes object: %v", err)}
+		}
+
+		switch {
+		case obj.APIVersion == "":
+			return &Error{File: filename, Document: document, Line: root.Line, Field: "apiVersion", Message: "is required"}
+		case !apiVersionPattern.MatchString(obj.APIVersion):
+			return &Error{File: filename, Document: document, Line: fieldLine(root, "apiVersion"), Field: "apiVersion", Message: fmt.Sprintf("%q is not a valid API version", obj.APIVersion)}
+		case obj.Kind == "":
+			return &Error{File: filename, Document: document, Line: root.Line, Field: "kind", Message: "is required"}
+		case obj.Metadata.Name == "" && obj.Kind != "Kustomization":
+			return &Error{File: filename, Document: document, Line: fieldLine(root, "metadata"), Field: "metadata.name", Message: "is required"}
+		}
+	}
+}
+
+// fieldLine returns the line of a top-level field's value, or of the
+// document if the field is missing
+func fieldLine(root *yaml.Node, key string) int {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			return root.Content[i+1].Line
+		}
+	}
+	return root.Line
+}
+
+// errorLinePattern finds the line number in yaml.v3 error messages, such as
+// "yaml: line 3: mapping values are not allowed in this context"
+var errorLinePattern = regexp.MustCompile(`\bline (\d+)\b`)
+
+// ErrorLine returns the line a YAML parse error refers to, or 0 if the error
+// has none
+func ErrorLine(err error) int {
+	match := errorLinePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line
+}
@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		data      string
+		wantField string
+		wantErr   bool
+	}{
+		{
+			name:     "valid object",
+			filename: "deployment.yaml",
+			data:     "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-api\n",
+		},
+		{
+			name:     "multiple documents",
+			filename: "all.yaml",
+			data:     "apiVersion: v1\nkind: Service\nmetadata:\n  name: my-api\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-config\n---\n",
+		},
+		{
+			name:     "kustomization without name",
+			filename: "kustomization.yaml",
+			data:     "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n  - deployment.yaml\n",
+		},
+		{
+			name:     "version.yml is skipped",
+			filename: "version.yml",
+			data:     "version: v1.0.0\n",
+		},
+		{
+			name:      "missing kind",
+			filename:  "deployment.yaml",
+			data:      "apiVersion: apps/v1\nmetadata:\n  name: my-api\n",
+			wantField: "kind",
+			wantErr:   true,
+		},
+		{
+			name:      "missing apiVersion",
+			filename:  "deployment.yaml",
+			data:      "kind: Deployment\nmetadata:\n  name: my-api\n",
+			wantField: "apiVersion",
+			wantErr:   true,
+		},
+		{
+			name:      "typo in apiVersion",
+			filename:  "deployment.yaml",
+			data:      "apiVersion: apps/vl\nkind: Deployment\nmetadata:\n  name: my-api\n",
+			wantField: "apiVersion",
+			wantErr:   true,
+		},
+		{
+			name:      "missing name in second document",
+			filename:  "all.yaml",
+			data:      "apiVersion: v1\nkind: Service\nmetadata:\n  name: my-api\n---\napiVersion: v1\nkind: ConfigMap\n",
+			wantField: "metadata.name",
+			wantErr:   true,
+		},
+		{
+			name:     "not a mapping",
+			filename: "list.yaml",
+			data:     "- a\n- b\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid YAML",
+			filename: "broken.yaml",
+			data:     "kind: [Service\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.filename, []byte(tt.data))
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var manifestErr *Error
+			if !errors.As(err, &manifestErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if manifestErr.File != tt.filename {
+				t.Errorf("expected error to name %s, got %s", tt.filename, manifestErr.File)
+			}
+			if manifestErr.Field != tt.wantField {
+				t.Errorf("expected field %q, got %q (%v)", tt.wantField, manifestErr.Field, err)
+			}
+		})
+	}
+
+	err := Validate("all.yaml", []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: my-api\n---\napiVersion: v1\nkind: ConfigMap\n"))
+	if err == nil || err.Error() != "all.yaml: document 2: metadata.name is required" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestValidate_Line(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"invalid YAML", "apiVersion: v1\nkind: Service\nmetadata:\n  name: a: b\n", 4},
+		{"bad apiVersion", "kind: Deployment\napiVersion: apps/vl\nmetadata:\n  name: my-api\n", 2},
+		{"missing name in second document", "apiVersion: v1\nkind: Service\nmetadata:\n  name: my-api\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  labels: {}\n", 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var merr *Error
+			if err := Validate("deployment.yaml", []byte(tt.data)); !errors.As(err, &merr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if merr.Line != tt.want {
+				t.Errorf("expected line %d, got %d (%v)", tt.want, merr.Line, merr)
+			}
+		})
+	}
+}
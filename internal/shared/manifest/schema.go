@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemasJSON is a subset of the Kubernetes OpenAPI definitions for common
+// built-in kinds, cut down to field names and types. Objects without
+// properties accept any fields, so only the parts listed are checked.
+//
+//go:embed schemas.json
+var schemasJSON []byte
+
+// schema is the part of an OpenAPI schema used to check manifests
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+}
+
+// schemaSet maps "apiVersion/kind" to the definition describing it
+type schemaSet struct {
+	Kinds       map[string]string  `json:"kinds"`
+	Definitions map[string]*schema `json:"definitions"`
+}
+
+var schemas = func() schemaSet {
+	var set schemaSet
+	if err := json.Unmarshal(schemasJSON, &set); err != nil {
+		panic(fmt.Sprintf("invalid bundled schemas: %v", err))
+	}
+	return set
+}()
+
+// ValidateSchema checks every document in a manifest file of a known kind
+// against the bundled schemas, returning all unknown fields and wrongly
+// typed values it finds. Documents of other kinds, such as custom
+// resources, are not checked.
+func ValidateSchema(filename string, data []byte) []error {
+	if path.Base(filename) == "version.yml" {
+		return nil
+	}
+
+	var errs []error
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for document := 1; ; document++ {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if !errors.Is(err, io.EOF) {
+				errs = append(errs, &Error{File: filename, Document: document, Line: ErrorLine(err), Message: fmt.Sprintf("invalid YAML: %v", err)})
+			}
+			return errs
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+
+		var obj object
+		if err := node.Decode(&obj); err != nil {
+			continue
+		}
+		definition, ok := schemas.Kinds[obj.APIVersion+"/"+obj.Kind]
+		if !ok {
+			continue
+		}
+
+		v := &schemaValidator{file: filename, document: document}
+		v.check(node.Content[0], schemas.Definitions[definition], "")
+		errs = append(errs, v.errs...)
+	}
+}
+
+// schemaValidator collects the problems found in one document
+type schemaValidator struct {
+	file     string
+	document int
+	errs     []error
+}
+
+func (v *schemaValidator) fail(node *yaml.Node, field, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{File: v.file, Document: v.document, Line: node.Line, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// check validates node against s, where field is the node's path in the
+// document
+func (v *schemaValidator) check(node *yaml.Node, s *schema, field string) {
+	if s.Ref != "" {
+		s = schemas.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" || s.Type == "" {
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, field, "must be an object")
+			return
+		}
+		if s.Properties == nil && s.AdditionalProperties == nil {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if key == "<<" {
+				// YAML merge keys are expanded by the parser
+				continue
+			}
+			child := joinField(field, key)
+			if prop, ok := s.Properties[key]; ok {
+				v.check(value, prop, child)
+			} else if s.AdditionalProperties != nil {
+				v.check(value, s.AdditionalProperties, child)
+			} else {
+				v.fail(node.Content[i], child, "is not a known field")
+			}
+		}
+
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			v.fail(node, field, "must be a list")
+			return
+		}
+		for i, item := range node.Content {
+			v.check(item, s.Items, fmt.Sprintf("%s[%d]", field, i))
+		}
+
+	case "string":
+		if node.Kind != yaml.ScalarNode {
+			v.fail(node, field, "must be a string")
+		}
+
+	case "integer":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.fail(node, field, "must be an integer")
+		}
+
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.fail(node, field, "must be true or false")
+		}
+	}
+}
+
+func joinField(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-api
+  labels:
+    app: my-api
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: my-api
+  template:
+    metadata:
+      labels:
+        app: my-api
+    spec:
+      containers:
+        - name: my-api
+          image: my-api:v1.0.0
+          ports:
+            - containerPort: 8080
+          resources:
+            limits:
+              cpu: 500m
+              memory: 128Mi
+          readinessProbe:
+            httpGet:
+              path: /health
+              port: 8080
+            initialDelaySeconds: 5
+`
+
+	tests := []struct {
+		name       string
+		data       string
+		wantFields []string
+	}{
+		{
+			name: "valid deployment",
+			data: deployment,
+		},
+		{
+			name:       "misspelled fields",
+			data:       strings.Replace(strings.Replace(deployment, "replicas: 2", "replica: 2", 1), "initialDelaySeconds", "initialDelaySecond", 1),
+			wantFields: []string{"spec.replica", "spec.template.spec.containers[0].readinessProbe.initialDelaySecond"},
+		},
+		{
+			name:       "wrong types",
+			data:       strings.Replace(strings.Replace(deployment, "replicas: 2", "replicas: two", 1), "containerPort: 8080", "containerPort: [8080]", 1),
+			wantFields: []string{"spec.replicas", "spec.template.spec.containers[0].ports[0].containerPort"},
+		},
+		{
+			name:       "second document",
+			data:       "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  key: value\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: b\nspec:\n  port: 80\n",
+			wantFields: []string{"spec.port"},
+		},
+		{
+			name: "custom resources are not checked",
+			data: "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\nspec:\n  anything: goes\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateSchema("manifest.yaml", []byte(tt.data))
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.wantFields), errs)
+			}
+			for i, err := range errs {
+				if field := err.(*Error).Field; field != tt.wantFields[i] {
+					t.Errorf("error %d: expected field %q, got %q (%v)", i, tt.wantFields[i], field, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemasResolve(t *testing.T) {
+	var walk func(name string, s *schema)
+	walk = func(name string, s *schema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			if _, ok := schemas.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]; !ok {
+				t.Errorf("%s: unresolved reference %s", name, s.Ref)
+			}
+		}
+		for field, prop := range s.Properties {
+			walk(name+"."+field, prop)
+		}
+		walk(name+"[*]", s.Items)
+		walk(name+".*", s.AdditionalProperties)
+	}
+
+	for name, definition := range schemas.Definitions {
+		walk(name, definition)
+	}
+	for kind, definition := range schemas.Kinds {
+		if _, ok := schemas.Definitions[definition]; !ok {
+			t.Errorf("%s: missing definition %s", kind, definition)
+		}
+	}
+}
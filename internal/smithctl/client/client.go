@@ -16,17 +16,15 @@ import (
 type Client struct {
 	baseURL string
 	apiKey  string
-	client  *http.Client
+	client  *retryingClient
 }
 
 // NewClient creates a new smithd API client
-func NewClient(baseURL, apiKey string) *Client {
+func NewClient(baseURL, apiKey string, opts Options) *Client {
 	return &Client{
 		baseURL: strings.TrimRight(baseURL, "/"),
 		apiKey:  apiKey,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client:  newRetryingClient(opts),
 	}
 }
 
@@ -35,21 +33,57 @@ func (c *Client) joinURL(path string) string {
 	return c.baseURL + "/" + strings.TrimLeft(path, "/")
 }
 
+// APIError is an error response from smithd. Code is smithd's
+// machine-readable error code, such as not_found, storage_error or
+// gitops_push_rejected, and is empty when the body wasn't a smithd error.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// newAPIError builds an APIError from a response body
+func newAPIError(status int, body []byte) *APIError {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error.Code == "" {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	return &APIError{StatusCode: status, Code: resp.Error.Code, Message: resp.Error.Message}
+}
+
 // Application represents an application
 type Application struct {
 	ID              string                       `json:"id"`
 	Name            string                       `json:"name"`
 	GitopsRepo      string                       `json:"gitopsRepo"`
 	GitopsPath      string                       `json:"gitopsPath"`
+	StorageBucket   string                       `json:"storageBucket,omitempty"`
+	StoragePrefix   string                       `json:"storagePrefix,omitempty"`
 	CreatedAt       time.Time                    `json:"createdAt"`
 	UpdatedAt       time.Time                    `json:"updatedAt"`
 	CurrentVersions map[string]CurrentDeployment `json:"currentVersions,omitempty"`
+
+	EnvironmentVariables  map[string]map[string]string `json:"environmentVariables,omitempty"`
+	ProtectedEnvironments []string                     `json:"protectedEnvironments,omitempty"`
 }
 
 // CurrentDeployment represents the current deployment in an environment
 type CurrentDeployment struct {
-	VersionID  string    `json:"versionId"`
-	DeployedAt time.Time `json:"deployedAt"`
+	VersionID    string    `json:"versionId"`
+	DeploymentID string    `json:"deploymentId"`
+	DeployedAt   time.Time `json:"deployedAt"`
 }
 
 // Version represents a version
@@ -70,12 +104,20 @@ type Version struct {
 
 // Deployment represents a deployment
 type Deployment struct {
-	ID          string    `json:"id"`
-	AppID       string    `json:"appId"`
-	VersionID   string    `json:"versionId"`
-	Environment string    `json:"environment"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID              string            `json:"id"`
+	AppID           string            `json:"appId"`
+	VersionID       string            `json:"versionId"`
+	Version         string            `json:"version,omitempty"`
+	Environment     string            `json:"environment"`
+	Status          string            `json:"status"`
+	TriggeredBy     string            `json:"triggeredBy,omitempty"`
+	GitopsCommitSHA string            `json:"gitopsCommitSha,omitempty"`
+	ErrorMessage    string            `json:"errorMessage,omitempty"`
+	StartedAt       time.Time         `json:"startedAt"`
+	CompletedAt     *time.Time        `json:"completedAt,omitempty"`
+	RolledBackFrom  string            `json:"rolledBackFrom,omitempty"`
+	Reason          string            `json:"reason,omitempty"`
+	Events          []DeploymentEvent `json:"events,omitempty"`
 }
 
 // Policy represents an auto-deployment policy
@@ -86,12 +128,16 @@ type Policy struct {
 	GitBranchPattern  string    `json:"gitBranchPattern"`
 	TargetEnvironment string    `json:"targetEnvironment"`
 	Enabled           bool      `json:"enabled"`
+	Priority          int       `json:"priority"`
 	CreatedAt         time.Time `json:"createdAt"`
 }
 
 // RegisterApplicationRequest is the request body for registering an application
 type RegisterApplicationRequest struct {
-	Name string `json:"name"`
+	Name                 string `json:"name"`
+	StorageBucket        string `json:"storageBucket,omitempty"`
+	StoragePrefix        string `json:"storagePrefix,omitempty"`
+	InterpolateManifests bool   `json:"interpolateManifests,omitempty"`
 }
 
 // RegisterApplication registers a new application
@@ -119,7 +165,7 @@ func (c *Client) RegisterApplication(req RegisterApplicationRequest) (*Applicati
 
 	if resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var app Application
@@ -167,7 +213,7 @@ func (c *Client) ListApplications(limit, offset int) (*ListApplicationsResponse,
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var listResp ListApplicationsResponse
@@ -178,45 +224,79 @@ func (c *Client) ListApplications(limit, offset int) (*ListApplicationsResponse,
 	return &listResp, nil
 }
 
+// ListEnvironmentsResponse is the response from listing environments
+type ListEnvironmentsResponse struct {
+	Environments []string `json:"environments"`
+	// Restricted is false when smithd accepts any environment
+	Restricted bool `json:"restricted"`
+}
+
+// ListEnvironments lists the environments smithd allows deploys to
+func (c *Client) ListEnvironments() (*ListEnvironmentsResponse, error) {
+	url := c.joinURL("api/v1/environments")
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var envResp ListEnvironmentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &envResp, nil
+}
+
 // GetAppIDByName resolves an app name to its app ID
 func (c *Client) GetAppIDByName(appName string) (string, error) {
-	// List all applications and find the one with matching name
-	resp, err := c.ListApplications(100, 0) // Get up to 100 apps
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s", appName))
+
+	httpReq, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to list applications: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	for _, app := range resp.Apps {
-		if app.Name == appName {
-			return app.ID, nil
-		}
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return "", fmt.Errorf("application not found: %s", appName)
-}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("application not found: %s", appName)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", newAPIError(resp.StatusCode, body)
+	}
 
-// resolveToAppID resolves an app name or ID to an app ID
-// If the input is already an app ID (UUID format), returns it directly
-// If the input is an app name, resolves it to the app ID
-func (c *Client) resolveToAppID(appNameOrID string) (string, error) {
-	// Simple heuristic: if it looks like a UUID (contains hyphens and is ~36 chars), treat as ID
-	if len(appNameOrID) > 30 && strings.Contains(appNameOrID, "-") {
-		return appNameOrID, nil
+	var app Application
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Otherwise, treat as name and resolve to ID
-	return c.GetAppIDByName(appNameOrID)
+	return app.ID, nil
 }
 
 // GetApplication gets an application by name or ID
 func (c *Client) GetApplication(appNameOrID string) (*Application, error) {
-	// Try to resolve name to ID if it's not already an ID
-	appID, err := c.resolveToAppID(appNameOrID)
-	if err != nil {
-		return nil, err
-	}
-
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s", appID))
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s", appNameOrID))
 
 	httpReq, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -233,7 +313,7 @@ func (c *Client) GetApplication(appNameOrID string) (*Application, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var app Application
@@ -244,6 +324,112 @@ func (c *Client) GetApplication(appNameOrID string) (*Application, error) {
 	return &app, nil
 }
 
+// DeleteApplication deletes an application and all of its versions, deployments
+// and policies. force deletes an application that is still deployed and purge
+// also removes its stored version files.
+func (c *Client) DeleteApplication(appNameOrID string, force, purge bool) error {
+	u, err := url.Parse(c.joinURL(fmt.Sprintf("api/v1/apps/%s", appNameOrID)))
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	if force {
+		q.Set("force", "true")
+	}
+	if purge {
+		q.Set("purge", "true")
+	}
+	u.RawQuery = q.Encode()
+
+	httpReq, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// SetVariablesRequest is the request body for setting an environment's placeholder values
+type SetVariablesRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// SetVariables replaces the placeholder values of one environment; an empty map removes them
+func (c *Client) SetVariables(appNameOrID, environment string, variables map[string]string) error {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/environments/%s/variables", appNameOrID, environment))
+
+	body, err := json.Marshal(SetVariablesRequest{Variables: variables})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// SetRequiresApproval turns the approval gate of one environment on or off
+func (c *Client) SetRequiresApproval(appNameOrID, environment string, requiresApproval bool) error {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/environments/%s/approval", appNameOrID, environment))
+
+	body, err := json.Marshal(map[string]bool{"requiresApproval": requiresApproval})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
 // ListVersionsResponse is the response from listing versions
 type ListVersionsResponse struct {
 	Versions   []Version `json:"versions"`
@@ -252,13 +438,7 @@ type ListVersionsResponse struct {
 
 // ListVersions lists all versions for an application
 func (c *Client) ListVersions(appNameOrID, status string, limit, offset int) (*ListVersionsResponse, error) {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
-	if err != nil {
-		return nil, err
-	}
-
-	u, err := url.Parse(c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions", appID)))
+	u, err := url.Parse(c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions", appNameOrID)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse URL: %w", err)
 	}
@@ -290,7 +470,7 @@ func (c *Client) ListVersions(appNameOrID, status string, limit, offset int) (*L
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var listResp ListVersionsResponse
@@ -303,13 +483,7 @@ func (c *Client) ListVersions(appNameOrID, status string, limit, offset int) (*L
 
 // GetVersion gets a specific version
 func (c *Client) GetVersion(appNameOrID, versionID string) (*Version, error) {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
-	if err != nil {
-		return nil, err
-	}
-
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s", appID, versionID))
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s", appNameOrID, versionID))
 
 	httpReq, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -326,7 +500,7 @@ func (c *Client) GetVersion(appNameOrID, versionID string) (*Version, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var version Version
@@ -337,9 +511,94 @@ func (c *Client) GetVersion(appNameOrID, versionID string) (*Version, error) {
 	return &version, nil
 }
 
+// DeleteVersion deletes a version that is not deployed to any environment
+func (c *Client) DeleteVersion(appNameOrID, versionID string) error {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s", appNameOrID, versionID))
+
+	httpReq, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// GetManifest reads a single stored file of a published version
+func (c *Client) GetManifest(appNameOrID, versionID, filename string) ([]byte, error) {
+	reqURL := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/manifests/%s", appNameOrID, versionID, url.PathEscape(filename)))
+
+	httpReq, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// GetManifestArchive downloads every stored file of a published version as
+// a tar.gz archive
+func (c *Client) GetManifestArchive(appNameOrID, versionID string) ([]byte, error) {
+	reqURL := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/manifests?all=true", appNameOrID, versionID))
+
+	httpReq, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	return body, nil
+}
+
 // DeployVersionRequest is the request body for deploying a version
 type DeployVersionRequest struct {
-	Environment string `json:"environment"`
+	Environment  string   `json:"environment,omitempty"`
+	Environments []string `json:"environments,omitempty"`
 }
 
 // DeployVersionResponse is the response from deploying a version
@@ -350,20 +609,63 @@ type DeployVersionResponse struct {
 	Status          string    `json:"status"`
 	GitopsCommitSHA string    `json:"gitopsCommitSha,omitempty"`
 	StartedAt       time.Time `json:"startedAt"`
+	// Error is why the deployment failed to start, for a failed environment
+	// of a multi-environment deploy
+	Error string `json:"error,omitempty"`
 }
 
 // DeployVersion deploys a version to an environment
 func (c *Client) DeployVersion(appNameOrID, versionID, environment string) (*DeployVersionResponse, error) {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/deploy", appNameOrID, versionID))
+
+	req := DeployVersionRequest{
+		Environment: environment,
+	}
+
+	body, err := json.Marshal(req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/deploy", appID, versionID))
+	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var deployResp DeployVersionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &deployResp, nil
+}
+
+// DeployVersionsResponse is the response from deploying a version to several environments
+type DeployVersionsResponse struct {
+	Deployments []DeployVersionResponse `json:"deployments"`
+}
+
+// DeployVersionToEnvironments deploys a version to several environments, with
+// one deployment per environment
+func (c *Client) DeployVersionToEnvironments(appNameOrID, versionID string, environments []string) (*DeployVersionsResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/deploy", appNameOrID, versionID))
 
 	req := DeployVersionRequest{
-		Environment: environment,
+		Environments: environments,
 	}
 
 	body, err := json.Marshal(req)
@@ -387,7 +689,269 @@ func (c *Client) DeployVersion(appNameOrID, versionID, environment string) (*Dep
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var deployResp DeployVersionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &deployResp, nil
+}
+
+// DeployPreview is the result of a dry-run deploy to one environment
+type DeployPreview struct {
+	VersionID     string `json:"versionId"`
+	Environment   string `json:"environment"`
+	CommitMessage string `json:"commitMessage"`
+	Diff          string `json:"diff"`
+}
+
+// PreviewDeploy shows what deploying a version to each environment would
+// change in the gitops repo, without deploying
+func (c *Client) PreviewDeploy(appNameOrID, versionID string, environments []string) ([]DeployPreview, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/versions/%s/deploy?dryRun=true", appNameOrID, versionID))
+
+	req := DeployVersionRequest{Environments: environments}
+	if len(environments) == 1 {
+		req = DeployVersionRequest{Environment: environments[0]}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	// A single environment returns one preview, several return a list
+	if len(environments) == 1 {
+		var preview DeployPreview
+		if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return []DeployPreview{preview}, nil
+	}
+
+	var previews struct {
+		Previews []DeployPreview `json:"previews"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&previews); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return previews.Previews, nil
+}
+
+// Rollback redeploys the version that was deployed to an environment before
+// the current one, recording why if reason is set
+func (c *Client) Rollback(appNameOrID, environment, reason string) (*DeployVersionResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/rollback", appNameOrID))
+
+	req := map[string]string{"environment": environment}
+	if reason != "" {
+		req["reason"] = reason
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var deployResp DeployVersionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &deployResp, nil
+}
+
+// ListDeploymentsResponse is the response from listing deployments
+type ListDeploymentsResponse struct {
+	Deployments []Deployment `json:"deployments"`
+	Total       int          `json:"total"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+}
+
+// ListDeployments lists deployments for an application, optionally filtered by
+// environment and status
+func (c *Client) ListDeployments(appNameOrID, environment, status string, limit, offset int) (*ListDeploymentsResponse, error) {
+	u, err := url.Parse(c.joinURL(fmt.Sprintf("api/v1/apps/%s/deployments", appNameOrID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	if environment != "" {
+		q.Set("environment", environment)
+	}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	u.RawQuery = q.Encode()
+
+	httpReq, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var listResp ListDeploymentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &listResp, nil
+}
+
+// GetDeployment gets a deployment by ID
+func (c *Client) GetDeployment(appNameOrID, deploymentID string) (*Deployment, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/deployments/%s", appNameOrID, deploymentID))
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var deployment Deployment
+	if err := json.NewDecoder(resp.Body).Decode(&deployment); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &deployment, nil
+}
+
+// DeploymentEvent is a stage a deployment went through
+type DeploymentEvent struct {
+	ID           int64     `json:"id"`
+	DeploymentID string    `json:"deploymentId"`
+	Stage        string    `json:"stage"`
+	Message      string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ListDeploymentEventsResponse is the response for listing a deployment's events
+type ListDeploymentEventsResponse struct {
+	Events []DeploymentEvent `json:"events"`
+}
+
+// ListDeploymentEvents gets the timeline of a deployment, oldest first
+func (c *Client) ListDeploymentEvents(appNameOrID, deploymentID string) (*ListDeploymentEventsResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/deployments/%s/events", appNameOrID, deploymentID))
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var eventsResp ListDeploymentEventsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&eventsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &eventsResp, nil
+}
+
+// ApproveDeployment approves a deployment held for approval and queues it
+func (c *Client) ApproveDeployment(appNameOrID, deploymentID string) (*DeployVersionResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/deployments/%s/approve", appNameOrID, deploymentID))
+
+	httpReq, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var deployResp DeployVersionResponse
@@ -404,24 +968,64 @@ type CreatePolicyRequest struct {
 	GitBranchPattern  string `json:"gitBranchPattern"`
 	TargetEnvironment string `json:"targetEnvironment"`
 	Enabled           *bool  `json:"enabled,omitempty"`
+	Priority          int    `json:"priority,omitempty"`
 }
 
 // CreatePolicy creates a new auto-deployment policy
 func (c *Client) CreatePolicy(appNameOrID string, req CreatePolicyRequest) (*Policy, error) {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies", appNameOrID))
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies", appID))
+	var policy Policy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// UpdatePolicyRequest is the request body for updating a policy; nil fields are left unchanged
+type UpdatePolicyRequest struct {
+	Name              *string `json:"name,omitempty"`
+	GitBranchPattern  *string `json:"gitBranchPattern,omitempty"`
+	TargetEnvironment *string `json:"targetEnvironment,omitempty"`
+	Enabled           *bool   `json:"enabled,omitempty"`
+	Priority          *int    `json:"priority,omitempty"`
+}
+
+// UpdatePolicy updates an auto-deployment policy
+func (c *Client) UpdatePolicy(appNameOrID, policyID string, req UpdatePolicyRequest) (*Policy, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies/%s", appNameOrID, policyID))
 
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	httpReq, err := http.NewRequest("PATCH", url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -435,9 +1039,9 @@ func (c *Client) CreatePolicy(appNameOrID string, req CreatePolicyRequest) (*Pol
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
+	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var policy Policy
@@ -455,13 +1059,7 @@ type ListPoliciesResponse struct {
 
 // ListPolicies lists all policies for an application
 func (c *Client) ListPolicies(appNameOrID string) (*ListPoliciesResponse, error) {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
-	if err != nil {
-		return nil, err
-	}
-
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies", appID))
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies", appNameOrID))
 
 	httpReq, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -478,7 +1076,7 @@ func (c *Client) ListPolicies(appNameOrID string) (*ListPoliciesResponse, error)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var listResp ListPoliciesResponse
@@ -491,13 +1089,7 @@ func (c *Client) ListPolicies(appNameOrID string) (*ListPoliciesResponse, error)
 
 // DeletePolicy deletes a policy
 func (c *Client) DeletePolicy(appNameOrID, policyID string) error {
-	// Resolve app name to ID
-	appID, err := c.resolveToAppID(appNameOrID)
-	if err != nil {
-		return err
-	}
-
-	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies/%s", appID, policyID))
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/policies/%s", appNameOrID, policyID))
 
 	httpReq, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
@@ -514,8 +1106,60 @@ func (c *Client) DeletePolicy(appNameOrID, policyID string) error {
 
 	if resp.StatusCode != http.StatusNoContent {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return newAPIError(resp.StatusCode, body)
 	}
 
 	return nil
 }
+
+// ReconcileResponse compares an environment's directory in the gitops repo
+// with the version last deployed there
+type ReconcileResponse struct {
+	Environment    string                 `json:"environment"`
+	VersionID      string                 `json:"versionId"`
+	DeploymentID   string                 `json:"deploymentId"`
+	GitopsPath     string                 `json:"gitopsPath"`
+	InSync         bool                   `json:"inSync"`
+	ExpectedImages []string               `json:"expectedImages"`
+	ActualImages   []string               `json:"actualImages"`
+	ExtraFiles     []string               `json:"extraFiles,omitempty"`
+	Diff           string                 `json:"diff,omitempty"`
+	Repair         *DeployVersionResponse `json:"repair,omitempty"`
+}
+
+// Reconcile checks whether the gitops repo still holds the version last
+// deployed to an environment, redeploying it on drift if repair is set
+func (c *Client) Reconcile(appNameOrID, environment string, repair bool) (*ReconcileResponse, error) {
+	url := c.joinURL(fmt.Sprintf("api/v1/apps/%s/environments/%s/reconcile", appNameOrID, environment))
+
+	body, err := json.Marshal(map[string]bool{"repair": repair})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var reconcileResp ReconcileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reconcileResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &reconcileResp, nil
+}
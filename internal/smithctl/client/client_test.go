@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/broken") {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("upstream unavailable"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"code":"gitops_push_rejected","message":"Failed to preview deployment"}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", Options{})
+
+	_, err := c.GetApplication("my-api")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusInternalServerError || apiErr.Code != "gitops_push_rejected" || apiErr.Message != "Failed to preview deployment" {
+		t.Errorf("unexpected APIError %+v", apiErr)
+	}
+	if !strings.Contains(err.Error(), "gitops_push_rejected") {
+		t.Errorf("expected the code in the message, got %q", err)
+	}
+
+	// Bodies that aren't smithd errors are kept as the message
+	_, err = c.GetApplication("broken")
+	if !errors.As(err, &apiErr) || apiErr.Code != "" || apiErr.Message != "upstream unavailable" {
+		t.Errorf("expected an APIError without a code, got %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/apps/my-api/environments/production/reconcile" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Repair bool `json:"repair"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Repair {
+			t.Errorf("expected repair in the request body, got %+v (%v)", req, err)
+		}
+		w.Write([]byte(`{"environment":"production","versionId":"v2","inSync":false,"diff":"-a\n+b\n","repair":{"deploymentId":"deploy-1","status":"pending"}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", Options{})
+	resp, err := c.Reconcile("my-api", "production", true)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if resp.InSync || resp.VersionID != "v2" || resp.Repair == nil || resp.Repair.DeploymentID != "deploy-1" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout limits each request when Options.Timeout is not set
+const DefaultTimeout = 30 * time.Second
+
+// maxBackoff caps the wait between retries
+const maxBackoff = 8 * time.Second
+
+// Options configures how a Client talks to smithd
+type Options struct {
+	// Timeout limits each request attempt. Zero means DefaultTimeout.
+	Timeout time.Duration
+	// Retries is how many times a request is retried after a network
+	// error or 5xx response
+	Retries int
+	// RetryUnsafe also retries requests that are not idempotent, such as
+	// POST, which may then be applied twice
+	RetryUnsafe bool
+}
+
+// retryingClient sends requests with an http.Client, retrying failures
+// with exponential backoff
+type retryingClient struct {
+	http        *http.Client
+	retries     int
+	retryUnsafe bool
+	backoff     time.Duration
+}
+
+func newRetryingClient(opts Options) *retryingClient {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &retryingClient{
+		http:        &http.Client{Timeout: timeout},
+		retries:     opts.Retries,
+		retryUnsafe: opts.RetryUnsafe,
+		backoff:     500 * time.Millisecond,
+	}
+}
+
+// Do sends req, retrying network errors and 5xx responses when the request
+// may be retried. The last attempt's response or error is returned.
+func (c *retryingClient) Do(req *http.Request) (*http.Response, error) {
+	retries := c.retries
+	if !c.canRetry(req) {
+		retries = 0
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to rewind request body: %w", err)
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := c.http.Do(req)
+		if attempt == retries || (err == nil && resp.StatusCode < 500) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+}
+
+// canRetry reports whether req is idempotent, or retrying unsafe requests
+// is allowed. Requests with a body that can't be replayed are never retried.
+func (c *retryingClient) canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	default:
+		return c.retryUnsafe
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyServer fails the first failures requests with 503, then echoes the
+// request body
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newTestRetryingClient(opts Options) *retryingClient {
+	c := newRetryingClient(opts)
+	c.backoff = 0
+	return c
+}
+
+func TestRetryingClient_RetriesGets(t *testing.T) {
+	server, calls := flakyServer(t, 2)
+	c := newTestRetryingClient(Options{Retries: 3})
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("expected success on the third attempt, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestRetryingClient_GivesUp(t *testing.T) {
+	server, calls := flakyServer(t, 10)
+	c := newTestRetryingClient(Options{Retries: 2})
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 3 {
+		t.Errorf("expected the last 503 after 3 calls, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestRetryingClient_PostsOnlyRetriedWhenUnsafe(t *testing.T) {
+	server, calls := flakyServer(t, 1)
+	c := newTestRetryingClient(Options{Retries: 3})
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("deploy"))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("expected POST not to be retried, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+
+	// With RetryUnsafe the body is sent again on the retry
+	server, calls = flakyServer(t, 1)
+	c = newTestRetryingClient(Options{Retries: 3, RetryUnsafe: true})
+
+	req, _ = http.NewRequest("POST", server.URL, strings.NewReader("deploy"))
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "deploy" || calls.Load() != 2 {
+		t.Errorf("expected POST to be retried with its body, got %q after %d calls", body, calls.Load())
+	}
+}
+
+func TestRetryingClient_RetriesNetworkErrors(t *testing.T) {
+	server, _ := flakyServer(t, 0)
+	url := server.URL
+	server.Close()
+
+	c := newTestRetryingClient(Options{Retries: 2})
+	req, _ := http.NewRequest("GET", url, nil)
+	if _, err := c.Do(req); err == nil {
+		t.Error("expected an error from a closed server")
+	}
+}
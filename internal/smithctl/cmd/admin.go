@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer smithd",
+	Long:  `Administrative commands. These need an API key with the admin scope.`,
+}
+
+var adminReconcileCmd = &cobra.Command{
+	Use:   "reconcile [app-name-or-id]",
+	Short: "Check the gitops repo for drift",
+	Long: `Compare an environment's manifests in the gitops repo with the version smithd
+last deployed there, reporting any drift such as manual edits, files added by
+hand or pushes that never landed. Exits with code 1 if the repo has drifted.
+
+Nothing is changed unless --repair is passed, which redeploys the recorded
+version to write its manifests back and removes files it doesn't have.
+
+You can specify the app by name or ID as an argument, or omit it if you've run 'forge app-bind' in this directory.
+
+Examples:
+  smithctl admin reconcile my-api-service --env production
+  smithctl admin reconcile --env production --repair`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Get app identifier from args or flag
+		var appIdentifier string
+		if len(args) > 0 {
+			appIdentifier = args[0]
+		} else {
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		environment, _ := cmd.Flags().GetString("env")
+		if environment == "" {
+			return fmt.Errorf("--env is required")
+		}
+		repair, _ := cmd.Flags().GetBool("repair")
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		resp, err := c.Reconcile(appID, environment, repair)
+		if err != nil {
+			return err
+		}
+
+		format := output.Format(GetOutputFormat())
+		if format == output.FormatJSON || format == output.FormatYAML {
+			if err := output.Print(format, resp, nil); err != nil {
+				return err
+			}
+		} else {
+			printReconcileResponse(resp)
+		}
+
+		if !resp.InSync && resp.Repair == nil {
+			return fmt.Errorf("%s has drifted from version %s", resp.GitopsPath, resp.VersionID)
+		}
+		return nil
+	},
+}
+
+// printReconcileResponse prints a reconcile report
+func printReconcileResponse(resp *client.ReconcileResponse) {
+	fmt.Printf("Environment: %s\n\n", resp.Environment)
+	fmt.Printf("  Version:     %s\n", resp.VersionID)
+	fmt.Printf("  Deployment:  %s\n", resp.DeploymentID)
+	fmt.Printf("  Gitops Path: %s\n", resp.GitopsPath)
+	fmt.Printf("  Expected:    %s\n", formatImages(resp.ExpectedImages))
+	fmt.Printf("  In Repo:     %s\n", formatImages(resp.ActualImages))
+	if len(resp.ExtraFiles) > 0 {
+		fmt.Printf("  Extra Files: %s\n", strings.Join(resp.ExtraFiles, ", "))
+	}
+	fmt.Println()
+
+	if resp.InSync {
+		output.Success("Gitops repo matches the deployed version")
+		return
+	}
+
+	output.Warn("Gitops repo has drifted from the deployed version")
+	fmt.Println()
+	fmt.Print(resp.Diff)
+
+	if resp.Repair != nil {
+		fmt.Println()
+		output.Success(fmt.Sprintf("Redeploying version %s to %s", resp.Repair.VersionID, resp.Repair.Environment))
+		fmt.Printf("  Deployment ID: %s\n", resp.Repair.DeploymentID)
+		fmt.Printf("  Status:        %s\n", resp.Repair.Status)
+	}
+}
+
+// formatImages joins image names for display
+func formatImages(images []string) string {
+	if len(images) == 0 {
+		return "-"
+	}
+	return strings.Join(images, ", ")
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminReconcileCmd)
+
+	adminReconcileCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	adminReconcileCmd.Flags().String("env", "", "Environment to check (required)")
+	adminReconcileCmd.Flags().Bool("repair", false, "Redeploy the recorded version if the repo has drifted")
+}
@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/sorenmh/deploysmith/internal/smithctl/client"
 	"github.com/sorenmh/deploysmith/internal/smithctl/output"
@@ -11,7 +15,7 @@ import (
 var appCmd = &cobra.Command{
 	Use:   "app",
 	Short: "Manage applications",
-	Long:  `Register, list, and view applications.`,
+	Long:  `Register, list, view, and delete applications.`,
 }
 
 var appRegisterCmd = &cobra.Command{
@@ -22,9 +26,19 @@ var appRegisterCmd = &cobra.Command{
 The application name can be provided as a positional argument or via the --name flag.
 smithd will deploy manifests to the global GitOps repository configured on the server.
 
+Versions are stored in the server's global bucket by default. Use --storage-bucket
+and --storage-prefix to store this application's versions elsewhere, e.g. to apply
+per-team bucket policies or lifecycle rules. --storage-bucket needs an API key
+with the admin scope.
+
+Use --interpolate to replace placeholders such as ${GIT_SHA}, ${VERSION} and
+${ENVIRONMENT} in manifests at deploy time.
+
 Example:
   smithctl app register my-api-service
-  smithctl app register --name my-api-service`,
+  smithctl app register --name my-api-service
+  smithctl app register my-api-service --storage-bucket team-a-versions --storage-prefix team-a
+  smithctl app register my-api-service --interpolate`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate configuration
@@ -41,13 +55,20 @@ Example:
 			return fmt.Errorf("application name is required")
 		}
 
+		storageBucket, _ := cmd.Flags().GetString("storage-bucket")
+		storagePrefix, _ := cmd.Flags().GetString("storage-prefix")
+		interpolate, _ := cmd.Flags().GetBool("interpolate")
+
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// Register application
 		// Note: smithd uses a single global GitOps repo configured at the server level
 		app, err := c.RegisterApplication(client.RegisterApplicationRequest{
-			Name: name,
+			Name:                 name,
+			StorageBucket:        storageBucket,
+			StoragePrefix:        storagePrefix,
+			InterpolateManifests: interpolate,
 		})
 		if err != nil {
 			return err
@@ -58,6 +79,15 @@ Example:
 		fmt.Println()
 		fmt.Printf("  Name: %s\n", app.Name)
 		fmt.Printf("  ID:   %s\n", app.ID)
+		if app.StorageBucket != "" {
+			fmt.Printf("  Storage Bucket: %s\n", app.StorageBucket)
+		}
+		if app.StoragePrefix != "" {
+			fmt.Printf("  Storage Prefix: %s\n", app.StoragePrefix)
+		}
+		if interpolate {
+			fmt.Println("  Manifest interpolation: enabled")
+		}
 
 		return nil
 	},
@@ -74,7 +104,7 @@ var appListCmd = &cobra.Command{
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// List applications
 		resp, err := c.ListApplications(100, 0)
@@ -121,7 +151,7 @@ var appShowCmd = &cobra.Command{
 		appName := args[0]
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// Get application
 		app, err := c.GetApplication(appName)
@@ -152,6 +182,174 @@ var appShowCmd = &cobra.Command{
 			}
 		}
 
+		if len(app.ProtectedEnvironments) > 0 {
+			fmt.Printf("\nRequires approval: %s\n", strings.Join(app.ProtectedEnvironments, ", "))
+		}
+
+		if len(app.EnvironmentVariables) > 0 {
+			fmt.Println("\nVariables:")
+			environments := make([]string, 0, len(app.EnvironmentVariables))
+			for env := range app.EnvironmentVariables {
+				environments = append(environments, env)
+			}
+			sort.Strings(environments)
+			for _, env := range environments {
+				names := make([]string, 0, len(app.EnvironmentVariables[env]))
+				for name := range app.EnvironmentVariables[env] {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				fmt.Printf("  %s:\n", env)
+				for _, name := range names {
+					fmt.Printf("    %s=%s\n", name, app.EnvironmentVariables[env][name])
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+var appSetVariablesCmd = &cobra.Command{
+	Use:   "set-variables [name] [KEY=VALUE...]",
+	Short: "Set placeholder values for an environment",
+	Long: `Set the values of ${NAME} placeholders for one environment of an application.
+
+The given values replace the environment's current values; run without any
+KEY=VALUE pairs to remove them. Values are only used by applications registered
+with --interpolate.
+
+Example:
+  smithctl app set-variables my-api-service --env production REPLICAS=3 LOG_LEVEL=warn
+  smithctl app set-variables my-api-service --env staging`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		appName := args[0]
+		environment, _ := cmd.Flags().GetString("env")
+		if environment == "" {
+			return fmt.Errorf("--env is required")
+		}
+
+		variables := make(map[string]string)
+		for _, arg := range args[1:] {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid variable %q: use KEY=VALUE", arg)
+			}
+			variables[name] = value
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		if err := c.SetVariables(appName, environment, variables); err != nil {
+			return err
+		}
+
+		if len(variables) == 0 {
+			output.Success(fmt.Sprintf("Removed variables for %s", environment))
+			return nil
+		}
+		output.Success(fmt.Sprintf("Set %d variable(s) for %s", len(variables), environment))
+		return nil
+	},
+}
+
+var appRequireApprovalCmd = &cobra.Command{
+	Use:   "require-approval [name]",
+	Short: "Require approval for deployments to an environment",
+	Long: `Require approval for deployments to an environment of an application.
+
+Deployments to the environment, including auto-deploys and rollbacks, wait in
+pending_approval until someone runs 'smithctl deployment approve'. Use --off to
+remove the requirement.
+
+Example:
+  smithctl app require-approval my-api-service --env production
+  smithctl app require-approval my-api-service --env production --off`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		appName := args[0]
+		environment, _ := cmd.Flags().GetString("env")
+		if environment == "" {
+			return fmt.Errorf("--env is required")
+		}
+		off, _ := cmd.Flags().GetBool("off")
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		if err := c.SetRequiresApproval(appName, environment, !off); err != nil {
+			return err
+		}
+
+		if off {
+			output.Success(fmt.Sprintf("Deployments to %s no longer require approval", environment))
+			return nil
+		}
+		output.Success(fmt.Sprintf("Deployments to %s now require approval", environment))
+		return nil
+	},
+}
+
+var appDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete an application",
+	Long: `Delete an application along with all of its versions, deployments and policies.
+
+Applications that are still deployed are refused unless --force is used. Deleting
+an application does not remove its manifests from the GitOps repository.
+
+Example:
+  smithctl app delete my-api-service
+  smithctl app delete my-api-service --force --purge`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		appName := args[0]
+		force, _ := cmd.Flags().GetBool("force")
+		purge, _ := cmd.Flags().GetBool("purge")
+		skipConfirm, _ := cmd.Flags().GetBool("confirm")
+
+		// Show confirmation prompt unless --confirm is used
+		if !skipConfirm {
+			fmt.Printf("Are you sure you want to delete application '%s' and all of its history? (y/n): ", appName)
+
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+
+			if response != "y" && response != "yes" {
+				output.Info("Deletion cancelled")
+				return nil
+			}
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// Delete application
+		if err := c.DeleteApplication(appName, force, purge); err != nil {
+			return err
+		}
+
+		// Print success message
+		output.Success("Application deleted")
+
 		return nil
 	},
 }
@@ -161,7 +359,23 @@ func init() {
 	appCmd.AddCommand(appRegisterCmd)
 	appCmd.AddCommand(appListCmd)
 	appCmd.AddCommand(appShowCmd)
+	appCmd.AddCommand(appSetVariablesCmd)
+	appCmd.AddCommand(appRequireApprovalCmd)
+	appCmd.AddCommand(appDeleteCmd)
 
 	// Flags for app register
 	appRegisterCmd.Flags().String("name", "", "Application name")
+	appRegisterCmd.Flags().String("storage-bucket", "", "S3 bucket for this application's versions (defaults to the server bucket)")
+	appRegisterCmd.Flags().String("storage-prefix", "", "Key prefix for this application's versions in the bucket")
+	appRegisterCmd.Flags().Bool("interpolate", false, "Replace ${GIT_SHA}-style placeholders in manifests at deploy time")
+
+	// Flags for app delete
+	appSetVariablesCmd.Flags().String("env", "", "Environment to set the variables for (required)")
+
+	appRequireApprovalCmd.Flags().String("env", "", "Environment to protect (required)")
+	appRequireApprovalCmd.Flags().Bool("off", false, "Stop requiring approval")
+
+	appDeleteCmd.Flags().Bool("force", false, "Delete even if the application is still deployed")
+	appDeleteCmd.Flags().Bool("purge", false, "Also delete the application's stored version files")
+	appDeleteCmd.Flags().Bool("confirm", false, "Skip confirmation prompt")
 }
@@ -37,6 +37,31 @@ func LoadAppConfig() (*AppConfig, error) {
 	return &config, nil
 }
 
+// SaveAppConfig saves app configuration to .deploysmith/app.yaml
+func SaveAppConfig(appID, appName string) error {
+	configDir := ".deploysmith"
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create .deploysmith directory: %w", err)
+	}
+
+	config := AppConfig{
+		AppID:   appID,
+		AppName: appName,
+	}
+
+	data, err := yaml.Marshal(&config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app config: %w", err)
+	}
+
+	configFile := filepath.Join(configDir, "app.yaml")
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write app config: %w", err)
+	}
+
+	return nil
+}
+
 // VersionInfo represents the version information stored in .forge/version-info
 type VersionInfo struct {
 	App     string `json:"app"`
@@ -93,7 +118,7 @@ func ResolveAppID(appIdentifier string) (string, string, error) {
 		}
 
 		// If not found in config files, treat as app name and resolve via API
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 		appID, err := c.GetAppIDByName(appIdentifier)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to resolve app '%s': %w", appIdentifier, err)
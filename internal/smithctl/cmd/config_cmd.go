@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sorenmh/deploysmith/internal/shared/config"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+// ResolvedConfig is the configuration smithctl would use, with the API key
+// masked
+type ResolvedConfig struct {
+	ConfigFile string `json:"configFile" yaml:"configFile"`
+	Context    string `json:"context" yaml:"context"`
+	URL        string `json:"url" yaml:"url"`
+	APIKey     string `json:"apiKey" yaml:"apiKey"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect smithctl configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the active configuration",
+	Long: `Show the smithd URL, context and API key smithctl would use after applying
+flags, environment variables and the config file. The API key is masked.
+
+The configuration is shown even when it is incomplete, along with the
+problem that stops other commands from running.
+
+Examples:
+  smithctl config show
+  smithctl --context production config show
+  smithctl config show --output json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolved := ResolvedConfig{
+			Context: config.CurrentContext(),
+			URL:     GetSmithdURL(),
+			APIKey:  config.MaskAPIKey(GetSmithdAPIKey()),
+		}
+		if path, err := config.ConfigFilePath(); err == nil {
+			resolved.ConfigFile = path
+		}
+		if err := ValidateConfig(); err != nil {
+			resolved.Error = err.Error()
+		}
+
+		// Print output based on format
+		format := output.Format(GetOutputFormat())
+		return output.Print(format, resolved, func() {
+			configFile := resolved.ConfigFile
+			if _, err := os.Stat(configFile); err != nil {
+				configFile += " (not found)"
+			}
+
+			fmt.Printf("  Config file: %s\n", configFile)
+			fmt.Printf("  Context:     %s\n", resolved.Context)
+			fmt.Printf("  URL:         %s\n", valueOrNotSet(resolved.URL))
+			fmt.Printf("  API Key:     %s\n", valueOrNotSet(resolved.APIKey))
+
+			if resolved.Error != "" {
+				fmt.Println()
+				output.Warn(resolved.Error)
+			}
+		})
+	},
+}
+
+// valueOrNotSet shows empty settings as (not set)
+func valueOrNotSet(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	return value
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
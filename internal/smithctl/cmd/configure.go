@@ -3,7 +3,6 @@ package cmd
 import (
 	"github.com/sorenmh/deploysmith/internal/shared/config"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var configureCmd = &cobra.Command{
@@ -35,9 +34,9 @@ func init() {
 }
 
 func runConfigure(cmd *cobra.Command, args []string) error {
-	// Get current values from config
-	currentURL := viper.GetString("url")
-	currentAPIKey := viper.GetString("apiKey")
+	// Get current values of the active context
+	currentURL := config.GetSmithdURL()
+	currentAPIKey := config.GetSmithdAPIKey()
 
 	var req *config.ConfigureRequest
 	var err error
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sorenmh/deploysmith/internal/shared/config"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Switch between smithd instances",
+	Long: `Manage the named contexts in the config file, each with its own smithd URL
+and API key. The url and apiKey at the top of the config file are the
+"default" context.
+
+  currentContext: staging
+  url: https://smithd.example.com
+  apiKey: sk_live_abc123
+  contexts:
+    staging:
+      url: https://smithd.staging.example.com
+      apiKey: sk_live_def456
+
+Select a context for one command with --context or SMITHD_CONTEXT. Create or
+update one with 'smithctl --context <name> configure'.`,
+}
+
+var contextListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List contexts",
+	Long: `List the contexts in the config file. The current context is marked with *.
+
+Examples:
+  smithctl context list`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		contexts := config.ListContexts()
+		if len(contexts) == 0 {
+			output.Info("No contexts configured (run 'smithctl configure')")
+			return nil
+		}
+
+		current := config.CurrentContext()
+
+		// Print output based on format
+		format := output.Format(GetOutputFormat())
+		return output.Print(format, contexts, func() {
+			headers := []string{"CURRENT", "NAME", "URL"}
+			rows := make([][]string, 0, len(contexts))
+
+			for _, c := range contexts {
+				marker := ""
+				if c.Name == current {
+					marker = "*"
+				}
+				rows = append(rows, []string{marker, c.Name, c.URL})
+			}
+
+			output.PrintTable(headers, rows)
+		})
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Set the current context",
+	Long: `Set the context smithctl and forge use when --context and SMITHD_CONTEXT
+are not set.
+
+Examples:
+  smithctl context use production
+  smithctl context use default`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.UseContext(args[0]); err != nil {
+			return err
+		}
+
+		output.Success(fmt.Sprintf("Switched to context %s", args[0]))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextUseCmd)
+}
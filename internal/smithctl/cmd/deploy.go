@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sorenmh/deploysmith/internal/smithctl/client"
 	"github.com/sorenmh/deploysmith/internal/smithctl/output"
@@ -13,15 +14,27 @@ import (
 
 var deployCmd = &cobra.Command{
 	Use:   "deploy [app-name-or-id] [version-id]",
-	Short: "Deploy a version to an environment",
-	Long: `Deploy a specific version to an environment.
+	Short: "Deploy a version to one or more environments",
+	Long: `Deploy a specific version to one or more environments.
 
 You can specify the app by name or ID, or omit it if you've run 'forge app-bind' in this directory.
 
+Pass a comma-separated list to --env to deploy to several environments at once.
+Each environment gets its own deployment, so a failure in one doesn't block the others.
+
+Use --dry-run to see the commit message and the diff the deploy would make in the
+gitops repository, without deploying.
+
+Use --wait to block until each deployment succeeds or fails, exiting non-zero if
+any fails or --timeout passes first. Deployments awaiting approval are waited on too.
+
 Examples:
   smithctl deploy v1.0.0 --env staging              # Uses app from binding
   smithctl deploy my-api-service v1.0.0 --env staging
-  smithctl deploy --app my-api-service v1.0.0 --env production --confirm`,
+  smithctl deploy my-api-service v1.0.0 --env staging,canary
+  smithctl deploy --app my-api-service v1.0.0 --env production --confirm
+  smithctl deploy my-api-service v1.0.0 --env production --dry-run
+  smithctl deploy my-api-service v1.0.0 --env staging --confirm --wait --timeout 5m`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate configuration
@@ -47,20 +60,54 @@ Examples:
 			return err
 		}
 
-		environment, _ := cmd.Flags().GetString("env")
+		envFlag, _ := cmd.Flags().GetString("env")
 		skipConfirm, _ := cmd.Flags().GetBool("confirm")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 
-		if environment == "" {
+		if envFlag == "" {
 			return fmt.Errorf("--env is required")
 		}
 
+		environments, err := parseEnvironments(envFlag)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// Preview the deploy without confirming or deploying
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			previews, err := c.PreviewDeploy(appID, versionID, environments)
+			if err != nil {
+				return err
+			}
+
+			for _, preview := range previews {
+				fmt.Printf("Environment: %s\n", preview.Environment)
+				fmt.Printf("Commit:      %s\n\n", preview.CommitMessage)
+				if preview.Diff == "" {
+					fmt.Println("No changes")
+				} else {
+					fmt.Print(preview.Diff)
+				}
+				fmt.Println()
+			}
+			return nil
+		}
+
 		// Show confirmation prompt unless --confirm is used
 		if !skipConfirm {
 			fmt.Println("You are about to deploy:")
 			fmt.Println()
 			fmt.Printf("  App:         %s\n", appName)
 			fmt.Printf("  Version:     %s\n", versionID)
-			fmt.Printf("  Environment: %s\n", environment)
+			if len(environments) == 1 {
+				fmt.Printf("  Environment: %s\n", environments[0])
+			} else {
+				fmt.Printf("  Environments: %s\n", strings.Join(environments, ", "))
+			}
 			fmt.Println()
 			fmt.Println("This will update the gitops repository and Flux will apply the changes.")
 			fmt.Println()
@@ -76,25 +123,120 @@ Examples:
 			}
 		}
 
-		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		format := output.Format(GetOutputFormat())
+		structured := format == output.FormatJSON || format == output.FormatYAML
+
+		// Progress goes to stdout, so it's only printed for the table format
+		progress := func(d *client.Deployment) {
+			if !structured {
+				output.Info(fmt.Sprintf("Deployment %s is %s", d.ID, d.Status))
+			}
+		}
+
+		// Deploy to several environments at once
+		if len(environments) > 1 {
+			resp, err := c.DeployVersionToEnvironments(appID, versionID, environments)
+			if err != nil {
+				return err
+			}
+
+			if !structured {
+				output.Success("Deployments initiated")
+				for _, d := range resp.Deployments {
+					if d.Status == "failed" {
+						if d.Error != "" {
+							output.Error(fmt.Sprintf("%s: deployment %s failed to start: %s", d.Environment, d.DeploymentID, d.Error))
+						} else {
+							output.Error(fmt.Sprintf("%s: deployment %s failed to start", d.Environment, d.DeploymentID))
+						}
+						continue
+					}
+					if d.Status == "pending_approval" {
+						fmt.Printf("  %s: %s (awaiting approval)\n", d.Environment, d.DeploymentID)
+						continue
+					}
+					fmt.Printf("  %s: %s\n", d.Environment, d.DeploymentID)
+				}
+				fmt.Println()
+
+				if !wait {
+					fmt.Println("Run 'smithctl deployment status <deployment-id> --watch' to follow progress")
+					return nil
+				}
+			}
+
+			// Wait on the deployments one by one under a shared deadline
+			var failed []string
+			if wait {
+				deadline := waitDeadline(timeout)
+				for i := range resp.Deployments {
+					d := &resp.Deployments[i]
+					if d.Status == "failed" {
+						failed = append(failed, d.Environment)
+						continue
+					}
+					if err := waitForDeployResponse(c, appID, d, deadline, progress); err != nil {
+						output.Error(fmt.Sprintf("%s: %v", d.Environment, err))
+						failed = append(failed, d.Environment)
+						continue
+					}
+					if !structured {
+						output.Success(fmt.Sprintf("%s: deployment %s succeeded", d.Environment, d.DeploymentID))
+					}
+				}
+			}
+
+			if structured {
+				if err := output.Print(format, resp, nil); err != nil {
+					return err
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("deployment failed in %s", strings.Join(failed, ", "))
+			}
+
+			return nil
+		}
 
 		// Deploy version
-		resp, err := c.DeployVersion(appID, versionID, environment)
+		resp, err := c.DeployVersion(appID, versionID, environments[0])
 		if err != nil {
 			return err
 		}
 
-		// Print success message
-		output.Success("Deployment initiated")
-		fmt.Printf("  Deployment ID: %s\n", resp.DeploymentID)
-		fmt.Printf("  Version:       %s\n", resp.VersionID)
-		fmt.Printf("  Environment:   %s\n", resp.Environment)
-		if resp.GitopsCommitSHA != "" {
-			fmt.Printf("  GitOps Commit: %s\n", resp.GitopsCommitSHA)
+		if !structured {
+			// Print success message
+			output.Success("Deployment initiated")
+			printDeployResponse(resp)
+			if resp.Status == "pending_approval" {
+				fmt.Printf("%s requires approval; run 'smithctl deployment approve %s' to deploy\n", resp.Environment, resp.DeploymentID)
+				if !wait {
+					return nil
+				}
+			}
+			if !wait {
+				fmt.Printf("Run 'smithctl deployment status %s --watch' to follow progress\n", resp.DeploymentID)
+				return nil
+			}
 		}
 
-		return nil
+		if wait {
+			err = waitForDeployResponse(c, appID, resp, waitDeadline(timeout), progress)
+			if err == nil && !structured {
+				output.Success("Deployment succeeded")
+				if resp.GitopsCommitSHA != "" {
+					fmt.Printf("  GitOps Commit: %s\n", resp.GitopsCommitSHA)
+				}
+			}
+		}
+
+		if structured {
+			if printErr := output.Print(format, resp, nil); printErr != nil {
+				return printErr
+			}
+		}
+
+		return err
 	},
 }
 
@@ -104,12 +246,15 @@ var rollbackCmd = &cobra.Command{
 	Long: `Rollback to a previous version in an environment.
 
 This command shows the current version and recent versions, allowing you to select
-which version to rollback to.
+which version to rollback to. With --previous, smithd picks the version that was
+deployed before the current one, without prompting.
 
 Examples:
   smithctl rollback --env staging                   # Uses app from binding
   smithctl rollback my-api-service --env staging
-  smithctl rollback --app my-api-service --env staging`,
+  smithctl rollback --app my-api-service --env staging
+  smithctl rollback my-api-service --env staging --previous
+  smithctl rollback my-api-service --env staging --previous --reason "error rate spiked"`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate configuration
@@ -138,7 +283,32 @@ Examples:
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		reason, _ := cmd.Flags().GetString("reason")
+		previous, _ := cmd.Flags().GetBool("previous")
+		if reason != "" && !previous {
+			return fmt.Errorf("--reason requires --previous")
+		}
+
+		// Let smithd pick the previous version
+		if previous {
+			deployResp, err := c.Rollback(appID, environment, reason)
+			if err != nil {
+				return err
+			}
+
+			format := output.Format(GetOutputFormat())
+			if format == output.FormatJSON || format == output.FormatYAML {
+				return output.Print(format, deployResp, nil)
+			}
+
+			output.Success(fmt.Sprintf("Rolling back %s to version %s", environment, deployResp.VersionID))
+			fmt.Printf("  Deployment ID: %s\n", deployResp.DeploymentID)
+			fmt.Println()
+			fmt.Printf("Run 'smithctl deployment status %s --watch' to follow progress\n", deployResp.DeploymentID)
+			return nil
+		}
 
 		// Get application to find current version
 		app, err := c.GetApplication(appID)
@@ -211,14 +381,15 @@ Examples:
 			return err
 		}
 
-		output.Success("Deployment initiated")
-		fmt.Printf("  Deployment ID: %s\n", deployResp.DeploymentID)
-		fmt.Printf("  Version:       %s\n", deployResp.VersionID)
-		fmt.Printf("  Environment:   %s\n", deployResp.Environment)
-		if deployResp.GitopsCommitSHA != "" {
-			fmt.Printf("  GitOps Commit: %s\n", deployResp.GitopsCommitSHA)
+		format := output.Format(GetOutputFormat())
+		if format == output.FormatJSON || format == output.FormatYAML {
+			return output.Print(format, deployResp, nil)
 		}
 
+		output.Success("Deployment initiated")
+		printDeployResponse(deployResp)
+		fmt.Printf("Run 'smithctl deployment status %s --watch' to follow progress\n", deployResp.DeploymentID)
+
 		return nil
 	},
 }
@@ -229,10 +400,99 @@ func init() {
 
 	// Flags for deploy
 	deployCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
-	deployCmd.Flags().String("env", "", "Target environment (required)")
+	deployCmd.Flags().String("env", "", "Target environment, or a comma-separated list of environments (required)")
 	deployCmd.Flags().Bool("confirm", false, "Skip confirmation prompt")
+	deployCmd.Flags().Bool("dry-run", false, "Show the gitops changes without deploying")
+	deployCmd.Flags().Bool("wait", false, "Wait until the deployment succeeds or fails")
+	deployCmd.Flags().Duration("timeout", 10*time.Minute, "How long --wait waits before giving up (0 waits forever)")
 
 	// Flags for rollback
 	rollbackCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
 	rollbackCmd.Flags().String("env", "", "Target environment (required)")
+	rollbackCmd.Flags().Bool("previous", false, "Roll back to the previously deployed version without prompting")
+	rollbackCmd.Flags().String("reason", "", "Why the rollback is made, recorded on the deployment (requires --previous)")
+}
+
+// parseEnvironments splits a comma-separated --env value into environment names
+func parseEnvironments(value string) ([]string, error) {
+	var environments []string
+	seen := make(map[string]bool)
+	for _, environment := range strings.Split(value, ",") {
+		environment = strings.TrimSpace(environment)
+		if environment == "" {
+			return nil, fmt.Errorf("--env contains an empty environment name")
+		}
+		if seen[environment] {
+			return nil, fmt.Errorf("--env lists %s more than once", environment)
+		}
+		seen[environment] = true
+		environments = append(environments, environment)
+	}
+	return environments, nil
+}
+
+// printDeployResponse prints a started deployment in table format
+func printDeployResponse(resp *client.DeployVersionResponse) {
+	fmt.Printf("  Deployment ID: %s\n", resp.DeploymentID)
+	fmt.Printf("  Version:       %s\n", resp.VersionID)
+	fmt.Printf("  Environment:   %s\n", resp.Environment)
+	if resp.GitopsCommitSHA != "" {
+		fmt.Printf("  GitOps Commit: %s\n", resp.GitopsCommitSHA)
+	}
+	fmt.Println()
+}
+
+// waitPollInterval is how often --wait checks a deployment's status
+var waitPollInterval = 2 * time.Second
+
+// waitDeadline turns a --timeout into a deadline, with zero meaning none
+func waitDeadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// waitForDeployResponse waits for a deployment started by deploy, updating
+// resp with the status and commit it ended up with
+func waitForDeployResponse(c *client.Client, appID string, resp *client.DeployVersionResponse, deadline time.Time, onStatus func(*client.Deployment)) error {
+	deployment, err := waitForDeployment(c, appID, resp.DeploymentID, deadline, onStatus)
+	if deployment != nil {
+		resp.Status = deployment.Status
+		resp.GitopsCommitSHA = deployment.GitopsCommitSHA
+	}
+	return err
+}
+
+// waitForDeployment polls a deployment until it reaches a terminal status,
+// calling onStatus each time the status changes. It returns an error if the
+// deployment fails or is still running at the deadline.
+func waitForDeployment(c *client.Client, appID, deploymentID string, deadline time.Time, onStatus func(*client.Deployment)) (*client.Deployment, error) {
+	lastStatus := ""
+	for {
+		deployment, err := c.GetDeployment(appID, deploymentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if deployment.Status != lastStatus {
+			onStatus(deployment)
+			lastStatus = deployment.Status
+		}
+
+		switch deployment.Status {
+		case "success":
+			return deployment, nil
+		case "failed":
+			if deployment.ErrorMessage != "" {
+				return deployment, fmt.Errorf("deployment %s failed: %s", deployment.ID, deployment.ErrorMessage)
+			}
+			return deployment, fmt.Errorf("deployment %s failed", deployment.ID)
+		}
+
+		if !deadline.IsZero() && time.Now().Add(waitPollInterval).After(deadline) {
+			return deployment, fmt.Errorf("timed out waiting for deployment %s (still %s)", deployment.ID, deployment.Status)
+		}
+		time.Sleep(waitPollInterval)
+	}
 }
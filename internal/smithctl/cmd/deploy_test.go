@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+func TestParseEnvironments(t *testing.T) {
+	environments, err := parseEnvironments("staging, canary")
+	if err != nil {
+		t.Fatalf("parseEnvironments failed: %v", err)
+	}
+	if !reflect.DeepEqual(environments, []string{"staging", "canary"}) {
+		t.Errorf("expected [staging canary], got %v", environments)
+	}
+
+	for _, value := range []string{"staging,", "staging,,canary", "staging,staging"} {
+		if _, err := parseEnvironments(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestWaitForDeployment(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = 0
+
+	tests := []struct {
+		name     string
+		stages   []string
+		deadline time.Time
+		wantErr  string
+	}{
+		{name: "succeeds", stages: []string{"created", "pushing", "success"}},
+		{name: "fails", stages: []string{"created", "failed"}, wantErr: "deployment deploy-1 failed"},
+		{name: "times out", stages: []string{"created", "pushing", "success"}, deadline: time.Now().Add(-time.Second), wantErr: "timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(&fakeDeploymentServer{stages: tt.stages})
+			defer server.Close()
+
+			c := client.NewClient(server.URL, "test-key", client.Options{})
+			deployment, err := waitForDeployment(c, testPolicyAppID, "deploy-1", tt.deadline, func(*client.Deployment) {})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("waitForDeployment failed: %v", err)
+				}
+				if deployment.Status != "success" {
+					t.Errorf("expected to wait until success, got %q", deployment.Status)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWaitForDeployResponse(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = 0
+
+	server := httptest.NewServer(&fakeDeploymentServer{stages: []string{"created", "failed"}})
+	defer server.Close()
+
+	c := client.NewClient(server.URL, "test-key", client.Options{})
+	resp := &client.DeployVersionResponse{DeploymentID: "deploy-1", Environment: "staging", Status: "pending"}
+	if err := waitForDeployResponse(c, testPolicyAppID, resp, time.Time{}, func(*client.Deployment) {}); err == nil {
+		t.Fatal("expected an error for a failed deployment")
+	}
+
+	// The printed response reflects where the deployment ended up
+	if resp.Status != "failed" {
+		t.Errorf("expected status failed, got %q", resp.Status)
+	}
+}
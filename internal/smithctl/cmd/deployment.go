@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var deploymentCmd = &cobra.Command{
+	Use:   "deployment",
+	Short: "Manage deployments",
+	Long:  `View deployment history and status.`,
+}
+
+var deploymentListCmd = &cobra.Command{
+	Use:   "list [app-name-or-id]",
+	Short: "List deployments for an application",
+	Long: `List deployment history for an application, most recent first.
+
+You can specify the app by name or ID as an argument, or omit it if you've run 'forge app-bind' in this directory.
+
+Examples:
+  smithctl deployment list                          # Uses app from binding
+  smithctl deployment list my-api-service
+  smithctl deployment list my-api-service --env production --limit 10
+  smithctl deployment list my-api-service --status failed --offset 20`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Get app identifier from args or flag
+		var appIdentifier string
+		if len(args) > 0 {
+			appIdentifier = args[0]
+		} else {
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		environment, _ := cmd.Flags().GetString("env")
+		status, _ := cmd.Flags().GetString("status")
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// List deployments
+		resp, err := c.ListDeployments(appID, environment, status, limit, offset)
+		if err != nil {
+			return err
+		}
+
+		// Check if there are no deployments
+		if len(resp.Deployments) == 0 {
+			output.Info("No deployments found")
+			return nil
+		}
+
+		// Print output based on format
+		format := output.Format(GetOutputFormat())
+		return output.Print(format, resp, func() {
+			headers := []string{"ID", "VERSION", "ENVIRONMENT", "STATUS", "TRIGGERED BY", "STARTED"}
+			rows := make([][]string, 0, len(resp.Deployments))
+
+			for _, d := range resp.Deployments {
+				version := d.Version
+				if version == "" {
+					version = d.VersionID
+				}
+
+				rows = append(rows, []string{
+					d.ID,
+					version,
+					d.Environment,
+					d.Status,
+					d.TriggeredBy,
+					output.FormatTime(d.StartedAt),
+				})
+			}
+
+			output.PrintTable(headers, rows)
+		})
+	},
+}
+
+var deploymentStatusCmd = &cobra.Command{
+	Use:   "status [deployment-id]",
+	Short: "Show the status of a deployment",
+	Long: `Show the status of a deployment.
+
+Use --watch to poll until the deployment succeeds or fails.
+
+Examples:
+  smithctl deployment status deploy-456                      # Uses app from binding
+  smithctl deployment status deploy-456 --app my-api-service
+  smithctl deployment status deploy-456 --watch`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		deploymentID := args[0]
+		appIdentifier, _ := cmd.Flags().GetString("app")
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		deployment, err := c.GetDeployment(appID, deploymentID)
+		if err != nil {
+			return err
+		}
+
+		// Poll until the deployment reaches a terminal status
+		lastStatus := ""
+		for watch && !isTerminalDeploymentStatus(deployment.Status) {
+			if deployment.Status != lastStatus {
+				output.Info(fmt.Sprintf("Deployment %s is %s", deployment.ID, deployment.Status))
+				lastStatus = deployment.Status
+			}
+
+			time.Sleep(interval)
+
+			deployment, err = c.GetDeployment(appID, deploymentID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Print output based on format
+		format := output.Format(GetOutputFormat())
+		if format == output.FormatJSON || format == output.FormatYAML {
+			if err := output.Print(format, deployment, nil); err != nil {
+				return err
+			}
+		} else {
+			printDeploymentStatus(deployment)
+		}
+
+		if watch && deployment.Status == "failed" {
+			return fmt.Errorf("deployment failed")
+		}
+
+		return nil
+	},
+}
+
+var deploymentApproveCmd = &cobra.Command{
+	Use:   "approve [deployment-id]",
+	Short: "Approve a deployment to a protected environment",
+	Long: `Approve a deployment that is waiting in pending_approval, so it is pushed
+to the gitops repository.
+
+Examples:
+  smithctl deployment approve deploy-456                      # Uses app from binding
+  smithctl deployment approve deploy-456 --app my-api-service`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		deploymentID := args[0]
+		appIdentifier, _ := cmd.Flags().GetString("app")
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		resp, err := c.ApproveDeployment(appID, deploymentID)
+		if err != nil {
+			return err
+		}
+
+		// Print output based on format
+		format := output.Format(GetOutputFormat())
+		if format == output.FormatJSON || format == output.FormatYAML {
+			return output.Print(format, resp, nil)
+		}
+
+		output.Success(fmt.Sprintf("Approved deployment of %s to %s", resp.VersionID, resp.Environment))
+		fmt.Printf("  Deployment ID: %s\n", resp.DeploymentID)
+		fmt.Printf("  Status:        %s\n", resp.Status)
+		return nil
+	},
+}
+
+var deploymentEventsCmd = &cobra.Command{
+	Use:     "events [deployment-id]",
+	Aliases: []string{"logs"},
+	Short:   "Show the timeline of a deployment",
+	Long: `Show each stage a deployment went through, such as cloning the gitops
+repository or pushing, with the time it happened. A failed deployment's last
+event says why it failed.
+
+Use --follow to keep printing new events until the deployment succeeds or fails.
+
+Examples:
+  smithctl deployment events deploy-456                      # Uses app from binding
+  smithctl deployment events deploy-456 --app my-api-service
+  smithctl deployment logs deploy-456 --follow`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		deploymentID := args[0]
+		appIdentifier, _ := cmd.Flags().GetString("app")
+		follow, _ := cmd.Flags().GetBool("follow")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// Structured output is printed once all events are in; the table
+		// prints events as they arrive
+		format := output.Format(GetOutputFormat())
+		structured := format == output.FormatJSON || format == output.FormatYAML
+		printEvent := printDeploymentEvent
+		if structured {
+			printEvent = func(client.DeploymentEvent) {}
+		}
+
+		events, status, err := followDeploymentEvents(c, appID, deploymentID, follow, interval, printEvent)
+		if err != nil {
+			return err
+		}
+
+		if structured {
+			return output.Print(format, client.ListDeploymentEventsResponse{Events: events}, nil)
+		}
+		if len(events) == 0 {
+			output.Info("No events recorded for this deployment")
+		}
+		if follow && status == "failed" {
+			return fmt.Errorf("deployment failed")
+		}
+		return nil
+	},
+}
+
+// followDeploymentEvents fetches a deployment's events, calling onEvent for
+// each. With follow it keeps polling for new events until the deployment
+// reaches a terminal status, which it returns.
+func followDeploymentEvents(c *client.Client, appID, deploymentID string, follow bool, interval time.Duration, onEvent func(client.DeploymentEvent)) ([]client.DeploymentEvent, string, error) {
+	var events []client.DeploymentEvent
+	fetch := func() error {
+		resp, err := c.ListDeploymentEvents(appID, deploymentID)
+		if err != nil {
+			return err
+		}
+		// Events are append-only, so anything past what we have is new
+		for _, event := range resp.Events[min(len(events), len(resp.Events)):] {
+			onEvent(event)
+			events = append(events, event)
+		}
+		return nil
+	}
+
+	if err := fetch(); err != nil {
+		return nil, "", err
+	}
+	if !follow {
+		return events, "", nil
+	}
+
+	for {
+		// Check the status before fetching, so events recorded as the
+		// deployment finished aren't missed
+		deployment, err := c.GetDeployment(appID, deploymentID)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := fetch(); err != nil {
+			return nil, "", err
+		}
+		if isTerminalDeploymentStatus(deployment.Status) {
+			return events, deployment.Status, nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// printDeploymentEvent prints one line of a deployment's timeline
+func printDeploymentEvent(event client.DeploymentEvent) {
+	line := fmt.Sprintf("%s  %-18s", output.FormatTime(event.CreatedAt), event.Stage)
+	if event.Message != "" {
+		line += " " + event.Message
+	}
+	fmt.Println(strings.TrimRight(line, " "))
+}
+
+// isTerminalDeploymentStatus reports whether a deployment has finished
+func isTerminalDeploymentStatus(status string) bool {
+	return status == "success" || status == "failed"
+}
+
+// printDeploymentStatus prints a deployment's status in table format
+func printDeploymentStatus(d *client.Deployment) {
+	version := d.Version
+	if version == "" {
+		version = d.VersionID
+	}
+
+	fmt.Printf("Deployment: %s\n\n", d.ID)
+	fmt.Printf("  Version:     %s\n", version)
+	fmt.Printf("  Environment: %s\n", d.Environment)
+	if d.RolledBackFrom != "" {
+		fmt.Printf("  Rolled back: from %s\n", d.RolledBackFrom)
+	}
+	if d.Reason != "" {
+		fmt.Printf("  Reason:      %s\n", d.Reason)
+	}
+	fmt.Printf("  Status:      %s\n", d.Status)
+	if d.Status == "pending_approval" {
+		fmt.Printf("               (run 'smithctl deployment approve %s' to deploy)\n", d.ID)
+	}
+	if d.GitopsCommitSHA != "" {
+		fmt.Printf("  Commit:      %s\n", d.GitopsCommitSHA)
+	}
+	fmt.Printf("  Started:     %s\n", output.FormatTime(d.StartedAt))
+	if d.CompletedAt != nil {
+		fmt.Printf("  Completed:   %s\n", output.FormatTime(*d.CompletedAt))
+	}
+	if d.ErrorMessage != "" {
+		fmt.Printf("  Error:       %s\n", d.ErrorMessage)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(deploymentCmd)
+	deploymentCmd.AddCommand(deploymentListCmd)
+	deploymentCmd.AddCommand(deploymentStatusCmd)
+	deploymentCmd.AddCommand(deploymentApproveCmd)
+	deploymentCmd.AddCommand(deploymentEventsCmd)
+
+	// Flags for deployment list
+	deploymentListCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	deploymentListCmd.Flags().String("env", "", "Filter by environment")
+	deploymentListCmd.Flags().String("status", "", "Filter by status (pending_approval, pending, success, failed)")
+	deploymentListCmd.Flags().Int("limit", 20, "Maximum number of results")
+	deploymentListCmd.Flags().Int("offset", 0, "Number of deployments to skip")
+
+	// Flags for deployment status
+	deploymentStatusCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	deploymentStatusCmd.Flags().Bool("watch", false, "Poll until the deployment succeeds or fails")
+	deploymentStatusCmd.Flags().Duration("interval", 2*time.Second, "Polling interval when watching")
+
+	// Flags for deployment approve
+	deploymentApproveCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+
+	// Flags for deployment events
+	deploymentEventsCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	deploymentEventsCmd.Flags().BoolP("follow", "f", false, "Keep printing new events until the deployment succeeds or fails")
+	deploymentEventsCmd.Flags().Duration("interval", 2*time.Second, "Polling interval when following")
+}
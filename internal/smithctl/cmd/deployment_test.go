@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+// fakeDeploymentServer is a minimal smithd serving one deployment that
+// gains an event every time its status is read, finishing after the last
+type fakeDeploymentServer struct {
+	mu     sync.Mutex
+	stages []string
+	seen   int
+}
+
+func (f *fakeDeploymentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := "/api/v1/apps/" + testPolicyAppID + "/deployments/deploy-1"
+	switch r.URL.Path {
+	case prefix:
+		if f.seen < len(f.stages) {
+			f.seen++
+		}
+		status := "pending"
+		if f.seen == len(f.stages) {
+			status = f.stages[len(f.stages)-1]
+		}
+		json.NewEncoder(w).Encode(client.Deployment{ID: "deploy-1", Status: status})
+
+	case prefix + "/events":
+		events := []client.DeploymentEvent{}
+		for i, stage := range f.stages[:f.seen] {
+			events = append(events, client.DeploymentEvent{ID: int64(i + 1), DeploymentID: "deploy-1", Stage: stage})
+		}
+		json.NewEncoder(w).Encode(client.ListDeploymentEventsResponse{Events: events})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestFollowDeploymentEvents(t *testing.T) {
+	fake := &fakeDeploymentServer{stages: []string{"created", "cloning", "pushing", "success"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	c := client.NewClient(server.URL, "test-key", client.Options{})
+	var printed []string
+	events, status, err := followDeploymentEvents(c, testPolicyAppID, "deploy-1", true, 0, func(event client.DeploymentEvent) {
+		printed = append(printed, event.Stage)
+	})
+	if err != nil {
+		t.Fatalf("followDeploymentEvents failed: %v", err)
+	}
+
+	if status != "success" {
+		t.Errorf("expected to follow until success, got %q", status)
+	}
+	// Each event is printed exactly once, in order
+	if want := "created cloning pushing success"; strings.Join(printed, " ") != want || len(events) != 4 {
+		t.Errorf("expected events %q, got %v (%d returned)", want, printed, len(events))
+	}
+}
+
+func TestFollowDeploymentEvents_NoFollow(t *testing.T) {
+	fake := &fakeDeploymentServer{stages: []string{"created", "failed"}, seen: 1}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	c := client.NewClient(server.URL, "test-key", client.Options{})
+	events, _, err := followDeploymentEvents(c, testPolicyAppID, "deploy-1", false, 0, func(client.DeploymentEvent) {})
+	if err != nil {
+		t.Fatalf("followDeploymentEvents failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("expected only the events recorded so far, got %+v", events)
+	}
+}
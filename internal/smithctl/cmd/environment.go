@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var environmentsCmd = &cobra.Command{
+	Use:     "environments",
+	Aliases: []string{"envs"},
+	Short:   "List the environments you can deploy to",
+	Long: `List the environments smithd allows deploys and auto-deploy policies to
+target, as set by ALLOWED_ENVIRONMENTS on the server.
+
+When the server doesn't restrict environments, any name is accepted.
+
+Example:
+  smithctl environments`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		resp, err := c.ListEnvironments()
+		if err != nil {
+			return err
+		}
+
+		format := output.Format(GetOutputFormat())
+		return output.Print(format, resp, func() {
+			if !resp.Restricted {
+				output.Info("smithd accepts any environment")
+				return
+			}
+
+			rows := make([][]string, 0, len(resp.Environments))
+			for _, environment := range resp.Environments {
+				rows = append(rows, []string{environment})
+			}
+			output.PrintTable([]string{"ENVIRONMENT"}, rows)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(environmentsCmd)
+}
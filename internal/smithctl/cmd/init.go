@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init [app-name]",
+	Short: "Set up this repository for an application",
+	Long: `Set up this repository to deploy an application in one step.
+
+Registers the application if it doesn't exist yet, binds this directory to it by
+writing .deploysmith/app.yaml, and optionally drafts a first version with
+'forge init'. Running it again for an existing application just refreshes the binding.
+
+Manifests are deployed to the GitOps repository configured on the smithd server.
+
+Example:
+  smithctl init my-api-service
+  smithctl init my-api-service --forge-version v0.1.0`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		appName := args[0]
+		forgeVersion, _ := cmd.Flags().GetString("forge-version")
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// Register the application unless it already exists
+		appID, created, err := ensureApplication(c, appName)
+		if err != nil {
+			return err
+		}
+		if created {
+			output.Success(fmt.Sprintf("Application '%s' registered (ID: %s)", appName, appID))
+		} else {
+			output.Info(fmt.Sprintf("Application '%s' already registered (ID: %s)", appName, appID))
+		}
+
+		// Bind this directory to the application
+		if err := SaveAppConfig(appID, appName); err != nil {
+			return err
+		}
+		output.Success("Repository bound to application (.deploysmith/app.yaml)")
+
+		// Optionally draft the first version
+		if forgeVersion != "" {
+			forgeCmd := exec.Command("forge", "init", "--app", appName, "--version", forgeVersion)
+			forgeCmd.Stdout = os.Stdout
+			forgeCmd.Stderr = os.Stderr
+			if err := forgeCmd.Run(); err != nil {
+				return fmt.Errorf("failed to run forge init: %w", err)
+			}
+		}
+
+		// Print next steps
+		fmt.Println()
+		fmt.Println("Next steps:")
+		if forgeVersion == "" {
+			fmt.Println("  forge init --version <version>   # draft a version")
+		}
+		fmt.Println("  forge upload <manifests-dir>     # upload manifests")
+		fmt.Println("  forge publish                    # publish the version")
+		fmt.Println("  smithctl deploy <version> --env <environment>")
+
+		return nil
+	},
+}
+
+// ensureApplication returns the ID of the named application, registering it
+// if it doesn't exist. created reports whether it was registered.
+func ensureApplication(c *client.Client, name string) (appID string, created bool, err error) {
+	appID, err = c.GetAppIDByName(name)
+	if err == nil {
+		return appID, false, nil
+	}
+	if !strings.HasPrefix(err.Error(), "application not found") {
+		return "", false, err
+	}
+
+	app, err := c.RegisterApplication(client.RegisterApplicationRequest{Name: name})
+	if err != nil {
+		return "", false, err
+	}
+
+	return app.ID, true, nil
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().String("forge-version", "", "Run 'forge init' to draft this version after binding")
+}
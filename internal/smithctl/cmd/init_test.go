@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+// fakeAppServer is a minimal smithd serving app registration and lookup
+type fakeAppServer struct {
+	mu            sync.Mutex
+	apps          []client.Application
+	registrations int
+}
+
+func (f *fakeAppServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/apps":
+		json.NewEncoder(w).Encode(map[string]interface{}{"apps": f.apps, "total": len(f.apps)})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/apps/"):
+		ref := strings.TrimPrefix(r.URL.Path, "/api/v1/apps/")
+		for _, app := range f.apps {
+			if app.ID == ref || app.Name == ref {
+				json.NewEncoder(w).Encode(app)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/apps":
+		var req client.RegisterApplicationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, app := range f.apps {
+			if app.Name == req.Name {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		f.registrations++
+		app := client.Application{ID: "app-" + req.Name, Name: req.Name}
+		f.apps = append(f.apps, app)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(app)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEnsureApplication_Idempotent(t *testing.T) {
+	fake := &fakeAppServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	c := client.NewClient(server.URL, "test-key", client.Options{})
+
+	appID, created, err := ensureApplication(c, "my-api")
+	if err != nil {
+		t.Fatalf("first ensureApplication failed: %v", err)
+	}
+	if !created {
+		t.Error("expected application to be registered on first run")
+	}
+
+	secondID, created, err := ensureApplication(c, "my-api")
+	if err != nil {
+		t.Fatalf("second ensureApplication failed: %v", err)
+	}
+	if created {
+		t.Error("expected existing application to be reused")
+	}
+	if secondID != appID {
+		t.Errorf("expected app ID %s, got %s", appID, secondID)
+	}
+	if fake.registrations != 1 {
+		t.Errorf("expected 1 registration, got %d", fake.registrations)
+	}
+}
+
+func TestEnsureApplication_ExistingApp(t *testing.T) {
+	fake := &fakeAppServer{apps: []client.Application{{ID: "app-123", Name: "my-api"}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	appID, created, err := ensureApplication(client.NewClient(server.URL, "test-key", client.Options{}), "my-api")
+	if err != nil {
+		t.Fatalf("ensureApplication failed: %v", err)
+	}
+	if created || appID != "app-123" {
+		t.Errorf("expected existing app-123, got %s (created=%v)", appID, created)
+	}
+	if fake.registrations != 0 {
+		t.Errorf("expected no registrations, got %d", fake.registrations)
+	}
+}
+
+func TestEnsureApplication_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if _, _, err := ensureApplication(client.NewClient(server.URL, "test-key", client.Options{}), "my-api"); err == nil {
+		t.Error("expected error when smithd is failing")
+	}
+}
@@ -4,31 +4,36 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/sorenmh/deploysmith/internal/smithctl/client"
 	"github.com/sorenmh/deploysmith/internal/smithctl/output"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var policyCmd = &cobra.Command{
 	Use:   "policy",
 	Short: "Manage auto-deployment policies",
-	Long:  `Create, list, and delete auto-deployment policies.`,
+	Long:  `Create, list, update, and delete auto-deployment policies.`,
 }
 
 var policyCreateCmd = &cobra.Command{
 	Use:   "create [app-name]",
 	Short: "Create an auto-deployment policy",
 	Long: `Create an auto-deployment policy that automatically deploys versions
-matching a branch pattern to a specified environment.
+matching a branch pattern to a specified environment. When several policies
+match a branch for the same environment, only the one with the highest
+--priority deploys.
 
 You can specify the app by name or ID, or omit it if you've run 'forge app-bind' in this directory.
 
 Example:
   smithctl policy create --name auto-deploy-main --branch main --env staging               # Uses app from binding
   smithctl policy create my-api-service --name auto-deploy-main --branch main --env staging
-  smithctl policy create --app my-api-service --name auto-deploy-release --branch "release/*" --env production`,
+  smithctl policy create --app my-api-service --name auto-deploy-release --branch "release/*" --env production
+  smithctl policy create --name hotfix-prod --branch "hotfix/*" --env production --priority 10`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate configuration
@@ -53,6 +58,7 @@ Example:
 		branch, _ := cmd.Flags().GetString("branch")
 		environment, _ := cmd.Flags().GetString("env")
 		disabled, _ := cmd.Flags().GetBool("disabled")
+		priority, _ := cmd.Flags().GetInt("priority")
 
 		if name == "" {
 			return fmt.Errorf("--name is required")
@@ -65,7 +71,7 @@ Example:
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// Determine enabled state
 		enabled := !disabled
@@ -74,6 +80,7 @@ Example:
 			GitBranchPattern:  branch,
 			TargetEnvironment: environment,
 			Enabled:           &enabled,
+			Priority:          priority,
 		}
 
 		// Create policy
@@ -88,6 +95,7 @@ Example:
 		fmt.Printf("  Name:        %s\n", policy.Name)
 		fmt.Printf("  Branch:      %s\n", policy.GitBranchPattern)
 		fmt.Printf("  Environment: %s\n", policy.TargetEnvironment)
+		fmt.Printf("  Priority:    %d\n", policy.Priority)
 		status := "enabled"
 		if !policy.Enabled {
 			status = "disabled"
@@ -131,7 +139,7 @@ Example:
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// List policies
 		resp, err := c.ListPolicies(appID)
@@ -148,7 +156,7 @@ Example:
 		// Print output based on format
 		format := output.Format(GetOutputFormat())
 		return output.Print(format, resp, func() {
-			headers := []string{"NAME", "BRANCH", "ENVIRONMENT", "STATUS"}
+			headers := []string{"NAME", "BRANCH", "ENVIRONMENT", "PRIORITY", "STATUS"}
 			rows := make([][]string, 0, len(resp.Policies))
 
 			for _, policy := range resp.Policies {
@@ -160,6 +168,7 @@ Example:
 					policy.Name,
 					policy.GitBranchPattern,
 					policy.TargetEnvironment,
+					strconv.Itoa(policy.Priority),
 					status,
 				})
 			}
@@ -169,6 +178,116 @@ Example:
 	},
 }
 
+var policyUpdateCmd = &cobra.Command{
+	Use:   "update [app-name] [policy-name]",
+	Short: "Update an auto-deployment policy",
+	Long: `Update the branch pattern, environment, priority or enabled state of an auto-deployment policy.
+The policy keeps its ID; only the given flags are changed.
+
+You can specify the app by name or ID, or omit it if you've run 'forge app-bind' in this directory.
+
+Example:
+  smithctl policy update my-policy-name --disable                          # Uses app from binding
+  smithctl policy update my-api-service my-policy-name --branch "release/*"
+  smithctl policy update --app my-api-service my-policy-name --env production --enable`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Parse arguments - could be [policy-name] or [app-name, policy-name]
+		var appIdentifier, policyName string
+		if len(args) == 1 {
+			// Only policy name provided, get app from flag or binding
+			policyName = args[0]
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		} else {
+			// Both app and policy name provided
+			appIdentifier = args[0]
+			policyName = args[1]
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		enable, _ := cmd.Flags().GetBool("enable")
+		disable, _ := cmd.Flags().GetBool("disable")
+		if enable && disable {
+			return fmt.Errorf("--enable and --disable cannot be used together")
+		}
+
+		// Only send the fields that were given
+		var req client.UpdatePolicyRequest
+		if cmd.Flags().Changed("branch") {
+			branch, _ := cmd.Flags().GetString("branch")
+			req.GitBranchPattern = &branch
+		}
+		if cmd.Flags().Changed("env") {
+			environment, _ := cmd.Flags().GetString("env")
+			req.TargetEnvironment = &environment
+		}
+		if cmd.Flags().Changed("priority") {
+			priority, _ := cmd.Flags().GetInt("priority")
+			req.Priority = &priority
+		}
+		if enable || disable {
+			enabled := enable
+			req.Enabled = &enabled
+		}
+
+		if req.GitBranchPattern == nil && req.TargetEnvironment == nil && req.Priority == nil && req.Enabled == nil {
+			return fmt.Errorf("nothing to update: use --branch, --env, --priority, --enable or --disable")
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// List policies to find the policy ID
+		resp, err := c.ListPolicies(appID)
+		if err != nil {
+			return err
+		}
+
+		var policyID string
+		for _, p := range resp.Policies {
+			if p.Name == policyName {
+				policyID = p.ID
+				break
+			}
+		}
+
+		if policyID == "" {
+			return fmt.Errorf("policy not found: %s", policyName)
+		}
+
+		// Update policy
+		policy, err := c.UpdatePolicy(appID, policyID, req)
+		if err != nil {
+			return err
+		}
+
+		// Print success message
+		output.Success("Auto-deploy policy updated")
+		fmt.Println()
+		fmt.Printf("  Name:        %s\n", policy.Name)
+		fmt.Printf("  Branch:      %s\n", policy.GitBranchPattern)
+		fmt.Printf("  Environment: %s\n", policy.TargetEnvironment)
+		fmt.Printf("  Priority:    %d\n", policy.Priority)
+		status := "enabled"
+		if !policy.Enabled {
+			status = "disabled"
+		}
+		fmt.Printf("  Status:      %s\n", status)
+
+		return nil
+	},
+}
+
 var policyDeleteCmd = &cobra.Command{
 	Use:   "delete [app-name] [policy-name]",
 	Short: "Delete an auto-deployment policy",
@@ -222,7 +341,7 @@ Example:
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// List policies to find the policy ID
 		resp, err := c.ListPolicies(appID)
@@ -254,11 +373,230 @@ Example:
 	},
 }
 
+var policyApplyCmd = &cobra.Command{
+	Use:   "apply [app-name]",
+	Short: "Apply auto-deployment policies from a file",
+	Long: `Reconcile an application's auto-deployment policies with a YAML file.
+
+Policies in the file that don't exist are created and policies whose branch,
+environment, priority or enabled state differ are updated. With --prune, policies that
+aren't in the file are deleted. Policies are matched by name.
+
+The file lists the policies and may name the application:
+
+  app: my-api-service
+  policies:
+    - name: auto-deploy-main
+      branch: main
+      environment: staging
+    - name: auto-deploy-release
+      branch: "release/*"
+      environment: production
+      priority: 10
+      enabled: false
+
+The app argument or --app flag takes precedence over the file, which takes
+precedence over the app binding.
+
+Example:
+  smithctl policy apply -f policies.yaml
+  smithctl policy apply my-api-service -f policies.yaml --prune`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		filename, _ := cmd.Flags().GetString("file")
+		if filename == "" {
+			return fmt.Errorf("--file is required")
+		}
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		file, err := loadPolicyFile(filename)
+		if err != nil {
+			return err
+		}
+
+		// Get app identifier from args, flag or the file
+		var appIdentifier string
+		if len(args) > 0 {
+			appIdentifier = args[0]
+		} else {
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		}
+		if appIdentifier == "" {
+			appIdentifier = file.App
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		changes, err := applyPolicies(c, appID, file.Policies, prune)
+		for _, change := range changes {
+			fmt.Printf("  %s %s\n", change.Action, change.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			output.Info("Policies are up to date")
+			return nil
+		}
+		output.Success(fmt.Sprintf("Applied %d policy change(s)", len(changes)))
+
+		return nil
+	},
+}
+
+// policyFile is the declarative policy list read by 'policy apply'
+type policyFile struct {
+	App      string       `yaml:"app"`
+	Policies []policySpec `yaml:"policies"`
+}
+
+// policySpec is a single policy in a policy file
+type policySpec struct {
+	Name        string `yaml:"name"`
+	Branch      string `yaml:"branch"`
+	Environment string `yaml:"environment"`
+	Priority    int    `yaml:"priority"`
+	Enabled     *bool  `yaml:"enabled"` // defaults to true
+}
+
+// enabled reports whether the policy should be enabled
+func (p policySpec) enabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// policyChange is a change made by applyPolicies
+type policyChange struct {
+	Action string // created, updated or deleted
+	Name   string
+}
+
+// loadPolicyFile reads and validates a policy file
+func loadPolicyFile(filename string) (*policyFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var file policyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, p := range file.Policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s: policy %d has no name", filename, i+1)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("%s: policy %s is listed more than once", filename, p.Name)
+		}
+		seen[p.Name] = true
+		if p.Branch == "" {
+			return nil, fmt.Errorf("%s: policy %s has no branch", filename, p.Name)
+		}
+		if p.Environment == "" {
+			return nil, fmt.Errorf("%s: policy %s has no environment", filename, p.Name)
+		}
+	}
+
+	return &file, nil
+}
+
+// applyPolicies reconciles an application's policies with the desired ones,
+// deleting policies that aren't desired if prune is set. It returns the
+// changes made, including those made before an error.
+func applyPolicies(c *client.Client, appID string, desired []policySpec, prune bool) ([]policyChange, error) {
+	resp, err := c.ListPolicies(appID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]client.Policy, len(resp.Policies))
+	for _, p := range resp.Policies {
+		existing[p.Name] = p
+	}
+
+	var changes []policyChange
+	wanted := make(map[string]bool, len(desired))
+	for _, spec := range desired {
+		wanted[spec.Name] = true
+		enabled := spec.enabled()
+
+		current, ok := existing[spec.Name]
+		if !ok {
+			_, err := c.CreatePolicy(appID, client.CreatePolicyRequest{
+				Name:              spec.Name,
+				GitBranchPattern:  spec.Branch,
+				TargetEnvironment: spec.Environment,
+				Enabled:           &enabled,
+				Priority:          spec.Priority,
+			})
+			if err != nil {
+				return changes, fmt.Errorf("failed to create policy %s: %w", spec.Name, err)
+			}
+			changes = append(changes, policyChange{Action: "created", Name: spec.Name})
+			continue
+		}
+
+		// Only send the fields that changed
+		var req client.UpdatePolicyRequest
+		if current.GitBranchPattern != spec.Branch {
+			req.GitBranchPattern = &spec.Branch
+		}
+		if current.TargetEnvironment != spec.Environment {
+			req.TargetEnvironment = &spec.Environment
+		}
+		if current.Priority != spec.Priority {
+			req.Priority = &spec.Priority
+		}
+		if current.Enabled != enabled {
+			req.Enabled = &enabled
+		}
+		if req.GitBranchPattern == nil && req.TargetEnvironment == nil && req.Priority == nil && req.Enabled == nil {
+			continue
+		}
+
+		if _, err := c.UpdatePolicy(appID, current.ID, req); err != nil {
+			return changes, fmt.Errorf("failed to update policy %s: %w", spec.Name, err)
+		}
+		changes = append(changes, policyChange{Action: "updated", Name: spec.Name})
+	}
+
+	if prune {
+		for _, p := range resp.Policies {
+			if wanted[p.Name] {
+				continue
+			}
+			if err := c.DeletePolicy(appID, p.ID); err != nil {
+				return changes, fmt.Errorf("failed to delete policy %s: %w", p.Name, err)
+			}
+			changes = append(changes, policyChange{Action: "deleted", Name: p.Name})
+		}
+	}
+
+	return changes, nil
+}
+
 func init() {
 	rootCmd.AddCommand(policyCmd)
 	policyCmd.AddCommand(policyCreateCmd)
 	policyCmd.AddCommand(policyListCmd)
+	policyCmd.AddCommand(policyUpdateCmd)
 	policyCmd.AddCommand(policyDeleteCmd)
+	policyCmd.AddCommand(policyApplyCmd)
 
 	// Flags for policy create
 	policyCreateCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
@@ -266,11 +604,25 @@ func init() {
 	policyCreateCmd.Flags().String("branch", "", "Git branch pattern (required)")
 	policyCreateCmd.Flags().String("env", "", "Target environment (required)")
 	policyCreateCmd.Flags().Bool("disabled", false, "Create policy in disabled state")
+	policyCreateCmd.Flags().Int("priority", 0, "Priority over other policies deploying the same branch to the same environment (higher wins)")
 
 	// Flags for policy list
 	policyListCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
 
+	// Flags for policy update
+	policyUpdateCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	policyUpdateCmd.Flags().String("branch", "", "New git branch pattern")
+	policyUpdateCmd.Flags().String("env", "", "New target environment")
+	policyUpdateCmd.Flags().Int("priority", 0, "New priority")
+	policyUpdateCmd.Flags().Bool("enable", false, "Enable the policy")
+	policyUpdateCmd.Flags().Bool("disable", false, "Disable the policy")
+
 	// Flags for policy delete
 	policyDeleteCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
 	policyDeleteCmd.Flags().Bool("confirm", false, "Skip confirmation prompt")
+
+	// Flags for policy apply
+	policyApplyCmd.Flags().String("app", "", "Application name or ID (optional if set in the file or app is bound)")
+	policyApplyCmd.Flags().StringP("file", "f", "", "Policy file to apply (required)")
+	policyApplyCmd.Flags().Bool("prune", false, "Delete policies that aren't in the file")
 }
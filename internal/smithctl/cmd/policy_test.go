@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+const testPolicyAppID = "550e8400-e29b-41d4-a716-446655440000"
+
+// fakePolicyServer is a minimal smithd serving one application's policies
+type fakePolicyServer struct {
+	mu       sync.Mutex
+	policies []client.Policy
+	nextID   int
+	requests []string
+}
+
+func (f *fakePolicyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := "/api/v1/apps/" + testPolicyAppID + "/policies"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	policyID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if r.Method != http.MethodGet {
+		f.requests = append(f.requests, r.Method+" "+policyID)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && policyID == "":
+		json.NewEncoder(w).Encode(map[string]interface{}{"policies": f.policies})
+
+	case r.Method == http.MethodPost && policyID == "":
+		var req client.CreatePolicyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.nextID++
+		policy := client.Policy{
+			ID:                fmt.Sprintf("policy-%d", f.nextID),
+			AppID:             testPolicyAppID,
+			Name:              req.Name,
+			GitBranchPattern:  req.GitBranchPattern,
+			TargetEnvironment: req.TargetEnvironment,
+			Enabled:           req.Enabled == nil || *req.Enabled,
+			Priority:          req.Priority,
+		}
+		f.policies = append(f.policies, policy)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(policy)
+
+	case r.Method == http.MethodPatch:
+		var req client.UpdatePolicyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for i := range f.policies {
+			p := &f.policies[i]
+			if p.ID != policyID {
+				continue
+			}
+			if req.GitBranchPattern != nil {
+				p.GitBranchPattern = *req.GitBranchPattern
+			}
+			if req.TargetEnvironment != nil {
+				p.TargetEnvironment = *req.TargetEnvironment
+			}
+			if req.Priority != nil {
+				p.Priority = *req.Priority
+			}
+			if req.Enabled != nil {
+				p.Enabled = *req.Enabled
+			}
+			json.NewEncoder(w).Encode(p)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == http.MethodDelete:
+		for i, p := range f.policies {
+			if p.ID == policyID {
+				f.policies = append(f.policies[:i], f.policies[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// find returns the fake's policy with the given name
+func (f *fakePolicyServer) find(name string) *client.Policy {
+	for i := range f.policies {
+		if f.policies[i].Name == name {
+			return &f.policies[i]
+		}
+	}
+	return nil
+}
+
+func TestApplyPolicies(t *testing.T) {
+	fake := &fakePolicyServer{
+		nextID: 2,
+		policies: []client.Policy{
+			{ID: "policy-1", Name: "auto-main", GitBranchPattern: "main", TargetEnvironment: "dev", Enabled: true},
+			{ID: "policy-2", Name: "auto-old", GitBranchPattern: "old", TargetEnvironment: "dev", Enabled: true},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	c := client.NewClient(server.URL, "test-key", client.Options{})
+	disabled := false
+	desired := []policySpec{
+		{Name: "auto-main", Branch: "main", Environment: "staging"},
+		{Name: "auto-release", Branch: "release/*", Environment: "production", Priority: 10, Enabled: &disabled},
+	}
+
+	changes, err := applyPolicies(c, testPolicyAppID, desired, false)
+	if err != nil {
+		t.Fatalf("applyPolicies failed: %v", err)
+	}
+	want := []policyChange{{Action: "updated", Name: "auto-main"}, {Action: "created", Name: "auto-release"}}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	if p := fake.find("auto-main"); p == nil || p.ID != "policy-1" || p.TargetEnvironment != "staging" {
+		t.Errorf("expected auto-main to be updated in place, got %+v", p)
+	}
+	if p := fake.find("auto-release"); p == nil || p.Enabled || p.GitBranchPattern != "release/*" || p.Priority != 10 {
+		t.Errorf("expected disabled auto-release to be created, got %+v", p)
+	}
+	if fake.find("auto-old") == nil {
+		t.Error("expected auto-old to be kept without --prune")
+	}
+
+	// A second apply changes nothing
+	fake.requests = nil
+	changes, err = applyPolicies(c, testPolicyAppID, desired, false)
+	if err != nil {
+		t.Fatalf("second applyPolicies failed: %v", err)
+	}
+	if len(changes) != 0 || len(fake.requests) != 0 {
+		t.Errorf("expected no changes, got %v (requests %v)", changes, fake.requests)
+	}
+}
+
+func TestApplyPolicies_Prune(t *testing.T) {
+	fake := &fakePolicyServer{
+		nextID: 2,
+		policies: []client.Policy{
+			{ID: "policy-1", Name: "auto-main", GitBranchPattern: "main", TargetEnvironment: "staging", Enabled: true},
+			{ID: "policy-2", Name: "auto-old", GitBranchPattern: "old", TargetEnvironment: "dev", Enabled: true},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	desired := []policySpec{{Name: "auto-main", Branch: "main", Environment: "staging"}}
+	changes, err := applyPolicies(client.NewClient(server.URL, "test-key", client.Options{}), testPolicyAppID, desired, true)
+	if err != nil {
+		t.Fatalf("applyPolicies failed: %v", err)
+	}
+
+	if len(changes) != 1 || changes[0] != (policyChange{Action: "deleted", Name: "auto-old"}) {
+		t.Errorf("expected only auto-old to be deleted, got %v", changes)
+	}
+	if len(fake.policies) != 1 || fake.policies[0].Name != "auto-main" {
+		t.Errorf("expected only auto-main to remain, got %+v", fake.policies)
+	}
+}
+
+func TestApplyPolicies_ServerError(t *testing.T) {
+	fake := &fakePolicyServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	desired := []policySpec{{Name: "auto-main", Branch: "main", Environment: "staging"}}
+	_, err := applyPolicies(client.NewClient(server.URL, "test-key", client.Options{}), testPolicyAppID, desired, false)
+	if err == nil || !strings.Contains(err.Error(), "failed to create policy auto-main") {
+		t.Errorf("expected create error naming the policy, got %v", err)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	file, err := loadPolicyFile(write("policies.yaml", `app: my-api
+policies:
+  - name: auto-main
+    branch: main
+    environment: staging
+  - name: auto-release
+    branch: "release/*"
+    environment: production
+    enabled: false
+`))
+	if err != nil {
+		t.Fatalf("loadPolicyFile failed: %v", err)
+	}
+	if file.App != "my-api" || len(file.Policies) != 2 {
+		t.Fatalf("unexpected policy file: %+v", file)
+	}
+	if !file.Policies[0].enabled() || file.Policies[1].enabled() {
+		t.Errorf("expected enabled to default to true and honor false, got %+v", file.Policies)
+	}
+
+	for name, content := range map[string]string{
+		"missing name":   "policies:\n  - branch: main\n    environment: staging\n",
+		"missing branch": "policies:\n  - name: a\n    environment: staging\n",
+		"missing env":    "policies:\n  - name: a\n    branch: main\n",
+		"duplicate name": "policies:\n  - {name: a, branch: main, environment: staging}\n  - {name: a, branch: dev, environment: dev}\n",
+		"invalid yaml":   "policies: [",
+	} {
+		if _, err := loadPolicyFile(write("bad.yaml", content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
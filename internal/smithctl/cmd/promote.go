@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote [app-name-or-id]",
+	Short: "Deploy the version running in one environment to another",
+	Long: `Promote the version currently deployed to one environment to another,
+such as from staging to production, without looking up the version ID.
+
+smithd treats the promotion as a regular deploy, so approval gates and deploy
+policies on the target environment still apply.
+
+Examples:
+  smithctl promote --from staging --to production          # Uses app from binding
+  smithctl promote my-api-service --from staging --to production
+  smithctl promote my-api-service --from staging --to production --confirm`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Get app identifier from args or flag
+		var appIdentifier string
+		if len(args) > 0 {
+			appIdentifier = args[0]
+		} else {
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		}
+
+		// Resolve app ID
+		appID, appName, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		skipConfirm, _ := cmd.Flags().GetBool("confirm")
+
+		if from == "" || to == "" {
+			return fmt.Errorf("--from and --to are required")
+		}
+		if from == to {
+			return fmt.Errorf("--from and --to must be different environments")
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		app, err := c.GetApplication(appID)
+		if err != nil {
+			return err
+		}
+
+		versionID, err := promotionVersion(app, from, to)
+		if err != nil {
+			return err
+		}
+		if versionID == "" {
+			output.Info(fmt.Sprintf("%s already runs %s, the version in %s", to, app.CurrentVersions[to].VersionID, from))
+			return nil
+		}
+
+		// Show confirmation prompt unless --confirm is used
+		if !skipConfirm {
+			fmt.Println("You are about to promote:")
+			fmt.Println()
+			fmt.Printf("  App:     %s\n", appName)
+			fmt.Printf("  Version: %s\n", versionID)
+			fmt.Printf("  From:    %s\n", from)
+			if current, ok := app.CurrentVersions[to]; ok {
+				fmt.Printf("  To:      %s (currently %s)\n", to, current.VersionID)
+			} else {
+				fmt.Printf("  To:      %s\n", to)
+			}
+			fmt.Println()
+			fmt.Print("Continue? (y/n): ")
+
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+
+			if response != "y" && response != "yes" {
+				output.Info("Promotion cancelled")
+				os.Exit(2)
+			}
+		}
+
+		resp, err := c.DeployVersion(appID, versionID, to)
+		if err != nil {
+			return err
+		}
+
+		output.Success(fmt.Sprintf("Promoting %s from %s to %s", versionID, from, to))
+		fmt.Printf("  Deployment ID: %s\n", resp.DeploymentID)
+		fmt.Println()
+		if resp.Status == "pending_approval" {
+			fmt.Printf("%s requires approval; run 'smithctl deployment approve %s' to deploy\n", resp.Environment, resp.DeploymentID)
+			return nil
+		}
+		fmt.Printf("Run 'smithctl deployment status %s --watch' to follow progress\n", resp.DeploymentID)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	promoteCmd.Flags().String("from", "", "Environment whose current version is promoted (required)")
+	promoteCmd.Flags().String("to", "", "Environment to deploy the version to (required)")
+	promoteCmd.Flags().Bool("confirm", false, "Skip confirmation prompt")
+}
+
+// promotionVersion returns the version deployed to from, or "" when to
+// already runs it
+func promotionVersion(app *client.Application, from, to string) (string, error) {
+	source, ok := app.CurrentVersions[from]
+	if !ok {
+		return "", fmt.Errorf("no version is deployed to %s", from)
+	}
+	if target, ok := app.CurrentVersions[to]; ok && target.VersionID == source.VersionID {
+		return "", nil
+	}
+	return source.VersionID, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+func TestPromotionVersion(t *testing.T) {
+	app := &client.Application{CurrentVersions: map[string]client.CurrentDeployment{
+		"staging":    {VersionID: "v1.1.0"},
+		"production": {VersionID: "v1.0.0"},
+		"canary":     {VersionID: "v1.1.0"},
+	}}
+
+	version, err := promotionVersion(app, "staging", "production")
+	if err != nil || version != "v1.1.0" {
+		t.Errorf("expected v1.1.0, got %q (%v)", version, err)
+	}
+
+	// Environments without a deployment yet can be promoted to
+	version, err = promotionVersion(app, "staging", "qa")
+	if err != nil || version != "v1.1.0" {
+		t.Errorf("expected v1.1.0 for a new environment, got %q (%v)", version, err)
+	}
+
+	// Nothing to do when the target already runs the version
+	version, err = promotionVersion(app, "staging", "canary")
+	if err != nil || version != "" {
+		t.Errorf("expected no promotion, got %q (%v)", version, err)
+	}
+
+	if _, err := promotionVersion(app, "qa", "production"); err == nil {
+		t.Error("expected error promoting from an environment with no deployment")
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"github.com/sorenmh/deploysmith/internal/shared/config"
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
 	"github.com/spf13/cobra"
 )
 
@@ -25,13 +26,22 @@ Configuration:
   Environment variables:
     SMITHD_URL          - smithd API endpoint (required)
     SMITHD_API_KEY      - smithd API authentication key (required)
+    SMITHD_CONTEXT      - config file context to use
 
   Config file (~/.deploysmith/config.yaml):
     url: https://smithd.example.com
     apiKey: sk_live_abc123
+    contexts:
+      staging:
+        url: https://smithd.staging.example.com
+        apiKey: sk_live_def456
 
   CLI flags override environment variables and config file.
 
+  Requests time out after --timeout (default 30s) and are retried --retries
+  times (default 3) after network errors and 5xx responses. Only reads are
+  retried unless --retry-unsafe is set, since a retried deploy may run twice.
+
 Example usage:
   smithctl app register my-api-service
   smithctl version list my-api-service
@@ -45,6 +55,7 @@ func Execute() error {
 func init() {
 	config.InitConfig()
 	config.AddFlags(rootCmd)
+	config.AddClientFlags(rootCmd)
 
 	// Add smithctl-specific flags
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
@@ -60,6 +71,15 @@ func GetSmithdAPIKey() string {
 	return config.GetSmithdAPIKey()
 }
 
+// GetClientOptions returns the configured smithd client options
+func GetClientOptions() client.Options {
+	return client.Options{
+		Timeout:     config.GetTimeout(),
+		Retries:     config.GetRetries(),
+		RetryUnsafe: config.GetRetryUnsafe(),
+	}
+}
+
 // GetOutputFormat returns the output format
 func GetOutputFormat() string {
 	return outputFormat
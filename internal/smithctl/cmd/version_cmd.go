@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/sorenmh/deploysmith/internal/smithctl/client"
@@ -12,7 +14,7 @@ import (
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Manage versions",
-	Long:  `List and view application versions.`,
+	Long:  `List, view and delete application versions.`,
 }
 
 var versionListCmd = &cobra.Command{
@@ -52,7 +54,7 @@ Examples:
 		limit, _ := cmd.Flags().GetInt("limit")
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// List versions (use appID since client now resolves internally)
 		resp, err := c.ListVersions(appID, status, limit, 0)
@@ -134,7 +136,7 @@ Examples:
 		}
 
 		// Create API client
-		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey())
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
 
 		// Get version
 		ver, err := c.GetVersion(appID, versionID)
@@ -188,10 +190,80 @@ Examples:
 	},
 }
 
+var versionDeleteCmd = &cobra.Command{
+	Use:   "delete [app-name-or-id] [version-id]",
+	Short: "Delete a version",
+	Long: `Delete a version and its stored manifests.
+
+Versions that are currently deployed to any environment cannot be deleted.
+
+You can specify the app by name or ID, or omit it if you've run 'forge app-bind' in this directory.
+
+Examples:
+  smithctl version delete v1.0.0                      # Uses app from binding
+  smithctl version delete my-api-service v1.0.0       # Uses app name
+  smithctl version delete --app my-api-service v1.0.0 --confirm`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Parse arguments - could be [version] or [app, version]
+		var appIdentifier, versionID string
+		if len(args) == 1 {
+			// Only version provided, get app from flag or binding
+			versionID = args[0]
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		} else {
+			// Both app and version provided
+			appIdentifier = args[0]
+			versionID = args[1]
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		skipConfirm, _ := cmd.Flags().GetBool("confirm")
+
+		// Show confirmation prompt unless --confirm is used
+		if !skipConfirm {
+			fmt.Printf("Are you sure you want to delete version '%s'? (y/n): ", versionID)
+
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+
+			if response != "y" && response != "yes" {
+				output.Info("Deletion cancelled")
+				return nil
+			}
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		// Delete version
+		if err := c.DeleteVersion(appID, versionID); err != nil {
+			return err
+		}
+
+		// Print success message
+		output.Success(fmt.Sprintf("Version %s deleted", versionID))
+
+		return nil
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 	versionCmd.AddCommand(versionListCmd)
 	versionCmd.AddCommand(versionShowCmd)
+	versionCmd.AddCommand(versionDeleteCmd)
 
 	// Flags for version list
 	versionListCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
@@ -200,4 +272,8 @@ func init() {
 
 	// Flags for version show
 	versionShowCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+
+	// Flags for version delete
+	versionDeleteCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	versionDeleteCmd.Flags().Bool("confirm", false, "Skip confirmation prompt")
 }
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+	"github.com/sorenmh/deploysmith/internal/smithctl/output"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestBundle is the archive forge uploads manifests in. Its files are
+// shown in place of the archive itself.
+const manifestBundle = "manifests.tar.gz"
+
+// manifestFile is a file of a version in list output
+type manifestFile struct {
+	Name string `json:"name" yaml:"name"`
+	Size int    `json:"size" yaml:"size"`
+}
+
+var versionManifestsCmd = &cobra.Command{
+	Use:   "manifests [app-name-or-id] [version-id]",
+	Short: "Show the manifests of a published version",
+	Long: `List the files of a published version, or print their contents.
+
+Files in the manifests.tar.gz bundle are shown in place of the bundle. Use
+--file to print a single file or --all to print every file. With --output
+json or yaml, the Kubernetes objects in the printed files are written as a
+List or a YAML stream that can be piped into kubectl.
+
+You can specify the app by name or ID, or omit it if you've run 'forge app-bind' in this directory.
+
+Examples:
+  smithctl version manifests v1.0.0                                # Uses app from binding
+  smithctl version manifests my-api-service v1.0.0                 # Lists files
+  smithctl version manifests my-api-service v1.0.0 --file deployment.yaml
+  smithctl version manifests my-api-service v1.0.0 --all -o yaml | kubectl diff -f -`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Validate configuration
+		if err := ValidateConfig(); err != nil {
+			return err
+		}
+
+		// Parse arguments - could be [version] or [app, version]
+		var appIdentifier, versionID string
+		if len(args) == 1 {
+			// Only version provided, get app from flag or binding
+			versionID = args[0]
+			appIdentifier, _ = cmd.Flags().GetString("app")
+		} else {
+			// Both app and version provided
+			appIdentifier = args[0]
+			versionID = args[1]
+		}
+
+		filename, _ := cmd.Flags().GetString("file")
+		all, _ := cmd.Flags().GetBool("all")
+		if filename != "" && all {
+			return fmt.Errorf("--file and --all can't be used together")
+		}
+
+		// Resolve app ID
+		appID, _, err := ResolveAppID(appIdentifier)
+		if err != nil {
+			return err
+		}
+
+		// Create API client
+		c := client.NewClient(GetSmithdURL(), GetSmithdAPIKey(), GetClientOptions())
+
+		format := output.Format(GetOutputFormat())
+
+		// Print a single file
+		if filename != "" {
+			data, err := versionManifest(c, appID, versionID, filename)
+			if err != nil {
+				return err
+			}
+			if format == output.FormatJSON || format == output.FormatYAML {
+				return printKubernetesObjects(format, map[string][]byte{filename: data})
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+
+		files, err := versionManifests(c, appID, versionID)
+		if err != nil {
+			return err
+		}
+		filenames := make([]string, 0, len(files))
+		for name := range files {
+			filenames = append(filenames, name)
+		}
+		sort.Strings(filenames)
+
+		// Print every file
+		if all {
+			if format == output.FormatJSON || format == output.FormatYAML {
+				return printKubernetesObjects(format, files)
+			}
+			for i, name := range filenames {
+				if i > 0 {
+					fmt.Println("---")
+				}
+				fmt.Printf("# Source: %s\n", name)
+				data := files[name]
+				os.Stdout.Write(data)
+				if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+					fmt.Println()
+				}
+			}
+			return nil
+		}
+
+		// List the files
+		list := make([]manifestFile, 0, len(filenames))
+		for _, name := range filenames {
+			list = append(list, manifestFile{Name: name, Size: len(files[name])})
+		}
+		return output.Print(format, list, func() {
+			rows := make([][]string, 0, len(list))
+			for _, file := range list {
+				rows = append(rows, []string{file.Name, strconv.Itoa(file.Size)})
+			}
+			output.PrintTable([]string{"FILE", "SIZE"}, rows)
+		})
+	},
+}
+
+// versionManifests downloads every file of a published version, with the
+// files of a manifests.tar.gz bundle in place of the bundle
+func versionManifests(c *client.Client, appID, versionID string) (map[string][]byte, error) {
+	archive, err := c.GetManifestArchive(appID, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readManifestArchive(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+
+	if bundle, ok := files[manifestBundle]; ok {
+		bundled, err := readManifestArchive(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", manifestBundle, err)
+		}
+		delete(files, manifestBundle)
+		for name, data := range bundled {
+			files[name] = data
+		}
+	}
+
+	return files, nil
+}
+
+// versionManifest reads one file of a published version, looking in the
+// manifests.tar.gz bundle for files that aren't stored on their own
+func versionManifest(c *client.Client, appID, versionID, filename string) ([]byte, error) {
+	data, err := c.GetManifest(appID, versionID, filename)
+	var apiErr *client.APIError
+	if err == nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return data, err
+	}
+
+	files, err := versionManifests(c, appID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[filename]
+	if !ok {
+		return nil, fmt.Errorf("version %s has no file %s", versionID, filename)
+	}
+	return data, nil
+}
+
+// readManifestArchive reads the files of a tar.gz archive
+func readManifestArchive(data []byte) (map[string][]byte, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		files[strings.TrimPrefix(header.Name, "./")] = content
+	}
+}
+
+// kubernetesObjects decodes the Kubernetes objects in the YAML files, in
+// filename order. Documents without a kind, such as version.yml, are skipped.
+func kubernetesObjects(files map[string][]byte) ([]map[string]interface{}, error) {
+	filenames := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+			filenames = append(filenames, name)
+		}
+	}
+	sort.Strings(filenames)
+
+	objects := []map[string]interface{}{}
+	for _, name := range filenames {
+		decoder := yaml.NewDecoder(bytes.NewReader(files[name]))
+		for {
+			var obj map[string]interface{}
+			if err := decoder.Decode(&obj); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			if _, ok := obj["kind"]; ok {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// printKubernetesObjects prints the Kubernetes objects in files as a List
+// for JSON, or as a multi-document stream for YAML
+func printKubernetesObjects(format output.Format, files map[string][]byte) error {
+	objects, err := kubernetesObjects(files)
+	if err != nil {
+		return err
+	}
+
+	if format == output.FormatJSON {
+		return output.PrintJSON(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      objects,
+		})
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	for _, obj := range objects {
+		if err := encoder.Encode(obj); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+func init() {
+	versionCmd.AddCommand(versionManifestsCmd)
+
+	versionManifestsCmd.Flags().String("app", "", "Application name or ID (optional if app is bound)")
+	versionManifestsCmd.Flags().String("file", "", "Print a single file")
+	versionManifestsCmd.Flags().Bool("all", false, "Print every file")
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithctl/client"
+)
+
+// writeTestArchive builds a tar.gz archive of files
+func writeTestArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, data := range files {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tarWriter.Write(data); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+	return buf.Bytes()
+}
+
+const testManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-api
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-api
+`
+
+// newManifestServer serves a published version stored as a manifests.tar.gz
+// bundle next to a version.yml
+func newManifestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	stored := map[string][]byte{
+		"manifests.tar.gz": writeTestArchive(t, map[string][]byte{"deployment.yaml": []byte(testManifest)}),
+		"version.yml":      []byte("gitSha: abc123\n"),
+	}
+	prefix := "/api/v1/apps/" + testPolicyAppID + "/versions/v1.0.0/manifests"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix && r.URL.Query().Get("all") == "true" {
+			w.Write(writeTestArchive(t, stored))
+			return
+		}
+		if data, ok := stored[r.URL.Path[len(prefix)+1:]]; ok {
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"not_found","message":"Manifest file not found"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVersionManifests_ExpandsBundle(t *testing.T) {
+	c := client.NewClient(newManifestServer(t).URL, "test-key", client.Options{})
+
+	files, err := versionManifests(c, testPolicyAppID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("versionManifests failed: %v", err)
+	}
+	if len(files) != 2 || string(files["deployment.yaml"]) != testManifest || files["version.yml"] == nil {
+		t.Errorf("expected the bundle's files in place of the bundle, got %v", files)
+	}
+}
+
+func TestVersionManifest(t *testing.T) {
+	c := client.NewClient(newManifestServer(t).URL, "test-key", client.Options{})
+
+	// Stored files are read directly, bundled files from the bundle
+	for filename, want := range map[string]string{"version.yml": "gitSha: abc123\n", "deployment.yaml": testManifest} {
+		data, err := versionManifest(c, testPolicyAppID, "v1.0.0", filename)
+		if err != nil {
+			t.Fatalf("versionManifest(%s) failed: %v", filename, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s: expected %q, got %q", filename, want, data)
+		}
+	}
+
+	if _, err := versionManifest(c, testPolicyAppID, "v1.0.0", "ingress.yaml"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestKubernetesObjects(t *testing.T) {
+	objects, err := kubernetesObjects(map[string][]byte{
+		"service.yaml":    []byte(testManifest),
+		"version.yml":     []byte("gitSha: abc123\n"),
+		"config.json":     []byte(`{"kind": "Config"}`),
+		"deployment.yaml": []byte("---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n---\n"),
+	})
+	if err != nil {
+		t.Fatalf("kubernetesObjects failed: %v", err)
+	}
+
+	kinds := []string{}
+	for _, obj := range objects {
+		kinds = append(kinds, obj["kind"].(string))
+	}
+	if want := []string{"ConfigMap", "Deployment", "Service"}; len(kinds) != len(want) || kinds[0] != want[0] || kinds[1] != want[1] || kinds[2] != want[2] {
+		t.Errorf("expected kinds %v in filename order, got %v", want, kinds)
+	}
+
+	if _, err := kubernetesObjects(map[string][]byte{"broken.yaml": []byte("kind: [")}); err == nil {
+		t.Error("expected an error for invalid YAML")
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// audit records a successful mutating call in the audit log, attributed to
+// the API key that made it. Failing to record doesn't fail the call, which
+// has already taken effect.
+func (s *Server) audit(r *http.Request, action, appID, target string) {
+	if _, err := s.auditStore.Record(apiKeyName(r), action, appID, target); err != nil {
+		requestLogger(r).Error("Failed to record audit entry", "action", action, "target", target, "error", err)
+	}
+}
+
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	// Parse filter and pagination parameters
+	appID := r.URL.Query().Get("appId")
+	actor := r.URL.Query().Get("actor")
+	limit := 50
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	entries, total, err := s.auditStore.List(appID, actor, limit, offset)
+	if err != nil {
+		requestLogger(r).Error("Failed to list audit entries", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list audit entries")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ListAuditResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sorenmh/deploysmith/internal/smithd/config"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestAudit_RecordsMutatingCalls(t *testing.T) {
+	s := newTestServer(t)
+	keys, err := config.ParseAPIKeys([]string{"ci:" + testAPIKey, "alice:alice-key"})
+	if err != nil {
+		t.Fatalf("failed to parse API keys: %v", err)
+	}
+	s.cfg.APIKeys = keys
+	s.router = chi.NewRouter()
+	s.setupRoutes()
+
+	rec := doRequest(t, s, "POST", "/api/v1/apps", models.RegisterAppRequest{Name: "my-api"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var app models.Application
+	if err := json.NewDecoder(rec.Body).Decode(&app); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	// Reads aren't audited
+	doRequest(t, s, "GET", "/api/v1/apps/"+app.ID, nil)
+
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/apps/%s/environments/production/approval", app.ID), strings.NewReader(`{"requiresApproval": true}`))
+	req.Header.Set("X-API-Key", "alice-key")
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "GET", "/api/v1/audit?appId="+app.ID, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.ListAuditResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Total != 2 || len(resp.Entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %+v", resp)
+	}
+	if e := resp.Entries[0]; e.Actor != "alice" || e.Action != "app.set_approval" || e.Target != "production" {
+		t.Errorf("unexpected latest entry: %+v", e)
+	}
+	if e := resp.Entries[1]; e.Actor != "ci" || e.Action != "app.register" || e.Target != "my-api" {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+
+	rec = doRequest(t, s, "GET", "/api/v1/audit?actor=ci", nil)
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Total != 1 || resp.Entries[0].Action != "app.register" {
+		t.Errorf("expected only the ci entry, got %+v", resp)
+	}
+}
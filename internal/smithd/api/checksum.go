@@ -0,0 +1,57 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// fileChecksums returns the SHA-256 hash of each file
+func fileChecksums(files map[string][]byte) map[string]string {
+	checksums := make(map[string]string, len(files))
+	for filename, content := range files {
+		sum := sha256.Sum256(content)
+		checksums[filename] = hex.EncodeToString(sum[:])
+	}
+	return checksums
+}
+
+// verifyChecksums checks that files match the checksums recorded at publish.
+// Versions published before checksums were recorded are not verified.
+func verifyChecksums(expected map[string]string, files map[string][]byte) error {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	actual := fileChecksums(files)
+
+	filenames := make([]string, 0, len(expected))
+	for filename := range expected {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		sum, ok := actual[filename]
+		if !ok {
+			return fmt.Errorf("%s is missing from storage", filename)
+		}
+		if sum != expected[filename] {
+			return fmt.Errorf("%s has checksum %s, expected %s", filename, sum, expected[filename])
+		}
+	}
+
+	extra := []string{}
+	for filename := range actual {
+		if _, ok := expected[filename]; !ok {
+			extra = append(extra, filename)
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return fmt.Errorf("%s was not part of the published version", extra[0])
+	}
+
+	return nil
+}
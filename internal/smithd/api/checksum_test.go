@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
+)
+
+// memoryStorage is an in-memory Storage keyed by "drafts/" or "published/"
+// plus version and filename
+type memoryStorage struct {
+	storage.Storage
+	files map[string]map[string][]byte
+}
+
+func (m *memoryStorage) key(versionID string, published bool) string {
+	if published {
+		return "published/" + versionID
+	}
+	return "drafts/" + versionID
+}
+
+func (m *memoryStorage) ListFiles(ctx context.Context, loc storage.Location, versionID string, published bool) ([]string, error) {
+	files := []string{}
+	for filename := range m.files[m.key(versionID, published)] {
+		files = append(files, filename)
+	}
+	return files, nil
+}
+
+func (m *memoryStorage) GetFile(ctx context.Context, loc storage.Location, versionID, filename string, published bool) (io.ReadCloser, error) {
+	data, ok := m.files[m.key(versionID, published)][filename]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", filename)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memoryStorage) GetAllFiles(ctx context.Context, loc storage.Location, versionID string, published bool) (map[string][]byte, error) {
+	return m.files[m.key(versionID, published)], nil
+}
+
+func (m *memoryStorage) MoveVersion(ctx context.Context, loc storage.Location, versionID string) error {
+	published := m.files[m.key(versionID, true)]
+	if published == nil {
+		published = map[string][]byte{}
+		m.files[m.key(versionID, true)] = published
+	}
+	for filename, data := range m.files[m.key(versionID, false)] {
+		published[filename] = data
+	}
+	delete(m.files, m.key(versionID, false))
+	return nil
+}
+
+func (m *memoryStorage) GeneratePresignedURL(loc storage.Location, versionID, filename string) (string, error) {
+	return "memory://" + m.key(versionID, false) + "/" + filename, nil
+}
+
+func (m *memoryStorage) VersionURI(loc storage.Location, versionID string, published bool) string {
+	return "memory://" + m.key(versionID, published)
+}
+
+func (m *memoryStorage) DeleteVersion(ctx context.Context, loc storage.Location, versionID string, published bool) error {
+	delete(m.files, m.key(versionID, published))
+	return nil
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	files := map[string][]byte{"deployment.yaml": []byte("kind: Deployment\n")}
+	checksums := fileChecksums(files)
+
+	if err := verifyChecksums(checksums, files); err != nil {
+		t.Errorf("expected matching files to verify, got %v", err)
+	}
+	if err := verifyChecksums(nil, files); err != nil {
+		t.Errorf("expected versions without checksums to be skipped, got %v", err)
+	}
+	if err := verifyChecksums(checksums, map[string][]byte{}); err == nil || !strings.Contains(err.Error(), "deployment.yaml is missing") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+
+	extra := map[string][]byte{"deployment.yaml": files["deployment.yaml"], "extra.yaml": []byte("kind: Secret\n")}
+	if err := verifyChecksums(checksums, extra); err == nil || !strings.Contains(err.Error(), "extra.yaml") {
+		t.Errorf("expected unexpected file error, got %v", err)
+	}
+}
+
+func TestRunDeployment_FailsWhenPublishedFilesChange(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": testDeploymentManifest}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	version, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	if len(version.Checksums) != 1 {
+		t.Fatalf("expected checksums to be recorded at publish, got %v", version.Checksums)
+	}
+
+	// Replace the published bundle out-of-band
+	mem.files["published/v1.0.0"]["manifests.tar.gz"] = createTestTarball(t, map[string]string{"deployment.yaml": "kind: Pod\n"})
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" {
+		t.Errorf("expected failed status, got %s", got.Status)
+	}
+	if !strings.HasPrefix(got.ErrorMessage, "Checksum mismatch: manifests.tar.gz has checksum") {
+		t.Errorf("expected checksum error naming the file, got %q", got.ErrorMessage)
+	}
+}
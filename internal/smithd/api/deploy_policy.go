@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/opa"
+)
+
+// checkDeployPolicy asks the configured OPA policy whether a version may be
+// deployed. Every deploy is allowed when no policy is configured.
+func (s *Server) checkDeployPolicy(ctx context.Context, app *models.Application, version *models.Version, environment, triggeredBy string) (*opa.Decision, error) {
+	if s.deployPolicy == nil {
+		return &opa.Decision{Allow: true}, nil
+	}
+
+	// The policy sees the manifests exactly as they would be written
+	files, err := s.fetchFiles(ctx, app, version.VersionID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifests: %w", err)
+	}
+	files, err = prepareManifests(app, version, environment, files, s.tarballLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare manifests: %w", err)
+	}
+
+	manifests := make(map[string]string, len(files))
+	for filename, content := range files {
+		manifests[filename] = string(content)
+	}
+
+	decision, err := s.deployPolicy.Evaluate(opa.Input{
+		App:         app.Name,
+		Environment: environment,
+		Version:     version.VersionID,
+		Metadata: models.VersionMetadata{
+			GitSHA:       version.GitSHA,
+			GitBranch:    version.GitBranch,
+			GitCommitter: version.GitCommitter,
+			BuildNumber:  version.BuildNumber,
+			Timestamp:    version.MetadataTimestamp.Format("2006-01-02T15:04:05Z07:00"),
+		},
+		TriggeredBy: triggeredBy,
+		Manifests:   manifests,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !decision.Allow && decision.Reason == "" {
+		decision.Reason = "no reason given"
+	}
+
+	return decision, nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/opa"
+)
+
+// newDeployPolicyServer returns a test server whose deploy policy replies with
+// result, and a published version to deploy
+func newDeployPolicyServer(t *testing.T, result string) (*Server, *models.Application) {
+	t.Helper()
+
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(result))
+	}))
+	t.Cleanup(mock.Close)
+
+	s := newTestServer(t)
+	s.deployPolicy = opa.NewClient(mock.URL)
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{
+		"published/v1.0.0": {"deployment.yaml": []byte("kind: Deployment\n")},
+	}}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	return s, app
+}
+
+func TestDeployVersion_PolicyAllows(t *testing.T) {
+	s, app := newDeployPolicyServer(t, `{"result": {"allow": true}}`)
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeployVersion_PolicyDenies(t *testing.T) {
+	s, app := newDeployPolicyServer(t, `{"result": {"allow": false, "reason": "production deploys are frozen"}}`)
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Error.Code != "forbidden" || !strings.Contains(resp.Error.Message, "production deploys are frozen") {
+		t.Errorf("expected denial reason in response, got %+v", resp.Error)
+	}
+
+	if len(s.deployQueue) != 0 {
+		t.Error("expected denied deployment not to be queued")
+	}
+}
+
+func TestAutoDeploy_PolicyDenies(t *testing.T) {
+	s, app := newDeployPolicyServer(t, `{"result": false}`)
+	version, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+
+	s.autoDeployVersion(context.Background(), slog.Default(), app, version, createTestPolicy(t, s, app.ID, "auto-main", "production"))
+
+	if len(s.deployQueue) != 0 {
+		t.Error("expected denied auto-deploy not to be queued")
+	}
+	deployments, _, err := s.deploymentStore.List(app.ID, "", "", 50, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].Status != "failed" || !strings.HasPrefix(deployments[0].ErrorMessage, "Deploy denied by policy") {
+		t.Errorf("expected one failed deployment denied by policy, got %+v", deployments)
+	}
+}
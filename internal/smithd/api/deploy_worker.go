@@ -0,0 +1,448 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/metrics"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/notify"
+)
+
+// deployQueueSize is how many deployments can wait for a worker
+const deployQueueSize = 100
+
+const (
+	// deploymentLease is how long a pending deployment stays claimed by the
+	// instance that queued it without being renewed. Deployments are only
+	// queued in memory, so once the lease runs out the instance is taken to
+	// have stopped and any instance fails the deployment.
+	deploymentLease = 2 * time.Minute
+	// leaseRenewInterval is how often an instance renews its leases and
+	// looks for expired ones
+	leaseRenewInterval = 30 * time.Second
+)
+
+// deployJob is a pending deployment waiting for a worker
+type deployJob struct {
+	app           *models.Application
+	version       *models.Version
+	deployment    *models.Deployment
+	commitMessage string
+	// removeOther deletes files in the app's gitops directory that the
+	// version doesn't have, for reconcile repairs
+	removeOther bool
+	// logger carries the ID of the request that created the deployment
+	logger *slog.Logger
+}
+
+// deployCommitMessage is the gitops commit message of a manual deploy
+func (s *Server) deployCommitMessage(appName, versionID, environment, triggeredBy string) string {
+	return s.commitMessage(gitops.CommitMessageData{
+		App:         appName,
+		Version:     versionID,
+		Environment: environment,
+		TriggeredBy: triggeredBy,
+		Action:      "deploy",
+		Message:     fmt.Sprintf("Deploy %s version %s to %s", appName, versionID, environment),
+	})
+}
+
+// commitMessage renders the configured commit message template, falling
+// back to the default message if there is none or it fails
+func (s *Server) commitMessage(data gitops.CommitMessageData) string {
+	if s.commitTemplate == nil {
+		return data.Message
+	}
+	message, err := gitops.RenderCommitMessage(s.commitTemplate, data)
+	if err != nil || message == "" {
+		slog.Warn("Failed to render commit message template, using the default", "error", err)
+		return data.Message
+	}
+	return message
+}
+
+// startDeployWorkers starts n goroutines that run queued deployments
+func (s *Server) startDeployWorkers(n int) {
+	for i := 0; i < n; i++ {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			for job := range s.deployQueue {
+				s.runDeployment(job)
+			}
+		}()
+	}
+}
+
+// stopDeployWorkers stops queueing deployments and waits until ctx is done
+// for the workers to run those already queued. It then cancels the rest and
+// waits for the workers to record them as failed.
+func (s *Server) stopDeployWorkers(ctx context.Context) {
+	s.queueMu.Lock()
+	if !s.queueClosed {
+		s.queueClosed = true
+		close(s.deployQueue)
+	}
+	s.queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Cancelling deployments still in progress")
+		s.cancelBase()
+		<-done
+	}
+}
+
+// runDeploymentLeases renews the leases of the deployments this instance
+// has queued and fails expired ones until ctx is cancelled
+func (s *Server) runDeploymentLeases(ctx context.Context) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.deploymentStore.RenewLeases(s.instanceID); err != nil {
+			slog.Warn("Failed to renew deployment leases", "error", err)
+		}
+		s.failExpiredDeployments(time.Now().Add(-deploymentLease))
+	}
+}
+
+// failExpiredDeployments fails pending deployments whose lease was last
+// renewed before before. The instance that queued them stopped, so no worker
+// will run them. Deployments other instances are still renewing are left
+// alone.
+func (s *Server) failExpiredDeployments(before time.Time) {
+	deployments, err := s.deploymentStore.ListExpired(before)
+	if err != nil {
+		slog.Error("Failed to list interrupted deployments", "error", err)
+		return
+	}
+
+	for i := range deployments {
+		deployment := &deployments[i]
+		logger := slog.With("app_id", deployment.AppID, "deployment_id", deployment.ID, "environment", deployment.Environment)
+
+		app, err := s.appStore.GetByID(deployment.AppID)
+		if err != nil {
+			logger.Error("Failed to fail interrupted deployment", "error", err)
+			continue
+		}
+		version := &models.Version{ID: deployment.VersionID, AppID: deployment.AppID, VersionID: deployment.Version}
+
+		const message = "smithd stopped before the deployment ran"
+		if err := s.deploymentStore.Expire(deployment.ID, before, message); err != nil {
+			// Another instance failed it first, or its owner renewed it
+			if err.Error() != "deployment lease not expired" {
+				logger.Error("Failed to fail interrupted deployment", "error", err)
+			}
+			continue
+		}
+		s.reportDeployment(logger, app, version, deployment, "failed", "", message)
+		logger.Warn("Failed deployment interrupted by a restart", "version_id", deployment.Version)
+	}
+}
+
+// errQueueFull is returned by enqueueDeployment when the deploy queue has no
+// room left
+var errQueueFull = errors.New("deployment queue is full")
+
+// enqueueDeployment queues a deployment without blocking
+func (s *Server) enqueueDeployment(job deployJob) error {
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.queueClosed {
+		return fmt.Errorf("smithd is shutting down")
+	}
+
+	// Claim it first, so the lease is held by the time a worker starts
+	if err := s.deploymentStore.Claim(job.deployment.ID, s.instanceID); err != nil {
+		slog.Warn("Failed to claim deployment", "deployment_id", job.deployment.ID, "error", err)
+	}
+
+	select {
+	case s.deployQueue <- job:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// writeQueueError writes the response for a deployment enqueueDeployment
+// refused: 503 when the queue is full, so clients retry, and 500 otherwise
+func writeQueueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errQueueFull) {
+		writeError(w, http.StatusServiceUnavailable, "queue_full", "Too many deployments in progress, try again later")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Failed to queue deployment: %v", err))
+}
+
+// recordEvent adds a stage to a deployment's timeline. The timeline is
+// informational, so failing to record it is only logged.
+func (s *Server) recordEvent(logger *slog.Logger, deploymentID, stage, message string) {
+	if _, err := s.deploymentEventStore.Record(deploymentID, stage, message); err != nil {
+		logger.Warn("Failed to record deployment event", "stage", stage, "error", err)
+	}
+}
+
+// finishDeployment records the outcome of a deployment, counts it and
+// notifies about it. Notifications are sent in the background and failing
+// to send one is only logged.
+func (s *Server) finishDeployment(logger *slog.Logger, app *models.Application, version *models.Version, deployment *models.Deployment, status, gitopsSHA, errorMsg string) error {
+	if err := s.deploymentStore.UpdateStatus(deployment.ID, status, gitopsSHA, errorMsg); err != nil {
+		return err
+	}
+	s.reportDeployment(logger, app, version, deployment, status, gitopsSHA, errorMsg)
+	return nil
+}
+
+// reportDeployment counts, records and notifies about the outcome of a
+// deployment already saved to the database
+func (s *Server) reportDeployment(logger *slog.Logger, app *models.Application, version *models.Version, deployment *models.Deployment, status, gitopsSHA, errorMsg string) {
+	metrics.Deployments.WithLabelValues(status).Inc()
+
+	message := errorMsg
+	if gitopsSHA != "" && errorMsg == "" {
+		message = "Pushed commit " + gitopsSHA
+	}
+	s.recordEvent(logger, deployment.ID, status, message)
+
+	event := notify.Event{
+		DeploymentID: deployment.ID,
+		App:          app.Name,
+		Version:      version.VersionID,
+		Environment:  deployment.Environment,
+		Status:       status,
+		CommitSHA:    gitopsSHA,
+		Error:        errorMsg,
+		TriggeredBy:  deployment.TriggeredBy,
+	}
+	go func() {
+		if err := s.notifier.Notify(event); err != nil {
+			logger.Warn("Failed to send deployment notification", "error", err)
+		}
+	}()
+}
+
+// deployContext returns the context a deployment runs under, cancelled
+// after the configured deploy timeout or when the server shuts down
+func (s *Server) deployContext() (context.Context, context.CancelFunc) {
+	if s.cfg.DeployTimeout > 0 {
+		return context.WithTimeout(s.baseCtx, s.cfg.DeployTimeout)
+	}
+	return context.WithCancel(s.baseCtx)
+}
+
+// fetchFiles reads every file of a version from storage, timing the download
+func (s *Server) fetchFiles(ctx context.Context, app *models.Application, versionID string, published bool) (map[string][]byte, error) {
+	start := time.Now()
+	defer func() {
+		metrics.StorageDownloadDuration.Observe(time.Since(start).Seconds())
+	}()
+	return s.storage.GetAllFiles(ctx, storageLocation(app), versionID, published)
+}
+
+// runDeployment fetches a version's manifests, writes them to the gitops
+// repo and records the outcome on the deployment
+func (s *Server) runDeployment(job deployJob) {
+	app, version, deployment := job.app, job.version, job.deployment
+	environment := deployment.Environment
+
+	logger := job.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("deployment_id", deployment.ID, "environment", environment)
+
+	// Fetching stops at the deploy timeout or when the server shuts down
+	fetchCtx, cancelFetch := s.deployContext()
+	defer cancelFetch()
+
+	fail := func(commitSHA, msg string, err error) {
+		logger.Error("Deployment failed: "+msg, "error", err)
+		if updateErr := s.finishDeployment(logger, app, version, deployment, "failed", commitSHA, fmt.Sprintf("%s: %v", msg, err)); updateErr != nil {
+			logger.Error("Failed to update deployment status", "error", updateErr)
+		}
+	}
+
+	s.recordEvent(logger, deployment.ID, "started", "")
+
+	// Fetch manifests from storage
+	s.recordEvent(logger, deployment.ID, "fetching_manifests", "")
+	manifests, err := s.fetchFiles(fetchCtx, app, version.VersionID, true)
+	if err != nil {
+		fail("", "Failed to fetch manifests", err)
+		return
+	}
+
+	// Refuse to deploy files that changed since publish
+	if err := verifyChecksums(version.Checksums, manifests); err != nil {
+		fail("", "Checksum mismatch", err)
+		return
+	}
+
+	// Expand the bundle and apply interpolation
+	manifests, err = prepareManifests(app, version, environment, manifests, s.tarballLimits)
+	if err != nil {
+		fail("", "Failed to prepare manifests", err)
+		return
+	}
+
+	// Record the deployment plan
+	plan := buildDeploymentPlan(s.storage.VersionURI(storageLocation(app), version.VersionID, true), s.gitops.AppPath(app.Name, environment), manifests)
+	if err := s.deploymentStore.SetPlan(deployment.ID, plan); err != nil {
+		fail("", "Failed to save deployment plan", err)
+		return
+	}
+
+	// The gitops working copy is shared, so only one deployment may use it
+	// at a time. Only shutting down stops the wait.
+	if err := s.gitops.LockContext(s.baseCtx); err != nil {
+		fail("", "Failed to wait for the gitops repo", err)
+		return
+	}
+	defer s.gitops.Unlock()
+
+	// The gitops work gets its own deploy timeout, started once the working
+	// copy is free so time queued behind other deployments doesn't count
+	ctx, cancel := s.deployContext()
+	defer cancel()
+
+	// Clone gitops repo
+	s.recordEvent(logger, deployment.ID, "cloning", "")
+	if err := s.gitops.Clone(ctx); err != nil {
+		fail("", "Failed to clone gitops repo", err)
+		return
+	}
+
+	// Unless the push succeeds, put the working copy back at the remote so
+	// the next deployment doesn't commit and push this one's changes
+	pushed := false
+	defer func() {
+		if pushed {
+			return
+		}
+		if err := s.gitops.ResetToRemote(); err != nil {
+			logger.Error("Failed to reset the gitops working copy", "error", err)
+		}
+	}()
+
+	// Write manifests to gitops repo
+	s.recordEvent(logger, deployment.ID, "writing_manifests", "")
+	if err := s.gitops.WriteManifests(app.Name, environment, version.VersionID, manifests); err != nil {
+		fail("", "Failed to write manifests", err)
+		return
+	}
+	if job.removeOther {
+		removed, err := s.gitops.RemoveOtherFiles(app.Name, environment, manifests)
+		if err != nil {
+			fail("", "Failed to remove extra files", err)
+			return
+		}
+		if len(removed) > 0 {
+			logger.Info("Removed files the version doesn't have", "files", removed)
+		}
+	}
+
+	// Commit changes
+	s.recordEvent(logger, deployment.ID, "committing", "")
+	commitSHA, err := s.gitops.Commit(job.commitMessage)
+	unchanged := errors.Is(err, gitops.ErrNoChanges)
+	if unchanged {
+		// The working copy already has these manifests. Failed deployments
+		// reset it to the remote, so pushing is normally a no-op, but push
+		// anyway in case an earlier reset failed.
+		s.recordEvent(logger, deployment.ID, "unchanged", "no changes to commit")
+	} else if err != nil {
+		fail("", "Failed to commit", err)
+		return
+	}
+
+	// Push to remote
+	s.recordEvent(logger, deployment.ID, "pushing", "")
+	pushStart := time.Now()
+	err = s.gitops.Push(ctx)
+	metrics.GitopsPushDuration.Observe(time.Since(pushStart).Seconds())
+	if err != nil {
+		fail(commitSHA, "Failed to push", err)
+		return
+	}
+	pushed = true
+	// A shallow working copy replays its commit when the remote moved on
+	if sha, err := s.gitops.HeadSHA(); err == nil {
+		commitSHA = sha
+	}
+
+	// Update deployment status
+	if err := s.finishDeployment(logger, app, version, deployment, "success", commitSHA, ""); err != nil {
+		logger.Error("Failed to update deployment status", "error", err)
+		return
+	}
+
+	if unchanged {
+		logger.Info("Deployment succeeded without changes", "app", app.Name, "version", version.VersionID, "commit", commitSHA)
+		return
+	}
+	logger.Info("Deployment succeeded", "app", app.Name, "version", version.VersionID, "commit", commitSHA)
+}
+
+// previewDeployment writes a version's manifests to the gitops working copy
+// like a deployment would and returns the resulting diff. The changes are
+// always discarded, so nothing is committed or pushed.
+func (s *Server) previewDeployment(ctx context.Context, app *models.Application, version *models.Version, environment string) (diff string, err error) {
+	// Fetch manifests from storage
+	manifests, err := s.fetchFiles(ctx, app, version.VersionID, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch manifests: %w", err)
+	}
+
+	if err := verifyChecksums(version.Checksums, manifests); err != nil {
+		return "", fmt.Errorf("checksum mismatch: %w", err)
+	}
+
+	manifests, err = prepareManifests(app, version, environment, manifests, s.tarballLimits)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare manifests: %w", err)
+	}
+
+	if err := s.gitops.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer s.gitops.Unlock()
+
+	if err := s.gitops.Clone(ctx); err != nil {
+		return "", fmt.Errorf("failed to clone gitops repo: %w", err)
+	}
+
+	// Leftover changes would end up in the next deployment's commit
+	defer func() {
+		if discardErr := s.gitops.Discard(); discardErr != nil && err == nil {
+			err = fmt.Errorf("failed to discard preview changes: %w", discardErr)
+		}
+	}()
+
+	if err := s.gitops.WriteManifests(app.Name, environment, version.VersionID, manifests); err != nil {
+		return "", fmt.Errorf("failed to write manifests: %w", err)
+	}
+
+	return s.gitops.Diff()
+}
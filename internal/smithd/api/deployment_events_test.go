@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestListDeploymentEvents_RecordsFailedStage(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = failingStorage{}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var deployResp models.DeployVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&deployResp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	s.runDeployment(<-s.deployQueue)
+
+	rec = doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/deployments/%s/events", app.ID, deployResp.DeploymentID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.ListDeploymentEventsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var stages []string
+	for _, event := range resp.Events {
+		stages = append(stages, event.Stage)
+	}
+	want := []string{"created", "started", "fetching_manifests", "failed"}
+	if fmt.Sprint(stages) != fmt.Sprint(want) {
+		t.Fatalf("expected stages %v, got %v", want, stages)
+	}
+	if msg := resp.Events[3].Message; msg != "Failed to fetch manifests: bucket unavailable" {
+		t.Errorf("expected the failure to be explained, got %q", msg)
+	}
+
+	// The deployment itself carries the same timeline
+	rec = doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/deployments/%s", app.ID, deployResp.DeploymentID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var deployment models.Deployment
+	if err := json.NewDecoder(rec.Body).Decode(&deployment); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(deployment.Events) != len(want) || deployment.Events[3].Stage != "failed" {
+		t.Errorf("expected the deployment to include its %d events, got %+v", len(want), deployment.Events)
+	}
+}
+
+func TestListDeploymentEvents_OtherApp(t *testing.T) {
+	s := newTestServer(t)
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	other, _ := createPublishedVersion(t, s, "other-api", "v1.0.0")
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	rec := doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/deployments/%s/events", other.ID, deployment.ID), nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
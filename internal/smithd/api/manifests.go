@@ -0,0 +1,177 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// manifestContentType returns the content type a stored file is served with
+func manifestContentType(filename string) string {
+	switch {
+	case strings.HasSuffix(filename, ".yaml"), strings.HasSuffix(filename, ".yml"):
+		return "application/x-yaml"
+	case strings.HasSuffix(filename, ".json"):
+		return "application/json"
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return "application/gzip"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// publishedVersion looks up the app and version of a manifests request,
+// writing an error response and returning false unless the version is
+// published
+func (s *Server) publishedVersion(w http.ResponseWriter, r *http.Request) (*models.Application, *models.Version, bool) {
+	appID := chi.URLParam(r, "appId")
+	versionID := chi.URLParam(r, "versionId")
+
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return nil, nil, false
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return nil, nil, false
+	}
+
+	version, err := s.versionStore.GetByVersionID(appID, versionID)
+	if err != nil {
+		if err.Error() == "version not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Version not found")
+			return nil, nil, false
+		}
+		requestLogger(r).Error("Failed to get version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
+		return nil, nil, false
+	}
+
+	if version.Status != "published" {
+		writeError(w, http.StatusBadRequest, "invalid_status", "Version must be published to read its manifests")
+		return nil, nil, false
+	}
+	if version.Publishing {
+		writeError(w, http.StatusConflict, "conflict", "Version is still being published")
+		return nil, nil, false
+	}
+
+	return app, version, true
+}
+
+// handleGetManifest streams a single file of a published version
+func (s *Server) handleGetManifest(w http.ResponseWriter, r *http.Request) {
+	filename := chi.URLParam(r, "filename")
+
+	app, version, ok := s.publishedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	// Check the file exists so a missing file is a 404 on every backend
+	files, err := s.storage.ListFiles(r.Context(), storageLocation(app), version.VersionID, true)
+	if err != nil {
+		requestLogger(r).Error("Failed to list manifest files", "error", err)
+		writeInternalError(w, err, "Failed to list manifest files")
+		return
+	}
+	found := false
+	for _, file := range files {
+		if file == filename {
+			found = true
+			break
+		}
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "not_found", "Manifest file not found")
+		return
+	}
+
+	body, err := s.storage.GetFile(r.Context(), storageLocation(app), version.VersionID, filename, true)
+	if err != nil {
+		requestLogger(r).Error("Failed to read manifest file", "file", filename, "error", err)
+		writeInternalError(w, err, "Failed to read manifest file")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", manifestContentType(filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		requestLogger(r).Error("Failed to send manifest file", "file", filename, "error", err)
+	}
+}
+
+// handleGetManifests sends every file of a published version as a tar.gz
+// archive when called with all=true
+func (s *Server) handleGetManifests(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("all") != "true" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Request a single manifest file, or all=true for an archive of every file")
+		return
+	}
+
+	app, version, ok := s.publishedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	// Read every file before responding, so a storage failure is still an
+	// error response
+	files, err := s.fetchFiles(r.Context(), app, version.VersionID, true)
+	if err != nil {
+		requestLogger(r).Error("Failed to read manifest files", "error", err)
+		writeInternalError(w, err, "Failed to read manifest files")
+		return
+	}
+
+	modTime := version.CreatedAt
+	if version.PublishedAt != nil {
+		modTime = *version.PublishedAt
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.tar.gz"`, app.Name, version.VersionID))
+	w.WriteHeader(http.StatusOK)
+	if err := writeManifestArchive(w, files, modTime); err != nil {
+		requestLogger(r).Error("Failed to send manifest archive", "error", err)
+	}
+}
+
+// writeManifestArchive writes files to w as a tar.gz archive in name order
+func writeManifestArchive(w io.Writer, files map[string][]byte, modTime time.Time) error {
+	gzWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	filenames := getKeys(files)
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		header := &tar.Header{
+			Name:    filename,
+			Mode:    0644,
+			Size:    int64(len(files[filename])),
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write header for %s: %w", filename, err)
+		}
+		if _, err := tarWriter.Write(files[filename]); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	return gzWriter.Close()
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestGetManifest(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{
+		"published/v1.0.0": {
+			"deployment.yaml": []byte(testDeploymentManifest),
+			"values.json":     []byte(`{"replicas": 2}`),
+		},
+	}}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	tests := []struct {
+		name        string
+		filename    string
+		wantStatus  int
+		contentType string
+		body        string
+	}{
+		{"yaml", "deployment.yaml", http.StatusOK, "application/x-yaml", testDeploymentManifest},
+		{"json", "values.json", http.StatusOK, "application/json", `{"replicas": 2}`},
+		{"missing", "service.yaml", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/manifests/%s", app.ID, tt.filename), nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, got)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetManifest_RequiresPublishedVersion(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{
+		"drafts/v1.0.0": {"deployment.yaml": []byte(testDeploymentManifest)},
+	}}
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+
+	for _, path := range []string{"manifests/deployment.yaml", "manifests?all=true"} {
+		rec := doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/%s", app.ID, path), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for a draft version, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestGetManifests_All(t *testing.T) {
+	s := newTestServer(t)
+	files := map[string][]byte{
+		"deployment.yaml": []byte(testDeploymentManifest),
+		"version.yml":     []byte("gitSha: abc123\n"),
+	}
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{"published/v1.0.0": files}}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/manifests", app.ID), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without all=true, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "GET", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/manifests?all=true", app.ID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/gzip" {
+		t.Errorf("expected application/gzip, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="my-api-v1.0.0.tar.gz"` {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+
+	extracted, err := s.extractTarball(io.NopCloser(rec.Body))
+	if err != nil {
+		t.Fatalf("failed to extract archive: %v", err)
+	}
+	if len(extracted) != len(files) {
+		t.Fatalf("expected %d files, got %v", len(files), getKeys(extracted))
+	}
+	for filename, data := range files {
+		if string(extracted[filename]) != string(data) {
+			t.Errorf("%s: expected %q, got %q", filename, data, extracted[filename])
+		}
+	}
+}
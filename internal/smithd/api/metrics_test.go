@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sorenmh/deploysmith/internal/smithd/metrics"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestMetrics_NoAuthRequired(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected Prometheus text format, got content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "smithd_publishes_total") {
+		t.Error("expected smithd metrics in the response")
+	}
+}
+
+func TestMetrics_CountsFailedDeployments(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	// The registry is global, so compare against the count before the test
+	failed := metrics.Deployments.WithLabelValues("failed")
+	before := testutil.ToFloat64(failed)
+
+	// Fill the queue so the second deploy is rejected
+	doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"})
+	if rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"}); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := testutil.ToFloat64(failed) - before; got != 1 {
+		t.Errorf("expected 1 failed deployment to be counted, got %v", got)
+	}
+}
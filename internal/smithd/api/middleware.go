@@ -1,12 +1,58 @@
 package api
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sorenmh/deploysmith/internal/smithd/config"
+	"github.com/sorenmh/deploysmith/internal/smithd/store"
 )
 
+// requestIDHeader carries the ID that ties together the log lines of a request
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the request context key holding the request ID
+type requestIDKey struct{}
+
+// RequestID middleware gives every request an ID, reusing the caller's
+// X-Request-ID if it sent one, and echoes it in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID of the request that ctx belongs to
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns a logger that tags every line with the request ID
+// and the app and version the request is about
+func requestLogger(r *http.Request) *slog.Logger {
+	logger := slog.Default().With("request_id", requestID(r.Context()))
+	if appID := chi.URLParam(r, "appId"); appID != "" {
+		logger = logger.With("app_id", appID)
+	}
+	if versionID := chi.URLParam(r, "versionId"); versionID != "" {
+		logger = logger.With("version_id", versionID)
+	}
+	return logger
+}
+
 // Logger middleware logs HTTP requests
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -17,13 +63,13 @@ func Logger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(rw, r)
 
-		log.Printf(
-			"%s %s %s %d %s",
-			r.Method,
-			r.RequestURI,
-			r.RemoteAddr,
-			rw.statusCode,
-			time.Since(start),
+		slog.Info("request",
+			"request_id", requestID(r.Context()),
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"remote_addr", r.RemoteAddr,
+			"status", rw.statusCode,
+			"duration", time.Since(start),
 		)
 	})
 }
@@ -39,8 +85,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// Auth middleware validates API keys
-func Auth(apiKeys []string) func(http.Handler) http.Handler {
+// apiKeyKey is the request context key holding the API key used
+type apiKeyKey struct{}
+
+// Auth middleware validates API keys. Handlers get the name of the key used
+// from apiKeyName, and RequireScope checks what the key may do.
+func Auth(apiKeys []config.APIKey) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get API key from header
@@ -51,30 +101,88 @@ func Auth(apiKeys []string) func(http.Handler) http.Handler {
 			}
 
 			// Validate API key
-			valid := false
-			for _, key := range apiKeys {
-				if key == apiKey {
-					valid = true
-					break
-				}
-			}
-
+			key, valid := config.ValidateAPIKey(apiKeys, apiKey)
 			if !valid {
 				writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid API key")
 				return
 			}
 
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+		})
+	}
+}
+
+// RequireScope middleware rejects requests whose API key lacks scope. It
+// must run after Auth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, _ := r.Context().Value(apiKeyKey{}).(config.APIKey)
+			if !key.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("API key is missing the %s scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResolveApp middleware lets the {appId} path segment name an application
+// instead of carrying its ID. A segment that isn't a UUID is looked up by
+// name and swapped for the app's ID, so handlers only ever see IDs.
+func ResolveApp(apps *store.ApplicationStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := chi.URLParam(r, "appId")
+			if name == "" || uuid.Validate(name) == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			app, err := apps.GetByName(name)
+			if err != nil {
+				if err.Error() == "application not found" {
+					writeError(w, http.StatusNotFound, "not_found", "Application not found")
+					return
+				}
+				requestLogger(r).Error("Failed to get application", "error", err)
+				writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+				return
+			}
+
+			params := &chi.RouteContext(r.Context()).URLParams
+			for i, key := range params.Keys {
+				if key == "appId" {
+					params.Values[i] = app.ID
+				}
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// apiKeyName returns the name of the API key that authenticated r
+func apiKeyName(r *http.Request) string {
+	key, _ := r.Context().Value(apiKeyKey{}).(config.APIKey)
+	return key.Name
+}
+
+// apiKeyHasScope reports whether the API key that authenticated r grants
+// scope, for handlers where only part of a request needs it
+func apiKeyHasScope(r *http.Request, scope string) bool {
+	key, _ := r.Context().Value(apiKeyKey{}).(config.APIKey)
+	return key.HasScope(scope)
+}
+
 // CORS middleware adds CORS headers
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -88,8 +196,8 @@ func CORS(next http.Handler) http.Handler {
 // ContentType middleware sets JSON content type
 func ContentType(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only set for non-OPTIONS requests
-		if r.Method != "OPTIONS" && !strings.HasPrefix(r.URL.Path, "/health") {
+		// Only set for non-OPTIONS requests; metrics use their own format
+		if r.Method != "OPTIONS" && !strings.HasPrefix(r.URL.Path, "/health") && r.URL.Path != "/metrics" {
 			w.Header().Set("Content-Type", "application/json")
 		}
 		next.ServeHTTP(w, r)
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sorenmh/deploysmith/internal/smithd/config"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+
+	// A new ID is generated when the caller doesn't send one
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if seen == "" || rec.Header().Get("X-Request-ID") != seen {
+		t.Errorf("expected generated ID %q to be echoed, got %q", seen, rec.Header().Get("X-Request-ID"))
+	}
+
+	// The caller's ID is reused
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "req-123" || rec.Header().Get("X-Request-ID") != "req-123" {
+		t.Errorf("expected caller's ID to be reused, got %q (header %q)", seen, rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestAutoDeploy_InheritsRequestLogger(t *testing.T) {
+	s := newTestServer(t)
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil)).With("request_id", "req-123")
+	s.autoDeployVersion(context.Background(), logger, app, version, createTestPolicy(t, s, app.ID, "auto-main", "staging"))
+
+	if !strings.Contains(buf.String(), "request_id=req-123") {
+		t.Errorf("expected auto-deploy logs to carry the request ID, got %q", buf.String())
+	}
+
+	// The deploy worker logs under the same request
+	select {
+	case job := <-s.deployQueue:
+		job.logger.Info("from worker")
+		if !strings.Contains(buf.String(), `msg="from worker" request_id=req-123 environment=staging policy=auto-main deployment_id=`+job.deployment.ID) {
+			t.Errorf("expected queued job to log under the request, got %q", buf.String())
+		}
+	default:
+		t.Fatal("expected deployment to be queued")
+	}
+}
+
+func TestAuth_HashedAndLegacyKeys(t *testing.T) {
+	hashed := sha256.Sum256([]byte("hashed-key"))
+	keys, err := config.ParseAPIKeys([]string{"legacy:legacy-key", "ci:sha256:" + hex.EncodeToString(hashed[:])})
+	if err != nil {
+		t.Fatalf("failed to parse API keys: %v", err)
+	}
+
+	var name string
+	handler := Auth(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name = apiKeyName(r)
+	}))
+
+	tests := []struct {
+		apiKey   string
+		wantCode int
+		wantName string
+	}{
+		{"legacy-key", http.StatusOK, "legacy"},
+		{"hashed-key", http.StatusOK, "ci"},
+		{"wrong-key", http.StatusUnauthorized, ""},
+		// The configured hash is not itself a key
+		{hex.EncodeToString(hashed[:]), http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		name = ""
+		req := httptest.NewRequest("GET", "/api/v1/apps", nil)
+		req.Header.Set("X-API-Key", tt.apiKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantCode || name != tt.wantName {
+			t.Errorf("%q: got status %d as %q, want %d as %q", tt.apiKey, rec.Code, name, tt.wantCode, tt.wantName)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	s := newTestServer(t)
+	keys, err := config.ParseAPIKeys([]string{"ci:" + testAPIKey, "dashboard:dash-key:apps:read"})
+	if err != nil {
+		t.Fatalf("failed to parse API keys: %v", err)
+	}
+	s.cfg.APIKeys = keys
+	s.router = chi.NewRouter()
+	s.setupRoutes()
+
+	do := func(method, path, apiKey string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name": "my-api"}`))
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Keys without scopes can do everything
+	if code := do("POST", "/api/v1/apps", testAPIKey); code != http.StatusCreated {
+		t.Errorf("expected unscoped key to register an app, got %d", code)
+	}
+
+	if code := do("GET", "/api/v1/apps", "dash-key"); code != http.StatusOK {
+		t.Errorf("expected apps:read key to list apps, got %d", code)
+	}
+	if code := do("POST", "/api/v1/apps", "dash-key"); code != http.StatusForbidden {
+		t.Errorf("expected apps:read key to be forbidden from registering, got %d", code)
+	}
+	if code := do("GET", "/api/v1/audit", "dash-key"); code != http.StatusForbidden {
+		t.Errorf("expected apps:read key to be forbidden from the audit log, got %d", code)
+	}
+}
+
+func TestRegisterApp_StorageBucketRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	keys, err := config.ParseAPIKeys([]string{"admin:" + testAPIKey, "ci:ci-key:apps:write"})
+	if err != nil {
+		t.Fatalf("failed to parse API keys: %v", err)
+	}
+	s.cfg.APIKeys = keys
+	s.router = chi.NewRouter()
+	s.setupRoutes()
+
+	do := func(body, apiKey string) int {
+		req := httptest.NewRequest("POST", "/api/v1/apps", strings.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(`{"name": "my-api", "storageBucket": "other-team"}`, "ci-key"); code != http.StatusForbidden {
+		t.Errorf("expected apps:write key to be forbidden from setting storageBucket, got %d", code)
+	}
+	if code := do(`{"name": "my-api", "storagePrefix": "team-a"}`, "ci-key"); code != http.StatusCreated {
+		t.Errorf("expected apps:write key to register an app in the default bucket, got %d", code)
+	}
+	if code := do(`{"name": "other-api", "storageBucket": "other-team"}`, testAPIKey); code != http.StatusCreated {
+		t.Errorf("expected admin key to set storageBucket, got %d", code)
+	}
+}
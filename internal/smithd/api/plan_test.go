@@ -0,0 +1,145 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestBuildDeploymentPlan(t *testing.T) {
+	deploymentYAML := "apiVersion: apps/v1\nkind: Deployment\n"
+	serviceYAML := "apiVersion: v1\nkind: Service\n"
+
+	manifests := map[string][]byte{
+		"service.yaml":    []byte(serviceYAML),
+		"deployment.yaml": []byte(deploymentYAML),
+	}
+
+	bundle := "s3://bucket/published/my-api/v1.0.0/"
+	plan := buildDeploymentPlan(bundle, "environments/production/apps/my-api", manifests)
+
+	if plan.Bundle != bundle {
+		t.Errorf("expected bundle %s, got %s", bundle, plan.Bundle)
+	}
+	if plan.GitopsPath != "environments/production/apps/my-api" {
+		t.Errorf("unexpected gitops path: %s", plan.GitopsPath)
+	}
+
+	expected := []struct{ path, content string }{
+		{"environments/production/apps/my-api/deployment.yaml", deploymentYAML},
+		{"environments/production/apps/my-api/service.yaml", serviceYAML},
+	}
+	if len(plan.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(plan.Files))
+	}
+	for i, want := range expected {
+		sum := sha256.Sum256([]byte(want.content))
+		if plan.Files[i].Path != want.path {
+			t.Errorf("file %d: expected path %s, got %s", i, want.path, plan.Files[i].Path)
+		}
+		if plan.Files[i].SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("file %d: hash mismatch", i)
+		}
+	}
+}
+
+func TestPrepareManifests_ExpandsTarball(t *testing.T) {
+	files := map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{
+			"deployment.yaml": "image: my-api:${GIT_SHA}\n",
+			"app.properties":  "greeting=${GREETING}\n",
+		}),
+	}
+
+	manifests, err := prepareManifests(&models.Application{Name: "my-api"}, &models.Version{VersionID: "v1.0.0"}, "production", files, gitops.TarballLimits{})
+	if err != nil {
+		t.Fatalf("prepareManifests failed: %v", err)
+	}
+
+	if len(manifests) != 2 || string(manifests["app.properties"]) != "greeting=${GREETING}\n" {
+		t.Fatalf("expected the manifest and the asset, got %v", manifests)
+	}
+	// Interpolation is opt-in, so placeholders are left alone
+	if string(manifests["deployment.yaml"]) != "image: my-api:${GIT_SHA}\n" {
+		t.Errorf("unexpected deployment.yaml: %q", manifests["deployment.yaml"])
+	}
+}
+
+func TestPrepareManifests_Interpolates(t *testing.T) {
+	app := &models.Application{Name: "my-api", InterpolateManifests: true}
+	version := &models.Version{VersionID: "42540c4-123", GitSHA: "42540c4", GitBranch: "main", BuildNumber: "123"}
+	files := map[string][]byte{
+		"deployment.yaml": []byte("sha: ${GIT_SHA}\nversion: ${VERSION}\nenv: ${ENVIRONMENT}\n"),
+	}
+
+	manifests, err := prepareManifests(app, version, "staging", files, gitops.TarballLimits{})
+	if err != nil {
+		t.Fatalf("prepareManifests failed: %v", err)
+	}
+
+	expected := "sha: 42540c4\nversion: 42540c4-123\nenv: staging\n"
+	if string(manifests["deployment.yaml"]) != expected {
+		t.Errorf("expected %q, got %q", expected, manifests["deployment.yaml"])
+	}
+}
+
+func TestPrepareManifests_EnvironmentVariables(t *testing.T) {
+	app := &models.Application{
+		Name:                 "my-api",
+		InterpolateManifests: true,
+		EnvironmentVariables: map[string]map[string]string{
+			"staging":    {"REPLICAS": "1"},
+			"production": {"REPLICAS": "3"},
+		},
+	}
+	files := map[string][]byte{"deployment.yaml": []byte("replicas: ${REPLICAS}\nenv: ${ENVIRONMENT}\n")}
+
+	for environment, expected := range map[string]string{
+		"staging":    "replicas: 1\nenv: staging\n",
+		"production": "replicas: 3\nenv: production\n",
+	} {
+		manifests, err := prepareManifests(app, &models.Version{VersionID: "v1"}, environment, files, gitops.TarballLimits{})
+		if err != nil {
+			t.Fatalf("prepareManifests failed: %v", err)
+		}
+		if string(manifests["deployment.yaml"]) != expected {
+			t.Errorf("expected %q for %s, got %q", expected, environment, manifests["deployment.yaml"])
+		}
+	}
+
+	// An environment without the variable fails instead of deploying the literal placeholder
+	if _, err := prepareManifests(app, &models.Version{VersionID: "v1"}, "canary", files, gitops.TarballLimits{}); err == nil {
+		t.Error("expected error for variable not set in canary")
+	}
+}
+
+func TestPrepareManifests_UnknownPlaceholder(t *testing.T) {
+	app := &models.Application{Name: "my-api", InterpolateManifests: true}
+	files := map[string][]byte{"deployment.yaml": []byte("sha: ${GIT_HASH}\n")}
+
+	if _, err := prepareManifests(app, &models.Version{VersionID: "v1"}, "staging", files, gitops.TarballLimits{}); err == nil {
+		t.Error("expected error for unknown placeholder")
+	}
+}
+
+func TestPrepareManifests_InvalidTarball(t *testing.T) {
+	files := map[string][]byte{"manifests.tar.gz": []byte("not a tarball")}
+
+	if _, err := prepareManifests(&models.Application{Name: "my-api"}, &models.Version{VersionID: "v1"}, "production", files, gitops.TarballLimits{}); err == nil {
+		t.Error("expected error for invalid tarball")
+	}
+}
+
+func TestPrepareManifests_NameClash(t *testing.T) {
+	files := map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": "kind: Deployment\n"}),
+		"deployment.yaml":  []byte("kind: Deployment\n"),
+	}
+
+	if _, err := prepareManifests(&models.Application{Name: "my-api"}, &models.Version{VersionID: "v1"}, "production", files, gitops.TarballLimits{}); err == nil {
+		t.Error("expected error for a tarball file overwriting an uploaded file")
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+// writeTestSSHKey writes a new SSH private key to dir and returns its path
+func writeTestSSHKey(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := cryptossh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyPath := filepath.Join(dir, name)
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return keyPath
+}
+
+// newTestGitops creates a gitops repo with one commit holding files and a
+// service working on a clone of it
+func newTestGitops(t *testing.T, files map[string]string) *gitops.Service {
+	t.Helper()
+	s, _ := newTestGitopsRemote(t, files)
+	return s
+}
+
+// newTestGitopsRemote creates a bare gitops repo holding files and a
+// gitops.Service for it, returning the service and the repo's path
+func newTestGitopsRemote(t *testing.T, files map[string]string) (*gitops.Service, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream")
+	repo, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	for path, content := range files {
+		full := filepath.Join(upstream, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		if _, err := worktree.Add(path); err != nil {
+			t.Fatalf("failed to add %s: %v", path, err)
+		}
+	}
+	_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// Pushes need a bare remote
+	remote := filepath.Join(dir, "gitops.git")
+	if _, err := git.PlainClone(remote, true, &git.CloneOptions{URL: upstream}); err != nil {
+		t.Fatalf("failed to create bare remote: %v", err)
+	}
+
+	return gitops.NewService(remote, writeTestSSHKey(t, dir, "key"), filepath.Join(dir, "work")), remote
+}
+
+func TestDeployVersion_DryRun(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+	s.gitops = newTestGitops(t, map[string]string{
+		"environments/production/apps/my-api/deployment.yaml": "replicas: 1\n",
+	})
+
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": "replicas: 3\n"}),
+	}
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	rec := doRequest(t, s, "POST", path+"?dryRun=true", models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var preview models.DeployPreviewResponse
+	if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !strings.Contains(preview.Diff, "-replicas: 1") || !strings.Contains(preview.Diff, "+replicas: 3") {
+		t.Errorf("expected diff to show the replica change, got:\n%s", preview.Diff)
+	}
+
+	// A dry run creates no deployment and leaves the working copy clean
+	if len(s.deployQueue) != 0 {
+		t.Fatalf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+	deployments, _, err := s.deploymentStore.List(app.ID, "", "", 50, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	if len(deployments) != 0 {
+		t.Fatalf("expected no deployments, got %d", len(deployments))
+	}
+	if diff, err := s.gitops.Diff(); err != nil || diff != "" {
+		t.Errorf("expected no leftover changes, got %q (%v)", diff, err)
+	}
+
+	// The real deploy commits with the previewed message
+	rec = doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	job := <-s.deployQueue
+	if preview.CommitMessage != job.commitMessage {
+		t.Errorf("expected preview %q to match commit message %q", preview.CommitMessage, job.commitMessage)
+	}
+}
+
+func TestDeployVersion_DryRunErrorCodes(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": "replicas: 3\n"}),
+	}
+	dir := t.TempDir()
+	unreachable := gitops.NewService(filepath.Join(dir, "missing"), writeTestSSHKey(t, dir, "key"), filepath.Join(dir, "work"))
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy?dryRun=true", app.ID)
+
+	tests := []struct {
+		name    string
+		storage storage.Storage
+		want    string
+	}{
+		{"storage unavailable", failingStorage{}, "storage_error"},
+		{"gitops clone fails", mem, "gitops_clone_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.storage = tt.storage
+			s.gitops = unreachable
+
+			rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "production"})
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Error.Code != tt.want {
+				t.Errorf("expected code %s, got %s (%s)", tt.want, resp.Error.Code, resp.Error.Message)
+			}
+		})
+	}
+}
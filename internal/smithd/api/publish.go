@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
+)
+
+// finishPublish moves a version marked published out of drafts and clears
+// its publishing flag. It picks up where an interrupted move stopped, so it
+// is safe to repeat.
+func (s *Server) finishPublish(ctx context.Context, app *models.Application, version *models.Version) error {
+	loc := storageLocation(app)
+
+	drafts, err := s.storage.ListFiles(ctx, loc, version.VersionID, false)
+	if err != nil {
+		return fmt.Errorf("failed to list draft files: %w", err)
+	}
+
+	if len(drafts) > 0 {
+		// A move interrupted after every file was published only has its
+		// drafts left to delete; moving those would publish a partial version
+		if s.fullyPublished(ctx, loc, version) {
+			err = s.storage.DeleteVersion(ctx, loc, version.VersionID, false)
+		} else {
+			err = s.storage.MoveVersion(ctx, loc, version.VersionID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move version to published: %w", err)
+		}
+	}
+
+	return s.versionStore.FinishPublish(version.ID)
+}
+
+// fullyPublished reports whether every file recorded at publish is in the
+// published location
+func (s *Server) fullyPublished(ctx context.Context, loc storage.Location, version *models.Version) bool {
+	if len(version.Checksums) == 0 {
+		return false
+	}
+
+	// Nothing has been published yet if the published version can't be listed
+	files, err := s.storage.ListFiles(ctx, loc, version.VersionID, true)
+	if err != nil {
+		return false
+	}
+
+	published := make(map[string]bool, len(files))
+	for _, filename := range files {
+		published[filename] = true
+	}
+	for filename := range version.Checksums {
+		if !published[filename] {
+			return false
+		}
+	}
+	return true
+}
+
+// resumePublishes finishes publishes interrupted, e.g. by a restart, between
+// marking their version published and moving its files out of drafts
+func (s *Server) resumePublishes(ctx context.Context) {
+	versions, err := s.versionStore.ListPublishing()
+	if err != nil {
+		slog.Error("Failed to list interrupted publishes", "error", err)
+		return
+	}
+
+	for _, v := range versions {
+		logger := slog.With("app_id", v.AppID, "version_id", v.VersionID)
+
+		app, err := s.appStore.GetByID(v.AppID)
+		if err != nil {
+			logger.Error("Failed to resume publish", "error", err)
+			continue
+		}
+		version, err := s.versionStore.GetByVersionID(v.AppID, v.VersionID)
+		if err != nil {
+			logger.Error("Failed to resume publish", "error", err)
+			continue
+		}
+
+		if err := s.finishPublish(ctx, app, version); err != nil {
+			logger.Error("Failed to resume publish", "error", err)
+			continue
+		}
+		logger.Info("Resumed interrupted publish")
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// newInterruptedPublish creates a version marked published whose files are
+// still in drafts, as left by a publish that stopped before moving them
+func newInterruptedPublish(t *testing.T, s *Server, mem *memoryStorage, files map[string][]byte) *models.Application {
+	t.Helper()
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	version, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = files
+	if err := s.versionStore.Publish(version.ID, fileChecksums(files)); err != nil {
+		t.Fatalf("failed to publish version: %v", err)
+	}
+
+	return app
+}
+
+func assertPublishFinished(t *testing.T, s *Server, mem *memoryStorage, app *models.Application, files []string) {
+	t.Helper()
+
+	if drafts := mem.files["drafts/v1.0.0"]; len(drafts) != 0 {
+		t.Errorf("expected drafts to be moved, got %v", getKeys(drafts))
+	}
+	for _, filename := range files {
+		if _, ok := mem.files["published/v1.0.0"][filename]; !ok {
+			t.Errorf("expected %s to be published", filename)
+		}
+	}
+
+	version, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	if version.Status != "published" || version.Publishing {
+		t.Errorf("expected a finished publish, got status %q publishing %v", version.Status, version.Publishing)
+	}
+}
+
+func TestResumePublishes_AfterCrash(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	// The process died after the version was marked published
+	app := newInterruptedPublish(t, s, mem, map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": testDeploymentManifest}),
+	})
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while publishing, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// On restart the move is finished
+	s.resumePublishes(context.Background())
+
+	assertPublishFinished(t, s, mem, app, []string{"manifests.tar.gz"})
+}
+
+func TestPublishVersion_ResumesPartialMove(t *testing.T) {
+	tarball := createTestTarball(t, map[string]string{"deployment.yaml": testDeploymentManifest})
+	values := []byte("replicas: 2\n")
+
+	tests := []struct {
+		name      string
+		published map[string][]byte
+	}{
+		{
+			name:      "some files moved",
+			published: map[string][]byte{"manifests.tar.gz": tarball},
+		},
+		{
+			name:      "drafts left behind",
+			published: map[string][]byte{"manifests.tar.gz": tarball, "values.yaml": values},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			mem := &memoryStorage{files: map[string]map[string][]byte{}}
+			s.storage = mem
+
+			app := newInterruptedPublish(t, s, mem, map[string][]byte{"manifests.tar.gz": tarball, "values.yaml": values})
+			mem.files["published/v1.0.0"] = tt.published
+			delete(mem.files["drafts/v1.0.0"], "manifests.tar.gz")
+
+			rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			assertPublishFinished(t, s, mem, app, []string{"manifests.tar.gz", "values.yaml"})
+
+			// Publishing a finished version is still a conflict
+			rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+			if rec.Code != http.StatusConflict {
+				t.Errorf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
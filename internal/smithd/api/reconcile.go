@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// checkDrift compares an environment's directory in the gitops repo with
+// what deploying version there would write. Nothing is committed or pushed.
+func (s *Server) checkDrift(ctx context.Context, app *models.Application, version *models.Version, environment string) (resp *models.ReconcileResponse, err error) {
+	manifests, err := s.fetchFiles(ctx, app, version.VersionID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifests: %w", err)
+	}
+
+	if err := verifyChecksums(version.Checksums, manifests); err != nil {
+		return nil, fmt.Errorf("checksum mismatch: %w", err)
+	}
+
+	manifests, err = prepareManifests(app, version, environment, manifests, s.tarballLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare manifests: %w", err)
+	}
+
+	if err := s.gitops.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.gitops.Unlock()
+
+	if err := s.gitops.Clone(ctx); err != nil {
+		return nil, fmt.Errorf("failed to clone gitops repo: %w", err)
+	}
+
+	actual, err := s.gitops.ReadManifests(app.Name, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leftover changes would end up in the next deployment's commit
+	defer func() {
+		if discardErr := s.gitops.Discard(); discardErr != nil && err == nil {
+			err = fmt.Errorf("failed to discard reconcile changes: %w", discardErr)
+		}
+	}()
+
+	if err := s.gitops.WriteManifests(app.Name, environment, version.VersionID, manifests); err != nil {
+		return nil, fmt.Errorf("failed to write manifests: %w", err)
+	}
+	// Writing manifests leaves other files alone, so files added by hand
+	// are only found by removing them
+	extra, err := s.gitops.RemoveOtherFiles(app.Name, environment, manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for extra files: %w", err)
+	}
+
+	diff, err := s.gitops.Diff()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReconcileResponse{
+		Environment:    environment,
+		VersionID:      version.VersionID,
+		GitopsPath:     s.gitops.AppPath(app.Name, environment),
+		InSync:         diff == "",
+		ExpectedImages: gitops.Images(manifests),
+		ActualImages:   gitops.Images(actual),
+		ExtraFiles:     extra,
+		Diff:           diff,
+	}, nil
+}
+
+// handleReconcile reports whether the gitops repo still holds what was last
+// deployed to an environment, and with repair set redeploys it if not
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	environment := chi.URLParam(r, "environment")
+
+	// The request body is optional
+	var req models.ReconcileRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	if s.rejectUnknownEnvironment(w, environment) {
+		return
+	}
+
+	// Verify application exists
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// Compare against the deployment the database records as current
+	current, err := s.appStore.GetCurrentVersions(appID)
+	if err != nil {
+		requestLogger(r).Error("Failed to get current versions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get current versions")
+		return
+	}
+	deployed, ok := current[environment]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("No successful deployment in %s", environment))
+		return
+	}
+
+	version, err := s.versionStore.GetByVersionID(appID, deployed.VersionID)
+	if err != nil {
+		requestLogger(r).Error("Failed to get version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
+		return
+	}
+
+	logger := requestLogger(r).With("environment", environment, "version_id", version.VersionID)
+
+	resp, err := s.checkDrift(r.Context(), app, version, environment)
+	if err != nil {
+		logger.Error("Failed to check gitops drift", "error", err)
+		writeInternalError(w, err, "Failed to check gitops drift")
+		return
+	}
+	resp.DeploymentID = deployed.DeploymentID
+
+	if !resp.InSync {
+		logger.Warn("Gitops repo has drifted from the current deployment", "gitops_path", resp.GitopsPath)
+	}
+
+	if req.Repair && !resp.InSync {
+		// Ask the deploy policy, if configured
+		decision, err := s.checkDeployPolicy(r.Context(), app, version, environment, "reconcile")
+		if err != nil {
+			logger.Error("Failed to evaluate deploy policy", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to evaluate deploy policy")
+			return
+		}
+		if !decision.Allow {
+			writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Deploy denied by policy: %s", decision.Reason))
+			return
+		}
+
+		// Redeploying the recorded version writes its manifests back
+		deployment, err := s.deploymentStore.Create(appID, version.ID, environment, "reconcile", nil)
+		if err != nil {
+			logger.Error("Failed to create deployment", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+			return
+		}
+		s.recordEvent(logger, deployment.ID, "created", "Repair gitops drift")
+
+		commitMessage := s.commitMessage(gitops.CommitMessageData{
+			App:         app.Name,
+			Version:     version.VersionID,
+			Environment: environment,
+			TriggeredBy: "reconcile",
+			Action:      "reconcile",
+			Message:     fmt.Sprintf("Reconcile %s in %s with version %s", app.Name, environment, version.VersionID),
+		})
+
+		// Protected environments wait for approval, repairs included
+		if app.RequiresApproval(environment) {
+			if err := s.deploymentStore.HoldForApproval(deployment.ID, commitMessage); err != nil {
+				logger.Error("Failed to hold deployment for approval", "error", err)
+				s.finishDeployment(logger, app, version, deployment, "failed", "", err.Error())
+				writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+				return
+			}
+			s.recordEvent(logger, deployment.ID, "awaiting_approval", "")
+			deployment.Status = "pending_approval"
+		} else {
+			// Hand the gitops work to the deploy workers
+			err = s.enqueueDeployment(deployJob{
+				app:           app,
+				version:       version,
+				deployment:    deployment,
+				commitMessage: commitMessage,
+				removeOther:   true,
+				logger:        logger,
+			})
+			if err != nil {
+				logger.Error("Failed to queue deployment", "error", err)
+				s.finishDeployment(logger, app, version, deployment, "failed", "", err.Error())
+				writeQueueError(w, err)
+				return
+			}
+		}
+
+		s.audit(r, "deployment.reconcile", appID, deployment.ID)
+
+		resp.Repair = &models.DeployVersionResponse{
+			DeploymentID: deployment.ID,
+			VersionID:    version.VersionID,
+			Environment:  environment,
+			Status:       deployment.Status,
+			StartedAt:    deployment.StartedAt,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
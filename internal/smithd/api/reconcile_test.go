@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+const reconcileManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-api
+spec:
+  template:
+    spec:
+      containers:
+        - name: api
+          image: registry.example.com/my-api:%s
+`
+
+// newReconcileServer records v2 as deployed to production, with the gitops
+// repo holding the manifest for gitopsImage and any extra files
+func newReconcileServer(t *testing.T, gitopsImage string, extra map[string]string) (*Server, *models.Application) {
+	t.Helper()
+
+	s := newTestServer(t)
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{
+		"published/v2": {"deployment.yaml": []byte(fmt.Sprintf(reconcileManifest, "v2"))},
+	}}
+	files := map[string]string{
+		"environments/production/apps/my-api/deployment.yaml": fmt.Sprintf(reconcileManifest, gitopsImage),
+	}
+	for filename, content := range extra {
+		files["environments/production/apps/my-api/"+filename] = content
+	}
+	s.gitops = newTestGitops(t, files)
+
+	app, version := createPublishedVersion(t, s, "my-api", "v2")
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", "abc123", ""); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	return s, app
+}
+
+func doReconcile(t *testing.T, s *Server, app *models.Application, req models.ReconcileRequest) models.ReconcileResponse {
+	t.Helper()
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/environments/production/reconcile", app.ID), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.ReconcileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestReconcile_InSync(t *testing.T) {
+	s, app := newReconcileServer(t, "v2", nil)
+
+	resp := doReconcile(t, s, app, models.ReconcileRequest{Repair: true})
+	if !resp.InSync || resp.Diff != "" || resp.Repair != nil {
+		t.Errorf("expected no drift and no repair, got %+v", resp)
+	}
+	if resp.VersionID != "v2" || resp.GitopsPath != "environments/production/apps/my-api" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if len(s.deployQueue) != 0 {
+		t.Errorf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+}
+
+func TestReconcile_ReportsDrift(t *testing.T) {
+	s, app := newReconcileServer(t, "v1-hotfix", nil)
+
+	resp := doReconcile(t, s, app, models.ReconcileRequest{})
+	if resp.InSync || resp.Diff == "" {
+		t.Fatalf("expected drift, got %+v", resp)
+	}
+	if want := []string{"registry.example.com/my-api:v2"}; !reflect.DeepEqual(resp.ExpectedImages, want) {
+		t.Errorf("expected images %v, got %v", want, resp.ExpectedImages)
+	}
+	if want := []string{"registry.example.com/my-api:v1-hotfix"}; !reflect.DeepEqual(resp.ActualImages, want) {
+		t.Errorf("expected actual images %v, got %v", want, resp.ActualImages)
+	}
+
+	// Without repair nothing is deployed, and the working copy is left clean
+	if resp.Repair != nil || len(s.deployQueue) != 0 {
+		t.Errorf("expected no repair without repair set, got %+v", resp.Repair)
+	}
+	if diff, err := s.gitops.Diff(); err != nil || diff != "" {
+		t.Errorf("expected no leftover changes, got %q (%v)", diff, err)
+	}
+}
+
+func TestReconcile_Repair(t *testing.T) {
+	s, app := newReconcileServer(t, "v1-hotfix", nil)
+
+	resp := doReconcile(t, s, app, models.ReconcileRequest{Repair: true})
+	if resp.Repair == nil || resp.Repair.VersionID != "v2" || resp.Repair.Status != "pending" {
+		t.Fatalf("expected a pending redeploy of v2, got %+v", resp.Repair)
+	}
+
+	job := <-s.deployQueue
+	if job.deployment.ID != resp.Repair.DeploymentID || job.deployment.TriggeredBy != "reconcile" {
+		t.Errorf("expected the repair deployment to be queued, got %+v", job.deployment)
+	}
+	if job.commitMessage != "Reconcile my-api in production with version v2" {
+		t.Errorf("unexpected commit message %q", job.commitMessage)
+	}
+}
+
+func TestReconcile_ExtraFiles(t *testing.T) {
+	s, app := newReconcileServer(t, "v2", map[string]string{"debug-pod.yaml": "kind: Pod\n"})
+
+	resp := doReconcile(t, s, app, models.ReconcileRequest{Repair: true})
+	if resp.InSync || !strings.Contains(resp.Diff, "-kind: Pod") {
+		t.Fatalf("expected a file added by hand to be drift, got %+v", resp)
+	}
+	if want := []string{"debug-pod.yaml"}; !reflect.DeepEqual(resp.ExtraFiles, want) {
+		t.Errorf("expected extra files %v, got %v", want, resp.ExtraFiles)
+	}
+	if resp.Repair == nil {
+		t.Fatal("expected a repair deployment")
+	}
+
+	// The repair removes the file from the gitops repo
+	s.runDeployment(<-s.deployQueue)
+	deployment, err := s.deploymentStore.GetByID(resp.Repair.DeploymentID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if deployment.Status != "success" {
+		t.Fatalf("expected the repair to succeed, got %s: %s", deployment.Status, deployment.ErrorMessage)
+	}
+
+	resp = doReconcile(t, s, app, models.ReconcileRequest{})
+	if !resp.InSync || len(resp.ExtraFiles) != 0 {
+		t.Errorf("expected no drift after the repair, got %+v", resp)
+	}
+}
+
+func TestReconcile_NoDeployment(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/environments/production/reconcile", app.ID), nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
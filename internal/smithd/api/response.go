@@ -2,7 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
 )
 
 // ErrorResponse represents an API error response
@@ -10,6 +15,8 @@ type ErrorResponse struct {
 	Error struct {
 		Code    string `json:"code"`
 		Message string `json:"message"`
+		// Details lists every problem for validation_failed errors
+		Details []models.ValidationIssue `json:"details,omitempty"`
 	} `json:"error"`
 }
 
@@ -28,3 +35,38 @@ func writeError(w http.ResponseWriter, status int, code, message string) {
 	resp.Error.Message = message
 	writeJSON(w, status, resp)
 }
+
+// writeInternalError writes a 500 response whose code tells which backend
+// err came from, so clients can tell an unreachable bucket from a rejected
+// gitops push
+func writeInternalError(w http.ResponseWriter, err error, message string) {
+	writeError(w, http.StatusInternalServerError, errorCode(err), message)
+}
+
+// errorCode returns the error code for a failure in the storage or gitops
+// backend, or internal_error for anything else
+func errorCode(err error) string {
+	var storageErr *storage.Error
+	switch {
+	case errors.As(err, &storageErr):
+		return "storage_error"
+	case errors.Is(err, gitops.ErrCloneFailed):
+		return "gitops_clone_failed"
+	case errors.Is(err, gitops.ErrPushRejected):
+		return "gitops_push_rejected"
+	case errors.Is(err, gitops.ErrPushFailed):
+		return "gitops_push_failed"
+	default:
+		return "internal_error"
+	}
+}
+
+// writeValidationError writes a 400 validation_failed response with every
+// issue in details and the first one as the message
+func writeValidationError(w http.ResponseWriter, issues []models.ValidationIssue) {
+	resp := ErrorResponse{}
+	resp.Error.Code = "validation_failed"
+	resp.Error.Message = issues[0].Message
+	resp.Error.Details = issues
+	writeJSON(w, http.StatusBadRequest, resp)
+}
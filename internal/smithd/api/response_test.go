@@ -0,0 +1,28 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed to fetch manifests: %w", &storage.Error{Err: errors.New("connection refused")}), "storage_error"},
+		{fmt.Errorf("%w: failed to pull: timeout", gitops.ErrCloneFailed), "gitops_clone_failed"},
+		{fmt.Errorf("%w: non-fast-forward update", gitops.ErrPushRejected), "gitops_push_rejected"},
+		{fmt.Errorf("%w: connection reset", gitops.ErrPushFailed), "gitops_push_failed"},
+		{errors.New("database is locked"), "internal_error"},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
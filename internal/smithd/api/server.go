@@ -1,20 +1,36 @@
 package api
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/sorenmh/deploysmith/internal/shared/manifest"
 	"github.com/sorenmh/deploysmith/internal/smithd/config"
 	"github.com/sorenmh/deploysmith/internal/smithd/db"
 	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/metrics"
 	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/notify"
+	"github.com/sorenmh/deploysmith/internal/smithd/opa"
 	"github.com/sorenmh/deploysmith/internal/smithd/storage"
 	"github.com/sorenmh/deploysmith/internal/smithd/store"
 	"github.com/go-chi/chi/v5"
@@ -30,18 +46,57 @@ type Server struct {
 	versionStore    *store.VersionStore
 	deploymentStore *store.DeploymentStore
 	policyStore     *store.PolicyStore
-	storage         *storage.S3Storage
+	auditStore      *store.AuditStore
+	storage         storage.Storage
 	gitops          *gitops.Service
+	deployQueue     chan deployJob
+	deployPolicy    *opa.Client
+	notifier        notify.Notifier
+
+	// deploymentEventStore records the timeline of each deployment
+	deploymentEventStore *store.DeploymentEventStore
+
+	// queueMu guards closing deployQueue, which Shutdown does once
+	// queueClosed is set, and workers tracks the deploy workers
+	queueMu     sync.RWMutex
+	queueClosed bool
+	workers     sync.WaitGroup
+
+	// instanceID identifies this smithd process as the owner of the
+	// deployments it queues
+	instanceID string
+
+	// commitTemplate formats gitops commit messages; nil uses the defaults
+	commitTemplate *template.Template
+
+	// tarballLimits caps what extractTarball reads from manifests.tar.gz
+	tarballLimits gitops.TarballLimits
+
+	// baseCtx is cancelled by Shutdown, stopping requests and deployments
+	// still in progress
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
+	httpServer *http.Server
+	// redirectServer sends plain HTTP to HTTPS when HTTPRedirectPort is set
+	redirectServer *http.Server
 }
 
 // NewServer creates a new HTTP server
 func NewServer(cfg *config.Config, database *db.DB) *Server {
-	s3Storage, err := storage.NewS3Storage(cfg.S3Bucket, cfg.S3Region, cfg.AWSEndpoint)
+	versionStorage, err := newStorage(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 storage: %v", err)
+		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	gitopsService := gitops.NewService(cfg.GitopsRepo, cfg.GitopsSSHKeyPath)
+	limits := gitops.TarballLimits{
+		MaxSize:     int64(cfg.TarballMaxSizeMB) << 20,
+		MaxFileSize: int64(cfg.TarballMaxFileSizeMB) << 20,
+		MaxFiles:    cfg.TarballMaxFiles,
+	}
+	gitopsService := gitops.NewService(cfg.GitopsRepo, cfg.GitopsSSHKeyPath, cfg.GitopsWorkDir)
+	gitopsService.SetCloneDepth(cfg.GitopsCloneDepth)
+	gitopsService.SetPathTemplate(cfg.GitopsPathTemplate)
+	gitopsService.SetTarballLimits(limits)
 
 	s := &Server{
 		cfg:             cfg,
@@ -51,17 +106,86 @@ func NewServer(cfg *config.Config, database *db.DB) *Server {
 		versionStore:    store.NewVersionStore(database.DB),
 		deploymentStore: store.NewDeploymentStore(database.DB),
 		policyStore:     store.NewPolicyStore(database.DB),
-		storage:         s3Storage,
+		auditStore:      store.NewAuditStore(database.DB),
+		storage:         versionStorage,
 		gitops:          gitopsService,
+		deployQueue:     make(chan deployJob, deployQueueSize),
+		notifier:        notify.Nop{},
+
+		deploymentEventStore: store.NewDeploymentEventStore(database.DB),
+		instanceID:           newInstanceID(),
+
+		tarballLimits: limits,
+	}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+
+	if cfg.OPAURL != "" {
+		s.deployPolicy = opa.NewClient(cfg.OPAURL)
+	}
+
+	if cfg.SlackWebhookURL != "" {
+		s.notifier = notify.NewSlack(cfg.SlackWebhookURL)
+	}
+
+	if cfg.GitopsCommitTemplate != "" {
+		s.commitTemplate, err = gitops.ParseCommitTemplate(cfg.GitopsCommitTemplate)
+		if err != nil {
+			log.Fatalf("Invalid GITOPS_COMMIT_TEMPLATE: %v", err)
+		}
 	}
 
 	s.setupRoutes()
+	s.failExpiredDeployments(time.Now().Add(-deploymentLease))
+	s.startDeployWorkers(cfg.DeployWorkers)
+	go s.runDeploymentLeases(s.baseCtx)
+	go s.resumePublishes(s.baseCtx)
 	return s
 }
 
+// newInstanceID returns an ID for this process that is unique across
+// restarts and replicas, starting with the host name for debugging
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "smithd"
+	}
+	return hostname + "-" + uuid.New().String()[:8]
+}
+
+// newStorage creates the version storage backend selected by cfg.StorageType
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	opts := storage.S3Options{
+		Region:          cfg.S3Region,
+		Endpoint:        cfg.AWSEndpoint,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+		SessionToken:    cfg.AWSSessionToken,
+	}
+	if cfg.S3ForcePathStyle != "" {
+		forcePathStyle := cfg.S3ForcePathStyle == "true"
+		opts.ForcePathStyle = &forcePathStyle
+	}
+
+	s3Storage, err := storage.NewS3Storage(cfg.S3Bucket, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s3Storage.SetPublishedStorageClass(cfg.S3PublishedStorageClass); err != nil {
+		return nil, err
+	}
+
+	if cfg.StorageType == "oci" {
+		return storage.NewOCIStorage(s3Storage, cfg.OCIRegistry, cfg.OCIRepository, cfg.OCIUsername, cfg.OCIPassword, cfg.OCIPlainHTTP)
+	}
+
+	return s3Storage, nil
+}
+
 // setupRoutes configures all HTTP routes
 func (s *Server) setupRoutes() {
 	// Global middleware
+	s.router.Use(RequestID)
 	s.router.Use(Logger)
 	s.router.Use(CORS)
 	s.router.Use(ContentType)
@@ -69,36 +193,153 @@ func (s *Server) setupRoutes() {
 	// Health check (no auth required)
 	s.router.Get("/health", s.handleHealth)
 
-	// API routes (auth required)
+	// Prometheus metrics (no auth required)
+	s.router.Handle("/metrics", metrics.Handler())
+
+	// API routes (auth required, and each route needs a scope on the key)
 	s.router.Route("/api/v1", func(r chi.Router) {
 		r.Use(Auth(s.cfg.APIKeys))
 
+		// {appId} may be an app's name as well as its ID
+		apps := ResolveApp(s.appStore)
+
 		// Application routes
-		r.Post("/apps", s.handleRegisterApp)
-		r.Get("/apps", s.handleListApps)
-		r.Get("/apps/{appId}", s.handleGetApp)
+		r.With(RequireScope(config.ScopeAppsWrite)).Post("/apps", s.handleRegisterApp)
+		r.With(RequireScope(config.ScopeAppsRead)).Get("/apps", s.handleListApps)
+		r.With(RequireScope(config.ScopeAppsRead), apps).Get("/apps/{appId}", s.handleGetApp)
+		r.With(RequireScope(config.ScopeAppsWrite), apps).Delete("/apps/{appId}", s.handleDeleteApp)
+		r.With(RequireScope(config.ScopeAppsWrite), apps).Put("/apps/{appId}/environments/{environment}/variables", s.handleSetVariables)
+		r.With(RequireScope(config.ScopeAppsWrite), apps).Put("/apps/{appId}/environments/{environment}/approval", s.handleSetApproval)
 
 		// Version routes
-		r.Post("/apps/{appId}/versions/draft", s.handleDraftVersion)
-		r.Post("/apps/{appId}/versions/{versionId}/publish", s.handlePublishVersion)
-		r.Get("/apps/{appId}/versions", s.handleListVersions)
-		r.Get("/apps/{appId}/versions/{versionId}", s.handleGetVersion)
+		r.With(RequireScope(config.ScopeVersionsWrite), apps).Post("/apps/{appId}/versions/draft", s.handleDraftVersion)
+		r.With(RequireScope(config.ScopeVersionsWrite), apps).Post("/apps/{appId}/versions/{versionId}/publish", s.handlePublishVersion)
+		r.With(RequireScope(config.ScopeVersionsRead), apps).Get("/apps/{appId}/versions", s.handleListVersions)
+		r.With(RequireScope(config.ScopeVersionsRead), apps).Get("/apps/{appId}/versions/{versionId}", s.handleGetVersion)
+		r.With(RequireScope(config.ScopeVersionsRead), apps).Get("/apps/{appId}/versions/{versionId}/manifests", s.handleGetManifests)
+		r.With(RequireScope(config.ScopeVersionsRead), apps).Get("/apps/{appId}/versions/{versionId}/manifests/{filename}", s.handleGetManifest)
+		r.With(RequireScope(config.ScopeVersionsWrite), apps).Delete("/apps/{appId}/versions/{versionId}", s.handleDeleteVersion)
 
 		// Deployment routes
-		r.Post("/apps/{appId}/versions/{versionId}/deploy", s.handleDeployVersion)
+		r.With(RequireScope(config.ScopeDeploy), apps).Post("/apps/{appId}/versions/{versionId}/deploy", s.handleDeployVersion)
+		r.With(RequireScope(config.ScopeDeploy), apps).Post("/apps/{appId}/rollback", s.handleRollback)
+		r.With(RequireScope(config.ScopeDeploymentsRead), apps).Get("/apps/{appId}/deployments", s.handleListDeployments)
+		r.With(RequireScope(config.ScopeDeploymentsRead), apps).Get("/apps/{appId}/deployments/{deploymentId}", s.handleGetDeployment)
+		r.With(RequireScope(config.ScopeDeploymentsRead), apps).Get("/apps/{appId}/deployments/{deploymentId}/events", s.handleListDeploymentEvents)
+		r.With(RequireScope(config.ScopeDeploymentsApprove), apps).Post("/apps/{appId}/deployments/{deploymentId}/approve", s.handleApproveDeployment)
 
 		// Policy routes
-		r.Post("/apps/{appId}/policies", s.handleCreatePolicy)
-		r.Get("/apps/{appId}/policies", s.handleListPolicies)
-		r.Delete("/apps/{appId}/policies/{policyId}", s.handleDeletePolicy)
+		r.With(RequireScope(config.ScopePoliciesWrite), apps).Post("/apps/{appId}/policies", s.handleCreatePolicy)
+		r.With(RequireScope(config.ScopePoliciesRead), apps).Get("/apps/{appId}/policies", s.handleListPolicies)
+		r.With(RequireScope(config.ScopePoliciesWrite), apps).Patch("/apps/{appId}/policies/{policyId}", s.handleUpdatePolicy)
+		r.With(RequireScope(config.ScopePoliciesWrite), apps).Delete("/apps/{appId}/policies/{policyId}", s.handleDeletePolicy)
+
+		// Environment routes
+		r.With(RequireScope(config.ScopeAppsRead)).Get("/environments", s.handleListEnvironments)
+
+		// Audit routes
+		r.With(RequireScope(config.ScopeAuditRead)).Get("/audit", s.handleListAudit)
+
+		// Admin routes
+		r.With(RequireScope(config.ScopeAdmin)).Post("/admin/gitops/credentials/reload", s.handleReloadGitopsCredentials)
+		r.With(RequireScope(config.ScopeAdmin), apps).Post("/apps/{appId}/environments/{environment}/reconcile", s.handleReconcile)
 	})
 }
 
-// Start starts the HTTP server
+// Start starts the HTTP server, serving HTTPS when a TLS certificate is
+// configured. It returns nil once Shutdown is called.
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%s", s.cfg.Port)
-	log.Printf("Starting server on %s", addr)
-	return http.ListenAndServe(addr, s.router)
+	s.httpServer = &http.Server{
+		Addr:        addr,
+		Handler:     s.router,
+		BaseContext: func(net.Listener) context.Context { return s.baseCtx },
+	}
+
+	var err error
+	if s.cfg.TLSEnabled() {
+		if err := s.startRedirect(); err != nil {
+			return err
+		}
+		slog.Info("Starting server", "addr", addr, "tls", true)
+		err = s.httpServer.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	} else {
+		slog.Info("Starting server", "addr", addr, "tls", false)
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if s.redirectServer != nil {
+			s.redirectServer.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// startRedirect starts redirecting plain HTTP to HTTPS if HTTPRedirectPort
+// is set. The port is bound before returning so a conflict fails Start.
+func (s *Server) startRedirect() error {
+	if s.cfg.HTTPRedirectPort == "" {
+		return nil
+	}
+
+	addr := fmt.Sprintf(":%s", s.cfg.HTTPRedirectPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for HTTP redirects: %w", err)
+	}
+	s.redirectServer = &http.Server{
+		Addr:              addr,
+		Handler:           redirectToHTTPS(s.cfg.Port),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	slog.Info("Redirecting HTTP to HTTPS", "addr", addr)
+	go func() {
+		if err := s.redirectServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP redirect server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// redirectToHTTPS redirects every request to the same URL over HTTPS on
+// port. 308 keeps the method and body, so API clients can follow it.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// Shutdown stops accepting requests and deployments, and waits until ctx is
+// done for the requests and queued deployments in progress. Anything still
+// running after that is cancelled, and Shutdown returns once the cancelled
+// deployments have recorded their outcome.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.cancelBase()
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			slog.Error("Failed to shut down HTTP redirect server", "error", err)
+		}
+	}
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+	}
+	s.stopDeployWorkers(ctx)
+	return err
 }
 
 // Health check handler
@@ -136,18 +377,36 @@ func (s *Server) handleRegisterApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid_request", "Application name is required")
 		return
 	}
+	if !isPathSegment(req.Name) {
+		writeError(w, http.StatusBadRequest, "invalid_request", `Application name must not contain '/', '\' or '..'`)
+		return
+	}
+
+	if strings.Contains(req.StoragePrefix, "..") {
+		writeError(w, http.StatusBadRequest, "invalid_request", "storagePrefix must not contain '..'")
+		return
+	}
+
+	// The bucket is read and written with smithd's own credentials, so only
+	// admins may point an app at one other than S3_BUCKET
+	if req.StorageBucket != "" && !apiKeyHasScope(r, config.ScopeAdmin) {
+		writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Setting storageBucket requires the %s scope", config.ScopeAdmin))
+		return
+	}
 
-	app, err := s.appStore.Create(req.Name)
+	app, err := s.appStore.Create(req.Name, req.StorageBucket, strings.Trim(req.StoragePrefix, "/"), req.InterpolateManifests)
 	if err != nil {
 		if err.Error() == fmt.Sprintf("application with name '%s' already exists", req.Name) {
 			writeError(w, http.StatusConflict, "conflict", err.Error())
 			return
 		}
-		log.Printf("Failed to create application: %v", err)
+		requestLogger(r).Error("Failed to create application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create application")
 		return
 	}
 
+	s.audit(r, "app.register", app.ID, app.Name)
+
 	writeJSON(w, http.StatusCreated, app)
 }
 
@@ -170,7 +429,7 @@ func (s *Server) handleListApps(w http.ResponseWriter, r *http.Request) {
 
 	apps, total, err := s.appStore.List(limit, offset)
 	if err != nil {
-		log.Printf("Failed to list applications: %v", err)
+		requestLogger(r).Error("Failed to list applications", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list applications")
 		return
 	}
@@ -194,7 +453,7 @@ func (s *Server) handleGetApp(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -202,21 +461,168 @@ func (s *Server) handleGetApp(w http.ResponseWriter, r *http.Request) {
 	// Get current versions for each environment
 	currentVersions, err := s.appStore.GetCurrentVersions(appID)
 	if err != nil {
-		log.Printf("Failed to get current versions: %v", err)
+		requestLogger(r).Error("Failed to get current versions", "error", err)
 		// Continue without current versions rather than failing
-		currentVersions = make(map[string]string)
+		currentVersions = make(map[string]models.CurrentDeployment)
 	}
 
 	resp := models.GetAppResponse{
-		ID:             app.ID,
-		Name:           app.Name,
-		CreatedAt:      app.CreatedAt,
-		CurrentVersion: currentVersions,
+		ID:                   app.ID,
+		Name:                 app.Name,
+		StorageBucket:        app.StorageBucket,
+		StoragePrefix:        app.StoragePrefix,
+		InterpolateManifests: app.InterpolateManifests,
+		CreatedAt:            app.CreatedAt,
+		CurrentVersions:      currentVersions,
+		EnvironmentVariables: app.EnvironmentVariables,
+
+		ProtectedEnvironments: app.ProtectedEnvironments,
 	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
+func (s *Server) handleDeleteApp(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	force := r.URL.Query().Get("force") == "true"
+	purge := r.URL.Query().Get("purge") == "true"
+
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// Refuse to delete apps that are still deployed unless forced
+	if !force {
+		active, err := s.deploymentStore.CountActive(appID)
+		if err != nil {
+			requestLogger(r).Error("Failed to count active deployments", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to check deployments")
+			return
+		}
+		if active > 0 {
+			writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("Application has %d active deployments, use force=true to delete anyway", active))
+			return
+		}
+	}
+
+	if err := s.appStore.DeleteCascade(appID); err != nil {
+		requestLogger(r).Error("Failed to delete application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete application")
+		return
+	}
+
+	s.audit(r, "app.delete", appID, app.Name)
+
+	if purge {
+		if err := s.storage.PurgeApp(r.Context(), storageLocation(app)); err != nil {
+			// The application is already gone, so report the leftover files
+			requestLogger(r).Error("Failed to purge files", "app", app.Name, "error", err)
+			writeInternalError(w, err, "Application deleted but failed to purge stored files")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSetVariables(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	environment := chi.URLParam(r, "environment")
+
+	// Decode request body
+	var req models.SetVariablesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	// Validate variable names
+	for name := range req.Variables {
+		if !gitops.IsVariableName(name) {
+			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid variable name %q: use uppercase letters, digits and underscores", name))
+			return
+		}
+		for _, builtin := range builtinVariables {
+			if name == builtin {
+				writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("%s is set by smithd and can't be overridden", name))
+				return
+			}
+		}
+	}
+
+	// Verify application exists
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// Variables are only substituted for applications that opted in
+	if !app.InterpolateManifests {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Application does not interpolate manifests; register it with interpolateManifests to use variables")
+		return
+	}
+
+	if err := s.appStore.SetVariables(appID, environment, req.Variables); err != nil {
+		requestLogger(r).Error("Failed to set variables", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to set variables")
+		return
+	}
+
+	variables := req.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+
+	s.audit(r, "app.set_variables", appID, environment)
+
+	writeJSON(w, http.StatusOK, models.SetVariablesResponse{
+		Environment: environment,
+		Variables:   variables,
+	})
+}
+
+func (s *Server) handleSetApproval(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	environment := chi.URLParam(r, "environment")
+
+	// Decode request body
+	var req models.SetApprovalRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	if err := s.appStore.SetRequiresApproval(appID, environment, req.RequiresApproval); err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to set approval", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to set approval")
+		return
+	}
+
+	s.audit(r, "app.set_approval", appID, environment)
+
+	writeJSON(w, http.StatusOK, models.SetApprovalResponse{
+		Environment:      environment,
+		RequiresApproval: req.RequiresApproval,
+	})
+}
+
 func (s *Server) handleDraftVersion(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "appId")
 
@@ -227,7 +633,7 @@ func (s *Server) handleDraftVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -242,6 +648,15 @@ func (s *Server) handleDraftVersion(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid_request", "versionId is required")
 		return
 	}
+	if !isPathSegment(req.VersionID) {
+		writeError(w, http.StatusBadRequest, "invalid_request", `versionId must not contain '/', '\' or '..'`)
+		return
+	}
+	// Published versions are tagged with their ID in the registry
+	if s.cfg.StorageType == "oci" && !storage.ValidOCITag(req.VersionID) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "versionId must be a valid OCI tag: letters, digits, '_', '.' and '-', not starting with '.' or '-', at most 128 characters")
+		return
+	}
 
 	// Validate metadata
 	if req.Metadata.GitSHA == "" || req.Metadata.GitBranch == "" || req.Metadata.Timestamp == "" {
@@ -259,19 +674,21 @@ func (s *Server) handleDraftVersion(w http.ResponseWriter, r *http.Request) {
 	// Create version record
 	version, err := s.versionStore.Create(appID, req.VersionID, req.Metadata)
 	if err != nil {
-		log.Printf("Failed to create version: %v", err)
+		requestLogger(r).Error("Failed to create version", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create version")
 		return
 	}
 
 	// Generate presigned URL for manifest upload
-	uploadURL, err := s.storage.GeneratePresignedURL(app.Name, req.VersionID, "manifests.tar.gz")
+	uploadURL, err := s.storage.GeneratePresignedURL(storageLocation(app), req.VersionID, "manifests.tar.gz")
 	if err != nil {
-		log.Printf("Failed to generate presigned URL: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to generate upload URL")
+		requestLogger(r).Error("Failed to generate presigned URL", "error", err)
+		writeInternalError(w, err, "Failed to generate upload URL")
 		return
 	}
 
+	s.audit(r, "version.draft", appID, version.VersionID)
+
 	resp := models.DraftVersionResponse{
 		VersionID:     version.VersionID,
 		UploadURL:     uploadURL,
@@ -286,7 +703,8 @@ func (s *Server) handlePublishVersion(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "appId")
 	versionID := chi.URLParam(r, "versionId")
 
-	log.Printf("Publishing version %s for app %s", versionID, appID)
+	logger := requestLogger(r)
+	logger.Info("Publishing version")
 
 	// Verify application exists
 	app, err := s.appStore.GetByID(appID)
@@ -295,7 +713,7 @@ func (s *Server) handlePublishVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -307,173 +725,132 @@ func (s *Server) handlePublishVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Version not found")
 			return
 		}
-		log.Printf("Failed to get version: %v", err)
+		requestLogger(r).Error("Failed to get version", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
 		return
 	}
 
-	// Check if already published
-	if version.Status == "published" {
+	// Check if already published. Publishing again resumes a publish that
+	// was interrupted before its files finished moving out of drafts.
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	resuming := version.Status == "published" && version.Publishing && !dryRun
+	if version.Status == "published" && !resuming {
 		writeError(w, http.StatusConflict, "conflict", "Version is already published")
 		return
 	}
 
-	// List files in draft location
-	files, err := s.storage.ListFiles(app.Name, versionID, false)
-	if err != nil {
-		log.Printf("Failed to list draft files: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to access draft files")
+	// The request body is optional
+	var req models.PublishVersionRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
 
-	log.Printf("Found %d files in draft location for version %s: %v", len(files), versionID, files)
+	if resuming {
+		logger.Info("Resuming interrupted publish")
+		if err := s.finishPublish(r.Context(), app, version); err != nil {
+			requestLogger(r).Error("Failed to move version to published", "error", err)
+			writeInternalError(w, err, "Failed to publish version")
+			return
+		}
+	}
 
-	if len(files) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "No manifest files uploaded")
+	// Read the draft files, or the published files of a resumed publish
+	draftFiles, err := s.fetchFiles(r.Context(), app, versionID, resuming)
+	if err != nil {
+		requestLogger(r).Error("Failed to read draft files", "error", err)
+		writeInternalError(w, err, "Failed to read manifest files")
 		return
 	}
 
-	// Check if we have a tarball that needs to be extracted
-	manifestFiles := []string{}
-	var tarballFiles map[string][]byte
-
-	// Look for manifests.tar.gz
-	hasTarball := false
-	for _, file := range files {
-		if file == "manifests.tar.gz" {
-			hasTarball = true
-			log.Printf("Found tarball, extracting files...")
+	logger.Info("Found files in draft location", "count", len(draftFiles), "files", getKeys(draftFiles))
 
-			// Get and extract tarball
-			reader, err := s.storage.GetFile(app.Name, versionID, file, false)
-			if err != nil {
-				log.Printf("Failed to get tarball %s: %v", file, err)
-				writeError(w, http.StatusInternalServerError, "internal_error", "Failed to read manifest files")
-				return
-			}
-			defer reader.Close()
+	// Validate manifests. A resumed publish was validated when it started.
+	validation := s.validateDraft(logger, versionID, draftFiles, !req.NoValidate && !resuming)
 
-			tarballFiles, err = s.extractTarball(reader)
-			if err != nil {
-				log.Printf("Failed to extract tarball: %v", err)
-				writeError(w, http.StatusInternalServerError, "internal_error", "Failed to extract manifest files")
-				return
-			}
+	// A dry run only reports the validation result
+	if dryRun {
+		writeJSON(w, http.StatusOK, validation)
+		return
+	}
 
-			log.Printf("Extracted %d files from tarball: %v", len(tarballFiles), getKeys(tarballFiles))
-			break
+	if !validation.Valid {
+		issue := validation.Errors[0]
+		if issue.File == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", issue.Message)
+			return
 		}
+		writeValidationError(w, validation.Errors)
+		return
 	}
+	manifestFiles := validation.ManifestFiles
+	assetFiles := validation.AssetFiles
 
-	// Process files (either from tarball or individual uploads)
-	if hasTarball {
-		// Validate files from tarball
-		for filename, content := range tarballFiles {
-			log.Printf("Processing extracted file: %s", filename)
-			if strings.HasSuffix(filename, ".yaml") || strings.HasSuffix(filename, ".yml") {
-				log.Printf("File %s is a YAML file, validating...", filename)
-				log.Printf("Read %d bytes from file %s", len(content), filename)
-
-				// Validate YAML syntax
-				var yamlContent interface{}
-				if err := yaml.Unmarshal(content, &yamlContent); err != nil {
-					log.Printf("YAML validation failed for file %s: %v", filename, err)
-					writeError(w, http.StatusBadRequest, "validation_failed", fmt.Sprintf("Invalid YAML in %s: %v", filename, err))
-					return
-				}
+	if !resuming {
+		// Record checksums of the draft files so deploys can detect changes
+		checksums := fileChecksums(draftFiles)
 
-				log.Printf("File %s validated successfully", filename)
-				manifestFiles = append(manifestFiles, filename)
-			} else {
-				log.Printf("Skipping non-YAML file: %s", filename)
+		// Mark the version published before moving its files, so a move
+		// interrupted part way is finished on restart or by publishing again
+		if err := s.versionStore.Publish(version.ID, checksums); err != nil {
+			if err.Error() == "version is not a draft" {
+				writeError(w, http.StatusConflict, "conflict", "Version is already published")
+				return
 			}
+			requestLogger(r).Error("Failed to update version status", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update version status")
+			return
 		}
-	} else {
-		// Validate individual files
-		for _, file := range files {
-			log.Printf("Processing file: %s", file)
-			if strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
-				log.Printf("File %s is a YAML file, validating...", file)
-				// Get file content
-				reader, err := s.storage.GetFile(app.Name, versionID, file, false)
-				if err != nil {
-					log.Printf("Failed to get file %s: %v", file, err)
-					writeError(w, http.StatusInternalServerError, "internal_error", "Failed to read manifest files")
-					return
-				}
-				defer reader.Close()
-
-				// Read content
-				content, err := io.ReadAll(reader)
-				if err != nil {
-					log.Printf("Failed to read file %s: %v", file, err)
-					writeError(w, http.StatusInternalServerError, "internal_error", "Failed to read manifest files")
-					return
-				}
-
-				log.Printf("Read %d bytes from file %s", len(content), file)
+		version.Checksums = checksums
 
-				// Validate YAML syntax
-				var yamlContent interface{}
-				if err := yaml.Unmarshal(content, &yamlContent); err != nil {
-					log.Printf("YAML validation failed for file %s: %v", file, err)
-					writeError(w, http.StatusBadRequest, "validation_failed", fmt.Sprintf("Invalid YAML in %s: %v", file, err))
-					return
-				}
-
-				log.Printf("File %s validated successfully", file)
-				manifestFiles = append(manifestFiles, file)
-			} else {
-				log.Printf("Skipping non-YAML file: %s", file)
-			}
+		// Move files from drafts to published
+		if err := s.finishPublish(r.Context(), app, version); err != nil {
+			requestLogger(r).Error("Failed to move version to published", "error", err)
+			writeInternalError(w, err, "Failed to publish version")
+			return
 		}
 	}
 
-	if len(manifestFiles) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "No valid YAML manifest files found")
-		return
-	}
+	// Refresh version to get updated fields
+	version, _ = s.versionStore.GetByVersionID(appID, versionID)
 
-	// Move files from drafts to published
-	if err := s.storage.MoveVersion(app.Name, versionID); err != nil {
-		log.Printf("Failed to move version to published: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to publish version")
-		return
-	}
+	s.audit(r, "version.publish", appID, versionID)
+	metrics.Publishes.Inc()
 
-	// Update version status
-	if err := s.versionStore.UpdateStatus(version.ID, "published"); err != nil {
-		log.Printf("Failed to update version status: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update version status")
-		return
+	resp := models.PublishVersionResponse{
+		VersionID:     version.VersionID,
+		Status:        version.Status,
+		PublishedAt:   *version.PublishedAt,
+		ManifestFiles: manifestFiles,
+		AssetFiles:    assetFiles,
 	}
 
-	// Refresh version to get updated fields
-	version, _ = s.versionStore.GetByVersionID(appID, versionID)
-
 	// Check for matching auto-deploy policies
 	if version.GitBranch != "" {
 		matchingPolicies, err := s.policyStore.FindMatchingPolicies(appID, version.GitBranch)
 		if err != nil {
-			log.Printf("Failed to check auto-deploy policies: %v", err)
+			logger.Error("Failed to check auto-deploy policies", "error", err)
 			// Don't fail the publish, just log the error
 		} else {
 			for _, policy := range matchingPolicies {
-				log.Printf("Auto-deploying version %s to %s via policy %s", versionID, policy.TargetEnvironment, policy.Name)
-
-				// Trigger deployment asynchronously to avoid blocking the response
-				go s.autoDeployVersion(app.Name, appID, version, policy)
+				// The deployment record is created before responding so the
+				// caller can poll it; the deploy workers do the gitops work,
+				// logging under this request's ID
+				deployment := s.autoDeployVersion(r.Context(), logger, app, version, policy)
+				if deployment == nil {
+					continue
+				}
+				resp.AutoDeployments = append(resp.AutoDeployments, models.DeployVersionResponse{
+					DeploymentID: deployment.ID,
+					VersionID:    version.VersionID,
+					Environment:  deployment.Environment,
+					Status:       deployment.Status,
+					StartedAt:    deployment.StartedAt,
+				})
 			}
 		}
 	}
 
-	resp := models.PublishVersionResponse{
-		VersionID:     version.VersionID,
-		Status:        version.Status,
-		PublishedAt:   *version.PublishedAt,
-		ManifestFiles: manifestFiles,
-	}
-
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -487,7 +864,7 @@ func (s *Server) handleListVersions(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -511,7 +888,7 @@ func (s *Server) handleListVersions(w http.ResponseWriter, r *http.Request) {
 	// List versions
 	versions, total, err := s.versionStore.List(appID, limit, offset)
 	if err != nil {
-		log.Printf("Failed to list versions: %v", err)
+		requestLogger(r).Error("Failed to list versions", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list versions")
 		return
 	}
@@ -521,7 +898,7 @@ func (s *Server) handleListVersions(w http.ResponseWriter, r *http.Request) {
 	for _, v := range versions {
 		deployedTo, err := s.versionStore.GetDeployedEnvironments(v.ID)
 		if err != nil {
-			log.Printf("Failed to get deployed environments for version %s: %v", v.ID, err)
+			requestLogger(r).Error("Failed to get deployed environments", "version_id", v.VersionID, "error", err)
 			deployedTo = []string{}
 		}
 
@@ -552,7 +929,7 @@ func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -564,7 +941,7 @@ func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Version not found")
 			return
 		}
-		log.Printf("Failed to get version: %v", err)
+		requestLogger(r).Error("Failed to get version", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
 		return
 	}
@@ -572,9 +949,9 @@ func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 	// Get manifest files
 	manifestFiles := []string{}
 	if version.Status == "published" {
-		files, err := s.storage.ListFiles(app.Name, versionID, true)
+		files, err := s.storage.ListFiles(r.Context(), storageLocation(app), versionID, true)
 		if err != nil {
-			log.Printf("Failed to list manifest files: %v", err)
+			requestLogger(r).Error("Failed to list manifest files", "error", err)
 			// Continue without manifest files rather than failing
 		} else {
 			manifestFiles = files
@@ -584,7 +961,7 @@ func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 	// Get deployed environments
 	deployedTo, err := s.versionStore.GetDeployedEnvironments(version.ID)
 	if err != nil {
-		log.Printf("Failed to get deployed environments: %v", err)
+		requestLogger(r).Error("Failed to get deployed environments", "error", err)
 		deployedTo = []string{}
 	}
 
@@ -607,23 +984,10 @@ func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleDeployVersion(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleDeleteVersion(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "appId")
 	versionID := chi.URLParam(r, "versionId")
 
-	// Decode request body
-	var req models.DeployVersionRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
-		return
-	}
-
-	// Validate environment
-	if req.Environment == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Environment is required")
-		return
-	}
-
 	// Verify application exists
 	app, err := s.appStore.GetByID(appID)
 	if err != nil {
@@ -631,93 +995,640 @@ func (s *Server) handleDeployVersion(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
 
-	// Verify version exists and is published
+	// Get version
 	version, err := s.versionStore.GetByVersionID(appID, versionID)
 	if err != nil {
 		if err.Error() == "version not found" {
 			writeError(w, http.StatusNotFound, "not_found", "Version not found")
 			return
 		}
-		log.Printf("Failed to get version: %v", err)
+		requestLogger(r).Error("Failed to get version", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
 		return
 	}
 
-	if version.Status != "published" {
-		writeError(w, http.StatusBadRequest, "invalid_status", "Version must be published before deployment")
+	// Refuse to delete versions that are about to be deployed or are the
+	// current version of an environment. Versions since replaced can go.
+	pending, err := s.deploymentStore.CountPendingForVersion(version.ID)
+	if err != nil {
+		requestLogger(r).Error("Failed to count pending deployments", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to check deployments")
 		return
 	}
-
-	// Create deployment record
-	deployment, err := s.deploymentStore.Create(appID, version.ID, req.Environment, req.TriggeredBy, nil)
-	if err != nil {
-		log.Printf("Failed to create deployment: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+	if pending > 0 {
+		writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("Version has %d pending deployments", pending))
 		return
 	}
 
-	// Fetch manifests from S3
-	manifests, err := s.storage.GetAllFiles(app.Name, versionID, true)
+	current, err := s.appStore.GetCurrentVersions(appID)
 	if err != nil {
-		log.Printf("Failed to fetch manifests from S3: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to fetch manifests: %v", err))
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch manifests")
+		requestLogger(r).Error("Failed to get current versions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to check deployments")
 		return
 	}
-
-	// Clone gitops repo
-	if err := s.gitops.Clone(); err != nil {
-		log.Printf("Failed to clone gitops repo: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to clone gitops repo: %v", err))
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to clone gitops repository")
+	var deployedTo []string
+	for environment, deployment := range current {
+		if deployment.VersionID == versionID {
+			deployedTo = append(deployedTo, environment)
+		}
+	}
+	if len(deployedTo) > 0 {
+		sort.Strings(deployedTo)
+		writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("Version is deployed to %s", strings.Join(deployedTo, ", ")))
 		return
 	}
 
-	// Write manifests to gitops repo
-	if err := s.gitops.WriteManifests(app.Name, req.Environment, versionID, manifests); err != nil {
-		log.Printf("Failed to write manifests: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to write manifests: %v", err))
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to write manifests")
+	// Delete stored files first so a failure leaves the version in place to retry
+	if err := s.storage.DeleteVersion(r.Context(), storageLocation(app), versionID, version.Status == "published"); err != nil {
+		requestLogger(r).Error("Failed to delete files", "app", app.Name, "error", err)
+		writeInternalError(w, err, "Failed to delete version files")
 		return
 	}
 
-	// Commit changes
-	commitMsg := fmt.Sprintf("Deploy %s version %s to %s", app.Name, versionID, req.Environment)
-	commitSHA, err := s.gitops.Commit(commitMsg)
-	if err != nil {
-		log.Printf("Failed to commit: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to commit: %v", err))
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to commit changes")
-		return
+	// An interrupted publish can leave files in drafts too
+	if version.Publishing {
+		if err := s.storage.DeleteVersion(r.Context(), storageLocation(app), versionID, false); err != nil {
+			requestLogger(r).Error("Failed to delete files", "app", app.Name, "error", err)
+			writeInternalError(w, err, "Failed to delete version files")
+			return
+		}
 	}
 
-	// Push to remote
-	if err := s.gitops.Push(); err != nil {
-		log.Printf("Failed to push: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", commitSHA, fmt.Sprintf("Failed to push: %v", err))
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to push to gitops repository")
+	if err := s.versionStore.Delete(version.ID); err != nil {
+		if err.Error() == "version has pending deployments" {
+			writeError(w, http.StatusConflict, "conflict", "Version has pending deployments")
+			return
+		}
+		requestLogger(r).Error("Failed to delete version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete version")
 		return
 	}
 
-	// Update deployment status
-	if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", commitSHA, ""); err != nil {
-		log.Printf("Failed to update deployment status: %v", err)
-		// Don't return error, deployment was successful
-	}
+	s.audit(r, "version.delete", appID, version.VersionID)
 
-	// Return response
-	resp := models.DeployVersionResponse{
-		DeploymentID:    deployment.ID,
-		VersionID:       versionID,
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeployVersion(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	versionID := chi.URLParam(r, "versionId")
+
+	// Decode request body
+	var req models.DeployVersionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	// Accept a single environment or a list of them
+	environments := req.Environments
+	if req.Environment != "" {
+		if len(environments) > 0 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Specify either environment or environments, not both")
+			return
+		}
+		environments = []string{req.Environment}
+	}
+
+	if len(environments) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Environment is required")
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, environment := range environments {
+		if environment == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Environment names must not be empty")
+			return
+		}
+		if seen[environment] {
+			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Environment %s is listed more than once", environment))
+			return
+		}
+		if s.rejectUnknownEnvironment(w, environment) {
+			return
+		}
+		seen[environment] = true
+	}
+
+	// Verify application exists
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// Verify version exists and is published
+	version, err := s.versionStore.GetByVersionID(appID, versionID)
+	if err != nil {
+		if err.Error() == "version not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Version not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
+		return
+	}
+
+	if version.Status != "published" {
+		writeError(w, http.StatusBadRequest, "invalid_status", "Version must be published before deployment")
+		return
+	}
+	if version.Publishing {
+		writeError(w, http.StatusConflict, "conflict", "Version is still being published")
+		return
+	}
+
+	// A dry run only previews the deploy, without creating deployments
+	if r.URL.Query().Get("dryRun") == "true" {
+		previews := make([]models.DeployPreviewResponse, 0, len(environments))
+		for _, environment := range environments {
+			diff, err := s.previewDeployment(r.Context(), app, version, environment)
+			if err != nil {
+				requestLogger(r).Error("Failed to preview deployment", "error", err)
+				writeInternalError(w, err, fmt.Sprintf("Failed to preview deployment to %s: %v", environment, err))
+				return
+			}
+
+			previews = append(previews, models.DeployPreviewResponse{
+				VersionID:     versionID,
+				Environment:   environment,
+				CommitMessage: s.deployCommitMessage(app.Name, versionID, environment, req.TriggeredBy),
+				Diff:          diff,
+			})
+		}
+
+		if len(req.Environments) == 0 {
+			writeJSON(w, http.StatusOK, previews[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, models.DeployPreviewsResponse{Previews: previews})
+		return
+	}
+
+	// Ask the deploy policy, if configured, before deploying anywhere
+	for _, environment := range environments {
+		decision, err := s.checkDeployPolicy(r.Context(), app, version, environment, req.TriggeredBy)
+		if err != nil {
+			requestLogger(r).Error("Failed to evaluate deploy policy", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to evaluate deploy policy")
+			return
+		}
+		if !decision.Allow {
+			writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Deploy to %s denied by policy: %s", environment, decision.Reason))
+			return
+		}
+	}
+
+	// Create every deployment record before queueing any, so a failure
+	// here doesn't leave some environments deploying behind a 500
+	deployments := make([]*models.Deployment, 0, len(environments))
+	for _, environment := range environments {
+		deployment, err := s.deploymentStore.Create(appID, version.ID, environment, req.TriggeredBy, nil)
+		if err != nil {
+			requestLogger(r).Error("Failed to create deployment", "error", err)
+			for _, created := range deployments {
+				s.finishDeployment(requestLogger(r), app, version, created, "failed", "", fmt.Sprintf("failed to create the deployment to %s", environment))
+			}
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+			return
+		}
+		s.recordEvent(requestLogger(r), deployment.ID, "created", "")
+		deployments = append(deployments, deployment)
+	}
+
+	// Each environment gets its own gitops commit, so a failure in one
+	// doesn't block the others
+	responses := make([]models.DeployVersionResponse, 0, len(environments))
+	queued := 0
+	// failure is why the last environment failed, preferring anything
+	// other than a full queue, for the response when none was started
+	var failure error
+	for _, deployment := range deployments {
+		environment := deployment.Environment
+		commitMessage := s.deployCommitMessage(app.Name, versionID, environment, req.TriggeredBy)
+
+		// Protected environments wait for approval before anything is pushed
+		var err error
+		if app.RequiresApproval(environment) {
+			if err = s.deploymentStore.HoldForApproval(deployment.ID, commitMessage); err != nil {
+				requestLogger(r).Error("Failed to hold deployment for approval", "error", err)
+			} else {
+				s.recordEvent(requestLogger(r), deployment.ID, "awaiting_approval", "")
+				deployment.Status = "pending_approval"
+			}
+		} else {
+			// Hand the gitops work to the deploy workers
+			err = s.enqueueDeployment(deployJob{
+				app:           app,
+				version:       version,
+				deployment:    deployment,
+				commitMessage: commitMessage,
+				logger:        requestLogger(r),
+			})
+			if err != nil {
+				requestLogger(r).Error("Failed to queue deployment", "error", err)
+			}
+		}
+
+		errorMsg := ""
+		if err != nil {
+			s.finishDeployment(requestLogger(r), app, version, deployment, "failed", "", err.Error())
+			deployment.Status = "failed"
+			errorMsg = err.Error()
+			if failure == nil || errors.Is(failure, errQueueFull) {
+				failure = err
+			}
+		} else {
+			queued++
+		}
+
+		s.audit(r, "deployment.create", appID, deployment.ID)
+
+		responses = append(responses, models.DeployVersionResponse{
+			DeploymentID: deployment.ID,
+			VersionID:    versionID,
+			Environment:  environment,
+			Status:       deployment.Status,
+			StartedAt:    deployment.StartedAt,
+			Error:        errorMsg,
+		})
+	}
+
+	if queued == 0 {
+		writeQueueError(w, failure)
+		return
+	}
+
+	// Return response
+	if len(req.Environments) == 0 {
+		writeJSON(w, http.StatusAccepted, responses[0])
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, models.DeployVersionsResponse{Deployments: responses})
+}
+
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+
+	// Decode request body
+	var req models.RollbackRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	// Validate environment
+	if req.Environment == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Environment is required")
+		return
+	}
+	if s.rejectUnknownEnvironment(w, req.Environment) {
+		return
+	}
+
+	// Verify application exists
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// The first version is the one currently deployed; roll back to the
+	// most recent different one
+	deployed, err := s.deploymentStore.SuccessfulVersions(appID, req.Environment)
+	if err != nil {
+		requestLogger(r).Error("Failed to list successful deployments", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list deployments")
+		return
+	}
+	if len(deployed) == 0 {
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("No successful deployment in %s", req.Environment))
+		return
+	}
+
+	previous := ""
+	for _, versionID := range deployed[1:] {
+		if versionID != deployed[0] {
+			previous = versionID
+			break
+		}
+	}
+	if previous == "" {
+		writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("No previous version to roll back to in %s", req.Environment))
+		return
+	}
+
+	version, err := s.versionStore.GetByVersionID(appID, previous)
+	if err != nil {
+		requestLogger(r).Error("Failed to get version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
+		return
+	}
+
+	// Ask the deploy policy, if configured
+	decision, err := s.checkDeployPolicy(r.Context(), app, version, req.Environment, "rollback")
+	if err != nil {
+		requestLogger(r).Error("Failed to evaluate deploy policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to evaluate deploy policy")
+		return
+	}
+	if !decision.Allow {
+		writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Deploy denied by policy: %s", decision.Reason))
+		return
+	}
+
+	// Create deployment record
+	deployment, err := s.deploymentStore.Create(appID, version.ID, req.Environment, "rollback", nil)
+	if err != nil {
+		requestLogger(r).Error("Failed to create deployment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+		return
+	}
+	if err := s.deploymentStore.SetRollback(deployment.ID, deployed[0], req.Reason); err != nil {
+		requestLogger(r).Error("Failed to record rollback details", "error", err)
+		s.finishDeployment(requestLogger(r).With("version_id", version.VersionID), app, version, deployment, "failed", "", err.Error())
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+		return
+	}
+	deployment.RolledBackFrom = deployed[0]
+	deployment.Reason = req.Reason
+	s.recordEvent(requestLogger(r), deployment.ID, "created", fmt.Sprintf("Rollback from %s", deployed[0]))
+
+	commitMessage := s.commitMessage(gitops.CommitMessageData{
+		App:             app.Name,
+		Version:         previous,
 		Environment:     req.Environment,
-		Status:          "success",
-		GitopsCommitSHA: commitSHA,
-		StartedAt:       deployment.StartedAt,
+		TriggeredBy:     "rollback",
+		Action:          "rollback",
+		PreviousVersion: deployed[0],
+		Message:         fmt.Sprintf("Roll back %s in %s from %s to %s", app.Name, req.Environment, deployed[0], previous),
+	})
+
+	// Protected environments wait for approval, rollbacks included
+	if app.RequiresApproval(req.Environment) {
+		if err := s.deploymentStore.HoldForApproval(deployment.ID, commitMessage); err != nil {
+			requestLogger(r).Error("Failed to hold deployment for approval", "error", err)
+			s.finishDeployment(requestLogger(r).With("version_id", version.VersionID), app, version, deployment, "failed", "", err.Error())
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create deployment")
+			return
+		}
+		s.recordEvent(requestLogger(r), deployment.ID, "awaiting_approval", "")
+		deployment.Status = "pending_approval"
+	} else {
+		// Hand the gitops work to the deploy workers
+		err = s.enqueueDeployment(deployJob{
+			app:           app,
+			version:       version,
+			deployment:    deployment,
+			commitMessage: commitMessage,
+			logger:        requestLogger(r).With("version_id", version.VersionID),
+		})
+		if err != nil {
+			requestLogger(r).Error("Failed to queue deployment", "error", err)
+			s.finishDeployment(requestLogger(r).With("version_id", version.VersionID), app, version, deployment, "failed", "", err.Error())
+			writeQueueError(w, err)
+			return
+		}
+	}
+
+	s.audit(r, "deployment.rollback", appID, deployment.ID)
+
+	resp := models.DeployVersionResponse{
+		DeploymentID: deployment.ID,
+		VersionID:    previous,
+		Environment:  req.Environment,
+		Status:       deployment.Status,
+		StartedAt:    deployment.StartedAt,
+	}
+
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+func (s *Server) handleListDeployments(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+
+	// Verify application exists
+	_, err := s.appStore.GetByID(appID)
+	if err != nil {
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	// Parse filter and pagination parameters
+	environment := r.URL.Query().Get("environment")
+	status := r.URL.Query().Get("status")
+	if status != "" && !isDeploymentStatus(status) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "status must be one of pending_approval, pending, success or failed")
+		return
+	}
+	limit := 50
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	// List deployments
+	deployments, total, err := s.deploymentStore.List(appID, environment, status, limit, offset)
+	if err != nil {
+		requestLogger(r).Error("Failed to list deployments", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list deployments")
+		return
+	}
+
+	resp := models.ListDeploymentsResponse{
+		Deployments: deployments,
+		Total:       total,
+		Limit:       limit,
+		Offset:      offset,
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// isDeploymentStatus reports whether status is a status a deployment can have
+func isDeploymentStatus(status string) bool {
+	switch status {
+	case "pending_approval", "pending", "success", "failed":
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleGetDeployment(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	deploymentID := chi.URLParam(r, "deploymentId")
+
+	deployment, err := s.deploymentStore.GetByID(deploymentID)
+	if err != nil {
+		if err.Error() == "deployment not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get deployment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get deployment")
+		return
+	}
+
+	// Deployments are scoped to their application
+	if deployment.AppID != appID {
+		writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+		return
+	}
+
+	// Include the timeline, so a failed deployment shows where it stopped
+	deployment.Events, err = s.deploymentEventStore.List(deploymentID)
+	if err != nil {
+		requestLogger(r).Error("Failed to list deployment events", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list deployment events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deployment)
+}
+
+func (s *Server) handleListDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	deploymentID := chi.URLParam(r, "deploymentId")
+
+	deployment, err := s.deploymentStore.GetByID(deploymentID)
+	if err != nil {
+		if err.Error() == "deployment not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get deployment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get deployment")
+		return
+	}
+
+	// Deployments are scoped to their application
+	if deployment.AppID != appID {
+		writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+		return
+	}
+
+	events, err := s.deploymentEventStore.List(deploymentID)
+	if err != nil {
+		requestLogger(r).Error("Failed to list deployment events", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list deployment events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ListDeploymentEventsResponse{Events: events})
+}
+
+func (s *Server) handleApproveDeployment(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	deploymentID := chi.URLParam(r, "deploymentId")
+
+	deployment, err := s.deploymentStore.GetByID(deploymentID)
+	if err != nil {
+		if err.Error() == "deployment not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get deployment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get deployment")
+		return
+	}
+
+	// Deployments are scoped to their application
+	if deployment.AppID != appID {
+		writeError(w, http.StatusNotFound, "not_found", "Deployment not found")
+		return
+	}
+
+	if deployment.Status != "pending_approval" {
+		writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("Deployment is %s, not awaiting approval", deployment.Status))
+		return
+	}
+
+	app, err := s.appStore.GetByID(appID)
+	if err != nil {
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
+		return
+	}
+
+	version, err := s.versionStore.GetByVersionID(appID, deployment.Version)
+	if err != nil {
+		requestLogger(r).Error("Failed to get version", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get version")
+		return
+	}
+
+	// Only one of two concurrent approvals gets to queue the deployment
+	if err := s.deploymentStore.Approve(deploymentID); err != nil {
+		if err.Error() == "deployment is not awaiting approval" {
+			writeError(w, http.StatusConflict, "conflict", "Deployment is not awaiting approval")
+			return
+		}
+		requestLogger(r).Error("Failed to approve deployment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to approve deployment")
+		return
+	}
+	deployment.Status = "pending"
+
+	logger := requestLogger(r).With("version_id", version.VersionID, "deployment_id", deployment.ID)
+	logger.Info("Deployment approved", "app", app.Name, "environment", deployment.Environment)
+	s.recordEvent(logger, deployment.ID, "approved", "")
+
+	// Hand the gitops work to the deploy workers
+	err = s.enqueueDeployment(deployJob{
+		app:           app,
+		version:       version,
+		deployment:    deployment,
+		commitMessage: deployment.CommitMessage,
+		// Reconcile repairs also remove files added by hand
+		removeOther: deployment.TriggeredBy == "reconcile",
+		logger:      logger,
+	})
+	if err != nil {
+		logger.Error("Failed to queue deployment", "error", err)
+		s.finishDeployment(logger, app, version, deployment, "failed", "", err.Error())
+		writeQueueError(w, err)
+		return
+	}
+
+	s.audit(r, "deployment.approve", appID, deployment.ID)
+
+	resp := models.DeployVersionResponse{
+		DeploymentID: deployment.ID,
+		VersionID:    version.VersionID,
+		Environment:  deployment.Environment,
+		Status:       deployment.Status,
+		StartedAt:    deployment.StartedAt,
 	}
 
 	writeJSON(w, http.StatusAccepted, resp)
@@ -733,7 +1644,7 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -754,10 +1665,17 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid_request", "Git branch pattern is required")
 		return
 	}
+	if err := store.ValidateBranchPattern(req.GitBranchPattern); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid git branch pattern: %v", err))
+		return
+	}
 	if req.TargetEnvironment == "" {
 		writeError(w, http.StatusBadRequest, "invalid_request", "Target environment is required")
 		return
 	}
+	if s.rejectUnknownEnvironment(w, req.TargetEnvironment) {
+		return
+	}
 
 	// Default enabled to true if not specified
 	enabled := true
@@ -766,13 +1684,15 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create policy
-	policy, err := s.policyStore.Create(appID, req.Name, req.GitBranchPattern, req.TargetEnvironment, enabled)
+	policy, err := s.policyStore.Create(appID, req.Name, req.GitBranchPattern, req.TargetEnvironment, enabled, req.Priority)
 	if err != nil {
-		log.Printf("Failed to create policy: %v", err)
+		requestLogger(r).Error("Failed to create policy", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to create policy")
 		return
 	}
 
+	s.audit(r, "policy.create", appID, policy.Name)
+
 	resp := models.PolicyResponse{
 		ID:                policy.ID,
 		AppID:             policy.AppID,
@@ -780,6 +1700,7 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 		GitBranchPattern:  policy.GitBranchPattern,
 		TargetEnvironment: policy.TargetEnvironment,
 		Enabled:           policy.Enabled,
+		Priority:          policy.Priority,
 		CreatedAt:         policy.CreatedAt,
 	}
 
@@ -796,7 +1717,7 @@ func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -804,7 +1725,7 @@ func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
 	// List policies
 	policies, err := s.policyStore.List(appID)
 	if err != nil {
-		log.Printf("Failed to list policies: %v", err)
+		requestLogger(r).Error("Failed to list policies", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to list policies")
 		return
 	}
@@ -817,7 +1738,7 @@ func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "appId")
 	policyID := chi.URLParam(r, "policyId")
 
@@ -828,7 +1749,7 @@ func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Application not found")
 			return
 		}
-		log.Printf("Failed to get application: %v", err)
+		requestLogger(r).Error("Failed to get application", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
@@ -840,7 +1761,7 @@ func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "not_found", "Policy not found")
 			return
 		}
-		log.Printf("Failed to get policy: %v", err)
+		requestLogger(r).Error("Failed to get policy", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get policy")
 		return
 	}
@@ -850,105 +1771,415 @@ func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete policy
-	if err := s.policyStore.Delete(policyID); err != nil {
-		log.Printf("Failed to delete policy: %v", err)
-		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete policy")
+	// Decode request body
+	var req models.UpdatePolicyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
-}
+	// Apply changes on top of the current policy
+	if req.Name != nil {
+		if *req.Name == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Policy name cannot be empty")
+			return
+		}
+		policy.Name = *req.Name
+	}
+	if req.GitBranchPattern != nil {
+		if *req.GitBranchPattern == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Git branch pattern cannot be empty")
+			return
+		}
+		if err := store.ValidateBranchPattern(*req.GitBranchPattern); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid git branch pattern: %v", err))
+			return
+		}
+		policy.GitBranchPattern = *req.GitBranchPattern
+	}
+	if req.TargetEnvironment != nil {
+		if *req.TargetEnvironment == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Target environment cannot be empty")
+			return
+		}
+		if s.rejectUnknownEnvironment(w, *req.TargetEnvironment) {
+			return
+		}
+		policy.TargetEnvironment = *req.TargetEnvironment
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Priority != nil {
+		policy.Priority = *req.Priority
+	}
 
-// autoDeployVersion automatically deploys a version based on a policy
-// This runs asynchronously in a goroutine
-func (s *Server) autoDeployVersion(appName, appID string, version *models.Version, policy models.Policy) {
-	// Create deployment record
-	policyID := policy.ID
-	deployment, err := s.deploymentStore.Create(appID, version.ID, policy.TargetEnvironment, "auto-deploy", &policyID)
+	// Update policy
+	policy, err = s.policyStore.Update(policyID, policy.Name, policy.GitBranchPattern, policy.TargetEnvironment, policy.Enabled, policy.Priority)
 	if err != nil {
-		log.Printf("Auto-deploy failed to create deployment record: %v", err)
+		if strings.HasSuffix(err.Error(), "already exists") {
+			writeError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		requestLogger(r).Error("Failed to update policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to update policy")
 		return
 	}
 
-	// Fetch manifests from S3
-	manifests, err := s.storage.GetAllFiles(appName, version.VersionID, true)
+	resp := models.PolicyResponse{
+		ID:                policy.ID,
+		AppID:             policy.AppID,
+		Name:              policy.Name,
+		GitBranchPattern:  policy.GitBranchPattern,
+		TargetEnvironment: policy.TargetEnvironment,
+		Enabled:           policy.Enabled,
+		Priority:          policy.Priority,
+		CreatedAt:         policy.CreatedAt,
+	}
+
+	s.audit(r, "policy.update", appID, policy.Name)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "appId")
+	policyID := chi.URLParam(r, "policyId")
+
+	// Verify application exists
+	_, err := s.appStore.GetByID(appID)
 	if err != nil {
-		log.Printf("Auto-deploy failed to fetch manifests: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to fetch manifests: %v", err))
+		if err.Error() == "application not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get application", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get application")
 		return
 	}
 
-	// Clone gitops repo
-	if err := s.gitops.Clone(); err != nil {
-		log.Printf("Auto-deploy failed to clone gitops repo: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to clone gitops repo: %v", err))
+	// Verify policy exists and belongs to this app
+	policy, err := s.policyStore.GetByID(policyID)
+	if err != nil {
+		if err.Error() == "policy not found" {
+			writeError(w, http.StatusNotFound, "not_found", "Policy not found")
+			return
+		}
+		requestLogger(r).Error("Failed to get policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get policy")
 		return
 	}
 
-	// Write manifests to gitops repo
-	if err := s.gitops.WriteManifests(appName, policy.TargetEnvironment, version.VersionID, manifests); err != nil {
-		log.Printf("Auto-deploy failed to write manifests: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to write manifests: %v", err))
+	if policy.AppID != appID {
+		writeError(w, http.StatusNotFound, "not_found", "Policy not found")
 		return
 	}
 
-	// Commit changes
-	commitMsg := fmt.Sprintf("Auto-deploy %s version %s to %s (policy: %s)", appName, version.VersionID, policy.TargetEnvironment, policy.Name)
-	commitSHA, err := s.gitops.Commit(commitMsg)
-	if err != nil {
-		log.Printf("Auto-deploy failed to commit: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", fmt.Sprintf("Failed to commit: %v", err))
+	// Delete policy
+	if err := s.policyStore.Delete(policyID); err != nil {
+		requestLogger(r).Error("Failed to delete policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete policy")
 		return
 	}
 
-	// Push to remote
-	if err := s.gitops.Push(); err != nil {
-		log.Printf("Auto-deploy failed to push: %v", err)
-		s.deploymentStore.UpdateStatus(deployment.ID, "failed", commitSHA, fmt.Sprintf("Failed to push: %v", err))
+	s.audit(r, "policy.delete", appID, policy.Name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleReloadGitopsCredentials(w http.ResponseWriter, r *http.Request) {
+	// The request body is optional
+	var req models.ReloadCredentialsRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
 
-	// Update deployment status
-	if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", commitSHA, ""); err != nil {
-		log.Printf("Auto-deploy failed to update deployment status: %v", err)
+	// Re-read the current key unless a new path is given
+	sshKeyPath := req.SSHKeyPath
+	if sshKeyPath == "" {
+		sshKeyPath = s.gitops.SSHKeyPath()
+	}
+
+	requestLogger(r).Info("Reloading gitops credentials", "ssh_key_path", sshKeyPath)
+
+	if err := s.gitops.ReloadCredentials(r.Context(), sshKeyPath); err != nil {
+		requestLogger(r).Error("Failed to reload gitops credentials", "error", err)
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Failed to reload gitops credentials: %v", err))
 		return
 	}
 
-	log.Printf("Auto-deploy succeeded: %s version %s to %s (deployment: %s, commit: %s)", appName, version.VersionID, policy.TargetEnvironment, deployment.ID, commitSHA)
+	s.audit(r, "gitops.reload_credentials", "", sshKeyPath)
+
+	writeJSON(w, http.StatusOK, models.ReloadCredentialsResponse{
+		SSHKeyPath: sshKeyPath,
+		ReloadedAt: time.Now(),
+	})
 }
 
-// extractTarball extracts files from a gzipped tarball
-func (s *Server) extractTarball(reader io.ReadCloser) (map[string][]byte, error) {
-	gzReader, err := gzip.NewReader(reader)
+func (s *Server) handleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments := s.cfg.AllowedEnvironments
+	if environments == nil {
+		environments = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, models.ListEnvironmentsResponse{
+		Environments: environments,
+		Restricted:   len(environments) > 0,
+	})
+}
+
+// rejectUnknownEnvironment writes an invalid_request error and returns true
+// when environment is not one of ALLOWED_ENVIRONMENTS, so that a typo
+// doesn't create a directory in the gitops repo that nothing reconciles
+func (s *Server) rejectUnknownEnvironment(w http.ResponseWriter, environment string) bool {
+	if s.cfg.EnvironmentAllowed(environment) {
+		return false
+	}
+	writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Unknown environment %q; allowed environments are %s", environment, strings.Join(s.cfg.AllowedEnvironments, ", ")))
+	return true
+}
+
+// autoDeployVersion creates a deployment for a policy and queues it, or
+// holds it for approval if the target environment is protected. It logs to
+// the logger of the publish that triggered it and returns the deployment,
+// or nil if none could be created.
+func (s *Server) autoDeployVersion(ctx context.Context, logger *slog.Logger, app *models.Application, version *models.Version, policy models.Policy) *models.Deployment {
+	logger = logger.With("environment", policy.TargetEnvironment, "policy", policy.Name)
+	logger.Info("Auto-deploying version")
+
+	// Create deployment record
+	policyID := policy.ID
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, policy.TargetEnvironment, "auto-deploy", &policyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		logger.Error("Auto-deploy failed to create deployment record", "error", err)
+		return nil
 	}
-	defer gzReader.Close()
+	logger = logger.With("deployment_id", deployment.ID)
+	s.recordEvent(logger, deployment.ID, "created", fmt.Sprintf("Auto-deploy by policy %s", policy.Name))
+	metrics.AutoDeploys.WithLabelValues(policy.TargetEnvironment).Inc()
 
-	tarReader := tar.NewReader(gzReader)
-	files := make(map[string][]byte)
+	// Record denied auto-deploys as failed so they show up in the deployment history
+	decision, err := s.checkDeployPolicy(ctx, app, version, policy.TargetEnvironment, "auto-deploy")
+	if err != nil {
+		logger.Error("Auto-deploy failed to evaluate deploy policy", "error", err)
+		s.finishDeployment(logger, app, version, deployment, "failed", "", fmt.Sprintf("Failed to evaluate deploy policy: %v", err))
+		deployment.Status = "failed"
+		return deployment
+	}
+	if !decision.Allow {
+		logger.Warn("Auto-deploy denied by policy", "reason", decision.Reason)
+		s.finishDeployment(logger, app, version, deployment, "failed", "", fmt.Sprintf("Deploy denied by policy: %s", decision.Reason))
+		deployment.Status = "failed"
+		return deployment
+	}
+
+	commitMessage := s.commitMessage(gitops.CommitMessageData{
+		App:         app.Name,
+		Version:     version.VersionID,
+		Environment: policy.TargetEnvironment,
+		TriggeredBy: "auto-deploy",
+		Action:      "auto-deploy",
+		Policy:      policy.Name,
+		Message:     fmt.Sprintf("Auto-deploy %s version %s to %s (policy: %s)", app.Name, version.VersionID, policy.TargetEnvironment, policy.Name),
+	})
 
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
+	// Stop before pushing to protected environments; the deployment is
+	// queued once someone approves it
+	if app.RequiresApproval(policy.TargetEnvironment) {
+		if err := s.deploymentStore.HoldForApproval(deployment.ID, commitMessage); err != nil {
+			logger.Error("Auto-deploy failed to hold deployment for approval", "error", err)
+			s.finishDeployment(logger, app, version, deployment, "failed", "", err.Error())
+			deployment.Status = "failed"
+			return deployment
 		}
+		s.recordEvent(logger, deployment.ID, "awaiting_approval", "")
+		logger.Info("Auto-deploy is waiting for approval")
+		deployment.Status = "pending_approval"
+		return deployment
+	}
+
+	err = s.enqueueDeployment(deployJob{
+		app:           app,
+		version:       version,
+		deployment:    deployment,
+		commitMessage: commitMessage,
+		logger:        logger,
+	})
+	if err != nil {
+		logger.Error("Auto-deploy failed to queue deployment", "error", err)
+		s.finishDeployment(logger, app, version, deployment, "failed", "", err.Error())
+		deployment.Status = "failed"
+	}
+	return deployment
+}
+
+// builtinVariables are the placeholders smithd fills in from the deployment;
+// environment variables can't override them
+var builtinVariables = []string{"APP_NAME", "VERSION", "ENVIRONMENT", "GIT_SHA", "GIT_BRANCH", "GIT_COMMITTER", "BUILD_NUMBER"}
+
+// prepareManifests expands a version's files into the manifests to write and,
+// if the application opted in, replaces placeholders with version metadata
+// and the target environment's variables. The bundle may not expand past
+// limits.
+func prepareManifests(app *models.Application, version *models.Version, environment string, files map[string][]byte, limits gitops.TarballLimits) (map[string][]byte, error) {
+	manifests, err := gitops.ExpandManifests(files, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.InterpolateManifests {
+		return manifests, nil
+	}
+
+	vars := make(map[string]string)
+	for name, value := range app.EnvironmentVariables[environment] {
+		vars[name] = value
+	}
+	vars["APP_NAME"] = app.Name
+	vars["VERSION"] = version.VersionID
+	vars["ENVIRONMENT"] = environment
+	vars["GIT_SHA"] = version.GitSHA
+	vars["GIT_BRANCH"] = version.GitBranch
+	vars["GIT_COMMITTER"] = version.GitCommitter
+	vars["BUILD_NUMBER"] = version.BuildNumber
+
+	return gitops.Interpolate(manifests, vars)
+}
+
+// buildDeploymentPlan records a hash of every manifest a deployment writes
+// under gitopsPath, alongside a pointer to the version bundle
+func buildDeploymentPlan(bundle, gitopsPath string, manifests map[string][]byte) *models.DeploymentPlan {
+	plan := &models.DeploymentPlan{
+		Bundle:     bundle,
+		GitopsPath: gitopsPath,
+		Files:      make([]models.PlanFile, 0, len(manifests)),
+	}
+	for filename, content := range manifests {
+		sum := sha256.Sum256(content)
+		plan.Files = append(plan.Files, models.PlanFile{
+			Path:   path.Join(gitopsPath, filename),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	sort.Slice(plan.Files, func(i, j int) bool {
+		return plan.Files[i].Path < plan.Files[j].Path
+	})
+
+	return plan
+}
+
+// validateDraft checks that a draft holds valid YAML manifests, either in a
+// manifests.tar.gz bundle or as individual files. Non-YAML files are listed
+// as assets without being validated. With validateObjects set, every
+// manifest must also be a Kubernetes object.
+func (s *Server) validateDraft(logger *slog.Logger, versionID string, files map[string][]byte, validateObjects bool) *models.ValidateVersionResponse {
+	result := &models.ValidateVersionResponse{
+		VersionID:     versionID,
+		ManifestFiles: []string{},
+		Errors:        []models.ValidationIssue{},
+		Warnings:      []models.ValidationIssue{},
+	}
+
+	if len(files) == 0 {
+		result.Errors = append(result.Errors, models.ValidationIssue{Message: "No manifest files uploaded"})
+		return result
+	}
+
+	// Validate the bundle contents instead of the uploaded files if there is one
+	manifests := files
+	if tarball, ok := files["manifests.tar.gz"]; ok {
+		extracted, err := s.extractTarball(io.NopCloser(bytes.NewReader(tarball)))
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tar header: %w", err)
+			result.Errors = append(result.Errors, models.ValidationIssue{
+				File:    "manifests.tar.gz",
+				Message: fmt.Sprintf("Invalid manifests.tar.gz: %v", err),
+			})
+			return result
+		}
+		logger.Info("Extracted files from tarball", "count", len(extracted), "files", getKeys(extracted))
+
+		// Files uploaded next to the bundle are written too, so names can't clash
+		for filename := range files {
+			if _, ok := extracted[filename]; ok && filename != "manifests.tar.gz" {
+				result.Errors = append(result.Errors, models.ValidationIssue{
+					File:    filename,
+					Message: fmt.Sprintf("%s is both uploaded and in manifests.tar.gz", filename),
+				})
+			}
 		}
+		manifests = extracted
+	}
 
-		// Only process regular files
-		if header.Typeflag == tar.TypeReg {
-			content, err := io.ReadAll(tarReader)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read file %s: %w", header.Name, err)
+	filenames := getKeys(manifests)
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		// Non-YAML files are assets, kept as they are
+		if !gitops.IsManifest(filename) {
+			result.AssetFiles = append(result.AssetFiles, filename)
+			continue
+		}
+
+		// Validate YAML syntax
+		var yamlContent interface{}
+		if err := yaml.Unmarshal(manifests[filename], &yamlContent); err != nil {
+			logger.Warn("YAML validation failed", "file", filename, "error", err)
+			result.Errors = append(result.Errors, models.ValidationIssue{
+				File:    filename,
+				Line:    manifest.ErrorLine(err),
+				Message: fmt.Sprintf("Invalid YAML in %s: %v", filename, err),
+			})
+			continue
+		}
+
+		// Validate the Kubernetes object fields
+		if validateObjects {
+			if err := manifest.Validate(filename, manifests[filename]); err != nil {
+				logger.Warn("Manifest validation failed", "file", filename, "error", err)
+				issue := models.ValidationIssue{
+					File:    filename,
+					Message: fmt.Sprintf("Invalid manifest %v", err),
+				}
+				var merr *manifest.Error
+				if errors.As(err, &merr) {
+					issue.Line = merr.Line
+				}
+				result.Errors = append(result.Errors, issue)
+				continue
 			}
-			files[header.Name] = content
 		}
+
+		result.ManifestFiles = append(result.ManifestFiles, filename)
 	}
 
-	return files, nil
+	if len(result.ManifestFiles) == 0 && len(result.Errors) == 0 {
+		result.Errors = append(result.Errors, models.ValidationIssue{Message: "No valid YAML manifest files found"})
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// extractTarball extracts files from a gzipped tarball, failing once it
+// goes over s.tarballLimits
+func (s *Server) extractTarball(reader io.ReadCloser) (map[string][]byte, error) {
+	return gitops.ExtractTarball(reader, s.tarballLimits)
+}
+
+// storageLocation returns the storage location for an application's versions
+func storageLocation(app *models.Application) storage.Location {
+	return storage.Location{
+		App:    app.Name,
+		Bucket: app.StorageBucket,
+		Prefix: app.StoragePrefix,
+	}
+}
+
+// isPathSegment reports whether name is safe as a single segment of a
+// storage key, with no separators or ".." to climb out of its prefix
+func isPathSegment(name string) bool {
+	return !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
 }
 
 // getKeys returns the keys of a map as a slice
@@ -0,0 +1,1559 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/sorenmh/deploysmith/internal/smithd/config"
+	"github.com/sorenmh/deploysmith/internal/smithd/db"
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+	"github.com/sorenmh/deploysmith/internal/smithd/notify"
+	"github.com/sorenmh/deploysmith/internal/smithd/storage"
+	"github.com/sorenmh/deploysmith/internal/smithd/store"
+)
+
+const testAPIKey = "test-key"
+
+// testDeploymentManifest is a minimal valid Kubernetes object
+const testDeploymentManifest = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-api\n"
+
+// newTestServer creates a server backed by a temporary database. Storage and
+// gitops are left unset and deploy workers are not started, so queued
+// deployments stay in s.deployQueue.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	database, err := db.Open("sqlite", filepath.Join(t.TempDir(), "smithd.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	s := &Server{
+		cfg:             &config.Config{APIKeys: []config.APIKey{{Name: "key-1", Hash: config.HashAPIKey(testAPIKey), Scopes: config.AllScopes}}},
+		db:              database,
+		router:          chi.NewRouter(),
+		appStore:        store.NewApplicationStore(database.DB),
+		versionStore:    store.NewVersionStore(database.DB),
+		deploymentStore: store.NewDeploymentStore(database.DB),
+		policyStore:     store.NewPolicyStore(database.DB),
+		auditStore:      store.NewAuditStore(database.DB),
+		deployQueue:     make(chan deployJob, 1),
+		notifier:        notify.Nop{},
+
+		deploymentEventStore: store.NewDeploymentEventStore(database.DB),
+		baseCtx:              context.Background(),
+	}
+	s.setupRoutes()
+
+	return s
+}
+
+// createPublishedVersion registers an app with a published version
+func createPublishedVersion(t *testing.T, s *Server, appName, versionID string) (*models.Application, *models.Version) {
+	t.Helper()
+
+	app, err := s.appStore.Create(appName, "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	version, err := s.versionStore.Create(app.ID, versionID, models.VersionMetadata{
+		GitSHA:    "abc123",
+		GitBranch: "main",
+		Timestamp: "2025-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	if err := s.versionStore.UpdateStatus(version.ID, "published"); err != nil {
+		t.Fatalf("failed to publish version: %v", err)
+	}
+	version.Status = "published"
+
+	return app, version
+}
+
+// createTestPolicy creates an enabled auto-deploy policy for the main branch
+func createTestPolicy(t *testing.T, s *Server, appID, name, environment string) models.Policy {
+	t.Helper()
+
+	policy, err := s.policyStore.Create(appID, name, "main", environment, true, 0)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	return *policy
+}
+
+// doRequest sends an authenticated request to the server
+func doRequest(t *testing.T, s *Server, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestDeployVersion_QueuesDeployment(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.DeployVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "pending" || resp.DeploymentID == "" {
+		t.Errorf("expected pending deployment with ID, got %+v", resp)
+	}
+
+	select {
+	case job := <-s.deployQueue:
+		if job.deployment.ID != resp.DeploymentID {
+			t.Errorf("queued deployment %s, want %s", job.deployment.ID, resp.DeploymentID)
+		}
+	default:
+		t.Fatal("expected deployment to be queued")
+	}
+
+	deployment, err := s.deploymentStore.GetByID(resp.DeploymentID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if deployment.Status != "pending" {
+		t.Errorf("expected pending status, got %s", deployment.Status)
+	}
+}
+
+func TestAppRoutes_AcceptName(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	for _, ref := range []string{app.ID, "my-api"} {
+		rec := doRequest(t, s, "GET", "/api/v1/apps/"+ref, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /apps/%s: expected 200, got %d: %s", ref, rec.Code, rec.Body.String())
+		}
+		var resp models.GetAppResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.ID != app.ID {
+			t.Errorf("GET /apps/%s returned app %s, want %s", ref, resp.ID, app.ID)
+		}
+	}
+
+	rec := doRequest(t, s, "POST", "/api/v1/apps/my-api/versions/v1.0.0/deploy", models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	job := <-s.deployQueue
+	if job.deployment.AppID != app.ID {
+		t.Errorf("expected deployment for app %s, got %s", app.ID, job.deployment.AppID)
+	}
+
+	rec = doRequest(t, s, "GET", "/api/v1/apps/my-api/deployments/"+job.deployment.ID, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for deployment looked up by app name, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "GET", "/api/v1/apps/other-api", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown app name, got %d", rec.Code)
+	}
+}
+
+func TestDeployVersion_QueueFull(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	// Fill the queue
+	if rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"}); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+
+	rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deployments, _, err := s.deploymentStore.List(app.ID, "", "", 50, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	failed := 0
+	for _, d := range deployments {
+		if d.Status == "failed" {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("expected the rejected deployment to be marked failed, got %d failed", failed)
+	}
+}
+
+// fakeNotifier records the events it is sent
+type fakeNotifier chan notify.Event
+
+func (f fakeNotifier) Notify(event notify.Event) error {
+	f <- event
+	return nil
+}
+
+func TestDeployVersion_NotifiesOnFailure(t *testing.T) {
+	s := newTestServer(t)
+	events := make(fakeNotifier, 1)
+	s.notifier = events
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	// Fill the queue so the second deploy fails
+	doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"})
+	rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case event := <-events:
+		if event.App != "my-api" || event.Version != "v1.0.0" || event.Environment != "staging" || event.Status != "failed" || event.Error == "" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a notification for the failed deployment")
+	}
+}
+
+func TestDeployVersion_MultipleEnvironments(t *testing.T) {
+	s := newTestServer(t)
+	s.deployQueue = make(chan deployJob, 2)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environments: []string{"staging", "canary"}})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.DeployVersionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Deployments) != 2 {
+		t.Fatalf("expected 2 deployments, got %d", len(resp.Deployments))
+	}
+	for i, environment := range []string{"staging", "canary"} {
+		if resp.Deployments[i].Environment != environment || resp.Deployments[i].Status != "pending" {
+			t.Errorf("expected pending deployment to %s, got %+v", environment, resp.Deployments[i])
+		}
+	}
+	if resp.Deployments[0].DeploymentID == resp.Deployments[1].DeploymentID {
+		t.Error("expected a separate deployment per environment")
+	}
+
+	// Each environment is queued as its own job
+	if len(s.deployQueue) != 2 {
+		t.Fatalf("expected 2 queued jobs, got %d", len(s.deployQueue))
+	}
+	first, second := <-s.deployQueue, <-s.deployQueue
+	if first.commitMessage == second.commitMessage {
+		t.Errorf("expected a commit per environment, got %q twice", first.commitMessage)
+	}
+}
+
+func TestDeployVersion_MultipleEnvironmentsPartialQueue(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	// The queue only has room for the first environment
+	rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environments: []string{"staging", "canary"}})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.DeployVersionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Deployments) != 2 || resp.Deployments[0].Status != "pending" || resp.Deployments[1].Status != "failed" {
+		t.Fatalf("expected staging pending and canary failed, got %+v", resp.Deployments)
+	}
+	if resp.Deployments[0].Error != "" || resp.Deployments[1].Error != "deployment queue is full" {
+		t.Errorf("expected only canary to say why it failed, got %+v", resp.Deployments)
+	}
+}
+
+func TestDeployVersion_StartFailedIsNotQueueFull(t *testing.T) {
+	s := newTestServer(t)
+	s.deployQueue = make(chan deployJob, 2)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+	rec := doRequest(t, s, "PUT", fmt.Sprintf("/api/v1/apps/%s/environments/production/approval", app.ID), models.SetApprovalRequest{RequiresApproval: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Holding the deployment for approval fails with the queue empty
+	_, err := s.db.Exec(`
+		CREATE TRIGGER fail_hold BEFORE UPDATE OF commit_message ON deployments
+		BEGIN SELECT RAISE(ABORT, 'boom'); END
+	`)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	rec = doRequest(t, s, "POST", path, models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&errResp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if errResp.Error.Code != "internal_error" || !strings.Contains(errResp.Error.Message, "boom") {
+		t.Errorf("expected the real cause, got %+v", errResp.Error)
+	}
+
+	// With several environments, each one says why it failed
+	rec = doRequest(t, s, "POST", path, models.DeployVersionRequest{Environments: []string{"staging", "production"}})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.DeployVersionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Deployments) != 2 || resp.Deployments[0].Status != "pending" || resp.Deployments[1].Status != "failed" {
+		t.Fatalf("expected staging pending and production failed, got %+v", resp.Deployments)
+	}
+	if !strings.Contains(resp.Deployments[1].Error, "boom") {
+		t.Errorf("expected production to say why it failed, got %q", resp.Deployments[1].Error)
+	}
+}
+
+func TestDeployVersion_MultipleEnvironmentsCreateFailed(t *testing.T) {
+	s := newTestServer(t)
+	s.deployQueue = make(chan deployJob, 2)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	// The second environment's deployment can't be created
+	_, err := s.db.Exec(`
+		CREATE TRIGGER fail_canary BEFORE INSERT ON deployments
+		WHEN NEW.environment = 'canary'
+		BEGIN SELECT RAISE(ABORT, 'boom'); END
+	`)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	rec := doRequest(t, s, "POST", path, models.DeployVersionRequest{Environments: []string{"staging", "canary"}})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(s.deployQueue) != 0 {
+		t.Errorf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+	deployments, _, err := s.deploymentStore.List(app.ID, "", "", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].Environment != "staging" || deployments[0].Status != "failed" {
+		t.Errorf("expected the staging deployment to fail, got %+v", deployments)
+	}
+}
+
+func TestDeployVersion_InvalidEnvironments(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID)
+
+	requests := map[string]models.DeployVersionRequest{
+		"none":      {},
+		"both":      {Environment: "staging", Environments: []string{"canary"}},
+		"empty":     {Environments: []string{"staging", ""}},
+		"duplicate": {Environments: []string{"staging", "staging"}},
+	}
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			rec := doRequest(t, s, "POST", path, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if len(s.deployQueue) != 0 {
+		t.Errorf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+}
+
+func TestAllowedEnvironments(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "GET", "/api/v1/environments", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"restricted":false`) {
+		t.Fatalf("expected unrestricted environments, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	s.cfg.AllowedEnvironments = []string{"staging", "production"}
+
+	rec = doRequest(t, s, "GET", "/api/v1/environments", nil)
+	var resp models.ListEnvironmentsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.Restricted || len(resp.Environments) != 2 {
+		t.Errorf("expected the 2 allowed environments, got %+v", resp)
+	}
+
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environments: []string{"staging", "prodution"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "prodution") {
+		t.Errorf("expected 400 naming prodution, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(s.deployQueue) != 0 {
+		t.Errorf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/policies", app.ID), models.CreatePolicyRequest{
+		Name:              "auto-main",
+		GitBranchPattern:  "main",
+		TargetEnvironment: "prodution",
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for policy targeting prodution, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected 202 for an allowed environment, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSetVariables(t *testing.T) {
+	s := newTestServer(t)
+	app, err := s.appStore.Create("my-api", "", "", true)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	path := fmt.Sprintf("/api/v1/apps/%s/environments/production/variables", app.ID)
+
+	rec := doRequest(t, s, "PUT", path, models.SetVariablesRequest{Variables: map[string]string{"REPLICAS": "3"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stored, err := s.appStore.GetByID(app.ID)
+	if err != nil {
+		t.Fatalf("failed to get application: %v", err)
+	}
+	if stored.EnvironmentVariables["production"]["REPLICAS"] != "3" {
+		t.Errorf("expected REPLICAS=3 for production, got %v", stored.EnvironmentVariables)
+	}
+
+	for name, variables := range map[string]map[string]string{
+		"lowercase name": {"replicas": "3"},
+		"builtin name":   {"GIT_SHA": "abc"},
+	} {
+		rec := doRequest(t, s, "PUT", path, models.SetVariablesRequest{Variables: variables})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Apps that don't interpolate manifests can't have variables
+	plain, err := s.appStore.Create("plain-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	rec = doRequest(t, s, "PUT", fmt.Sprintf("/api/v1/apps/%s/environments/production/variables", plain.ID), models.SetVariablesRequest{Variables: map[string]string{"REPLICAS": "3"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// failingStorage is a Storage whose reads fail
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) GetAllFiles(ctx context.Context, loc storage.Location, versionID string, published bool) (map[string][]byte, error) {
+	return nil, &storage.Error{Err: fmt.Errorf("bucket unavailable")}
+}
+
+func TestRunDeployment_RecordsFailure(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = failingStorage{}
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" {
+		t.Errorf("expected failed status, got %s", got.Status)
+	}
+	if got.ErrorMessage != "Failed to fetch manifests: bucket unavailable" {
+		t.Errorf("unexpected error message: %s", got.ErrorMessage)
+	}
+	if got.CompletedAt == nil {
+		t.Error("expected completedAt to be set")
+	}
+}
+
+// blockingStorage is a Storage whose reads wait until they are cancelled
+type blockingStorage struct {
+	storage.Storage
+}
+
+func (blockingStorage) GetAllFiles(ctx context.Context, loc storage.Location, versionID string, published bool) (map[string][]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunDeployment_Timeout(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = blockingStorage{}
+	s.cfg.DeployTimeout = 10 * time.Millisecond
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" || got.ErrorMessage != "Failed to fetch manifests: context deadline exceeded" {
+		t.Errorf("expected the deployment to time out, got %s: %s", got.Status, got.ErrorMessage)
+	}
+}
+
+func TestRunDeployment_PushesEarlierCommit(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+	var remote string
+	s.gitops, remote = newTestGitopsRemote(t, map[string]string{"README.md": "gitops\n"})
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{"deployment.yaml": []byte(testDeploymentManifest)}
+
+	// An earlier deployment of the version committed and then failed to push
+	manifests, err := prepareManifests(app, version, "staging", mem.files["published/v1.0.0"], gitops.TarballLimits{})
+	if err != nil {
+		t.Fatalf("failed to prepare manifests: %v", err)
+	}
+	if err := s.gitops.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if err := s.gitops.WriteManifests(app.Name, "staging", version.VersionID, manifests); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	unpushed, err := s.gitops.Commit("Deploy")
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// Redeploying finds nothing to commit but still pushes the commit
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "success" || got.GitopsCommitSHA != unpushed {
+		t.Fatalf("expected success with commit %s, got %s (%s): %s", unpushed, got.Status, got.GitopsCommitSHA, got.ErrorMessage)
+	}
+
+	remoteRepo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("failed to open remote: %v", err)
+	}
+	head, err := remoteRepo.Head()
+	if err != nil || head.Hash().String() != unpushed {
+		t.Errorf("expected the remote at %s, got %v, %v", unpushed, head, err)
+	}
+}
+
+func TestRunDeployment_FailedPushLeavesNothingBehind(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+	var remote string
+	s.gitops, remote = newTestGitopsRemote(t, map[string]string{"README.md": "gitops\n"})
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{"deployment.yaml": []byte(testDeploymentManifest)}
+	if err := s.gitops.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	// The remote can still be pulled from but can't store the pushed pack
+	packs := filepath.Join(remote, "objects", "pack")
+	if err := os.Rename(packs, packs+".bak"); err != nil {
+		t.Fatalf("failed to move packs: %v", err)
+	}
+	if err := os.WriteFile(packs, nil, 0644); err != nil {
+		t.Fatalf("failed to block packs: %v", err)
+	}
+	failed, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	s.runDeployment(deployJob{app: app, version: version, deployment: failed, commitMessage: "Deploy staging"})
+	if got, _ := s.deploymentStore.GetByID(failed.ID); got.Status != "failed" {
+		t.Fatalf("expected the push to fail, got %s", got.Status)
+	}
+	if err := os.Remove(packs); err != nil {
+		t.Fatalf("failed to unblock packs: %v", err)
+	}
+	if err := os.Rename(packs+".bak", packs); err != nil {
+		t.Fatalf("failed to restore packs: %v", err)
+	}
+
+	// The next deployment pushes only its own manifests
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy production"})
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", got.Status, got.ErrorMessage)
+	}
+
+	remoteRepo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("failed to open remote: %v", err)
+	}
+	head, err := remoteRepo.Head()
+	if err != nil {
+		t.Fatalf("failed to get remote HEAD: %v", err)
+	}
+	commit, err := remoteRepo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if _, err := commit.File("environments/staging/apps/my-api/deployment.yaml"); err == nil {
+		t.Error("expected the failed staging deployment not to reach the remote")
+	}
+	if _, err := commit.File("environments/production/apps/my-api/deployment.yaml"); err != nil {
+		t.Errorf("expected the production deployment on the remote: %v", err)
+	}
+}
+
+func TestFailExpiredDeployments(t *testing.T) {
+	s := newTestServer(t)
+	s.instanceID = "instance-a"
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	// A stopped instance lost the queued deployment; another instance is
+	// running one and the held one wasn't queued yet
+	lost, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.Claim(lost.ID, "stopped-instance"); err != nil {
+		t.Fatalf("failed to claim deployment: %v", err)
+	}
+	if _, err := s.db.Exec("UPDATE deployments SET heartbeat_at = ? WHERE id = ?", time.Now().Add(-time.Hour).UTC(), lost.ID); err != nil {
+		t.Fatalf("failed to age lease: %v", err)
+	}
+	running, err := s.deploymentStore.Create(app.ID, version.ID, "canary", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.Claim(running.ID, "instance-b"); err != nil {
+		t.Fatalf("failed to claim deployment: %v", err)
+	}
+	held, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.HoldForApproval(held.ID, "Deploy"); err != nil {
+		t.Fatalf("failed to hold deployment: %v", err)
+	}
+
+	s.failExpiredDeployments(time.Now().Add(-deploymentLease))
+
+	got, err := s.deploymentStore.GetByID(lost.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" || got.ErrorMessage != "smithd stopped before the deployment ran" || got.CompletedAt == nil {
+		t.Errorf("expected the lost deployment to fail, got %s: %s", got.Status, got.ErrorMessage)
+	}
+	for _, id := range []string{running.ID, held.ID} {
+		got, err := s.deploymentStore.GetByID(id)
+		if err != nil {
+			t.Fatalf("failed to get deployment: %v", err)
+		}
+		if got.Status == "failed" {
+			t.Errorf("expected %s deployment %s to be left alone", got.Environment, id)
+		}
+	}
+}
+
+func TestRunDeployment_TimeoutStartsWithGitopsLock(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+	s.gitops = newTestGitops(t, map[string]string{"README.md": "gitops\n"})
+	s.cfg.DeployTimeout = time.Second
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{"deployment.yaml": []byte(testDeploymentManifest)}
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	// Another deployment holds the gitops repo for longer than the timeout
+	s.gitops.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+	}()
+	time.Sleep(1500 * time.Millisecond)
+	s.gitops.Unlock()
+	<-done
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "success" {
+		t.Errorf("expected time waiting for the gitops repo not to count, got %s: %s", got.Status, got.ErrorMessage)
+	}
+}
+
+func TestRunDeployment_CancelledWaitingForGitops(t *testing.T) {
+	s := newTestServer(t)
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+	s.gitops = newTestGitops(t, map[string]string{"README.md": "gitops\n"})
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	mem.files["published/v1.0.0"] = map[string][]byte{"deployment.yaml": []byte(testDeploymentManifest)}
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	// Shutting down stops a deployment stuck behind another one
+	s.gitops.Lock()
+	defer s.gitops.Unlock()
+	s.cancelBase()
+	s.runDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"})
+
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" || got.ErrorMessage != "Failed to wait for the gitops repo: context canceled" {
+		t.Errorf("expected the wait to be cancelled, got %s: %s", got.Status, got.ErrorMessage)
+	}
+}
+
+func TestShutdown_WaitsForDeployments(t *testing.T) {
+	s := newTestServer(t)
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	s.storage = blockingStorage{}
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.enqueueDeployment(deployJob{app: app, version: version, deployment: deployment, commitMessage: "Deploy"}); err != nil {
+		t.Fatalf("failed to queue deployment: %v", err)
+	}
+	s.startDeployWorkers(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// The deployment was cancelled at the deadline and recorded before
+	// Shutdown returned
+	got, err := s.deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if got.Status != "failed" || got.ErrorMessage != "Failed to fetch manifests: context canceled" {
+		t.Errorf("expected the deployment to be cancelled, got %s: %s", got.Status, got.ErrorMessage)
+	}
+
+	if err := s.enqueueDeployment(deployJob{app: app, version: version, deployment: deployment}); err == nil {
+		t.Error("expected deployments queued after shutdown to be refused")
+	}
+}
+
+// deletingStorage is a Storage that records deleted versions
+type deletingStorage struct {
+	storage.Storage
+	deleted []string
+}
+
+func (d *deletingStorage) DeleteVersion(ctx context.Context, loc storage.Location, versionID string, published bool) error {
+	d.deleted = append(d.deleted, versionID)
+	return nil
+}
+
+func TestDeleteVersion(t *testing.T) {
+	s := newTestServer(t)
+	stored := &deletingStorage{}
+	s.storage = stored
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	// A failed deployment does not keep the version around
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "staging", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.UpdateStatus(deployment.ID, "failed", "", "boom"); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	rec := doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0", app.ID), nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(stored.deleted) != 1 || stored.deleted[0] != "v1.0.0" {
+		t.Errorf("expected stored files of v1.0.0 to be deleted, got %v", stored.deleted)
+	}
+	if _, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0"); err == nil || err.Error() != "version not found" {
+		t.Errorf("expected version not found, got %v", err)
+	}
+}
+
+func TestDeleteVersion_Replaced(t *testing.T) {
+	s := newTestServer(t)
+	stored := &deletingStorage{}
+	s.storage = stored
+	app, first := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	second, err := s.versionStore.Create(app.ID, "v2.0.0", models.VersionMetadata{GitSHA: "def456", GitBranch: "main", Timestamp: "2025-01-02T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+
+	// v1.0.0 was deployed once, then replaced by v2.0.0
+	for _, version := range []*models.Version{first, second} {
+		deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+		if err != nil {
+			t.Fatalf("failed to create deployment: %v", err)
+		}
+		if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", "abc123", ""); err != nil {
+			t.Fatalf("failed to update deployment: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0", app.ID), nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s/versions/v2.0.0", app.ID), nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for the current version, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeleteVersion_PendingConflict(t *testing.T) {
+	for _, status := range []string{"pending", "pending_approval"} {
+		t.Run(status, func(t *testing.T) {
+			s := newTestServer(t)
+			stored := &deletingStorage{}
+			s.storage = stored
+			app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+			deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+			if err != nil {
+				t.Fatalf("failed to create deployment: %v", err)
+			}
+			if status == "pending_approval" {
+				if err := s.deploymentStore.HoldForApproval(deployment.ID, "Deploy"); err != nil {
+					t.Fatalf("failed to hold deployment: %v", err)
+				}
+			}
+
+			rec := doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0", app.ID), nil)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if len(stored.deleted) != 0 {
+				t.Errorf("expected no files to be deleted, got %v", stored.deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteVersion_DeployedConflict(t *testing.T) {
+	s := newTestServer(t)
+	stored := &deletingStorage{}
+	s.storage = stored
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", "def456", ""); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	rec := doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0", app.ID), nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(stored.deleted) != 0 {
+		t.Errorf("expected no files to be deleted, got %v", stored.deleted)
+	}
+	if _, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0"); err != nil {
+		t.Errorf("expected version to remain, got %v", err)
+	}
+}
+
+func TestDeleteApp_HeldDeploymentConflict(t *testing.T) {
+	s := newTestServer(t)
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	// Approving the held deployment would still write the app's manifests
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.HoldForApproval(deployment.ID, "Deploy"); err != nil {
+		t.Fatalf("failed to hold deployment: %v", err)
+	}
+
+	rec := doRequest(t, s, "DELETE", fmt.Sprintf("/api/v1/apps/%s", app.ID), nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := s.appStore.GetByID(app.ID); err != nil {
+		t.Errorf("expected app to remain, got %v", err)
+	}
+}
+
+func TestRegisterApp_RejectsPathNames(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, name := range []string{"foo/..", "..", `foo\bar`, "a/b"} {
+		rec := doRequest(t, s, "POST", "/api/v1/apps", models.RegisterAppRequest{Name: name})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDraftVersion_RejectsPathVersionIDs(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	metadata := models.VersionMetadata{GitSHA: "abc123", GitBranch: "main", Timestamp: "2024-01-01T00:00:00Z"}
+
+	for _, versionID := range []string{"x/../../../published/other/v1", "..", `v1\v2`, "feature/x"} {
+		rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/draft", app.ID), models.DraftVersionRequest{VersionID: versionID, Metadata: metadata})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d: %s", versionID, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDraftVersion_OCIRejectsInvalidTags(t *testing.T) {
+	s := newTestServer(t)
+	s.storage = &memoryStorage{files: map[string]map[string][]byte{}}
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	metadata := models.VersionMetadata{GitSHA: "abc123", GitBranch: "main", Timestamp: "2024-01-01T00:00:00Z"}
+	path := fmt.Sprintf("/api/v1/apps/%s/versions/draft", app.ID)
+
+	// S3 storage takes any ID that stays in its prefix
+	if rec := doRequest(t, s, "POST", path, models.DraftVersionRequest{VersionID: "v1.1.0+build.1", Metadata: metadata}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with S3 storage, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	s.cfg.StorageType = "oci"
+	for _, versionID := range []string{"v1.2.0+build.1", ".v1", "-v1", strings.Repeat("a", 129)} {
+		rec := doRequest(t, s, "POST", path, models.DraftVersionRequest{VersionID: versionID, Metadata: metadata})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d: %s", versionID, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := doRequest(t, s, "POST", path, models.DraftVersionRequest{VersionID: "v1.2.0", Metadata: metadata}); rec.Code != http.StatusCreated {
+		t.Errorf("expected 201 for a valid tag, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	policy, err := s.policyStore.Create(app.ID, "auto-main", "main", "staging", true, 0)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	branch := "release/*"
+	enabled := false
+	rec := doRequest(t, s, "PATCH", fmt.Sprintf("/api/v1/apps/%s/policies/%s", app.ID, policy.ID), models.UpdatePolicyRequest{
+		GitBranchPattern: &branch,
+		Enabled:          &enabled,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.PolicyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ID != policy.ID || resp.Name != "auto-main" || resp.GitBranchPattern != "release/*" || resp.TargetEnvironment != "staging" || resp.Enabled {
+		t.Errorf("unexpected policy after update: %+v", resp)
+	}
+}
+
+func TestCreatePolicy_InvalidRegex(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/policies", app.ID)
+
+	rec := doRequest(t, s, "POST", path, models.CreatePolicyRequest{
+		Name:              "auto-release",
+		GitBranchPattern:  `regex:release/(v\d+`,
+		TargetEnvironment: "production",
+	})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_request") {
+		t.Fatalf("expected 400 invalid_request, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "POST", path, models.CreatePolicyRequest{
+		Name:              "auto-release",
+		GitBranchPattern:  `regex:release/v\d+\.\d+`,
+		TargetEnvironment: "production",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdatePolicy_OtherApp(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	other, _ := createPublishedVersion(t, s, "other-api", "v1.0.0")
+
+	policy, err := s.policyStore.Create(other.ID, "auto-main", "main", "staging", true, 0)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	enabled := false
+	rec := doRequest(t, s, "PATCH", fmt.Sprintf("/api/v1/apps/%s/policies/%s", app.ID, policy.ID), models.UpdatePolicyRequest{Enabled: &enabled})
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPublishVersion_DryRun(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{
+			"deployment.yaml": testDeploymentManifest,
+			"service.yaml":    "kind: [Service\n",
+			"README.md":       "docs",
+		}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish?dryRun=true", app.ID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.ValidateVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Valid {
+		t.Error("expected draft with invalid YAML to be invalid")
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].File != "service.yaml" {
+		t.Errorf("expected one error for service.yaml, got %+v", resp.Errors)
+	}
+	if len(resp.AssetFiles) != 1 || resp.AssetFiles[0] != "README.md" {
+		t.Errorf("expected README.md to be an asset, got %+v", resp.AssetFiles)
+	}
+
+	// Nothing was published
+	version, err := s.versionStore.GetByVersionID(app.ID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	if version.Status != "draft" {
+		t.Errorf("expected version to stay draft, got %s", version.Status)
+	}
+	if _, ok := mem.files["drafts/v1.0.0"]; !ok {
+		t.Error("expected draft files to stay in place")
+	}
+}
+
+func TestPublishVersion_InvalidManifest(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{
+			"deployment.yaml": "apiVersion: apps/v1\nmetadata:\n  name: my-api\n",
+			"service.yaml":    "apiVersion: v1\nkind: Service\nmetadata:\n  name: a: b\n",
+		}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Error.Code != "validation_failed" {
+		t.Errorf("expected validation_failed, got %s", resp.Error.Code)
+	}
+	if !strings.Contains(resp.Error.Message, "deployment.yaml") || !strings.Contains(resp.Error.Message, "kind") {
+		t.Errorf("expected error to name the file and field, got %q", resp.Error.Message)
+	}
+
+	// Every file's problems are listed with their line
+	details := resp.Error.Details
+	if len(details) != 2 || details[0].File != "deployment.yaml" || details[0].Line != 1 || details[1].File != "service.yaml" || details[1].Line != 4 {
+		t.Errorf("expected an issue with a line for each file, got %+v", details)
+	}
+
+	// noValidate skips the Kubernetes object check
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{
+			"deployment.yaml": "apiVersion: apps/v1\nmetadata:\n  name: my-api\n",
+		}),
+	}
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), models.PublishVersionRequest{NoValidate: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with noValidate, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPublishVersion_ReturnsAutoDeployments(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{GitBranch: "main", Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	if _, err := s.policyStore.Create(app.ID, "auto-main", "main", "staging", true, 0); err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": testDeploymentManifest}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.PublishVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.AutoDeployments) != 1 {
+		t.Fatalf("expected 1 auto-deployment, got %+v", resp.AutoDeployments)
+	}
+	auto := resp.AutoDeployments[0]
+	if auto.DeploymentID == "" || auto.Environment != "staging" || auto.Status != "pending" || auto.VersionID != "v1.0.0" {
+		t.Errorf("unexpected auto-deployment: %+v", auto)
+	}
+
+	// The deployment exists and is queued by the time publish responds
+	if _, err := s.deploymentStore.GetByID(auto.DeploymentID); err != nil {
+		t.Errorf("expected auto-deployment to exist: %v", err)
+	}
+	select {
+	case job := <-s.deployQueue:
+		if job.deployment.ID != auto.DeploymentID {
+			t.Errorf("queued deployment %s, want %s", job.deployment.ID, auto.DeploymentID)
+		}
+	default:
+		t.Fatal("expected auto-deployment to be queued")
+	}
+}
+
+// deploySuccessfully records a successful deployment of a version
+func deploySuccessfully(t *testing.T, s *Server, app *models.Application, version *models.Version, environment string) {
+	t.Helper()
+
+	deployment, err := s.deploymentStore.Create(app.ID, version.ID, environment, "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := s.deploymentStore.UpdateStatus(deployment.ID, "success", "abc123", ""); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	s := newTestServer(t)
+	app, v1 := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	v2, err := s.versionStore.Create(app.ID, "v2.0.0", models.VersionMetadata{Timestamp: "2025-01-02T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+
+	deploySuccessfully(t, s, app, v1, "staging")
+	deploySuccessfully(t, s, app, v2, "staging")
+	deploySuccessfully(t, s, app, v2, "staging")
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/rollback", app.ID), models.RollbackRequest{Environment: "staging", Reason: "error rate spiked"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.DeployVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.VersionID != "v1.0.0" {
+		t.Errorf("expected rollback to v1.0.0, got %s", resp.VersionID)
+	}
+
+	deployment, err := s.deploymentStore.GetByID(resp.DeploymentID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if deployment.TriggeredBy != "rollback" || deployment.VersionID != v1.ID {
+		t.Errorf("expected rollback deployment of v1.0.0, got %+v", deployment)
+	}
+	if deployment.RolledBackFrom != "v2.0.0" || deployment.Reason != "error rate spiked" {
+		t.Errorf("expected rollback from v2.0.0 with a reason, got from %q, reason %q", deployment.RolledBackFrom, deployment.Reason)
+	}
+	if len(s.deployQueue) != 1 {
+		t.Error("expected rollback deployment to be queued")
+	}
+}
+
+func TestRollback_FailsDeploymentOnError(t *testing.T) {
+	s := newTestServer(t)
+	app, v1 := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	v2, err := s.versionStore.Create(app.ID, "v2.0.0", models.VersionMetadata{Timestamp: "2025-01-02T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	deploySuccessfully(t, s, app, v1, "staging")
+	deploySuccessfully(t, s, app, v2, "staging")
+
+	// Recording the rollback details fails after the deployment is created
+	_, err = s.db.Exec(`
+		CREATE TRIGGER fail_rollback BEFORE UPDATE OF rolled_back_from ON deployments
+		BEGIN SELECT RAISE(ABORT, 'boom'); END
+	`)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/rollback", app.ID), models.RollbackRequest{Environment: "staging"})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deployments, _, err := s.deploymentStore.List(app.ID, "staging", "", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	for _, deployment := range deployments {
+		if deployment.TriggeredBy == "rollback" && deployment.Status != "failed" {
+			t.Errorf("expected the rollback deployment to fail, got %s", deployment.Status)
+		}
+	}
+	if len(deployments) != 3 {
+		t.Errorf("expected the rollback deployment to be recorded, got %d deployments", len(deployments))
+	}
+	if len(s.deployQueue) != 0 {
+		t.Errorf("expected nothing to be queued, got %d jobs", len(s.deployQueue))
+	}
+}
+
+func TestRollback_NoPreviousVersion(t *testing.T) {
+	s := newTestServer(t)
+	app, v1 := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	path := fmt.Sprintf("/api/v1/apps/%s/rollback", app.ID)
+
+	if rec := doRequest(t, s, "POST", path, models.RollbackRequest{Environment: "staging"}); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with no deployments, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deploySuccessfully(t, s, app, v1, "staging")
+
+	if rec := doRequest(t, s, "POST", path, models.RollbackRequest{Environment: "staging"}); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 with a single deployed version, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReloadGitopsCredentials(t *testing.T) {
+	s := newTestServer(t)
+
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "gitops.git")
+	if _, err := git.PlainInit(repoPath, true); err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+
+	keyPaths := []string{writeTestSSHKey(t, dir, "old_key"), writeTestSSHKey(t, dir, "new_key")}
+	s.gitops = gitops.NewService(repoPath, keyPaths[0], filepath.Join(dir, "work"))
+
+	rec := doRequest(t, s, "POST", "/api/v1/admin/gitops/credentials/reload", models.ReloadCredentialsRequest{SSHKeyPath: keyPaths[1]})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if s.gitops.SSHKeyPath() != keyPaths[1] {
+		t.Errorf("expected key path %s, got %s", keyPaths[1], s.gitops.SSHKeyPath())
+	}
+
+	// Without a body the current key is re-read
+	rec = doRequest(t, s, "POST", "/api/v1/admin/gitops/credentials/reload", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A bad key is rejected and the current key stays in use
+	rec = doRequest(t, s, "POST", "/api/v1/admin/gitops/credentials/reload", models.ReloadCredentialsRequest{SSHKeyPath: filepath.Join(dir, "missing_key")})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if s.gitops.SSHKeyPath() != keyPaths[1] {
+		t.Errorf("expected key path to stay %s, got %s", keyPaths[1], s.gitops.SSHKeyPath())
+	}
+}
+
+func TestDeployVersion_RequiresApproval(t *testing.T) {
+	s := newTestServer(t)
+	app, _ := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "PUT", fmt.Sprintf("/api/v1/apps/%s/environments/production/approval", app.ID), models.SetApprovalRequest{RequiresApproval: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "production"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp models.DeployVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "pending_approval" {
+		t.Errorf("expected pending_approval, got %s", resp.Status)
+	}
+	if len(s.deployQueue) != 0 {
+		t.Fatal("expected deployment not to be queued before approval")
+	}
+
+	approvePath := fmt.Sprintf("/api/v1/apps/%s/deployments/%s/approve", app.ID, resp.DeploymentID)
+	rec = doRequest(t, s, "POST", approvePath, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case job := <-s.deployQueue:
+		if job.deployment.ID != resp.DeploymentID {
+			t.Errorf("queued deployment %s, want %s", job.deployment.ID, resp.DeploymentID)
+		}
+		if want := "Deploy my-api version v1.0.0 to production"; job.commitMessage != want {
+			t.Errorf("commit message = %q, want %q", job.commitMessage, want)
+		}
+	default:
+		t.Fatal("expected approved deployment to be queued")
+	}
+
+	// Approving twice doesn't queue the deployment again
+	rec = doRequest(t, s, "POST", approvePath, nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Other environments deploy straight away
+	rec = doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "staging"})
+	if rec.Code != http.StatusAccepted || len(s.deployQueue) != 1 {
+		t.Errorf("expected staging deployment to be queued, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeployVersion_CommitTemplate(t *testing.T) {
+	s := newTestServer(t)
+	tmpl, err := gitops.ParseCommitTemplate("{{.Action}}({{.App}}): {{.Version}} to {{.Environment}} by {{.TriggeredBy}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	s.commitTemplate = tmpl
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/deploy", app.ID), models.DeployVersionRequest{Environment: "staging", TriggeredBy: "alice"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	job := <-s.deployQueue
+	if want := "deploy(my-api): v1.0.0 to staging by alice"; job.commitMessage != want {
+		t.Errorf("commit message = %q, want %q", job.commitMessage, want)
+	}
+
+	// Auto-deploys can use the default message as part of their own
+	s.commitTemplate, err = gitops.ParseCommitTemplate("[{{.Policy}}] {{.Message}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	s.autoDeployVersion(context.Background(), slog.Default(), app, version, createTestPolicy(t, s, app.ID, "auto-main", "production"))
+	job = <-s.deployQueue
+	if want := "[auto-main] Auto-deploy my-api version v1.0.0 to production (policy: auto-main)"; job.commitMessage != want {
+		t.Errorf("commit message = %q, want %q", job.commitMessage, want)
+	}
+}
+
+func TestAutoDeploy_RequiresApproval(t *testing.T) {
+	s := newTestServer(t)
+	app, version := createPublishedVersion(t, s, "my-api", "v1.0.0")
+	if err := s.appStore.SetRequiresApproval(app.ID, "production", true); err != nil {
+		t.Fatalf("failed to protect environment: %v", err)
+	}
+	app, err := s.appStore.GetByID(app.ID)
+	if err != nil {
+		t.Fatalf("failed to get application: %v", err)
+	}
+
+	s.autoDeployVersion(context.Background(), slog.Default(), app, version, createTestPolicy(t, s, app.ID, "auto-main", "production"))
+
+	if len(s.deployQueue) != 0 {
+		t.Error("expected auto-deploy to a protected environment not to be queued")
+	}
+	deployments, _, err := s.deploymentStore.List(app.ID, "", "", 50, 0)
+	if err != nil {
+		t.Fatalf("failed to list deployments: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].Status != "pending_approval" {
+		t.Fatalf("expected one deployment awaiting approval, got %+v", deployments)
+	}
+
+	deployment, err := s.deploymentStore.GetByID(deployments[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if want := "Auto-deploy my-api version v1.0.0 to production (policy: auto-main)"; deployment.CommitMessage != want {
+		t.Errorf("commit message = %q, want %q", deployment.CommitMessage, want)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		method string
+		target string
+		want   string
+	}{
+		{"default port", "443", http.MethodGet, "http://smithd.example.com/health", "https://smithd.example.com/health"},
+		{"custom port", "8443", http.MethodGet, "http://smithd.example.com:8080/api/v1/apps?limit=5", "https://smithd.example.com:8443/api/v1/apps?limit=5"},
+		{"ipv6 host", "8443", http.MethodPost, "http://[::1]:8080/api/v1/apps", "https://[::1]:8443/api/v1/apps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(tt.port).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Fatalf("expected status 308, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
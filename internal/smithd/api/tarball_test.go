@@ -4,11 +4,15 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
 	"gopkg.in/yaml.v3"
 )
 
@@ -170,4 +174,91 @@ func createTestTarball(t *testing.T, files map[string]string) []byte {
 	}
 
 	return buf.Bytes()
-}
\ No newline at end of file
+}
+
+func TestExtractTarball_Limits(t *testing.T) {
+	files := map[string]string{
+		"deployment.yaml": strings.Repeat("a", 60),
+		"service.yaml":    strings.Repeat("b", 60),
+	}
+	tarballData := createTestTarball(t, files)
+
+	tests := []struct {
+		name    string
+		limits  gitops.TarballLimits
+		wantErr string
+	}{
+		{name: "within limits", limits: gitops.TarballLimits{MaxSize: 120, MaxFileSize: 60, MaxFiles: 2}},
+		{name: "too many files", limits: gitops.TarballLimits{MaxFiles: 1}, wantErr: "more than 1 files"},
+		{name: "file too large", limits: gitops.TarballLimits{MaxFileSize: 59}, wantErr: "is larger than 59 bytes"},
+		{name: "contents too large", limits: gitops.TarballLimits{MaxSize: 100}, wantErr: "contents are larger than 100 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{tarballLimits: tt.limits}
+			extracted, err := server.extractTarball(io.NopCloser(bytes.NewReader(tarballData)))
+			if tt.wantErr == "" {
+				if err != nil || len(extracted) != len(files) {
+					t.Errorf("expected %d files, got %d, %v", len(files), len(extracted), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPublishVersion_TarballTooLarge(t *testing.T) {
+	s := newTestServer(t)
+	s.tarballLimits = gitops.TarballLimits{MaxFileSize: 1 << 10}
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	// Compresses to far less than it expands to
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"deployment.yaml": strings.Repeat("#", 1<<20)}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "validation_failed") {
+		t.Fatalf("expected 400 validation_failed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "deployment.yaml is larger than 1024 bytes") {
+		t.Errorf("expected the oversized file to be named, got %s", rec.Body.String())
+	}
+}
+
+func TestPublishVersion_TarballEscapesAppDir(t *testing.T) {
+	s := newTestServer(t)
+	mem := &memoryStorage{files: map[string]map[string][]byte{}}
+	s.storage = mem
+
+	app, err := s.appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if _, err := s.versionStore.Create(app.ID, "v1.0.0", models.VersionMetadata{Timestamp: "2025-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	mem.files["drafts/v1.0.0"] = map[string][]byte{
+		"manifests.tar.gz": createTestTarball(t, map[string]string{"../other-app/deployment.yaml": "kind: Deployment\n"}),
+	}
+
+	rec := doRequest(t, s, "POST", fmt.Sprintf("/api/v1/apps/%s/versions/v1.0.0/publish", app.ID), nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "validation_failed") {
+		t.Fatalf("expected 400 validation_failed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "must not contain '..'") {
+		t.Errorf("expected the file name to be rejected, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// hashPrefix marks a key given as the hex SHA-256 hash of the key, as in
+// name:sha256:hash
+const hashPrefix = "sha256"
+
+// Scopes an API key can be limited to
+const (
+	ScopeAppsRead           = "apps:read"
+	ScopeAppsWrite          = "apps:write"
+	ScopeVersionsRead       = "versions:read"
+	ScopeVersionsWrite      = "versions:write"
+	ScopeDeploymentsRead    = "deployments:read"
+	ScopeDeploy             = "deploy"
+	ScopeDeploymentsApprove = "deployments:approve"
+	ScopePoliciesRead       = "policies:read"
+	ScopePoliciesWrite      = "policies:write"
+	ScopeAuditRead          = "audit:read"
+	ScopeAdmin              = "admin"
+)
+
+// AllScopes lists every scope. Keys configured without scopes get all of them.
+var AllScopes = []string{
+	ScopeAppsRead,
+	ScopeAppsWrite,
+	ScopeVersionsRead,
+	ScopeVersionsWrite,
+	ScopeDeploymentsRead,
+	ScopeDeploy,
+	ScopeDeploymentsApprove,
+	ScopePoliciesRead,
+	ScopePoliciesWrite,
+	ScopeAuditRead,
+	ScopeAdmin,
+}
+
+// APIKey is a key that may call the API. Only the key's hash is kept.
+type APIKey struct {
+	Name string
+	Hash [sha256.Size]byte
+	// Plaintext is set for keys configured unhashed, which is deprecated
+	Plaintext bool
+	Scopes    []string
+}
+
+// HasScope reports whether the key grants scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAPIKeys parses API_KEYS entries of the form key, name:key or
+// name:key:scope|scope, where a named key may be given hashed as
+// sha256:hash. Unnamed keys are called key-1, key-2 and so on by position,
+// and keys without scopes get all scopes. Empty entries are skipped.
+func ParseAPIKeys(entries []string) ([]APIKey, error) {
+	var keys []APIKey
+	for i, entry := range entries {
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		key := APIKey{Name: fmt.Sprintf("key-%d", i+1)}
+		secret := entry
+		if len(parts) > 1 {
+			key.Name, secret = parts[0], parts[1]
+		}
+		if key.Name == "" || secret == "" {
+			return nil, fmt.Errorf("API key %d must have a name and a key", i+1)
+		}
+		// Without a name the hash itself would become the key
+		if len(parts) == 2 && key.Name == hashPrefix {
+			return nil, fmt.Errorf("API key %d must have a name to be given hashed, as name:sha256:hash", i+1)
+		}
+
+		scopes, hasScopes := "", len(parts) == 3
+		if hasScopes {
+			scopes = parts[2]
+		}
+		if secret == hashPrefix && hasScopes {
+			var hash string
+			hash, scopes, hasScopes = strings.Cut(parts[2], ":")
+			sum, err := hex.DecodeString(hash)
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("API key %s must have a hex SHA-256 hash after sha256:", key.Name)
+			}
+			copy(key.Hash[:], sum)
+		} else {
+			key.Hash = HashAPIKey(secret)
+			key.Plaintext = true
+		}
+
+		key.Scopes = AllScopes
+		if hasScopes {
+			key.Scopes = strings.Split(scopes, "|")
+			for _, scope := range key.Scopes {
+				if !isScope(scope) {
+					return nil, fmt.Errorf("API key %s has unknown scope %q", key.Name, scope)
+				}
+			}
+		}
+
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// HashAPIKey returns the hash an API key is checked against
+func HashAPIKey(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
+
+// ValidateAPIKey returns the configured key matching key. Hashes are
+// compared in constant time and every configured key is checked, so the
+// time taken doesn't reveal how much of a key matched.
+func ValidateAPIKey(keys []APIKey, key string) (APIKey, bool) {
+	hash := HashAPIKey(key)
+	var match APIKey
+	found := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare(hash[:], k.Hash[:]) == 1 {
+			match, found = k, true
+		}
+	}
+	return match, found
+}
+
+// isScope reports whether scope is a known scope
+func isScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	hashed := sha256.Sum256([]byte("sk_deploy"))
+	got, err := ParseAPIKeys([]string{
+		"ci:sk_ci",
+		"sk_plain",
+		"",
+		"dashboard:sk_dash:apps:read|deployments:read",
+		"deploy:sha256:" + hex.EncodeToString(hashed[:]),
+		"audit:sha256:" + hex.EncodeToString(hashed[:]) + ":audit:read",
+	})
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+	want := []APIKey{
+		{Name: "ci", Hash: HashAPIKey("sk_ci"), Plaintext: true, Scopes: AllScopes},
+		{Name: "key-2", Hash: HashAPIKey("sk_plain"), Plaintext: true, Scopes: AllScopes},
+		{Name: "dashboard", Hash: HashAPIKey("sk_dash"), Plaintext: true, Scopes: []string{ScopeAppsRead, ScopeDeploymentsRead}},
+		{Name: "deploy", Hash: hashed, Scopes: AllScopes},
+		{Name: "audit", Hash: hashed, Scopes: []string{ScopeAuditRead}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAPIKeys = %+v, want %+v", got, want)
+	}
+
+	for _, entry := range []string{
+		"ci:",
+		":sk_ci",
+		"ci:sk_ci:apps:delete",
+		"ci:sk_ci:",
+		"sha256:" + hex.EncodeToString(hashed[:]),
+		"ci:sha256:not-hex",
+		"ci:sha256:abcd",
+		"ci:sha256:" + hex.EncodeToString(hashed[:]) + ":",
+	} {
+		if _, err := ParseAPIKeys([]string{entry}); err == nil {
+			t.Errorf("%q: expected error", entry)
+		}
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	hashed := sha256.Sum256([]byte("sk_hashed"))
+	keys, err := ParseAPIKeys([]string{"legacy:sk_legacy", "hashed:sha256:" + hex.EncodeToString(hashed[:])})
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"sk_legacy", "legacy"},
+		{"sk_hashed", "hashed"},
+		{"sk_other", ""},
+		{"sk_legacy ", ""},
+		{hex.EncodeToString(hashed[:]), ""},
+	}
+	for _, tt := range tests {
+		key, ok := ValidateAPIKey(keys, tt.key)
+		if ok != (tt.want != "") || key.Name != tt.want {
+			t.Errorf("ValidateAPIKey(%q) = %q, %v; want %q", tt.key, key.Name, ok, tt.want)
+		}
+	}
+}
@@ -1,16 +1,29 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/gitops"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// Server
 	Port    string
-	APIKeys []string
+	APIKeys []APIKey
+
+	// Certificate and key files; Port serves HTTPS when both are set and
+	// plain HTTP otherwise
+	TLSCertFile string
+	TLSKeyFile  string
+	// Port that redirects plain HTTP requests to HTTPS; disabled when empty
+	HTTPRedirectPort string
 
 	// Database
 	DBType string
@@ -22,19 +35,72 @@ type Config struct {
 	AWSEndpoint        string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
+	AWSSessionToken    string
+	// "true" or "false" to override bucket addressing; empty uses path
+	// style only with AWSEndpoint
+	S3ForcePathStyle string
+
+	// S3 storage class for published objects, e.g. STANDARD_IA.
+	// Empty uses the bucket default.
+	S3PublishedStorageClass string
+
+	// Storage backend for published versions: "s3" or "oci".
+	// Drafts are always uploaded to S3.
+	StorageType   string
+	OCIRegistry   string
+	OCIRepository string
+	OCIUsername   string
+	OCIPassword   string
+	OCIPlainHTTP  bool
 
 	// Gitops
 	GitopsRepo        string
 	GitopsSSHKeyPath  string
+	GitopsWorkDir     string
 	GitopsUserName    string
 	GitopsUserEmail   string
+
+	// Go template for gitops commit messages; the built-in messages when empty
+	GitopsCommitTemplate string
+
+	// Directory of each app's manifests in the gitops repo, using {app} and
+	// {environment}; gitops.DefaultPathTemplate when empty
+	GitopsPathTemplate string
+
+	// Commits of history fetched from the gitops repo; 0 clones it in full
+	GitopsCloneDepth int
+
+	// Deployments
+	DeployWorkers int
+	// AllowedEnvironments are the environments deploys and policies may
+	// target; any environment is accepted when empty
+	AllowedEnvironments []string
+	// DeployTimeout limits how long a deployment may spend fetching its
+	// manifests, and then working in the gitops repo once it has the repo
+	// to itself
+	DeployTimeout time.Duration
+
+	// Limits on the contents of manifests.tar.gz, checked on publish so an
+	// upload can't expand into more than smithd can hold in memory. Sizes
+	// are uncompressed, in MB; 0 disables a limit.
+	TarballMaxSizeMB     int
+	TarballMaxFileSizeMB int
+	TarballMaxFiles      int
+
+	// OPA decision URL that must allow each deploy; disabled when empty
+	OPAURL string
+
+	// Slack incoming webhook notified when deployments finish; disabled when empty
+	SlackWebhookURL string
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
 		Port:              getEnv("PORT", "8080"),
-		APIKeys:           strings.Split(getEnv("API_KEYS", ""), ","),
+		TLSCertFile:       getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:        getEnv("TLS_KEY_FILE", ""),
+		HTTPRedirectPort:  getEnv("HTTP_REDIRECT_PORT", ""),
 		DBType:            getEnv("DB_TYPE", "sqlite"),
 		DBPath:            getEnv("DB_PATH", "./data/smithd.db"),
 		S3Bucket:           getEnv("S3_BUCKET", ""),
@@ -42,31 +108,262 @@ func Load() (*Config, error) {
 		AWSEndpoint:        getEnv("AWS_ENDPOINT", ""),
 		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		S3ForcePathStyle:   getEnv("S3_FORCE_PATH_STYLE", ""),
+		S3PublishedStorageClass: getEnv("S3_PUBLISHED_STORAGE_CLASS", ""),
+		StorageType:        getEnv("STORAGE_TYPE", "s3"),
+		OCIRegistry:        getEnv("OCI_REGISTRY", ""),
+		OCIRepository:      getEnv("OCI_REPOSITORY", "deploysmith"),
+		OCIUsername:        getEnv("OCI_USERNAME", ""),
+		OCIPassword:        getEnv("OCI_PASSWORD", ""),
+		OCIPlainHTTP:       getEnv("OCI_PLAIN_HTTP", "false") == "true",
 		GitopsRepo:        getEnv("GITOPS_REPO", ""),
 		GitopsSSHKeyPath:  getEnv("GITOPS_SSH_KEY_PATH", ""),
+		GitopsWorkDir:     getEnv("GITOPS_WORK_DIR", "/tmp/deploysmith-gitops"),
 		GitopsUserName:    getEnv("GITOPS_USER_NAME", "smithd"),
 		GitopsUserEmail:   getEnv("GITOPS_USER_EMAIL", "smithd@deploysmith.io"),
+		GitopsCommitTemplate: getEnv("GITOPS_COMMIT_TEMPLATE", ""),
+		GitopsPathTemplate: getEnv("GITOPS_PATH_TEMPLATE", ""),
+		OPAURL:            getEnv("OPA_URL", ""),
+		SlackWebhookURL:   getEnv("SLACK_WEBHOOK_URL", ""),
 	}
 
-	// Validate required fields
-	if len(cfg.APIKeys) == 0 || cfg.APIKeys[0] == "" {
-		return nil, fmt.Errorf("API_KEYS is required")
+	var errs ValidationErrors
+
+	// Unparsable values are left out of range for Validate to report
+	cfg.DeployWorkers, _ = strconv.Atoi(getEnv("DEPLOY_WORKERS", "2"))
+	cloneDepth, err := strconv.Atoi(getEnv("GITOPS_CLONE_DEPTH", "0"))
+	if err != nil {
+		cloneDepth = -1
+	}
+	cfg.GitopsCloneDepth = cloneDepth
+	deployTimeout, err := time.ParseDuration(getEnv("DEPLOY_TIMEOUT", "10m"))
+	if err != nil {
+		deployTimeout = -1
 	}
+	cfg.DeployTimeout = deployTimeout
+	cfg.AllowedEnvironments = splitList(getEnv("ALLOWED_ENVIRONMENTS", ""))
+	cfg.TarballMaxSizeMB = getEnvLimit("TARBALL_MAX_SIZE_MB", "100")
+	cfg.TarballMaxFileSizeMB = getEnvLimit("TARBALL_MAX_FILE_SIZE_MB", "10")
+	cfg.TarballMaxFiles = getEnvLimit("TARBALL_MAX_FILES", "1000")
 
-	if cfg.S3Bucket == "" {
-		return nil, fmt.Errorf("S3_BUCKET is required")
+	apiKeys, err := ParseAPIKeys(strings.Split(getEnv("API_KEYS", ""), ","))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid API_KEYS: %w", err))
 	}
+	cfg.APIKeys = apiKeys
 
-	if cfg.GitopsRepo == "" {
-		return nil, fmt.Errorf("GITOPS_REPO is required")
+	for _, problem := range cfg.validate() {
+		// Unparsable API_KEYS are reported above, not as missing too
+		if err != nil && problem == errAPIKeysRequired {
+			continue
+		}
+		errs = append(errs, problem)
 	}
 
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return cfg, nil
 }
 
+// ValidationErrors is every problem found in a configuration
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d configuration problems: %s", len(e), strings.Join(msgs, "; "))
+}
+
+var errAPIKeysRequired = errors.New("API_KEYS is required")
+
+// Validate checks that required settings are present and that the rest are
+// usable, returning ValidationErrors listing every problem found
+func (c *Config) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validate() ValidationErrors {
+	var errs ValidationErrors
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT must be a port number, got %q", c.Port)
+	}
+	if len(c.APIKeys) == 0 {
+		errs = append(errs, errAPIKeysRequired)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" {
+		if _, err := os.Stat(c.TLSCertFile); err != nil {
+			fail("TLS_CERT_FILE is not readable: %v", err)
+		}
+	}
+	if c.TLSKeyFile != "" {
+		if _, err := os.Stat(c.TLSKeyFile); err != nil {
+			fail("TLS_KEY_FILE is not readable: %v", err)
+		}
+	}
+	if c.HTTPRedirectPort != "" {
+		if port, err := strconv.Atoi(c.HTTPRedirectPort); err != nil || port < 1 || port > 65535 {
+			fail("HTTP_REDIRECT_PORT must be a port number, got %q", c.HTTPRedirectPort)
+		} else if c.HTTPRedirectPort == c.Port {
+			fail("HTTP_REDIRECT_PORT must differ from PORT")
+		}
+		if !c.TLSEnabled() {
+			fail("HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+	}
+
+	switch c.DBType {
+	case "sqlite", "postgres":
+		if c.DBPath == "" {
+			fail("DB_PATH is required")
+		}
+	default:
+		fail("unsupported DB_TYPE: %s (must be sqlite or postgres)", c.DBType)
+	}
+
+	if c.S3Bucket == "" {
+		fail("S3_BUCKET is required")
+	}
+	if (c.AWSAccessKeyID == "") != (c.AWSSecretAccessKey == "") {
+		fail("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+	if c.S3ForcePathStyle != "" && c.S3ForcePathStyle != "true" && c.S3ForcePathStyle != "false" {
+		fail("S3_FORCE_PATH_STYLE must be true or false, got %q", c.S3ForcePathStyle)
+	}
+
+	switch c.StorageType {
+	case "s3":
+	case "oci":
+		if c.OCIRegistry == "" {
+			fail("OCI_REGISTRY is required when STORAGE_TYPE is oci")
+		}
+	default:
+		fail("unsupported STORAGE_TYPE: %s (must be s3 or oci)", c.StorageType)
+	}
+
+	if c.GitopsRepo == "" {
+		fail("GITOPS_REPO is required")
+	}
+	if c.GitopsSSHKeyPath != "" {
+		if _, err := os.Stat(c.GitopsSSHKeyPath); err != nil {
+			fail("GITOPS_SSH_KEY_PATH is not readable: %v", err)
+		}
+	}
+	if c.GitopsWorkDir == "" {
+		fail("GITOPS_WORK_DIR is required")
+	}
+	if c.GitopsCloneDepth < 0 {
+		fail("GITOPS_CLONE_DEPTH must be 0 or a positive integer")
+	}
+	if c.GitopsCommitTemplate != "" {
+		if _, err := gitops.ParseCommitTemplate(c.GitopsCommitTemplate); err != nil {
+			fail("GITOPS_COMMIT_TEMPLATE is not a valid template: %v", err)
+		}
+	}
+	if c.GitopsPathTemplate != "" {
+		if err := gitops.ValidatePathTemplate(c.GitopsPathTemplate); err != nil {
+			fail("GITOPS_PATH_TEMPLATE is not a valid path template: %v", err)
+		}
+	}
+
+	if c.DeployWorkers < 1 {
+		fail("DEPLOY_WORKERS must be a positive integer")
+	}
+	if c.DeployTimeout <= 0 {
+		fail("DEPLOY_TIMEOUT must be a positive duration such as 10m")
+	}
+	if c.TarballMaxSizeMB < 0 {
+		fail("TARBALL_MAX_SIZE_MB must be 0 or a positive integer")
+	}
+	if c.TarballMaxFileSizeMB < 0 {
+		fail("TARBALL_MAX_FILE_SIZE_MB must be 0 or a positive integer")
+	}
+	if c.TarballMaxFiles < 0 {
+		fail("TARBALL_MAX_FILES must be 0 or a positive integer")
+	}
+	seen := make(map[string]bool)
+	for _, environment := range c.AllowedEnvironments {
+		if seen[environment] {
+			fail("ALLOWED_ENVIRONMENTS lists %s more than once", environment)
+		}
+		seen[environment] = true
+	}
+
+	if c.OPAURL != "" && !isHTTPURL(c.OPAURL) {
+		fail("OPA_URL must be an http or https URL, got %q", c.OPAURL)
+	}
+	if c.SlackWebhookURL != "" && !isHTTPURL(c.SlackWebhookURL) {
+		fail("SLACK_WEBHOOK_URL must be an http or https URL")
+	}
+
+	return errs
+}
+
+// TLSEnabled reports whether smithd serves HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// EnvironmentAllowed reports whether deploys and policies may target
+// environment
+func (c *Config) EnvironmentAllowed(environment string) bool {
+	if len(c.AllowedEnvironments) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedEnvironments {
+		if allowed == environment {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvLimit reads a non-negative integer setting, returning -1 for
+// Validate to report if it can't be parsed
+func getEnvLimit(key, defaultValue string) int {
+	value, err := strconv.Atoi(getEnv(key, defaultValue))
+	if err != nil {
+		return -1
+	}
+	return value
+}
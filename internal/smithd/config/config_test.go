@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	return &Config{
+		Port:          "8080",
+		APIKeys:       []APIKey{{Name: "ci", Hash: HashAPIKey("sk_ci"), Scopes: AllScopes}},
+		DBType:        "sqlite",
+		DBPath:        "./data/smithd.db",
+		S3Bucket:      "deploysmith-versions",
+		StorageType:   "s3",
+		GitopsRepo:    "git@github.com:org/gitops.git",
+		GitopsWorkDir: "/tmp/deploysmith-gitops",
+		DeployWorkers: 2,
+		DeployTimeout: 10 * time.Minute,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"missing api keys", func(c *Config) { c.APIKeys = nil }, []string{"API_KEYS is required"}},
+		{"bad port", func(c *Config) { c.Port = "http" }, []string{"PORT must be a port number"}},
+		{"tls cert without key", func(c *Config) { c.TLSCertFile = "config_test.go" }, []string{"TLS_CERT_FILE and TLS_KEY_FILE must be set together"}},
+		{"missing tls key", func(c *Config) { c.TLSCertFile = "config_test.go"; c.TLSKeyFile = "/nonexistent/key" }, []string{"TLS_KEY_FILE is not readable"}},
+		{"redirect without tls", func(c *Config) { c.HTTPRedirectPort = "80" }, []string{"HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE"}},
+		{"redirect on tls port", func(c *Config) {
+			c.TLSCertFile, c.TLSKeyFile = "config_test.go", "config.go"
+			c.HTTPRedirectPort = "8080"
+		}, []string{"HTTP_REDIRECT_PORT must differ from PORT"}},
+		{"unknown database", func(c *Config) { c.DBType = "mysql" }, []string{"unsupported DB_TYPE: mysql"}},
+		{"oci without registry", func(c *Config) { c.StorageType = "oci" }, []string{"OCI_REGISTRY is required"}},
+		{"missing ssh key", func(c *Config) { c.GitopsSSHKeyPath = "/nonexistent/key" }, []string{"GITOPS_SSH_KEY_PATH is not readable"}},
+		{"negative clone depth", func(c *Config) { c.GitopsCloneDepth = -1 }, []string{"GITOPS_CLONE_DEPTH must be 0 or a positive integer"}},
+		{"zero deploy timeout", func(c *Config) { c.DeployTimeout = 0 }, []string{"DEPLOY_TIMEOUT must be a positive duration"}},
+		{"duplicate allowed environment", func(c *Config) { c.AllowedEnvironments = []string{"staging", "production", "staging"} }, []string{"ALLOWED_ENVIRONMENTS lists staging more than once"}},
+		{"access key without secret", func(c *Config) { c.AWSAccessKeyID = "minio" }, []string{"AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together"}},
+		{"bad force path style", func(c *Config) { c.S3ForcePathStyle = "yes" }, []string{"S3_FORCE_PATH_STYLE must be true or false"}},
+		{"negative tarball limit", func(c *Config) { c.TarballMaxFiles = -1 }, []string{"TARBALL_MAX_FILES must be 0 or a positive integer"}},
+		{"bad opa url", func(c *Config) { c.OPAURL = "opa:8181" }, []string{"OPA_URL must be an http or https URL"}},
+		{"unparsable commit template", func(c *Config) { c.GitopsCommitTemplate = "deploy {{.App" }, []string{"GITOPS_COMMIT_TEMPLATE is not a valid template"}},
+		{"unknown commit template field", func(c *Config) { c.GitopsCommitTemplate = "deploy {{.Service}}" }, []string{"GITOPS_COMMIT_TEMPLATE is not a valid template"}},
+		{"unknown path template variable", func(c *Config) { c.GitopsPathTemplate = "{environment}/{service}" }, []string{"GITOPS_PATH_TEMPLATE is not a valid path template"}},
+		{
+			"several problems",
+			func(c *Config) {
+				c.S3Bucket = ""
+				c.GitopsRepo = ""
+				c.DeployWorkers = 0
+			},
+			[]string{"S3_BUCKET is required", "GITOPS_REPO is required", "DEPLOY_WORKERS must be a positive integer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != len(tt.want) {
+				t.Fatalf("expected %d problem(s), got %v", len(tt.want), err)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("problem %d: expected %q, got %q", i, want, errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_ReportsAllProblems(t *testing.T) {
+	t.Setenv("API_KEYS", "ci:")
+	t.Setenv("S3_BUCKET", "")
+	t.Setenv("GITOPS_REPO", "")
+	t.Setenv("DEPLOY_WORKERS", "two")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected Load to fail")
+	}
+	for _, want := range []string{"4 configuration problems", "invalid API_KEYS", "S3_BUCKET is required", "GITOPS_REPO is required", "DEPLOY_WORKERS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "API_KEYS is required") {
+		t.Errorf("expected invalid API_KEYS not to be reported as missing: %v", err)
+	}
+}
+
+func TestEnvironmentAllowed(t *testing.T) {
+	cfg := validConfig()
+	if !cfg.EnvironmentAllowed("prodution") {
+		t.Error("expected any environment to be allowed without ALLOWED_ENVIRONMENTS")
+	}
+
+	t.Setenv("ALLOWED_ENVIRONMENTS", "staging, production,")
+	t.Setenv("API_KEYS", "ci:secret")
+	t.Setenv("S3_BUCKET", "deploysmith")
+	t.Setenv("GITOPS_REPO", "git@github.com:example/gitops.git")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.AllowedEnvironments) != 2 {
+		t.Fatalf("expected 2 allowed environments, got %q", cfg.AllowedEnvironments)
+	}
+	if !cfg.EnvironmentAllowed("production") {
+		t.Error("expected production to be allowed")
+	}
+	if cfg.EnvironmentAllowed("prodution") {
+		t.Error("expected prodution to be rejected")
+	}
+}
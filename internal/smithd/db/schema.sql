@@ -1,8 +1,4 @@
--- Schema version tracking
-CREATE TABLE IF NOT EXISTS schema_version (
-    version INTEGER PRIMARY KEY,
-    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
+-- Base schema, applied as migration 1. Later migrations live in db.go.
 
 -- Applications table
 CREATE TABLE IF NOT EXISTS applications (
@@ -88,6 +84,3 @@ CREATE TABLE IF NOT EXISTS policies (
 
 CREATE INDEX IF NOT EXISTS idx_policies_app_id ON policies(app_id);
 CREATE INDEX IF NOT EXISTS idx_policies_enabled ON policies(enabled);
-
--- Record schema version
-INSERT OR IGNORE INTO schema_version (version) VALUES (1);
@@ -0,0 +1,89 @@
+-- Postgres version of schema.sql, applied as migration 1. Later migrations
+-- live in db.go, with Postgres variants where the SQLite statements don't
+-- work.
+
+-- Applications table
+CREATE TABLE IF NOT EXISTS applications (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_applications_name ON applications(name);
+
+-- Versions table
+CREATE TABLE IF NOT EXISTS versions (
+    id TEXT PRIMARY KEY,
+    app_id TEXT NOT NULL,
+    version_id TEXT NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('draft', 'published')),
+
+    -- Metadata from version.yml
+    git_sha TEXT,
+    git_branch TEXT,
+    git_committer TEXT,
+    build_number TEXT,
+    metadata_timestamp TIMESTAMPTZ,
+
+    -- Lifecycle timestamps
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMPTZ,
+
+    FOREIGN KEY (app_id) REFERENCES applications(id) ON DELETE CASCADE,
+    UNIQUE(app_id, version_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_versions_app_id ON versions(app_id);
+CREATE INDEX IF NOT EXISTS idx_versions_status ON versions(status);
+CREATE INDEX IF NOT EXISTS idx_versions_created_at ON versions(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_versions_git_branch ON versions(git_branch);
+
+-- Policies table, created before deployments because Postgres checks
+-- foreign key targets exist
+CREATE TABLE IF NOT EXISTS policies (
+    id TEXT PRIMARY KEY,
+    app_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    git_branch_pattern TEXT NOT NULL,
+    target_environment TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (app_id) REFERENCES applications(id) ON DELETE CASCADE,
+    UNIQUE(app_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_policies_app_id ON policies(app_id);
+CREATE INDEX IF NOT EXISTS idx_policies_enabled ON policies(enabled);
+
+-- Deployments table
+CREATE TABLE IF NOT EXISTS deployments (
+    id TEXT PRIMARY KEY,
+    app_id TEXT NOT NULL,
+    version_id TEXT NOT NULL,
+    environment TEXT NOT NULL,
+    status TEXT NOT NULL CONSTRAINT deployments_status_check CHECK(status IN ('pending', 'success', 'failed')),
+
+    -- Deployment details
+    triggered_by TEXT,
+    policy_id TEXT,
+
+    -- Git commit info
+    gitops_commit_sha TEXT,
+
+    -- Error details (if failed)
+    error_message TEXT,
+
+    -- Timestamps
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+
+    FOREIGN KEY (app_id) REFERENCES applications(id) ON DELETE CASCADE,
+    FOREIGN KEY (version_id) REFERENCES versions(id) ON DELETE CASCADE,
+    FOREIGN KEY (policy_id) REFERENCES policies(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployments_app_id ON deployments(app_id);
+CREATE INDEX IF NOT EXISTS idx_deployments_environment ON deployments(environment);
+CREATE INDEX IF NOT EXISTS idx_deployments_started_at ON deployments(started_at DESC);
@@ -0,0 +1,52 @@
+package gitops
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// CommitMessageData is what a commit message template can refer to
+type CommitMessageData struct {
+	App         string
+	Version     string
+	Environment string
+	TriggeredBy string
+	// Action is deploy, rollback, auto-deploy or reconcile
+	Action string
+	// PreviousVersion is the version a rollback replaces
+	PreviousVersion string
+	// Policy is the auto-deploy policy that triggered the deploy
+	Policy string
+	// Message is the default commit message
+	Message string
+}
+
+// ParseCommitTemplate parses a Go template for gitops commit messages, such
+// as "deploy({{.App}}): {{.Version}} to {{.Environment}}". Unknown fields are
+// caught here by rendering it once, rather than on the first deploy.
+func ParseCommitTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("commit").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := CommitMessageData{App: "app", Version: "v1", Environment: "staging", Action: "deploy", Message: "Deploy app version v1 to staging"}
+	message, err := RenderCommitMessage(tmpl, sample)
+	if err != nil {
+		return nil, err
+	}
+	if message == "" {
+		return nil, fmt.Errorf("template renders an empty message")
+	}
+	return tmpl, nil
+}
+
+// RenderCommitMessage renders a commit message template with data
+func RenderCommitMessage(tmpl *template.Template, data CommitMessageData) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
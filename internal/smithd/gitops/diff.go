@@ -0,0 +1,181 @@
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Diff returns a unified diff of the uncommitted changes in the working copy
+// against HEAD, such as the files written by WriteManifests
+func (s *Service) Diff() (string, error) {
+	if s.repo == nil {
+		return "", fmt.Errorf("repository not initialized, call Clone() first")
+	}
+
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree status: %w", err)
+	}
+
+	// An empty repository has no HEAD, so every file is new
+	var headTree *object.Tree
+	head, err := s.repo.Head()
+	if err == nil {
+		commit, err := s.repo.CommitObject(head.Hash())
+		if err != nil {
+			return "", fmt.Errorf("failed to get HEAD commit: %w", err)
+		}
+		if headTree, err = commit.Tree(); err != nil {
+			return "", fmt.Errorf("failed to get HEAD tree: %w", err)
+		}
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	paths := make([]string, 0, len(status))
+	for path, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var filePatches []fdiff.FilePatch
+	for _, path := range paths {
+		var from, to fdiff.File
+		var oldContent, newContent string
+
+		if headTree != nil {
+			if f, err := headTree.File(path); err == nil {
+				if oldContent, err = f.Contents(); err != nil {
+					return "", fmt.Errorf("failed to read %s at HEAD: %w", path, err)
+				}
+				from = diffFile{path: path, hash: f.Hash, mode: f.Mode}
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.workDir, path))
+		if err == nil {
+			newContent = string(data)
+			to = diffFile{path: path, hash: plumbing.ComputeHash(plumbing.BlobObject, data), mode: filemode.Regular}
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		if oldContent == newContent && (from == nil) == (to == nil) {
+			continue
+		}
+
+		filePatches = append(filePatches, filePatch{from: from, to: to, chunks: diffChunks(oldContent, newContent)})
+	}
+
+	var buf bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).Encode(patch(filePatches)); err != nil {
+		return "", fmt.Errorf("failed to encode diff: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// Discard throws away uncommitted changes in the working copy, leaving it at HEAD
+func (s *Service) Discard() error {
+	if s.repo == nil {
+		return fmt.Errorf("repository not initialized, call Clone() first")
+	}
+
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	_, err = s.repo.Head()
+	switch {
+	case err == nil:
+		if err := worktree.Reset(&git.ResetOptions{Mode: git.HardReset}); err != nil {
+			return fmt.Errorf("failed to reset worktree: %w", err)
+		}
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		// Nothing is committed yet, so unstage everything
+		if err := s.repo.Storer.SetIndex(&index.Index{Version: 2}); err != nil {
+			return fmt.Errorf("failed to reset index: %w", err)
+		}
+	default:
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	// Remove files that were added but never committed
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %w", err)
+	}
+
+	return nil
+}
+
+// diffChunks splits the change from oldContent to newContent into chunks
+func diffChunks(oldContent, newContent string) []fdiff.Chunk {
+	var chunks []fdiff.Chunk
+	for _, d := range diff.Do(oldContent, newContent) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, diffChunk{content: d.Text, op: op})
+	}
+	return chunks
+}
+
+// patch, filePatch, diffFile and diffChunk implement the go-git diff
+// interfaces so worktree changes can use its unified diff encoder
+
+type patch []fdiff.FilePatch
+
+func (p patch) FilePatches() []fdiff.FilePatch { return p }
+func (p patch) Message() string                { return "" }
+
+type filePatch struct {
+	from, to fdiff.File
+	chunks   []fdiff.Chunk
+}
+
+func (p filePatch) IsBinary() bool                  { return false }
+func (p filePatch) Files() (fdiff.File, fdiff.File) { return p.from, p.to }
+func (p filePatch) Chunks() []fdiff.Chunk           { return p.chunks }
+
+type diffFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f diffFile) Hash() plumbing.Hash     { return f.hash }
+func (f diffFile) Mode() filemode.FileMode { return f.mode }
+func (f diffFile) Path() string            { return f.path }
+
+type diffChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c diffChunk) Content() string       { return c.content }
+func (c diffChunk) Type() fdiff.Operation { return c.op }
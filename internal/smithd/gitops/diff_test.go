@@ -0,0 +1,112 @@
+package gitops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRemote creates a repository with one commit holding files
+func newTestRemote(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "gitops")
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	for path, content := range files {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		if _, err := worktree.Add(path); err != nil {
+			t.Fatalf("failed to add %s: %v", path, err)
+		}
+	}
+
+	_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	return dir
+}
+
+func TestDiffAndDiscard(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{
+		"environments/staging/apps/my-api/deployment.yaml": "kind: Deployment\nreplicas: 1\n",
+	})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	err := s.WriteManifests("my-api", "staging", "v2", map[string][]byte{
+		"deployment.yaml": []byte("kind: Deployment\nreplicas: 3\n"),
+		"service.yaml":    []byte("kind: Service\n"),
+	})
+	if err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+
+	diff, err := s.Diff()
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	for _, want := range []string{
+		"--- a/environments/staging/apps/my-api/deployment.yaml",
+		"-replicas: 1",
+		"+replicas: 3",
+		"+++ b/environments/staging/apps/my-api/service.yaml",
+		"+kind: Service",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+
+	if err := s.Discard(); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+
+	// The working copy is back at HEAD
+	appDir := filepath.Join(dir, "work", "environments", "staging", "apps", "my-api")
+	data, err := os.ReadFile(filepath.Join(appDir, "deployment.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read deployment.yaml: %v", err)
+	}
+	if string(data) != "kind: Deployment\nreplicas: 1\n" {
+		t.Errorf("expected deployment.yaml to be restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(appDir, "service.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected service.yaml to be removed, got %v", err)
+	}
+
+	diff, err = s.Diff()
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if diff != "" {
+		t.Errorf("expected no changes after Discard, got:\n%s", diff)
+	}
+}
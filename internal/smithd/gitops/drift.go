@@ -0,0 +1,133 @@
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadManifests returns the files in an application's directory of the
+// working copy, or no files if the directory doesn't exist
+func (s *Service) ReadManifests(appName, environment string) (map[string][]byte, error) {
+	if s.repo == nil {
+		return nil, fmt.Errorf("repository not initialized, call Clone() first")
+	}
+
+	appDir := filepath.Join(s.workDir, s.AppPath(appName, environment))
+	entries, err := os.ReadDir(appDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app directory: %w", err)
+	}
+
+	files := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(appDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", entry.Name(), err)
+		}
+		files[entry.Name()] = content
+	}
+
+	return files, nil
+}
+
+// RemoveOtherFiles deletes the files in an application's directory of the
+// working copy that writing manifests wouldn't, such as files added by hand,
+// and stages their removal. It returns the removed files' names, sorted.
+func (s *Service) RemoveOtherFiles(appName, environment string, manifests map[string][]byte) ([]string, error) {
+	if s.repo == nil {
+		return nil, fmt.Errorf("repository not initialized, call Clone() first")
+	}
+
+	expected, err := ExpandManifests(manifests, s.tarballLimits)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := s.ReadManifests(appName, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	relativePath := s.AppPath(appName, environment)
+	removed := []string{}
+	for filename := range actual {
+		if _, ok := expected[filename]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.workDir, relativePath, filename)); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", filename, err)
+		}
+		if _, err := worktree.Add(path.Join(relativePath, filename)); err != nil {
+			return nil, fmt.Errorf("failed to stage removal of %s: %w", filename, err)
+		}
+		removed = append(removed, filename)
+	}
+	sort.Strings(removed)
+
+	return removed, nil
+}
+
+// Images returns the container images referenced by the YAML manifests in
+// files, sorted and without duplicates
+func Images(files map[string][]byte) []string {
+	seen := map[string]bool{}
+	for filename, content := range files {
+		if !IsManifest(filename) {
+			continue
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var doc interface{}
+			// Stop at the end of the file, or at a document that isn't valid
+			// YAML since the documents after it can't be read
+			if err := decoder.Decode(&doc); err != nil {
+				break
+			}
+			collectImages(doc, seen)
+		}
+	}
+
+	images := make([]string, 0, len(seen))
+	for image := range seen {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// collectImages adds the value of every "image" field in a decoded YAML
+// document to seen
+func collectImages(node interface{}, seen map[string]bool) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if image, ok := value.(string); ok && key == "image" && image != "" {
+				seen[image] = true
+				continue
+			}
+			collectImages(value, seen)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectImages(item, seen)
+		}
+	}
+}
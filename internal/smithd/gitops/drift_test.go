@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestReadManifests(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{
+		"environments/staging/apps/my-api/deployment.yaml": "kind: Deployment\n",
+		"environments/staging/apps/my-api/config.json":     "{}\n",
+	})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	files, err := s.ReadManifests("my-api", "staging")
+	if err != nil {
+		t.Fatalf("ReadManifests failed: %v", err)
+	}
+	if len(files) != 2 || string(files["deployment.yaml"]) != "kind: Deployment\n" || string(files["config.json"]) != "{}\n" {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	// An environment never deployed to has no files
+	files, err = s.ReadManifests("my-api", "production")
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected no files, got %v, %v", files, err)
+	}
+}
+
+func TestRemoveOtherFiles(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{
+		"environments/staging/apps/my-api/deployment.yaml": "kind: Deployment\n",
+		"environments/staging/apps/my-api/debug-pod.yaml":  "kind: Pod\n",
+		"environments/staging/apps/other/service.yaml":     "kind: Service\n",
+	})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	manifests := map[string][]byte{"deployment.yaml": []byte("kind: Deployment\n")}
+	removed, err := s.RemoveOtherFiles("my-api", "staging", manifests)
+	if err != nil {
+		t.Fatalf("RemoveOtherFiles failed: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"debug-pod.yaml"}) {
+		t.Errorf("expected debug-pod.yaml to be removed, got %v", removed)
+	}
+
+	// The removal is staged, and other apps are left alone
+	diff, err := s.Diff()
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if !strings.Contains(diff, "-kind: Pod") || strings.Contains(diff, "service.yaml") || strings.Contains(diff, "deployment.yaml") {
+		t.Errorf("expected only debug-pod.yaml to be deleted, got:\n%s", diff)
+	}
+	sha, err := s.Commit("Remove extra files")
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	commit, err := s.repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	if _, err := commit.File("environments/staging/apps/my-api/debug-pod.yaml"); err == nil {
+		t.Error("expected debug-pod.yaml to be gone from the commit")
+	}
+}
+
+func TestImages(t *testing.T) {
+	images := Images(map[string][]byte{
+		"deployment.yaml": []byte(`apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: registry.example.com/my-api:v2
+      containers:
+        - name: api
+          image: registry.example.com/my-api:v2
+        - name: proxy
+          image: envoyproxy/envoy:v1.30
+---
+apiVersion: v1
+kind: Service
+`),
+		"cronjob.yml": []byte("spec:\n  jobTemplate:\n    spec:\n      template:\n        spec:\n          containers:\n            - image: busybox:1.36\n"),
+		"values.json": []byte(`{"image": "ignored:latest"}`),
+		"broken.yaml": []byte("image: [\n"),
+	})
+
+	want := []string{"busybox:1.36", "envoyproxy/envoy:v1.30", "registry.example.com/my-api:v2"}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("expected %v, got %v", want, images)
+	}
+}
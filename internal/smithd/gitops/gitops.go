@@ -1,41 +1,124 @@
 package gitops
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
 	cryptossh "golang.org/x/crypto/ssh"
 )
 
-// Service handles gitops repository operations
+// ErrNoChanges is returned by Commit when the working copy already matches
+// HEAD, such as when a version is deployed again
+var ErrNoChanges = errors.New("no changes to commit")
+
+var (
+	// ErrCloneFailed wraps errors from Clone, which couldn't clone or pull
+	// the gitops repo
+	ErrCloneFailed = errors.New("gitops clone failed")
+	// ErrPushRejected wraps errors from Push when the remote refused the
+	// update, such as when the branch moved on since the last pull
+	ErrPushRejected = errors.New("gitops push rejected")
+	// ErrPushFailed wraps other errors from Push, such as the remote being
+	// unreachable
+	ErrPushFailed = errors.New("gitops push failed")
+)
+
+// Service handles gitops repository operations.
+// Callers must hold the lock from Clone through Push, since all
+// deployments share one working copy.
 type Service struct {
+	// lock is a semaphore rather than a sync.Mutex so waiting for it can be
+	// cancelled; see LockContext
+	lock chan struct{}
+
+	// authMu guards sshKeyPath and auth, so credentials can be read and
+	// reloaded while a deployment holds the working copy
+	authMu     sync.Mutex
 	repoURL    string
 	sshKeyPath string
+	auth       *ssh.PublicKeys
 	workDir    string
 	repo       *git.Repository
+	// depth limits how many commits are fetched; 0 fetches all history
+	depth int
+	// pathTemplate lays out app directories; DefaultPathTemplate when empty
+	pathTemplate string
+	// tarballLimits caps what manifests.tar.gz may expand to
+	tarballLimits TarballLimits
 }
 
-// NewService creates a new gitops service
-func NewService(repoURL, sshKeyPath string) *Service {
+// NewService creates a new gitops service that keeps its working copy in workDir
+func NewService(repoURL, sshKeyPath, workDir string) *Service {
 	return &Service{
+		lock:       make(chan struct{}, 1),
 		repoURL:    repoURL,
 		sshKeyPath: sshKeyPath,
-		workDir:    "/tmp/deploysmith-gitops", // Could be configurable
+		workDir:    workDir,
+	}
+}
+
+// Lock waits for exclusive use of the working copy
+func (s *Service) Lock() {
+	s.lock <- struct{}{}
+}
+
+// LockContext is like Lock, but gives up with ctx's error if ctx is done
+// before the working copy is free
+func (s *Service) LockContext(ctx context.Context) error {
+	select {
+	case s.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock releases the working copy taken by Lock or LockContext
+func (s *Service) Unlock() {
+	<-s.lock
+}
+
+// SetCloneDepth makes Clone fetch only the branch being deployed, with at
+// most depth commits of history. 0 fetches every branch in full.
+func (s *Service) SetCloneDepth(depth int) {
+	s.depth = depth
+}
+
+// SetPathTemplate changes where WriteManifests puts each application's
+// manifests. The template must have passed ValidatePathTemplate.
+func (s *Service) SetPathTemplate(tmpl string) {
+	s.pathTemplate = tmpl
+}
+
+// SetTarballLimits caps what WriteManifests extracts from manifests.tar.gz
+func (s *Service) SetTarballLimits(limits TarballLimits) {
+	s.tarballLimits = limits
+}
+
+// Clone clones the gitops repository or pulls if it already exists,
+// stopping if ctx is cancelled. Errors wrap ErrCloneFailed.
+func (s *Service) Clone(ctx context.Context) error {
+	if err := s.clone(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrCloneFailed, err)
 	}
+	return nil
 }
 
-// Clone clones the gitops repository or pulls if it already exists
-func (s *Service) Clone() error {
+func (s *Service) clone(ctx context.Context) error {
 	// Check if repo already exists
 	if _, err := os.Stat(filepath.Join(s.workDir, ".git")); err == nil {
 		// Repo exists, try to open and pull
@@ -56,9 +139,11 @@ func (s *Service) Clone() error {
 			return fmt.Errorf("failed to get auth: %w", err)
 		}
 
-		err = worktree.Pull(&git.PullOptions{
-			RemoteName: "origin",
-			Auth:       auth,
+		err = worktree.PullContext(ctx, &git.PullOptions{
+			RemoteName:   "origin",
+			Auth:         auth,
+			Depth:        s.depth,
+			SingleBranch: s.depth > 0,
 		})
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			return fmt.Errorf("failed to pull: %w", err)
@@ -77,10 +162,12 @@ func (s *Service) Clone() error {
 	os.RemoveAll(s.workDir)
 
 	// Clone the repository
-	repo, err := git.PlainClone(s.workDir, false, &git.CloneOptions{
-		URL:      s.repoURL,
-		Auth:     auth,
-		Progress: nil, // Could add progress tracking
+	repo, err := git.PlainCloneContext(ctx, s.workDir, false, &git.CloneOptions{
+		URL:          s.repoURL,
+		Auth:         auth,
+		Depth:        s.depth,
+		SingleBranch: s.depth > 0,
+		Progress:     nil, // Could add progress tracking
 	})
 	if err != nil {
 		return fmt.Errorf("failed to clone repo: %w", err)
@@ -96,39 +183,28 @@ func (s *Service) WriteManifests(appName, environment, versionID string, manifes
 		return fmt.Errorf("repository not initialized, call Clone() first")
 	}
 
-	// Create directory structure: environments/{environment}/apps/{app_name}/
-	appDir := filepath.Join(s.workDir, "environments", environment, "apps", appName)
+	// Create the app's directory, environments/{environment}/apps/{app} by default
+	relativePath := s.AppPath(appName, environment)
+	appDir := filepath.Join(s.workDir, relativePath)
 	if err := os.MkdirAll(appDir, 0755); err != nil {
 		return fmt.Errorf("failed to create app directory: %w", err)
 	}
 
 	// Process manifest files, extracting tarballs if present
-	processedManifests := make(map[string][]byte)
-
-	for filename, content := range manifests {
-		if filename == "manifests.tar.gz" {
-			// Extract tarball contents
-			extractedFiles, err := s.extractTarball(content)
-			if err != nil {
-				return fmt.Errorf("failed to extract tarball %s: %w", filename, err)
-			}
-
-			// Add extracted files to processed manifests
-			for extractedFilename, extractedContent := range extractedFiles {
-				// Only include YAML files
-				if strings.HasSuffix(extractedFilename, ".yaml") || strings.HasSuffix(extractedFilename, ".yml") {
-					processedManifests[extractedFilename] = extractedContent
-				}
-			}
-		} else {
-			// Regular file, add as-is
-			processedManifests[filename] = content
-		}
+	processedManifests, err := ExpandManifests(manifests, s.tarballLimits)
+	if err != nil {
+		return err
 	}
 
-	// Write each processed manifest file
+	// Write each processed manifest file, leaving unchanged files alone
 	for filename, content := range processedManifests {
 		filePath := filepath.Join(appDir, filename)
+		if !strings.HasPrefix(filePath, appDir+string(filepath.Separator)) {
+			return fmt.Errorf("manifest %s would be written outside %s", filename, relativePath)
+		}
+		if existing, err := os.ReadFile(filePath); err == nil && bytes.Equal(existing, content) {
+			continue
+		}
 		if err := os.WriteFile(filePath, content, 0644); err != nil {
 			return fmt.Errorf("failed to write manifest %s: %w", filename, err)
 		}
@@ -141,7 +217,6 @@ func (s *Service) WriteManifests(appName, environment, versionID string, manifes
 	}
 
 	// Add the entire app directory
-	relativePath := filepath.Join("environments", environment, "apps", appName)
 	if err := worktree.AddGlob(relativePath + "/*"); err != nil {
 		return fmt.Errorf("failed to add files to git: %w", err)
 	}
@@ -149,7 +224,56 @@ func (s *Service) WriteManifests(appName, environment, versionID string, manifes
 	return nil
 }
 
-// Commit commits the changes and returns the commit SHA
+// AppPath returns the path of an application's manifests within the gitops repo
+func (s *Service) AppPath(appName, environment string) string {
+	tmpl := s.pathTemplate
+	if tmpl == "" {
+		tmpl = DefaultPathTemplate
+	}
+	return RenderPath(tmpl, appName, environment)
+}
+
+// IsManifest reports whether a version file is a YAML manifest. Other files
+// are assets, written to the gitops repo as they are.
+func IsManifest(filename string) bool {
+	return strings.HasSuffix(filename, ".yaml") || strings.HasSuffix(filename, ".yml")
+}
+
+// ExpandManifests returns the files that will be written for a set of
+// version files, extracting manifests.tar.gz if present. A file in the
+// tarball may not share a name with a file uploaded next to it, and the
+// tarball may not expand past limits.
+func ExpandManifests(manifests map[string][]byte, limits TarballLimits) (map[string][]byte, error) {
+	processedManifests := make(map[string][]byte)
+	var extractedFiles map[string][]byte
+
+	for filename, content := range manifests {
+		if filename == "manifests.tar.gz" {
+			// Extract tarball contents
+			var err error
+			extractedFiles, err = ExtractTarball(bytes.NewReader(content), limits)
+			if err != nil {
+				return nil, fmt.Errorf("failed to extract tarball %s: %w", filename, err)
+			}
+		} else {
+			// Regular file, add as-is
+			processedManifests[filename] = content
+		}
+	}
+
+	// Add extracted files, manifests and assets alike
+	for extractedFilename, extractedContent := range extractedFiles {
+		if _, ok := processedManifests[extractedFilename]; ok {
+			return nil, fmt.Errorf("%s in manifests.tar.gz would overwrite an uploaded file of the same name", extractedFilename)
+		}
+		processedManifests[extractedFilename] = extractedContent
+	}
+
+	return processedManifests, nil
+}
+
+// Commit commits the changes and returns the commit SHA. If nothing
+// changed, no commit is made and it returns the HEAD SHA with ErrNoChanges.
 func (s *Service) Commit(message string) (string, error) {
 	if s.repo == nil {
 		return "", fmt.Errorf("repository not initialized, call Clone() first")
@@ -168,6 +292,13 @@ func (s *Service) Commit(message string) (string, error) {
 			When:  time.Now(),
 		},
 	})
+	if errors.Is(err, git.ErrEmptyCommit) {
+		head, headErr := s.repo.Head()
+		if headErr != nil {
+			return "", fmt.Errorf("failed to get HEAD: %w", headErr)
+		}
+		return head.Hash().String(), ErrNoChanges
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to commit: %w", err)
 	}
@@ -175,8 +306,15 @@ func (s *Service) Commit(message string) (string, error) {
 	return commitHash.String(), nil
 }
 
-// Push pushes the commits to the remote repository
-func (s *Service) Push() error {
+// Push pushes the commits to the remote repository, stopping if ctx is
+// cancelled. Errors reaching the remote wrap ErrPushRejected or
+// ErrPushFailed.
+//
+// A shallow working copy can't merge a remote that moved on since the last
+// pull, so if its push is rejected it fetches the remote, replays the
+// unpushed commits on top and pushes once more. HEAD then names the
+// replayed commit.
+func (s *Service) Push(ctx context.Context) error {
 	if s.repo == nil {
 		return fmt.Errorf("repository not initialized, call Clone() first")
 	}
@@ -186,75 +324,294 @@ func (s *Service) Push() error {
 		return fmt.Errorf("failed to get auth: %w", err)
 	}
 
-	err = s.repo.Push(&git.PushOptions{
+	err = s.push(ctx, auth)
+	if errors.Is(err, ErrPushRejected) && s.depth > 0 {
+		if replayErr := s.replayOnRemote(ctx, auth); replayErr != nil {
+			return fmt.Errorf("%w; replaying onto the remote failed: %v", err, replayErr)
+		}
+		err = s.push(ctx, auth)
+	}
+	return err
+}
+
+func (s *Service) push(ctx context.Context, auth transport.AuthMethod) error {
+	err := s.repo.PushContext(ctx, &git.PushOptions{
 		RemoteName: "origin",
 		Auth:       auth,
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return fmt.Errorf("failed to push: %w", err)
+		// A shallow copy can't find a remote head it never fetched while
+		// checking the push fast-forwards
+		if isPushRejected(err) || (s.depth > 0 && errors.Is(err, plumbing.ErrObjectNotFound)) {
+			return fmt.Errorf("%w: %w", ErrPushRejected, err)
+		}
+		return fmt.Errorf("%w: %w", ErrPushFailed, err)
 	}
 
 	return nil
 }
 
-// getAuth returns SSH authentication
-func (s *Service) getAuth() (*ssh.PublicKeys, error) {
-	if s.sshKeyPath == "" {
-		return nil, fmt.Errorf("SSH key path not configured")
+// replayOnRemote fetches the current branch and recreates the commits not
+// yet pushed on top of it, with the same messages and authors. Each commit's
+// files are written as they were in it, so they win over remote changes to
+// the same files. Only the remote's tip is fetched, since replaying needs no
+// history beyond it.
+func (s *Service) replayOnRemote(ctx context.Context, auth transport.AuthMethod) error {
+	head, err := s.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	remoteHead, err := s.remoteHead(head.Name())
+	if err != nil {
+		return err
 	}
 
-	auth, err := ssh.NewPublicKeysFromFile("git", s.sshKeyPath, "")
+	// Collect the unpushed commits, newest first
+	var unpushed []*object.Commit
+	commit, err := s.repo.CommitObject(head.Hash())
+	for err == nil && commit.Hash != remoteHead {
+		unpushed = append(unpushed, commit)
+		commit, err = commit.Parent(0)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH auth: %w", err)
+		return fmt.Errorf("failed to find the unpushed commits: %w", err)
 	}
 
-	// Disable host key verification to avoid known_hosts issues
-	auth.HostKeyCallback = cryptossh.InsecureIgnoreHostKey()
+	err = s.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Depth:      s.depth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	remoteHead, err = s.remoteHead(head.Name())
+	if err != nil {
+		return err
+	}
 
-	return auth, nil
-}
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: remoteHead, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset to the remote: %w", err)
+	}
 
-// Cleanup removes the working directory
-func (s *Service) Cleanup() error {
-	if s.workDir != "" {
-		return os.RemoveAll(s.workDir)
+	for i := len(unpushed) - 1; i >= 0; i-- {
+		if err := s.replayCommit(worktree, unpushed[i]); err != nil {
+			return fmt.Errorf("failed to replay %s: %w", unpushed[i].Hash, err)
+		}
 	}
+
 	return nil
 }
 
-// extractTarball extracts files from a gzipped tarball
-func (s *Service) extractTarball(data []byte) (map[string][]byte, error) {
-	gzReader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+// ResetToRemote throws away commits that weren't pushed and uncommitted
+// changes, leaving the working copy at the remote's head as last fetched
+func (s *Service) ResetToRemote() error {
+	if s.repo == nil {
+		return fmt.Errorf("repository not initialized, call Clone() first")
 	}
-	defer gzReader.Close()
 
-	tarReader := tar.NewReader(gzReader)
-	files := make(map[string][]byte)
+	head, err := s.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// Nothing is committed yet
+		return s.Discard()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
 
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to read tar header: %w", err)
+	remoteHead, err := s.remoteHead(head.Name())
+	if err != nil {
+		// The remote has no commits yet, so none of ours were pushed
+		if err := s.repo.Storer.RemoveReference(head.Name()); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", head.Name(), err)
 		}
+		return s.Discard()
+	}
 
-		// Skip directories
-		if header.Typeflag == tar.TypeDir {
-			continue
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: remoteHead, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset to the remote: %w", err)
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %w", err)
+	}
+
+	return nil
+}
+
+// remoteHead returns the commit the remote's branch was at when last
+// fetched. Shallow clones track only the remote's HEAD.
+func (s *Service) remoteHead(branch plumbing.ReferenceName) (plumbing.Hash, error) {
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewRemoteHEADReferenceName("origin"),
+		plumbing.NewRemoteReferenceName("origin", branch.Short()),
+	} {
+		if ref, err := s.repo.Reference(name, true); err == nil {
+			return ref.Hash(), nil
 		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("no remote-tracking branch for %s", branch.Short())
+}
 
-		// Read file content
-		content, err := io.ReadAll(tarReader)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %w", header.Name, err)
+// replayCommit applies the files commit changed to the worktree and commits
+// them again. A commit whose changes the remote already has is dropped.
+func (s *Service) replayCommit(worktree *git.Worktree, commit *object.Commit) error {
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		path := change.To.Name
+		if path == "" {
+			// Deleted
+			path = change.From.Name
+			if err := os.Remove(filepath.Join(s.workDir, path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			file, err := tree.File(path)
+			if err != nil {
+				return err
+			}
+			content, err := file.Contents()
+			if err != nil {
+				return err
+			}
+			full := filepath.Join(s.workDir, path)
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+				return err
+			}
 		}
+		if _, err := worktree.Add(path); err != nil {
+			return err
+		}
+	}
 
-		files[header.Name] = content
+	_, err = worktree.Commit(commit.Message, &git.CommitOptions{
+		Author:    &commit.Author,
+		Committer: &commit.Committer,
+	})
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return nil
 	}
+	return err
+}
 
-	return files, nil
+// HeadSHA returns the SHA of the working copy's HEAD commit
+func (s *Service) HeadSHA() (string, error) {
+	if s.repo == nil {
+		return "", fmt.Errorf("repository not initialized, call Clone() first")
+	}
+	head, err := s.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// isPushRejected reports whether a push failed because the remote refused
+// the update. go-git reports most of these as plain errors.
+func isPushRejected(err error) bool {
+	if errors.Is(err, git.ErrForceNeeded) {
+		return true
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "non-fast-forward update") || strings.HasPrefix(msg, "command error on")
+}
+
+// SSHKeyPath returns the path of the SSH key currently in use
+func (s *Service) SSHKeyPath() string {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.sshKeyPath
+}
+
+// ReloadCredentials re-reads the SSH key at sshKeyPath and switches to it once
+// it has been used to reach the remote. The current key stays in use if the
+// new one can't be loaded or is rejected, so keys can be rotated without a
+// restart.
+func (s *Service) ReloadCredentials(ctx context.Context, sshKeyPath string) error {
+	auth, err := loadAuth(sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{s.repoURL},
+	})
+	_, err = remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return fmt.Errorf("failed to reach gitops repo with new credentials: %w", err)
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.sshKeyPath = sshKeyPath
+	s.auth = auth
+	return nil
+}
+
+// getAuth returns SSH authentication, loading the key on first use
+func (s *Service) getAuth() (*ssh.PublicKeys, error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if s.auth != nil {
+		return s.auth, nil
+	}
+
+	auth, err := loadAuth(s.sshKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	s.auth = auth
+	return auth, nil
+}
+
+// loadAuth reads an SSH private key from disk
+func loadAuth(sshKeyPath string) (*ssh.PublicKeys, error) {
+	if sshKeyPath == "" {
+		return nil, fmt.Errorf("SSH key path not configured")
+	}
+
+	auth, err := ssh.NewPublicKeysFromFile("git", sshKeyPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH auth: %w", err)
+	}
+
+	// Disable host key verification to avoid known_hosts issues
+	auth.HostKeyCallback = cryptossh.InsecureIgnoreHostKey()
+
+	return auth, nil
+}
+
+// Cleanup removes the working directory
+func (s *Service) Cleanup() error {
+	if s.workDir != "" {
+		return os.RemoveAll(s.workDir)
+	}
+	return nil
 }
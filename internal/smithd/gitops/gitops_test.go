@@ -0,0 +1,512 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+// writeTestKey writes a new SSH private key to dir and returns its path and
+// public key
+func writeTestKey(t testing.TB, dir, name string) (string, cryptossh.PublicKey) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := cryptossh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	signer, err := cryptossh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	keyPath := filepath.Join(dir, name)
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return keyPath, signer.PublicKey()
+}
+
+func TestReloadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "gitops.git")
+	if _, err := git.PlainInit(repoPath, true); err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+
+	oldKey, oldPublic := writeTestKey(t, dir, "old_key")
+	newKey, newPublic := writeTestKey(t, dir, "new_key")
+
+	s := NewService(repoPath, oldKey, filepath.Join(dir, "work"))
+	auth, err := s.getAuth()
+	if err != nil {
+		t.Fatalf("getAuth failed: %v", err)
+	}
+	if !bytes.Equal(auth.Signer.PublicKey().Marshal(), oldPublic.Marshal()) {
+		t.Fatal("expected the configured key to be used")
+	}
+
+	if err := s.ReloadCredentials(context.Background(), newKey); err != nil {
+		t.Fatalf("ReloadCredentials failed: %v", err)
+	}
+
+	// The next operation uses the reloaded key
+	auth, err = s.getAuth()
+	if err != nil {
+		t.Fatalf("getAuth failed: %v", err)
+	}
+	if !bytes.Equal(auth.Signer.PublicKey().Marshal(), newPublic.Marshal()) {
+		t.Error("expected the reloaded key to be used")
+	}
+	if s.SSHKeyPath() != newKey {
+		t.Errorf("expected key path %s, got %s", newKey, s.SSHKeyPath())
+	}
+}
+
+func TestReloadCredentials_WhileWorkingCopyLocked(t *testing.T) {
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "gitops.git")
+	if _, err := git.PlainInit(repoPath, true); err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	oldKey, _ := writeTestKey(t, dir, "old_key")
+	newKey, _ := writeTestKey(t, dir, "new_key")
+	s := NewService(repoPath, oldKey, filepath.Join(dir, "work"))
+
+	// A deployment holds the working copy
+	s.Lock()
+	defer s.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ReloadCredentials(context.Background(), newKey)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ReloadCredentials failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected ReloadCredentials not to wait for the working copy")
+	}
+	if s.SSHKeyPath() != newKey {
+		t.Errorf("expected key path %s, got %s", newKey, s.SSHKeyPath())
+	}
+}
+
+func TestReloadCredentials_KeepsCurrentKeyOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "gitops.git")
+	if _, err := git.PlainInit(repoPath, true); err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+
+	oldKey, oldPublic := writeTestKey(t, dir, "old_key")
+	s := NewService(repoPath, oldKey, filepath.Join(dir, "work"))
+
+	// A key that doesn't exist is rejected
+	if err := s.ReloadCredentials(context.Background(), filepath.Join(dir, "missing_key")); err == nil {
+		t.Error("expected error for missing key")
+	}
+
+	// A key that can't reach the remote is rejected
+	newKey, _ := writeTestKey(t, dir, "new_key")
+	unreachable := NewService(filepath.Join(dir, "missing.git"), oldKey, filepath.Join(dir, "work"))
+	if err := unreachable.ReloadCredentials(context.Background(), newKey); err == nil {
+		t.Error("expected error when the remote can't be reached")
+	}
+	if unreachable.SSHKeyPath() != oldKey {
+		t.Errorf("expected key path to stay %s, got %s", oldKey, unreachable.SSHKeyPath())
+	}
+
+	auth, err := s.getAuth()
+	if err != nil {
+		t.Fatalf("getAuth failed: %v", err)
+	}
+	if !bytes.Equal(auth.Signer.PublicKey().Marshal(), oldPublic.Marshal()) {
+		t.Error("expected the current key to stay in use")
+	}
+}
+
+func TestCommit_NoChanges(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{
+		"environments/staging/apps/my-api/deployment.yaml": "kind: Deployment\nreplicas: 1\n",
+	})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	head, err := s.repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+
+	// Writing the manifests already in the repo leaves nothing to commit
+	err = s.WriteManifests("my-api", "staging", "v1", map[string][]byte{
+		"deployment.yaml": []byte("kind: Deployment\nreplicas: 1\n"),
+	})
+	if err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	sha, err := s.Commit("Deploy v1")
+	if !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("expected ErrNoChanges, got %v", err)
+	}
+	if sha != head.Hash().String() {
+		t.Errorf("expected HEAD %s, got %s", head.Hash(), sha)
+	}
+
+	// A real change is committed
+	err = s.WriteManifests("my-api", "staging", "v2", map[string][]byte{
+		"deployment.yaml": []byte("kind: Deployment\nreplicas: 2\n"),
+	})
+	if err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	sha, err = s.Commit("Deploy v2")
+	if err != nil || sha == head.Hash().String() {
+		t.Errorf("expected a new commit, got %s, %v", sha, err)
+	}
+}
+
+// commitToRemote adds a commit writing path to the repository at dir
+func commitToRemote(t testing.TB, dir, path, content string) {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	full := filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	if _, err := worktree.Add(path); err != nil {
+		t.Fatalf("failed to add %s: %v", path, err)
+	}
+	_, err = worktree.Commit("Update "+path, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestClone_Shallow(t *testing.T) {
+	upstream := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	for i := 0; i < 5; i++ {
+		commitToRemote(t, upstream, "environments/staging/apps/other/deployment.yaml", fmt.Sprintf("replicas: %d\n", i))
+	}
+	// Pushes need a bare remote
+	remote := filepath.Join(t.TempDir(), "gitops.git")
+	if _, err := git.PlainClone(remote, true, &git.CloneOptions{URL: upstream}); err != nil {
+		t.Fatalf("failed to create bare remote: %v", err)
+	}
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	s.SetCloneDepth(1)
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	commits, err := s.repo.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	count := 0
+	commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("expected 1 commit in a depth 1 clone, got %d", count)
+	}
+
+	// Another deploy moves the remote on; the shallow copy pulls it
+	other := NewService(remote, key, filepath.Join(dir, "other"))
+	if err := other.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if err := other.WriteManifests("other", "staging", "v2", map[string][]byte{"deployment.yaml": []byte("replicas: 9\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	if _, err := other.Commit("Deploy other v2"); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := other.Push(context.Background()); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("pull failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "work", "environments", "staging", "apps", "other", "deployment.yaml"))
+	if err != nil || string(data) != "replicas: 9\n" {
+		t.Errorf("expected the pulled change, got %q, %v", data, err)
+	}
+
+	// Deploys commit on top of the shallow history and push it
+	err = s.WriteManifests("my-api", "staging", "v1", map[string][]byte{"deployment.yaml": []byte("kind: Deployment\n")})
+	if err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	sha, err := s.Commit("Deploy v1")
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	remoteRepo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("failed to open remote: %v", err)
+	}
+	head, err := remoteRepo.Head()
+	if err != nil || head.Hash().String() != sha {
+		t.Errorf("expected the remote at %s, got %v, %v", sha, head, err)
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	remote := newTestRemote(b, map[string]string{"README.md": "gitops\n"})
+	for i := 0; i < 200; i++ {
+		commitToRemote(b, remote, fmt.Sprintf("environments/staging/apps/app-%d/deployment.yaml", i%20), fmt.Sprintf("replicas: %d\n", i))
+	}
+	key, _ := writeTestKey(b, b.TempDir(), "key")
+
+	for _, depth := range []int{0, 1} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s := NewService(remote, key, filepath.Join(b.TempDir(), "work"))
+				s.SetCloneDepth(depth)
+				if err := s.Clone(context.Background()); err != nil {
+					b.Fatalf("Clone failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestClone_Cancelled(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled clone to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestPush_Rejected(t *testing.T) {
+	upstream := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	remote := filepath.Join(t.TempDir(), "gitops.git")
+	if _, err := git.PlainClone(remote, true, &git.CloneOptions{URL: upstream}); err != nil {
+		t.Fatalf("failed to create bare remote: %v", err)
+	}
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	// Two working copies deploy from the same starting point
+	first := NewService(remote, key, filepath.Join(dir, "first"))
+	second := NewService(remote, key, filepath.Join(dir, "second"))
+	for _, s := range []*Service{first, second} {
+		if err := s.Clone(context.Background()); err != nil {
+			t.Fatalf("Clone failed: %v", err)
+		}
+	}
+
+	for i, s := range []*Service{first, second} {
+		version := fmt.Sprintf("v%d", i+1)
+		if err := s.WriteManifests("my-api", "staging", version, map[string][]byte{"deployment.yaml": []byte(version + "\n")}); err != nil {
+			t.Fatalf("WriteManifests failed: %v", err)
+		}
+		if _, err := s.Commit("Deploy " + version); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+
+	if err := first.Push(context.Background()); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if err := second.Push(context.Background()); !errors.Is(err, ErrPushRejected) {
+		t.Errorf("expected a push behind the remote to be rejected, got %v", err)
+	}
+}
+
+func TestPush_ShallowReplaysOntoRemote(t *testing.T) {
+	upstream := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	for i := 0; i < 3; i++ {
+		commitToRemote(t, upstream, "environments/staging/apps/other/deployment.yaml", fmt.Sprintf("replicas: %d\n", i))
+	}
+	remote := filepath.Join(t.TempDir(), "gitops.git")
+	if _, err := git.PlainClone(remote, true, &git.CloneOptions{URL: upstream}); err != nil {
+		t.Fatalf("failed to create bare remote: %v", err)
+	}
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	s.SetCloneDepth(1)
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if err := s.WriteManifests("my-api", "staging", "v1", map[string][]byte{"deployment.yaml": []byte("v1\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	if _, err := s.Commit("Deploy my-api v1"); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// The remote moves ahead before the shallow copy pushes
+	other := NewService(remote, key, filepath.Join(dir, "other"))
+	if err := other.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if err := other.WriteManifests("other", "staging", "v2", map[string][]byte{"deployment.yaml": []byte("replicas: 9\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	otherSHA, err := other.Commit("Deploy other v2")
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := other.Push(context.Background()); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatalf("expected the shallow push to be retried, got %v", err)
+	}
+	sha, err := s.HeadSHA()
+	if err != nil {
+		t.Fatalf("HeadSHA failed: %v", err)
+	}
+
+	// The remote has both deploys, ours replayed on top
+	remoteRepo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("failed to open remote: %v", err)
+	}
+	head, err := remoteRepo.Head()
+	if err != nil || head.Hash().String() != sha {
+		t.Fatalf("expected the remote at %s, got %v, %v", sha, head, err)
+	}
+	commit, err := remoteRepo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if commit.Message != "Deploy my-api v1" || len(commit.ParentHashes) != 1 || commit.ParentHashes[0].String() != otherSHA {
+		t.Errorf("expected our deploy on top of %s, got %q with parents %v", otherSHA, commit.Message, commit.ParentHashes)
+	}
+	for path, want := range map[string]string{
+		"environments/staging/apps/my-api/deployment.yaml": "v1\n",
+		"environments/staging/apps/other/deployment.yaml":  "replicas: 9\n",
+	} {
+		file, err := commit.File(path)
+		if err != nil {
+			t.Errorf("expected %s on the remote: %v", path, err)
+			continue
+		}
+		if content, _ := file.Contents(); content != want {
+			t.Errorf("expected %s to be %q, got %q", path, want, content)
+		}
+	}
+}
+
+func TestResetToRemote(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	remoteSHA, err := s.HeadSHA()
+	if err != nil {
+		t.Fatalf("HeadSHA failed: %v", err)
+	}
+
+	// A failed deployment left a commit and uncommitted files behind
+	if err := s.WriteManifests("my-api", "staging", "v1", map[string][]byte{"deployment.yaml": []byte("v1\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	if _, err := s.Commit("Deploy v1"); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := s.WriteManifests("my-api", "production", "v1", map[string][]byte{"deployment.yaml": []byte("v1\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+
+	if err := s.ResetToRemote(); err != nil {
+		t.Fatalf("ResetToRemote failed: %v", err)
+	}
+	if sha, err := s.HeadSHA(); err != nil || sha != remoteSHA {
+		t.Errorf("expected HEAD at the remote's %s, got %s, %v", remoteSHA, sha, err)
+	}
+	for _, environment := range []string{"staging", "production"} {
+		if _, err := os.Stat(filepath.Join(dir, "work", "environments", environment)); !os.IsNotExist(err) {
+			t.Errorf("expected the %s manifests to be gone, got %v", environment, err)
+		}
+	}
+}
+
+func TestClone_Failed(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(filepath.Join(dir, "missing.git"), key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); !errors.Is(err, ErrCloneFailed) {
+		t.Errorf("expected ErrCloneFailed, got %v", err)
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	s := NewService("", "", t.TempDir())
+	if err := s.LockContext(context.Background()); err != nil {
+		t.Fatalf("LockContext failed: %v", err)
+	}
+
+	// The working copy is taken, so a second caller waits until cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.LockContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected waiting for a held lock to time out, got %v", err)
+	}
+
+	s.Unlock()
+	if err := s.LockContext(context.Background()); err != nil {
+		t.Errorf("expected the released lock to be free, got %v", err)
+	}
+	s.Unlock()
+}
@@ -0,0 +1,56 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches placeholders such as ${GIT_SHA}
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Z][A-Z0-9_]*)\}`)
+
+// variableNamePattern matches names that can be used in placeholders
+var variableNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// IsVariableName reports whether name can be used as a ${NAME} placeholder
+func IsVariableName(name string) bool {
+	return variableNamePattern.MatchString(name)
+}
+
+// Interpolate replaces ${NAME} placeholders in manifest content with values
+// from vars. Any placeholder without a value is an error, so a typo can
+// never be deployed as a literal string.
+func Interpolate(manifests map[string][]byte, vars map[string]string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(manifests))
+	unknown := map[string]bool{}
+
+	for filename, content := range manifests {
+		// Assets are written exactly as uploaded
+		if !IsManifest(filename) {
+			result[filename] = content
+			continue
+		}
+
+		result[filename] = placeholderPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+			name := string(placeholderPattern.FindSubmatch(match)[1])
+			value, ok := vars[name]
+			if !ok {
+				unknown[fmt.Sprintf("%s in %s", match, filename)] = true
+				return match
+			}
+			return []byte(value)
+		})
+	}
+
+	if len(unknown) > 0 {
+		placeholders := make([]string, 0, len(unknown))
+		for placeholder := range unknown {
+			placeholders = append(placeholders, placeholder)
+		}
+		sort.Strings(placeholders)
+		return nil, fmt.Errorf("unknown placeholders: %s", strings.Join(placeholders, ", "))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package gitops
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolate_Placeholders(t *testing.T) {
+	vars := map[string]string{
+		"GIT_SHA":      "42540c4",
+		"GIT_BRANCH":   "main",
+		"BUILD_NUMBER": "123",
+		"VERSION":      "42540c4-123",
+		"ENVIRONMENT":  "staging",
+		"APP_NAME":     "my-api",
+	}
+
+	for name, value := range vars {
+		t.Run(name, func(t *testing.T) {
+			manifests := map[string][]byte{
+				"deployment.yaml": []byte("value: ${" + name + "}\n"),
+			}
+
+			result, err := Interpolate(manifests, vars)
+			if err != nil {
+				t.Fatalf("Interpolate failed: %v", err)
+			}
+
+			expected := "value: " + value + "\n"
+			if string(result["deployment.yaml"]) != expected {
+				t.Errorf("expected %q, got %q", expected, result["deployment.yaml"])
+			}
+		})
+	}
+}
+
+func TestInterpolate_MultipleFiles(t *testing.T) {
+	manifests := map[string][]byte{
+		"deployment.yaml": []byte("labels:\n  git-sha: ${GIT_SHA}\n  env: ${ENVIRONMENT}\n"),
+		"service.yaml":    []byte("kind: Service\n"),
+	}
+
+	result, err := Interpolate(manifests, map[string]string{"GIT_SHA": "abc", "ENVIRONMENT": "prod"})
+	if err != nil {
+		t.Fatalf("Interpolate failed: %v", err)
+	}
+
+	if string(result["deployment.yaml"]) != "labels:\n  git-sha: abc\n  env: prod\n" {
+		t.Errorf("unexpected deployment.yaml: %q", result["deployment.yaml"])
+	}
+	if string(result["service.yaml"]) != "kind: Service\n" {
+		t.Errorf("files without placeholders should be unchanged, got %q", result["service.yaml"])
+	}
+}
+
+func TestInterpolate_UnknownPlaceholder(t *testing.T) {
+	manifests := map[string][]byte{
+		"deployment.yaml": []byte("image: app:${GIT_SHAA}\n"),
+	}
+
+	_, err := Interpolate(manifests, map[string]string{"GIT_SHA": "abc"})
+	if err == nil {
+		t.Fatal("expected error for unknown placeholder")
+	}
+	if !strings.Contains(err.Error(), "${GIT_SHAA} in deployment.yaml") {
+		t.Errorf("expected error to name the placeholder and file, got %v", err)
+	}
+}
+
+func TestInterpolate_IgnoresOtherSyntax(t *testing.T) {
+	content := "command: echo $HOME ${lowercase} $(date)\n"
+	manifests := map[string][]byte{"job.yaml": []byte(content)}
+
+	result, err := Interpolate(manifests, map[string]string{})
+	if err != nil {
+		t.Fatalf("Interpolate failed: %v", err)
+	}
+	if string(result["job.yaml"]) != content {
+		t.Errorf("expected content unchanged, got %q", result["job.yaml"])
+	}
+}
+
+func TestInterpolate_LeavesAssetsAlone(t *testing.T) {
+	asset := "url=${SERVICE_URL}\n"
+	manifests := map[string][]byte{
+		"deployment.yaml": []byte("image: app:${GIT_SHA}\n"),
+		"app.properties":  []byte(asset),
+	}
+
+	result, err := Interpolate(manifests, map[string]string{"GIT_SHA": "abc"})
+	if err != nil {
+		t.Fatalf("Interpolate failed: %v", err)
+	}
+	if string(result["deployment.yaml"]) != "image: app:abc\n" || string(result["app.properties"]) != asset {
+		t.Errorf("expected only the manifest to be interpolated, got %q", result)
+	}
+}
@@ -0,0 +1,47 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultPathTemplate is where an application's manifests are written in the
+// gitops repo when no template is configured
+const DefaultPathTemplate = "environments/{environment}/apps/{app}"
+
+var pathVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidatePathTemplate checks a gitops path template, such as
+// "clusters/{environment}/{app}". It may only use {app} and {environment},
+// must use both so deployments don't overwrite each other, and must stay
+// inside the repo.
+func ValidatePathTemplate(tmpl string) error {
+	used := make(map[string]bool)
+	for _, variable := range pathVariable.FindAllString(tmpl, -1) {
+		if variable != "{app}" && variable != "{environment}" {
+			return fmt.Errorf("unknown variable %s, expected {app} or {environment}", variable)
+		}
+		used[variable] = true
+	}
+	if !used["{app}"] || !used["{environment}"] {
+		return fmt.Errorf("template must use both {app} and {environment}")
+	}
+
+	rendered := RenderPath(tmpl, "app", "staging")
+	if strings.ContainsAny(rendered, "{}") {
+		return fmt.Errorf("template has unmatched braces")
+	}
+	if path.IsAbs(rendered) || rendered == "." || rendered == ".." || strings.HasPrefix(rendered, "../") {
+		return fmt.Errorf("template must be a path inside the repository")
+	}
+	return nil
+}
+
+// RenderPath fills in a gitops path template for an application and
+// environment
+func RenderPath(tmpl, appName, environment string) string {
+	rendered := strings.NewReplacer("{app}", appName, "{environment}", environment).Replace(tmpl)
+	return path.Clean(rendered)
+}
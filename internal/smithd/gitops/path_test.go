@@ -0,0 +1,53 @@
+package gitops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePathTemplate(t *testing.T) {
+	valid := []string{DefaultPathTemplate, "clusters/{environment}/{app}", "{app}-{environment}"}
+	for _, tmpl := range valid {
+		if err := ValidatePathTemplate(tmpl); err != nil {
+			t.Errorf("expected %q to be valid, got %v", tmpl, err)
+		}
+	}
+
+	invalid := []string{
+		"apps/{app}",                      // every environment would share a directory
+		"{environment}/{component}/{app}", // unknown variable
+		"{environment}/{app",              // unmatched brace
+		"/srv/{environment}/{app}",        // outside the repo
+		"../{environment}/{app}",          // outside the repo
+		"{environment}/../../{app}/../..", // cleans to outside the repo
+	}
+	for _, tmpl := range invalid {
+		if err := ValidatePathTemplate(tmpl); err == nil {
+			t.Errorf("expected %q to be rejected", tmpl)
+		}
+	}
+}
+
+func TestWriteManifests_PathTemplate(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	s.SetPathTemplate("clusters/{environment}/{app}")
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if got := s.AppPath("my-api", "staging"); got != "clusters/staging/my-api" {
+		t.Errorf("expected clusters/staging/my-api, got %s", got)
+	}
+	if err := s.WriteManifests("my-api", "staging", "v1", map[string][]byte{"deployment.yaml": []byte("kind: Deployment\n")}); err != nil {
+		t.Fatalf("WriteManifests failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "work", "clusters", "staging", "my-api", "deployment.yaml")); err != nil {
+		t.Errorf("expected the manifest under the templated path: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package gitops
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// TarballLimits caps the contents of a manifests.tar.gz. Zero fields are
+// unlimited.
+type TarballLimits struct {
+	MaxSize     int64 // total uncompressed bytes
+	MaxFileSize int64 // uncompressed bytes of any one file
+	MaxFiles    int
+}
+
+// ExtractTarball extracts the files from a gzipped tarball, failing once it
+// goes over limits. Only regular files with relative names that stay in the
+// app's directory are allowed; directories are skipped.
+func ExtractTarball(r io.Reader, limits TarballLimits) (map[string][]byte, error) {
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	files := make(map[string][]byte)
+	var total int64
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			// Directories are created as files are written, and git
+			// archive adds a global header with the commit
+			continue
+		default:
+			return nil, fmt.Errorf("%s is not a regular file", header.Name)
+		}
+		if err := checkFileName(header.Name); err != nil {
+			return nil, err
+		}
+
+		if limits.MaxFiles > 0 && len(files) >= limits.MaxFiles {
+			return nil, fmt.Errorf("more than %d files", limits.MaxFiles)
+		}
+
+		// Read at most one byte past what's left, rather than trusting the
+		// header's size, so a limit can't be exceeded in memory
+		limit := int64(-1)
+		if limits.MaxFileSize > 0 {
+			limit = limits.MaxFileSize
+		}
+		if limits.MaxSize > 0 && (limit < 0 || limits.MaxSize-total < limit) {
+			limit = limits.MaxSize - total
+		}
+		var content []byte
+		if limit >= 0 {
+			content, err = io.ReadAll(io.LimitReader(tarReader, limit+1))
+		} else {
+			content, err = io.ReadAll(tarReader)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", header.Name, err)
+		}
+
+		if limits.MaxFileSize > 0 && int64(len(content)) > limits.MaxFileSize {
+			return nil, fmt.Errorf("file %s is larger than %d bytes", header.Name, limits.MaxFileSize)
+		}
+		total += int64(len(content))
+		if limits.MaxSize > 0 && total > limits.MaxSize {
+			return nil, fmt.Errorf("contents are larger than %d bytes", limits.MaxSize)
+		}
+
+		if _, ok := files[header.Name]; ok {
+			return nil, fmt.Errorf("duplicate file %s", header.Name)
+		}
+		files[header.Name] = content
+	}
+
+	return files, nil
+}
+
+// checkFileName rejects a file name that could be written outside the app's
+// directory: an absolute path or one with a ".." element
+func checkFileName(name string) error {
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || filepath.IsAbs(name) {
+		return fmt.Errorf("%s is an absolute path", name)
+	}
+	for _, element := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return fmt.Errorf("%s must not contain '..'", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package gitops
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry is an entry of a tarball built by buildTarball
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+// buildTarball returns a gzipped tarball of entries
+func buildTarball(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		if err := tarWriter.WriteHeader(&header); err != nil {
+			t.Fatalf("failed to write tar header for %s: %v", header.Name, err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("failed to write %s: %v", header.Name, err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTarball_EntryNames(t *testing.T) {
+	data := buildTarball(t,
+		tarEntry{header: tar.Header{Name: "./", Typeflag: tar.TypeDir}},
+		tarEntry{header: tar.Header{Name: "./deployment.yaml", Typeflag: tar.TypeReg}, content: "kind: Deployment\n"},
+		tarEntry{header: tar.Header{Name: "config/app..properties", Typeflag: tar.TypeReg}, content: "a=b\n"},
+	)
+	files, err := ExtractTarball(bytes.NewReader(data), TarballLimits{})
+	if err != nil {
+		t.Fatalf("ExtractTarball failed: %v", err)
+	}
+	if len(files) != 2 || string(files["./deployment.yaml"]) != "kind: Deployment\n" {
+		t.Errorf("expected both files, got %v", files)
+	}
+
+	tests := []struct {
+		name    string
+		entry   tarEntry
+		wantErr string
+	}{
+		{name: "parent directory", entry: tarEntry{header: tar.Header{Name: "../other-app/deployment.yaml", Typeflag: tar.TypeReg}}, wantErr: "must not contain '..'"},
+		{name: "nested parent directory", entry: tarEntry{header: tar.Header{Name: "a/../../deployment.yaml", Typeflag: tar.TypeReg}}, wantErr: "must not contain '..'"},
+		{name: "absolute path", entry: tarEntry{header: tar.Header{Name: "/etc/deployment.yaml", Typeflag: tar.TypeReg}}, wantErr: "is an absolute path"},
+		{name: "symlink", entry: tarEntry{header: tar.Header{Name: "deployment.yaml", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}, wantErr: "is not a regular file"},
+		{name: "hard link", entry: tarEntry{header: tar.Header{Name: "deployment.yaml", Typeflag: tar.TypeLink, Linkname: "other.yaml"}}, wantErr: "is not a regular file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExtractTarball(bytes.NewReader(buildTarball(t, tt.entry)), TarballLimits{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExpandManifests_Limits(t *testing.T) {
+	manifests := map[string][]byte{
+		"manifests.tar.gz": buildTarball(t, tarEntry{header: tar.Header{Name: "deployment.yaml", Typeflag: tar.TypeReg}, content: strings.Repeat("#", 1<<10)}),
+	}
+	if _, err := ExpandManifests(manifests, TarballLimits{MaxFileSize: 1 << 9}); err == nil || !strings.Contains(err.Error(), "is larger than 512 bytes") {
+		t.Errorf("expected the file size limit to apply, got %v", err)
+	}
+}
+
+func TestWriteManifests_StaysInAppDir(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "gitops\n"})
+	dir := t.TempDir()
+	key, _ := writeTestKey(t, dir, "key")
+
+	s := NewService(remote, key, filepath.Join(dir, "work"))
+	if err := s.Clone(context.Background()); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	err := s.WriteManifests("my-api", "staging", "v1", map[string][]byte{"../deployment.yaml": []byte("kind: Deployment\n")})
+	if err == nil || !strings.Contains(err.Error(), "would be written outside") {
+		t.Fatalf("expected the manifest to be rejected, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "work", "environments", "staging", "apps", "deployment.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written outside the app directory, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// Deployments counts deployments that finished, by status
+	Deployments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "smithd",
+		Name:      "deployments_total",
+		Help:      "Deployments that finished, by status (success or failed).",
+	}, []string{"status"})
+
+	// Publishes counts published versions
+	Publishes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "smithd",
+		Name:      "publishes_total",
+		Help:      "Versions published.",
+	})
+
+	// AutoDeploys counts deployments triggered by auto-deploy policies
+	AutoDeploys = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "smithd",
+		Name:      "auto_deploys_total",
+		Help:      "Deployments triggered by auto-deploy policies, by target environment.",
+	}, []string{"environment"})
+
+	// GitopsPushDuration observes how long pushes to the gitops repo take
+	GitopsPushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "smithd",
+		Name:      "gitops_push_duration_seconds",
+		Help:      "Time taken to push to the gitops repo.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// StorageDownloadDuration observes how long fetching a version's files takes
+	StorageDownloadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "smithd",
+		Name:      "storage_download_duration_seconds",
+		Help:      "Time taken to download a version's files from storage.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ReloadCredentialsRequest is the optional request to reload the gitops credentials
+type ReloadCredentialsRequest struct {
+	SSHKeyPath string `json:"sshKeyPath,omitempty"`
+}
+
+// ReloadCredentialsResponse is the response for reloading the gitops credentials
+type ReloadCredentialsResponse struct {
+	SSHKeyPath string    `json:"sshKeyPath"`
+	ReloadedAt time.Time `json:"reloadedAt"`
+}
+
+// ReconcileRequest is the optional request to reconcile an environment with
+// the gitops repo
+type ReconcileRequest struct {
+	// Repair redeploys the recorded version if the gitops repo has drifted
+	Repair bool `json:"repair,omitempty"`
+}
+
+// ReconcileResponse compares an environment's directory in the gitops repo
+// with the version last deployed there successfully
+type ReconcileResponse struct {
+	Environment  string `json:"environment"`
+	VersionID    string `json:"versionId"`
+	DeploymentID string `json:"deploymentId"`
+	GitopsPath   string `json:"gitopsPath"`
+	InSync       bool   `json:"inSync"`
+	// ExpectedImages are the images in the deployed version's manifests,
+	// ActualImages those in the gitops repo
+	ExpectedImages []string `json:"expectedImages"`
+	ActualImages   []string `json:"actualImages"`
+	// ExtraFiles are files in the gitops directory that the version doesn't
+	// have, such as ones added by hand. Repairing removes them.
+	ExtraFiles []string `json:"extraFiles,omitempty"`
+	// Diff is what redeploying the version would change in the gitops repo
+	Diff string `json:"diff,omitempty"`
+	// Repair is the deployment started to repair the drift
+	Repair *DeployVersionResponse `json:"repair,omitempty"`
+}
@@ -4,15 +4,45 @@ import "time"
 
 // Application represents a registered application
 type Application struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	StorageBucket        string    `json:"storageBucket,omitempty"`
+	StoragePrefix        string    `json:"storagePrefix,omitempty"`
+	InterpolateManifests bool      `json:"interpolateManifests,omitempty"`
+	CreatedAt            time.Time `json:"createdAt"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+
+	// EnvironmentVariables holds extra placeholder values per environment,
+	// used when InterpolateManifests is set
+	EnvironmentVariables map[string]map[string]string `json:"environmentVariables,omitempty"`
+
+	// ProtectedEnvironments lists the environments whose deployments wait
+	// for approval before they are pushed
+	ProtectedEnvironments []string `json:"protectedEnvironments,omitempty"`
+}
+
+// RequiresApproval reports whether deployments to environment must be approved
+func (a *Application) RequiresApproval(environment string) bool {
+	for _, protected := range a.ProtectedEnvironments {
+		if protected == environment {
+			return true
+		}
+	}
+	return false
 }
 
 // RegisterAppRequest is the request to register a new application
 type RegisterAppRequest struct {
 	Name string `json:"name"`
+
+	// Optional storage overrides. When empty, the global bucket and
+	// the default drafts/ and published/ prefixes are used.
+	StorageBucket string `json:"storageBucket,omitempty"`
+	StoragePrefix string `json:"storagePrefix,omitempty"`
+
+	// InterpolateManifests enables ${GIT_SHA}-style placeholders in
+	// manifests, replaced at deploy time
+	InterpolateManifests bool `json:"interpolateManifests,omitempty"`
 }
 
 // ListAppsResponse is the response for listing applications
@@ -25,8 +55,50 @@ type ListAppsResponse struct {
 
 // GetAppResponse is the response for getting an application
 type GetAppResponse struct {
-	ID             string            `json:"id"`
-	Name           string            `json:"name"`
-	CreatedAt      time.Time         `json:"createdAt"`
-	CurrentVersion map[string]string `json:"currentVersion,omitempty"`
+	ID                   string                       `json:"id"`
+	Name                 string                       `json:"name"`
+	StorageBucket        string                       `json:"storageBucket,omitempty"`
+	StoragePrefix        string                       `json:"storagePrefix,omitempty"`
+	InterpolateManifests bool                         `json:"interpolateManifests,omitempty"`
+	CreatedAt            time.Time                    `json:"createdAt"`
+	CurrentVersions      map[string]CurrentDeployment `json:"currentVersions,omitempty"`
+
+	EnvironmentVariables  map[string]map[string]string `json:"environmentVariables,omitempty"`
+	ProtectedEnvironments []string                     `json:"protectedEnvironments,omitempty"`
+}
+
+// CurrentDeployment is the deployment currently live in an environment
+type CurrentDeployment struct {
+	VersionID    string    `json:"versionId"`
+	DeploymentID string    `json:"deploymentId"`
+	DeployedAt   time.Time `json:"deployedAt"`
+}
+
+// SetVariablesRequest is the request to replace an environment's placeholder values
+type SetVariablesRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// SetVariablesResponse is the response for setting an environment's placeholder values
+type SetVariablesResponse struct {
+	Environment string            `json:"environment"`
+	Variables   map[string]string `json:"variables"`
+}
+
+// SetApprovalRequest is the request to turn the approval gate of an environment on or off
+type SetApprovalRequest struct {
+	RequiresApproval bool `json:"requiresApproval"`
+}
+
+// SetApprovalResponse is the response for setting an environment's approval gate
+type SetApprovalResponse struct {
+	Environment      string `json:"environment"`
+	RequiresApproval bool   `json:"requiresApproval"`
+}
+
+// ListEnvironmentsResponse is the response for listing the environments
+// deploys may target. Restricted is false when any environment is accepted.
+type ListEnvironmentsResponse struct {
+	Environments []string `json:"environments"`
+	Restricted   bool     `json:"restricted"`
 }
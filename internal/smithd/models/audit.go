@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AuditEntry records a mutating API call
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`  // name of the API key used
+	Action    string    `json:"action"` // e.g. version.publish
+	AppID     string    `json:"appId,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListAuditResponse is the response for listing audit log entries
+type ListAuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
@@ -7,20 +7,47 @@ type Deployment struct {
 	ID               string     `json:"id"`
 	AppID            string     `json:"appId"`
 	VersionID        string     `json:"versionId"`
+	Version          string     `json:"version,omitempty"` // user-facing version ID
 	Environment      string     `json:"environment"`
-	Status           string     `json:"status"` // pending, success, failed
+	Status           string     `json:"status"` // pending_approval, pending, success, failed
 	TriggeredBy      string     `json:"triggeredBy,omitempty"`
 	PolicyID         *string    `json:"policyId,omitempty"`
 	GitopsCommitSHA  string     `json:"gitopsCommitSha,omitempty"`
 	ErrorMessage     string     `json:"errorMessage,omitempty"`
 	StartedAt        time.Time  `json:"startedAt"`
 	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+	Plan             *DeploymentPlan `json:"plan,omitempty"`
+	CommitMessage    string     `json:"commitMessage,omitempty"` // recorded for deployments held for approval
+	RolledBackFrom   string     `json:"rolledBackFrom,omitempty"` // version a rollback replaced
+	Reason           string     `json:"reason,omitempty"`         // why a rollback was made
+	Events           []DeploymentEvent `json:"events,omitempty"` // timeline, included by Get Deployment
 }
 
-// DeployVersionRequest is the request to deploy a version
+// DeploymentPlan records exactly what a deployment writes to the gitops repo
+type DeploymentPlan struct {
+	Bundle     string     `json:"bundle"`     // location of the published version files
+	GitopsPath string     `json:"gitopsPath"` // directory written in the gitops repo
+	Files      []PlanFile `json:"files"`
+}
+
+// PlanFile is a single manifest written by a deployment
+type PlanFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// DeployVersionRequest is the request to deploy a version to one environment,
+// or to several with Environments
 type DeployVersionRequest struct {
+	Environment  string   `json:"environment,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	TriggeredBy  string   `json:"triggeredBy,omitempty"`
+}
+
+// RollbackRequest is the request to roll an environment back to its previous version
+type RollbackRequest struct {
 	Environment string `json:"environment"`
-	TriggeredBy string `json:"triggeredBy,omitempty"`
+	Reason      string `json:"reason,omitempty"`
 }
 
 // DeployVersionResponse is the response for deploying a version
@@ -31,6 +58,28 @@ type DeployVersionResponse struct {
 	Status          string    `json:"status"`
 	GitopsCommitSHA string    `json:"gitopsCommitSha,omitempty"`
 	StartedAt       time.Time `json:"startedAt"`
+	// Error is why the deployment failed to start, for a failed environment
+	// of a multi-environment deploy
+	Error string `json:"error,omitempty"`
+}
+
+// DeployVersionsResponse is the response for deploying a version to several
+// environments, with one deployment per environment
+type DeployVersionsResponse struct {
+	Deployments []DeployVersionResponse `json:"deployments"`
+}
+
+// DeployPreviewResponse is the response for a dry-run deploy to one environment
+type DeployPreviewResponse struct {
+	VersionID     string `json:"versionId"`
+	Environment   string `json:"environment"`
+	CommitMessage string `json:"commitMessage"`
+	Diff          string `json:"diff"`
+}
+
+// DeployPreviewsResponse is the response for a dry-run deploy to several environments
+type DeployPreviewsResponse struct {
+	Previews []DeployPreviewResponse `json:"previews"`
 }
 
 // ListDeploymentsResponse is the response for listing deployments
@@ -40,3 +89,17 @@ type ListDeploymentsResponse struct {
 	Limit       int          `json:"limit"`
 	Offset      int          `json:"offset"`
 }
+
+// DeploymentEvent records a stage a deployment went through
+type DeploymentEvent struct {
+	ID           int64     `json:"id"`
+	DeploymentID string    `json:"deploymentId"`
+	Stage        string    `json:"stage"` // e.g. queued, cloning, pushing, failed
+	Message      string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ListDeploymentEventsResponse is the response for listing a deployment's events
+type ListDeploymentEventsResponse struct {
+	Events []DeploymentEvent `json:"events"`
+}
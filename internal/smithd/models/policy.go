@@ -10,6 +10,7 @@ type Policy struct {
 	GitBranchPattern string    `json:"gitBranchPattern"`
 	TargetEnvironment string   `json:"targetEnvironment"`
 	Enabled          bool      `json:"enabled"`
+	Priority         int       `json:"priority"`
 	CreatedAt        time.Time `json:"createdAt"`
 }
 
@@ -19,6 +20,16 @@ type CreatePolicyRequest struct {
 	GitBranchPattern  string `json:"gitBranchPattern"`
 	TargetEnvironment string `json:"targetEnvironment"`
 	Enabled           *bool  `json:"enabled,omitempty"` // Optional, defaults to true
+	Priority          int    `json:"priority,omitempty"` // Higher wins when policies target the same environment
+}
+
+// UpdatePolicyRequest is the request to update a policy; omitted fields are left unchanged
+type UpdatePolicyRequest struct {
+	Name              *string `json:"name,omitempty"`
+	GitBranchPattern  *string `json:"gitBranchPattern,omitempty"`
+	TargetEnvironment *string `json:"targetEnvironment,omitempty"`
+	Enabled           *bool   `json:"enabled,omitempty"`
+	Priority          *int    `json:"priority,omitempty"`
 }
 
 // PolicyResponse is the response for a single policy
@@ -29,6 +40,7 @@ type PolicyResponse struct {
 	GitBranchPattern  string    `json:"gitBranchPattern"`
 	TargetEnvironment string    `json:"targetEnvironment"`
 	Enabled           bool      `json:"enabled"`
+	Priority          int       `json:"priority"`
 	CreatedAt         time.Time `json:"createdAt"`
 }
 
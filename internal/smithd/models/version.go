@@ -15,6 +15,13 @@ type Version struct {
 	MetadataTimestamp time.Time `json:"metadataTimestamp,omitempty"`
 	CreatedAt         time.Time `json:"createdAt"`
 	PublishedAt       *time.Time `json:"publishedAt,omitempty"`
+
+	// Checksums maps each published file to its SHA-256 hash, recorded at publish
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// Publishing is set while a published version's files are still moving
+	// out of drafts
+	Publishing bool `json:"publishing,omitempty"`
 }
 
 // VersionMetadata represents the metadata in version.yml
@@ -40,12 +47,38 @@ type DraftVersionResponse struct {
 	Status        string    `json:"status"`
 }
 
+// PublishVersionRequest is the optional request body for publishing a version
+type PublishVersionRequest struct {
+	NoValidate bool `json:"noValidate,omitempty"`
+}
+
 // PublishVersionResponse is the response for publishing a version
 type PublishVersionResponse struct {
 	VersionID     string    `json:"versionId"`
 	Status        string    `json:"status"`
 	PublishedAt   time.Time `json:"publishedAt"`
 	ManifestFiles []string  `json:"manifestFiles"`
+	// AssetFiles are non-YAML files written alongside the manifests
+	AssetFiles []string `json:"assetFiles,omitempty"`
+	// AutoDeployments are the deployments started by auto-deploy policies
+	AutoDeployments []DeployVersionResponse `json:"autoDeployments,omitempty"`
+}
+
+// ValidationIssue is a problem found while validating a draft version
+type ValidationIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidateVersionResponse is the response for a dry-run publish
+type ValidateVersionResponse struct {
+	VersionID     string            `json:"versionId"`
+	Valid         bool              `json:"valid"`
+	ManifestFiles []string          `json:"manifestFiles"`
+	AssetFiles    []string          `json:"assetFiles,omitempty"`
+	Errors        []ValidationIssue `json:"errors"`
+	Warnings      []ValidationIssue `json:"warnings"`
 }
 
 // ListVersionsResponse is the response for listing versions
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Event is the outcome of a deployment
+type Event struct {
+	DeploymentID string
+	App          string
+	Version      string
+	Environment  string
+	Status       string
+	CommitSHA    string
+	Error        string
+	TriggeredBy  string
+}
+
+// Notifier tells people that a deployment finished
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// Nop is the notifier used when none is configured
+type Nop struct{}
+
+// Notify does nothing
+func (Nop) Notify(Event) error {
+	return nil
+}
+
+// Slack posts events to a Slack incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack creates a notifier for a Slack incoming webhook URL
+func NewSlack(url string) *Slack {
+	return &Slack{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts a one-line summary of the event
+func (s *Slack) Notify(event Event) error {
+	body, err := json.Marshal(map[string]string{"text": slackText(event)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Slack returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// slackText formats an event as a Slack message
+func slackText(event Event) string {
+	target := fmt.Sprintf("*%s* %s to *%s*", event.App, event.Version, event.Environment)
+	if event.TriggeredBy != "" {
+		target += fmt.Sprintf(" (%s)", event.TriggeredBy)
+	}
+
+	if event.Status == "success" {
+		return fmt.Sprintf(":white_check_mark: Deployed %s, commit `%s`", target, shortSHA(event.CommitSHA))
+	}
+
+	text := fmt.Sprintf(":x: Failed to deploy %s: %s", target, event.Error)
+	if event.CommitSHA != "" {
+		text += fmt.Sprintf(" (commit `%s`)", shortSHA(event.CommitSHA))
+	}
+	return text
+}
+
+// shortSHA abbreviates a commit SHA
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlack_Notify(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	err := NewSlack(server.URL).Notify(Event{
+		App:         "my-api",
+		Version:     "v1.2.3",
+		Environment: "production",
+		Status:      "success",
+		CommitSHA:   "abc1234def5678",
+		TriggeredBy: "auto-deploy",
+	})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	want := ":white_check_mark: Deployed *my-api* v1.2.3 to *production* (auto-deploy), commit `abc1234`"
+	if got["text"] != want {
+		t.Errorf("text = %q, want %q", got["text"], want)
+	}
+}
+
+func TestSlack_NotifyFailure(t *testing.T) {
+	event := Event{App: "my-api", Version: "v1.2.3", Environment: "staging", Status: "failed", Error: "Failed to push: timeout"}
+	want := ":x: Failed to deploy *my-api* v1.2.3 to *staging*: Failed to push: timeout"
+	if got := slackText(event); got != want {
+		t.Errorf("slackText = %q, want %q", got, want)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if err := NewSlack(server.URL).Notify(event); err == nil {
+		t.Error("expected error when Slack rejects the message")
+	}
+}
@@ -0,0 +1,87 @@
+package opa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// Client asks an Open Policy Agent decision endpoint whether a deploy may proceed
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// Input is the deploy context sent to OPA as the policy input
+type Input struct {
+	App         string                 `json:"app"`
+	Environment string                 `json:"environment"`
+	Version     string                 `json:"version"`
+	Metadata    models.VersionMetadata `json:"metadata"`
+	TriggeredBy string                 `json:"triggeredBy"`
+	Manifests   map[string]string      `json:"manifests"`
+}
+
+// Decision is the outcome of a policy evaluation
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewClient creates a client for an OPA data API URL, such as
+// http://opa:8181/v1/data/deploysmith/deploy
+func NewClient(url string) *Client {
+	return &Client{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Evaluate sends input to OPA and returns its decision. The policy may
+// return either a boolean or an object with "allow" and "reason".
+// An undefined result is treated as a denial.
+func (c *Client) Evaluate(input Input) (*Decision, error) {
+	body, err := json.Marshal(map[string]Input{"input": input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query OPA: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OPA returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode OPA response: %w", err)
+	}
+
+	if len(result.Result) == 0 {
+		return &Decision{Allow: false, Reason: "deploy policy is undefined"}, nil
+	}
+
+	var allow bool
+	if err := json.Unmarshal(result.Result, &allow); err == nil {
+		return &Decision{Allow: allow}, nil
+	}
+
+	var decision Decision
+	if err := json.Unmarshal(result.Result, &decision); err != nil {
+		return nil, fmt.Errorf("failed to decode OPA decision: %w", err)
+	}
+
+	return &decision, nil
+}
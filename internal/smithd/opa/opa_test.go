@@ -0,0 +1,98 @@
+package opa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newMockOPA starts a server that records the input and replies with result
+func newMockOPA(t *testing.T, result string, got *Input) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input Input `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode input: %v", err)
+		}
+		if got != nil {
+			*got = body.Input
+		}
+		w.Write([]byte(result))
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(server.URL)
+}
+
+func TestEvaluate_Allow(t *testing.T) {
+	var got Input
+	c := newMockOPA(t, `{"result": {"allow": true}}`, &got)
+
+	decision, err := c.Evaluate(Input{
+		App:         "my-api",
+		Environment: "production",
+		Version:     "v1.0.0",
+		TriggeredBy: "alice",
+		Manifests:   map[string]string{"deployment.yaml": "kind: Deployment\n"},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !decision.Allow {
+		t.Errorf("expected allow, got %+v", decision)
+	}
+	if got.App != "my-api" || got.Environment != "production" || got.TriggeredBy != "alice" || got.Manifests["deployment.yaml"] == "" {
+		t.Errorf("unexpected input sent to OPA: %+v", got)
+	}
+}
+
+func TestEvaluate_DenyWithReason(t *testing.T) {
+	c := newMockOPA(t, `{"result": {"allow": false, "reason": "production deploys are frozen"}}`, nil)
+
+	decision, err := c.Evaluate(Input{App: "my-api", Environment: "production"})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if decision.Allow || decision.Reason != "production deploys are frozen" {
+		t.Errorf("expected denial with reason, got %+v", decision)
+	}
+}
+
+func TestEvaluate_BooleanResult(t *testing.T) {
+	c := newMockOPA(t, `{"result": true}`, nil)
+
+	decision, err := c.Evaluate(Input{App: "my-api"})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !decision.Allow {
+		t.Errorf("expected allow, got %+v", decision)
+	}
+}
+
+func TestEvaluate_UndefinedDenies(t *testing.T) {
+	c := newMockOPA(t, `{}`, nil)
+
+	decision, err := c.Evaluate(Input{App: "my-api"})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if decision.Allow {
+		t.Errorf("expected undefined result to deny, got %+v", decision)
+	}
+}
+
+func TestEvaluate_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(server.URL).Evaluate(Input{App: "my-api"}); err == nil {
+		t.Error("expected error when OPA fails")
+	}
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+func TestS3StorageConformance(t *testing.T) {
+	testStorageConformance(t, func(t *testing.T) Storage {
+		return newFakeS3Storage(t, "versions")
+	})
+}
+
+func TestOCIStorageConformance(t *testing.T) {
+	testStorageConformance(t, func(t *testing.T) Storage {
+		o, err := NewOCIStorage(newFakeS3Storage(t, "versions"), "registry.example.com", "deploysmith", "", "", false)
+		if err != nil {
+			t.Fatalf("failed to create OCI storage: %v", err)
+		}
+
+		// Use an OCI image layout per app instead of a registry
+		root := t.TempDir()
+		o.target = func(app string) (oras.Target, error) {
+			return oci.New(filepath.Join(root, app))
+		}
+
+		return o
+	})
+}
+
+func TestValidOCITag(t *testing.T) {
+	for _, versionID := range []string{"v1.0.0", "42540c4-123", "_build.7", strings.Repeat("a", 128)} {
+		if !ValidOCITag(versionID) {
+			t.Errorf("expected %q to be a valid tag", versionID)
+		}
+	}
+	for _, versionID := range []string{"", "v1.0.0+build.1", ".hidden", "-rc1", "feature:x", strings.Repeat("a", 129)} {
+		if ValidOCITag(versionID) {
+			t.Errorf("expected %q to be rejected", versionID)
+		}
+	}
+}
+
+// testStorageConformance checks the behaviour every Storage backend must provide
+func testStorageConformance(t *testing.T, newStorage func(t *testing.T) Storage) {
+	ctx := context.Background()
+
+	files := map[string][]byte{
+		"manifests.tar.gz": []byte("tarball"),
+		"version.yml":      []byte("version: v1.0.0\n"),
+	}
+
+	locations := map[string]Location{
+		"default location":  {App: "my-api"},
+		"per-app overrides": {App: "my-api", Bucket: "team-a-versions", Prefix: "team-a"},
+	}
+
+	for name, loc := range locations {
+		t.Run(name+"/publish round trip", func(t *testing.T) {
+			s := newStorage(t)
+			uploadDraft(t, s, loc, "v1.0.0", files)
+
+			drafts, err := s.ListFiles(ctx, loc, "v1.0.0", false)
+			if err != nil {
+				t.Fatalf("ListFiles(draft) failed: %v", err)
+			}
+			assertFiles(t, drafts, files)
+
+			if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+				t.Fatalf("MoveVersion failed: %v", err)
+			}
+
+			published, err := s.ListFiles(ctx, loc, "v1.0.0", true)
+			if err != nil {
+				t.Fatalf("ListFiles(published) failed: %v", err)
+			}
+			assertFiles(t, published, files)
+
+			drafts, err = s.ListFiles(ctx, loc, "v1.0.0", false)
+			if err != nil {
+				t.Fatalf("ListFiles(draft) failed: %v", err)
+			}
+			if len(drafts) != 0 {
+				t.Errorf("expected draft to be removed after publish, got %v", drafts)
+			}
+
+			all, err := s.GetAllFiles(ctx, loc, "v1.0.0", true)
+			if err != nil {
+				t.Fatalf("GetAllFiles failed: %v", err)
+			}
+			if !reflect.DeepEqual(all, files) {
+				t.Errorf("GetAllFiles returned %v, want %v", all, files)
+			}
+
+			reader, err := s.GetFile(ctx, loc, "v1.0.0", "version.yml", true)
+			if err != nil {
+				t.Fatalf("GetFile failed: %v", err)
+			}
+			defer reader.Close()
+			data, _ := io.ReadAll(reader)
+			if !bytes.Equal(data, files["version.yml"]) {
+				t.Errorf("GetFile returned %q, want %q", data, files["version.yml"])
+			}
+		})
+	}
+
+	loc := Location{App: "my-api"}
+
+	t.Run("missing file", func(t *testing.T) {
+		s := newStorage(t)
+		uploadDraft(t, s, loc, "v1.0.0", files)
+		if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+			t.Fatalf("MoveVersion failed: %v", err)
+		}
+
+		if _, err := s.GetFile(ctx, loc, "v1.0.0", "missing.yaml", true); err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+
+	t.Run("empty draft", func(t *testing.T) {
+		s := newStorage(t)
+
+		if err := s.MoveVersion(ctx, loc, "v1.0.0"); err == nil {
+			t.Error("expected error publishing an empty draft")
+		}
+	})
+
+	t.Run("apps are isolated", func(t *testing.T) {
+		s := newStorage(t)
+		uploadDraft(t, s, loc, "v1.0.0", files)
+		if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+			t.Fatalf("MoveVersion failed: %v", err)
+		}
+
+		other, err := s.GetAllFiles(ctx, Location{App: "other-app"}, "v1.0.0", true)
+		if err == nil && len(other) != 0 {
+			t.Errorf("expected no files for another app, got %v", other)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		s := newStorage(t)
+		uploadDraft(t, s, loc, "v1.0.0", files)
+		if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+			t.Fatalf("MoveVersion failed: %v", err)
+		}
+		uploadDraft(t, s, loc, "v2.0.0", files)
+
+		if err := s.PurgeApp(ctx, loc); err != nil {
+			t.Fatalf("PurgeApp failed: %v", err)
+		}
+
+		drafts, err := s.ListFiles(ctx, loc, "v2.0.0", false)
+		if err != nil {
+			t.Fatalf("ListFiles failed: %v", err)
+		}
+		if len(drafts) != 0 {
+			t.Errorf("expected drafts to be purged, got %v", drafts)
+		}
+		if published, err := s.ListFiles(ctx, loc, "v1.0.0", true); err == nil && len(published) != 0 {
+			t.Errorf("expected published files to be purged, got %v", published)
+		}
+	})
+
+	t.Run("delete version", func(t *testing.T) {
+		s := newStorage(t)
+		uploadDraft(t, s, loc, "v1.0.0", files)
+		if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+			t.Fatalf("MoveVersion failed: %v", err)
+		}
+		uploadDraft(t, s, loc, "v2.0.0", files)
+
+		if err := s.DeleteVersion(ctx, loc, "v1.0.0", true); err != nil {
+			t.Fatalf("DeleteVersion(published) failed: %v", err)
+		}
+		if err := s.DeleteVersion(ctx, loc, "v2.0.0", false); err != nil {
+			t.Fatalf("DeleteVersion(draft) failed: %v", err)
+		}
+
+		if published, err := s.ListFiles(ctx, loc, "v1.0.0", true); err == nil && len(published) != 0 {
+			t.Errorf("expected published version to be deleted, got %v", published)
+		}
+		drafts, err := s.ListFiles(ctx, loc, "v2.0.0", false)
+		if err != nil {
+			t.Fatalf("ListFiles failed: %v", err)
+		}
+		if len(drafts) != 0 {
+			t.Errorf("expected draft to be deleted, got %v", drafts)
+		}
+
+		// Deleting again is not an error
+		if err := s.DeleteVersion(ctx, loc, "v1.0.0", true); err != nil {
+			t.Errorf("second DeleteVersion failed: %v", err)
+		}
+	})
+
+	t.Run("version URI", func(t *testing.T) {
+		s := newStorage(t)
+
+		uri := s.VersionURI(loc, "v1.0.0", true)
+		if !strings.Contains(uri, "my-api") || !strings.Contains(uri, "v1.0.0") {
+			t.Errorf("expected URI to reference app and version, got %s", uri)
+		}
+	})
+}
+
+// uploadDraft uploads files through presigned URLs, as forge does
+func uploadDraft(t *testing.T, s Storage, loc Location, versionID string, files map[string][]byte) {
+	t.Helper()
+
+	for filename, data := range files {
+		uploadURL, err := s.GeneratePresignedURL(loc, versionID, filename)
+		if err != nil {
+			t.Fatalf("GeneratePresignedURL failed: %v", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to create upload request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("upload returned status %d", resp.StatusCode)
+		}
+	}
+}
+
+func assertFiles(t *testing.T, got []string, want map[string][]byte) {
+	t.Helper()
+
+	wantNames := make([]string, 0, len(want))
+	for name := range want {
+		wantNames = append(wantNames, name)
+	}
+	sort.Strings(wantNames)
+	sort.Strings(got)
+
+	if !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("got files %v, want %v", got, wantNames)
+	}
+}
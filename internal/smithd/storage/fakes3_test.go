@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory, path-style S3 server implementing the calls
+// S3Storage makes: put (including presigned), copy, list, get and delete
+type fakeS3 struct {
+	mu             sync.Mutex
+	objects        map[string][]byte // "bucket/key" -> content
+	storageClasses map[string]string // "bucket/key" -> storage class, if set
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string   `xml:"Name"`
+	Prefix      string   `xml:"Prefix"`
+	KeyCount    int      `xml:"KeyCount"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Contents    []struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// newFakeS3Storage starts a fake S3 server and returns an S3Storage using it
+func newFakeS3Storage(t *testing.T, bucket string) *S3Storage {
+	t.Helper()
+
+	s, _ := newFakeS3(t, bucket)
+	return s
+}
+
+// newFakeS3 is newFakeS3Storage that also returns the fake server
+func newFakeS3(t *testing.T, bucket string) (*S3Storage, *fakeS3) {
+	t.Helper()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	fake := &fakeS3{objects: make(map[string][]byte), storageClasses: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := NewS3Storage(bucket, S3Options{Region: "us-east-1", Endpoint: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create S3 storage: %v", err)
+	}
+
+	return s, fake
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, bucket, r.URL.Query().Get("prefix"))
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+		data, ok := f.objects[source]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[bucket+"/"+key] = data
+		f.storageClasses[bucket+"/"+key] = r.Header.Get("X-Amz-Storage-Class")
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[bucket+"/"+key] = data
+
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	result := listBucketResult{Name: bucket, Prefix: prefix}
+
+	keys := []string{}
+	for k := range f.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result.Contents = append(result.Contents, struct {
+			Key  string `xml:"Key"`
+			Size int    `xml:"Size"`
+		}{Key: key, Size: len(f.objects[bucket+"/"+key])})
+	}
+	result.KeyCount = len(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte("<Error><Code>" + code + "</Code><Message>" + code + "</Message></Error>"))
+}
@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+const (
+	// ociArtifactType identifies a published DeploySmith version
+	ociArtifactType = "application/vnd.deploysmith.version.v1"
+
+	// ociFileMediaType is the media type of each file in a version
+	ociFileMediaType = "application/vnd.deploysmith.file.v1"
+)
+
+// ociTag is the grammar of an OCI tag, which published versions are tagged with
+var ociTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+
+// ValidOCITag reports whether versionID can be used as the tag of a version
+// published by OCIStorage
+func ValidOCITag(versionID string) bool {
+	return ociTag.MatchString(versionID)
+}
+
+// OCIStorage publishes versions as OCI artifacts in a registry.
+// Drafts are still uploaded to S3 through presigned URLs; publishing
+// pushes the draft files to {registry}/{repository}/{app}:{version}.
+type OCIStorage struct {
+	drafts     *S3Storage
+	registry   string
+	repository string
+
+	// target returns the OCI repository for an application
+	target func(app string) (oras.Target, error)
+}
+
+// NewOCIStorage creates a new OCI registry storage backend
+func NewOCIStorage(drafts *S3Storage, registryHost, repository, username, password string, plainHTTP bool) (*OCIStorage, error) {
+	if registryHost == "" {
+		return nil, fmt.Errorf("registry is required")
+	}
+
+	client := &auth.Client{
+		Client: retry.DefaultClient,
+		Cache:  auth.NewCache(),
+	}
+	if username != "" || password != "" {
+		client.Credential = auth.StaticCredential(registryHost, auth.Credential{
+			Username: username,
+			Password: password,
+		})
+	}
+
+	o := &OCIStorage{
+		drafts:     drafts,
+		registry:   registryHost,
+		repository: strings.Trim(repository, "/"),
+	}
+	o.target = func(app string) (oras.Target, error) {
+		repo, err := remote.NewRepository(o.reference(app))
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository for %s: %w", app, err)
+		}
+		repo.Client = client
+		repo.PlainHTTP = plainHTTP
+		return repo, nil
+	}
+
+	return o, nil
+}
+
+// reference returns the repository reference for an application, without tag
+func (o *OCIStorage) reference(app string) string {
+	return path.Join(o.registry, o.repository, app)
+}
+
+// GeneratePresignedURL generates a presigned URL for uploading a draft file
+func (o *OCIStorage) GeneratePresignedURL(loc Location, versionID, filename string) (string, error) {
+	return o.drafts.GeneratePresignedURL(loc, versionID, filename)
+}
+
+// ListFiles lists all files for a version
+func (o *OCIStorage) ListFiles(ctx context.Context, loc Location, versionID string, published bool) ([]string, error) {
+	if !published {
+		return o.drafts.ListFiles(ctx, loc, versionID, false)
+	}
+
+	_, manifest, err := o.fetchManifest(ctx, loc, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, layer := range manifest.Layers {
+		if name := layer.Annotations[ocispec.AnnotationTitle]; name != "" {
+			files = append(files, name)
+		}
+	}
+
+	return files, nil
+}
+
+// MoveVersion pushes a draft version to the registry and removes the draft
+func (o *OCIStorage) MoveVersion(ctx context.Context, loc Location, versionID string) error {
+	if !ValidOCITag(versionID) {
+		return fmt.Errorf("version %s is not a valid OCI tag", versionID)
+	}
+
+	files, err := o.drafts.GetAllFiles(ctx, loc, versionID, false)
+	if err != nil {
+		return fmt.Errorf("failed to read draft files: %w", err)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no files found in draft")
+	}
+
+	target, err := o.target(loc.App)
+	if err != nil {
+		return err
+	}
+
+	// Push each file as a layer, in a stable order
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	layers := make([]ocispec.Descriptor, 0, len(filenames))
+	for _, filename := range filenames {
+		desc, err := oras.PushBytes(ctx, target, ociFileMediaType, files[filename])
+		if err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+			return backendError("failed to push %s: %w", filename, err)
+		}
+		if err != nil {
+			desc = content.NewDescriptorFromBytes(ociFileMediaType, files[filename])
+		}
+		desc.Annotations = map[string]string{ocispec.AnnotationTitle: filename}
+		layers = append(layers, desc)
+	}
+
+	manifestDesc, err := oras.PackManifest(ctx, target, oras.PackManifestVersion1_1, ociArtifactType, oras.PackManifestOptions{
+		Layers: layers,
+	})
+	if err != nil {
+		return backendError("failed to push manifest: %w", err)
+	}
+
+	if err := target.Tag(ctx, manifestDesc, versionID); err != nil {
+		return backendError("failed to tag %s: %w", versionID, err)
+	}
+
+	// Remove the draft now that it is published
+	if err := o.drafts.DeleteVersion(ctx, loc, versionID, false); err != nil {
+		return backendError("failed to delete draft: %w", err)
+	}
+
+	return nil
+}
+
+// GetFile retrieves a file for a version
+func (o *OCIStorage) GetFile(ctx context.Context, loc Location, versionID, filename string, published bool) (io.ReadCloser, error) {
+	if !published {
+		return o.drafts.GetFile(ctx, loc, versionID, filename, false)
+	}
+
+	target, manifest, err := o.fetchManifest(ctx, loc, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.Annotations[ocispec.AnnotationTitle] != filename {
+			continue
+		}
+		data, err := content.FetchAll(ctx, target, layer)
+		if err != nil {
+			return nil, backendError("failed to get file: %w", err)
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return nil, fmt.Errorf("failed to get file: %s not found in %s:%s", filename, o.reference(loc.App), versionID)
+}
+
+// GetAllFiles retrieves all files for a version
+func (o *OCIStorage) GetAllFiles(ctx context.Context, loc Location, versionID string, published bool) (map[string][]byte, error) {
+	if !published {
+		return o.drafts.GetAllFiles(ctx, loc, versionID, false)
+	}
+
+	target, manifest, err := o.fetchManifest(ctx, loc, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, layer := range manifest.Layers {
+		filename := layer.Annotations[ocispec.AnnotationTitle]
+		if filename == "" {
+			continue
+		}
+		data, err := content.FetchAll(ctx, target, layer)
+		if err != nil {
+			return nil, backendError("failed to read %s: %w", filename, err)
+		}
+		files[filename] = data
+	}
+
+	return files, nil
+}
+
+// DeleteVersion deletes a draft from S3 or a published artifact from the registry
+func (o *OCIStorage) DeleteVersion(ctx context.Context, loc Location, versionID string, published bool) error {
+	if !published {
+		return o.drafts.DeleteVersion(ctx, loc, versionID, false)
+	}
+
+	target, err := o.target(loc.App)
+	if err != nil {
+		return err
+	}
+
+	deleter, ok := target.(content.Deleter)
+	if !ok {
+		return fmt.Errorf("registry does not support deleting %s:%s", o.reference(loc.App), versionID)
+	}
+
+	desc, err := target.Resolve(ctx, versionID)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return nil
+		}
+		return backendError("failed to resolve %s: %w", versionID, err)
+	}
+
+	if err := deleter.Delete(ctx, desc); err != nil && !errors.Is(err, errdef.ErrNotFound) {
+		return backendError("failed to delete %s: %w", versionID, err)
+	}
+
+	return nil
+}
+
+// VersionURI returns an oci:// URI for published versions and an
+// s3:// URI for drafts
+func (o *OCIStorage) VersionURI(loc Location, versionID string, published bool) string {
+	if !published {
+		return o.drafts.VersionURI(loc, versionID, false)
+	}
+	return fmt.Sprintf("oci://%s:%s", o.reference(loc.App), versionID)
+}
+
+// PurgeApp deletes an application's drafts and, where the registry
+// supports it, its published artifacts
+func (o *OCIStorage) PurgeApp(ctx context.Context, loc Location) error {
+	if err := o.drafts.PurgeApp(ctx, loc); err != nil {
+		return err
+	}
+
+	target, err := o.target(loc.App)
+	if err != nil {
+		return err
+	}
+
+	lister, canList := target.(registry.TagLister)
+	deleter, canDelete := target.(content.Deleter)
+	if !canList || !canDelete {
+		return nil
+	}
+
+	tags, err := registry.Tags(ctx, lister)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return nil
+		}
+		return backendError("failed to list tags: %w", err)
+	}
+
+	for _, tag := range tags {
+		desc, err := target.Resolve(ctx, tag)
+		if err != nil {
+			return backendError("failed to resolve %s: %w", tag, err)
+		}
+		if err := deleter.Delete(ctx, desc); err != nil && !errors.Is(err, errdef.ErrNotFound) {
+			return backendError("failed to delete %s: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// fetchManifest fetches the manifest of a published version
+func (o *OCIStorage) fetchManifest(ctx context.Context, loc Location, versionID string) (oras.Target, *ocispec.Manifest, error) {
+	target, err := o.target(loc.App)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, data, err := oras.FetchBytes(ctx, target, versionID, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return nil, nil, backendError("failed to fetch %s:%s: %w", o.reference(loc.App), versionID, err)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	return target, &manifest, nil
+}
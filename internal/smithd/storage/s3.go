@@ -1,12 +1,15 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -16,19 +19,59 @@ type S3Storage struct {
 	bucket string
 	region string
 	client *s3.S3
+
+	// publishedStorageClass is set on objects copied to published/;
+	// empty keeps the bucket default
+	publishedStorageClass string
+}
+
+// Location identifies where an application's versions are stored.
+// Bucket and Prefix are optional per-app overrides; when empty the
+// global bucket and the top-level drafts/ and published/ prefixes are used.
+type Location struct {
+	App    string
+	Bucket string
+	Prefix string
+}
+
+// S3Options configures how S3Storage reaches S3 or an S3-compatible service
+// such as MinIO
+type S3Options struct {
+	Region   string
+	Endpoint string
+
+	// ForcePathStyle addresses buckets in the URL path rather than the host
+	// name. When nil, path style is used only with a custom Endpoint.
+	ForcePathStyle *bool
+
+	// Static credentials, used when AccessKeyID is set. Otherwise the
+	// default AWS credential chain finds them.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
 }
 
 // NewS3Storage creates a new S3 storage client
-func NewS3Storage(bucket, region, endpoint string) (*S3Storage, error) {
+func NewS3Storage(bucket string, opts S3Options) (*S3Storage, error) {
 	config := &aws.Config{
-		Region: aws.String(region),
+		Region: aws.String(opts.Region),
 	}
 
 	// If custom endpoint is provided (for MinIO, etc.), configure it
-	if endpoint != "" {
-		config.Endpoint = aws.String(endpoint)
+	if opts.Endpoint != "" {
+		config.Endpoint = aws.String(opts.Endpoint)
 		config.S3ForcePathStyle = aws.Bool(true) // Required for MinIO
 	}
+	if opts.ForcePathStyle != nil {
+		config.S3ForcePathStyle = aws.Bool(*opts.ForcePathStyle)
+	}
+
+	if opts.AccessKeyID != "" {
+		if opts.SecretAccessKey == "" {
+			return nil, fmt.Errorf("S3 secret access key is required with an access key ID")
+		}
+		config.Credentials = credentials.NewStaticCredentials(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken)
+	}
 
 	sess, err := session.NewSession(config)
 	if err != nil {
@@ -37,42 +80,88 @@ func NewS3Storage(bucket, region, endpoint string) (*S3Storage, error) {
 
 	return &S3Storage{
 		bucket: bucket,
-		region: region,
+		region: opts.Region,
 		client: s3.New(sess),
 	}, nil
 }
 
+// SetPublishedStorageClass sets the S3 storage class of published objects.
+// Drafts keep the bucket default. An empty class restores the default.
+func (s *S3Storage) SetPublishedStorageClass(class string) error {
+	if class != "" && !slices.Contains(s3.StorageClass_Values(), class) {
+		return fmt.Errorf("unknown S3 storage class: %s (must be one of %s)", class, strings.Join(s3.StorageClass_Values(), ", "))
+	}
+
+	// Deploys read published objects directly, so they can't be archived
+	if class == s3.StorageClassGlacier || class == s3.StorageClassDeepArchive {
+		return fmt.Errorf("S3 storage class %s needs a restore before objects can be read", class)
+	}
+
+	s.publishedStorageClass = class
+	return nil
+}
+
+// bucketFor returns the bucket for a location, falling back to the global bucket
+func (s *S3Storage) bucketFor(loc Location) string {
+	if loc.Bucket != "" {
+		return loc.Bucket
+	}
+	return s.bucket
+}
+
+// versionPrefix returns the key prefix for a version, e.g. "team-a/drafts/my-app/v1/"
+func versionPrefix(loc Location, versionID string, published bool) string {
+	stage := "drafts"
+	if published {
+		stage = "published"
+	}
+	return appPrefix(loc, stage) + versionID + "/"
+}
+
+// appPrefix returns the key prefix for an app's files in a stage, e.g.
+// "team-a/drafts/my-app/". The parts are joined without cleaning the path,
+// so a ".." in them can't move the key under another prefix.
+func appPrefix(loc Location, stage string) string {
+	prefix := strings.Trim(loc.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix + stage + "/" + loc.App + "/"
+}
+
+// VersionURI returns an s3:// URI pointing at a version's files
+func (s *S3Storage) VersionURI(loc Location, versionID string, published bool) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucketFor(loc), versionPrefix(loc, versionID, published))
+}
+
 // GeneratePresignedURL generates a pre-signed URL for uploading files
-func (s *S3Storage) GeneratePresignedURL(appName, versionID, filename string) (string, error) {
-	key := fmt.Sprintf("drafts/%s/%s/%s", appName, versionID, filename)
+func (s *S3Storage) GeneratePresignedURL(loc Location, versionID, filename string) (string, error) {
+	key := versionPrefix(loc, versionID, false) + filename
 
 	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
+		Bucket: aws.String(s.bucketFor(loc)),
 		Key:    aws.String(key),
 	})
 
 	// URL expires in 5 minutes
 	url, err := req.Presign(5 * time.Minute)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+		return "", backendError("failed to generate presigned URL: %w", err)
 	}
 
 	return url, nil
 }
 
 // ListFiles lists all files for a version
-func (s *S3Storage) ListFiles(appName, versionID string, published bool) ([]string, error) {
-	prefix := fmt.Sprintf("drafts/%s/%s/", appName, versionID)
-	if published {
-		prefix = fmt.Sprintf("published/%s/%s/", appName, versionID)
-	}
+func (s *S3Storage) ListFiles(ctx context.Context, loc Location, versionID string, published bool) ([]string, error) {
+	prefix := versionPrefix(loc, versionID, published)
 
-	result, err := s.client.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
+	result, err := s.client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketFor(loc)),
 		Prefix: aws.String(prefix),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+		return nil, backendError("failed to list files: %w", err)
 	}
 
 	files := []string{}
@@ -91,9 +180,9 @@ func (s *S3Storage) ListFiles(appName, versionID string, published bool) ([]stri
 }
 
 // MoveVersion moves a version from drafts to published
-func (s *S3Storage) MoveVersion(appName, versionID string) error {
+func (s *S3Storage) MoveVersion(ctx context.Context, loc Location, versionID string) error {
 	// List all files in the draft
-	files, err := s.ListFiles(appName, versionID, false)
+	files, err := s.ListFiles(ctx, loc, versionID, false)
 	if err != nil {
 		return fmt.Errorf("failed to list draft files: %w", err)
 	}
@@ -102,28 +191,34 @@ func (s *S3Storage) MoveVersion(appName, versionID string) error {
 		return fmt.Errorf("no files found in draft")
 	}
 
+	bucket := s.bucketFor(loc)
+
 	// Copy each file to published location
 	for _, file := range files {
-		srcKey := fmt.Sprintf("drafts/%s/%s/%s", appName, versionID, file)
-		dstKey := fmt.Sprintf("published/%s/%s/%s", appName, versionID, file)
+		srcKey := versionPrefix(loc, versionID, false) + file
+		dstKey := versionPrefix(loc, versionID, true) + file
 
 		// Copy file
-		_, err := s.client.CopyObject(&s3.CopyObjectInput{
-			Bucket:     aws.String(s.bucket),
-			CopySource: aws.String(fmt.Sprintf("%s/%s", s.bucket, srcKey)),
+		input := &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			CopySource: aws.String(fmt.Sprintf("%s/%s", bucket, srcKey)),
 			Key:        aws.String(dstKey),
-		})
+		}
+		if s.publishedStorageClass != "" {
+			input.StorageClass = aws.String(s.publishedStorageClass)
+		}
+		_, err := s.client.CopyObjectWithContext(ctx, input)
 		if err != nil {
-			return fmt.Errorf("failed to copy %s: %w", file, err)
+			return backendError("failed to copy %s: %w", file, err)
 		}
 
 		// Delete original
-		_, err = s.client.DeleteObject(&s3.DeleteObjectInput{
-			Bucket: aws.String(s.bucket),
+		_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
 			Key:    aws.String(srcKey),
 		})
 		if err != nil {
-			return fmt.Errorf("failed to delete draft %s: %w", file, err)
+			return backendError("failed to delete draft %s: %w", file, err)
 		}
 	}
 
@@ -131,33 +226,30 @@ func (s *S3Storage) MoveVersion(appName, versionID string) error {
 }
 
 // GetFile retrieves a file from S3
-func (s *S3Storage) GetFile(appName, versionID, filename string, published bool) (io.ReadCloser, error) {
-	key := fmt.Sprintf("drafts/%s/%s/%s", appName, versionID, filename)
-	if published {
-		key = fmt.Sprintf("published/%s/%s/%s", appName, versionID, filename)
-	}
+func (s *S3Storage) GetFile(ctx context.Context, loc Location, versionID, filename string, published bool) (io.ReadCloser, error) {
+	key := versionPrefix(loc, versionID, published) + filename
 
-	result, err := s.client.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
+	result, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketFor(loc)),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file: %w", err)
+		return nil, backendError("failed to get file: %w", err)
 	}
 
 	return result.Body, nil
 }
 
 // GetAllFiles retrieves all files for a version
-func (s *S3Storage) GetAllFiles(appName, versionID string, published bool) (map[string][]byte, error) {
-	files, err := s.ListFiles(appName, versionID, published)
+func (s *S3Storage) GetAllFiles(ctx context.Context, loc Location, versionID string, published bool) (map[string][]byte, error) {
+	files, err := s.ListFiles(ctx, loc, versionID, published)
 	if err != nil {
 		return nil, err
 	}
 
 	result := make(map[string][]byte)
 	for _, file := range files {
-		reader, err := s.GetFile(appName, versionID, file, published)
+		reader, err := s.GetFile(ctx, loc, versionID, file, published)
 		if err != nil {
 			return nil, err
 		}
@@ -165,7 +257,7 @@ func (s *S3Storage) GetAllFiles(appName, versionID string, published bool) (map[
 
 		data, err := io.ReadAll(reader)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %w", file, err)
+			return nil, backendError("failed to read file %s: %w", file, err)
 		}
 
 		result[file] = data
@@ -173,3 +265,57 @@ func (s *S3Storage) GetAllFiles(appName, versionID string, published bool) (map[
 
 	return result, nil
 }
+
+// DeleteVersion deletes all files of a draft or published version
+func (s *S3Storage) DeleteVersion(ctx context.Context, loc Location, versionID string, published bool) error {
+	files, err := s.ListFiles(ctx, loc, versionID, published)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketFor(loc)),
+			Key:    aws.String(versionPrefix(loc, versionID, published) + file),
+		})
+		if err != nil {
+			return backendError("failed to delete %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// PurgeApp deletes all draft and published files for an application
+func (s *S3Storage) PurgeApp(ctx context.Context, loc Location) error {
+	bucket := s.bucketFor(loc)
+
+	for _, stage := range []string{"drafts", "published"} {
+		prefix := appPrefix(loc, stage)
+
+		var deleteErr error
+		err := s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				if _, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    obj.Key,
+				}); err != nil {
+					deleteErr = backendError("failed to delete %s: %w", *obj.Key, err)
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return backendError("failed to list %s files: %w", stage, err)
+		}
+		if deleteErr != nil {
+			return deleteErr
+		}
+	}
+
+	return nil
+}
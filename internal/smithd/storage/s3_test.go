@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestS3Storage_PublishedStorageClass(t *testing.T) {
+	ctx := context.Background()
+
+	s, fake := newFakeS3(t, "versions")
+	if err := s.SetPublishedStorageClass("STANDARD_IA"); err != nil {
+		t.Fatalf("SetPublishedStorageClass failed: %v", err)
+	}
+
+	loc := Location{App: "my-api"}
+	fake.objects["versions/drafts/my-api/v1.0.0/deployment.yaml"] = []byte("kind: Deployment\n")
+
+	if err := s.MoveVersion(ctx, loc, "v1.0.0"); err != nil {
+		t.Fatalf("MoveVersion failed: %v", err)
+	}
+
+	class, ok := fake.storageClasses["versions/published/my-api/v1.0.0/deployment.yaml"]
+	if !ok {
+		t.Fatal("expected the published object to be copied")
+	}
+	if class != "STANDARD_IA" {
+		t.Errorf("expected storage class STANDARD_IA, got %q", class)
+	}
+}
+
+func TestS3Storage_PublishedStorageClassDefault(t *testing.T) {
+	ctx := context.Background()
+
+	s, fake := newFakeS3(t, "versions")
+
+	fake.objects["versions/drafts/my-api/v1.0.0/deployment.yaml"] = []byte("kind: Deployment\n")
+	if err := s.MoveVersion(ctx, Location{App: "my-api"}, "v1.0.0"); err != nil {
+		t.Fatalf("MoveVersion failed: %v", err)
+	}
+
+	if class := fake.storageClasses["versions/published/my-api/v1.0.0/deployment.yaml"]; class != "" {
+		t.Errorf("expected the bucket default storage class, got %q", class)
+	}
+}
+
+func TestS3Storage_UnknownStorageClass(t *testing.T) {
+	s := newFakeS3Storage(t, "versions")
+
+	err := s.SetPublishedStorageClass("CHEAP")
+	if err == nil || !strings.Contains(err.Error(), "unknown S3 storage class") {
+		t.Errorf("expected unknown storage class error, got %v", err)
+	}
+
+	// Archived objects can't be read by deploys
+	if err := s.SetPublishedStorageClass("GLACIER"); err == nil {
+		t.Error("expected error for GLACIER")
+	}
+}
+
+func TestS3Storage_BackendErrors(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeS3Storage(t, "versions")
+	loc := Location{App: "my-api"}
+
+	var storageErr *Error
+	if _, err := s.GetFile(ctx, loc, "v1.0.0", "deployment.yaml", true); !errors.As(err, &storageErr) {
+		t.Errorf("expected a storage error for a failed S3 call, got %v", err)
+	}
+
+	// An empty draft is a problem with the version, not with S3
+	err := s.MoveVersion(ctx, loc, "v1.0.0")
+	if err == nil || errors.As(err, &storageErr) {
+		t.Errorf("expected a plain error for an empty draft, got %v", err)
+	}
+}
+
+func TestNewS3Storage_Options(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "from-env")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "from-env")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	hostStyle := false
+	tests := []struct {
+		name string
+		opts S3Options
+		// want are substrings of a presigned URL for versions/drafts/my-api/v1/deployment.yaml
+		want []string
+	}{
+		{
+			name: "static credentials",
+			opts: S3Options{Region: "us-east-1", Endpoint: "http://minio.local:9000", AccessKeyID: "minio", SecretAccessKey: "secret", SessionToken: "token"},
+			want: []string{"http://minio.local:9000/versions/drafts/", "X-Amz-Credential=minio%2F", "X-Amz-Security-Token=token"},
+		},
+		{
+			name: "default chain",
+			opts: S3Options{Region: "us-east-1", Endpoint: "http://minio.local:9000"},
+			want: []string{"X-Amz-Credential=from-env%2F"},
+		},
+		{
+			name: "host style override",
+			opts: S3Options{Region: "us-east-1", Endpoint: "http://minio.local:9000", ForcePathStyle: &hostStyle},
+			want: []string{"http://versions.minio.local:9000/drafts/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewS3Storage("versions", tt.opts)
+			if err != nil {
+				t.Fatalf("NewS3Storage failed: %v", err)
+			}
+			url, err := s.GeneratePresignedURL(Location{App: "my-api"}, "v1", "deployment.yaml")
+			if err != nil {
+				t.Fatalf("GeneratePresignedURL failed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(url, want) {
+					t.Errorf("expected %q in %s", want, url)
+				}
+			}
+		})
+	}
+
+	if _, err := NewS3Storage("versions", S3Options{Region: "us-east-1", AccessKeyID: "minio"}); err == nil {
+		t.Error("expected an access key ID without a secret to be rejected")
+	}
+}
+
+func TestVersionPrefix_NotCleaned(t *testing.T) {
+	tests := []struct {
+		loc       Location
+		versionID string
+		want      string
+	}{
+		{Location{App: "my-api"}, "v1.0.0", "drafts/my-api/v1.0.0/"},
+		{Location{App: "my-api", Prefix: "/team-a/"}, "v1.0.0", "team-a/drafts/my-api/v1.0.0/"},
+		{Location{App: "my-api"}, "x/../../../published/other/v1", "drafts/my-api/x/../../../published/other/v1/"},
+	}
+	for _, tt := range tests {
+		if got := versionPrefix(tt.loc, tt.versionID, false); got != tt.want {
+			t.Errorf("versionPrefix(%+v, %q) = %q, want %q", tt.loc, tt.versionID, got, tt.want)
+		}
+	}
+}
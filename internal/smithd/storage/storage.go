@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Error is a failed call to the storage backend, such as S3 or the registry
+// being unreachable or refusing access, as opposed to a problem with the
+// version itself
+type Error struct {
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// backendError formats a backend failure as an *Error
+func backendError(format string, args ...interface{}) error {
+	return &Error{Err: fmt.Errorf(format, args...)}
+}
+
+// Storage stores the files of draft and published versions. Methods that
+// reach the backend stop when ctx is cancelled.
+type Storage interface {
+	// GeneratePresignedURL returns a URL that a draft file can be uploaded to
+	GeneratePresignedURL(loc Location, versionID, filename string) (string, error)
+
+	// ListFiles lists the files of a draft or published version
+	ListFiles(ctx context.Context, loc Location, versionID string, published bool) ([]string, error)
+
+	// MoveVersion publishes a draft version
+	MoveVersion(ctx context.Context, loc Location, versionID string) error
+
+	// GetFile opens a single file of a version
+	GetFile(ctx context.Context, loc Location, versionID, filename string, published bool) (io.ReadCloser, error)
+
+	// GetAllFiles reads every file of a version
+	GetAllFiles(ctx context.Context, loc Location, versionID string, published bool) (map[string][]byte, error)
+
+	// DeleteVersion deletes all files of a draft or published version
+	DeleteVersion(ctx context.Context, loc Location, versionID string, published bool) error
+
+	// VersionURI returns a URI pointing at a version's files
+	VersionURI(loc Location, versionID string, published bool) string
+
+	// PurgeApp deletes all stored files for an application
+	PurgeApp(ctx context.Context, loc Location) error
+}
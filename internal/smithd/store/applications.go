@@ -2,11 +2,16 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
-	"github.com/sorenmh/deploysmith/internal/smithd/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
 )
 
 // ApplicationStore handles application database operations
@@ -20,7 +25,7 @@ func NewApplicationStore(db *sql.DB) *ApplicationStore {
 }
 
 // Create creates a new application
-func (s *ApplicationStore) Create(name string) (*models.Application, error) {
+func (s *ApplicationStore) Create(name, storageBucket, storagePrefix string, interpolateManifests bool) (*models.Application, error) {
 	// Check if app already exists
 	var exists bool
 	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM applications WHERE name = ?)", name).Scan(&exists)
@@ -32,17 +37,25 @@ func (s *ApplicationStore) Create(name string) (*models.Application, error) {
 	}
 
 	app := &models.Application{
-		ID:        uuid.New().String(),
-		Name:      name,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		ID:                   uuid.New().String(),
+		Name:                 name,
+		StorageBucket:        storageBucket,
+		StoragePrefix:        storagePrefix,
+		InterpolateManifests: interpolateManifests,
+		CreatedAt:            time.Now().UTC(),
+		UpdatedAt:            time.Now().UTC(),
 	}
 
 	_, err = s.db.Exec(`
-		INSERT INTO applications (id, name, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-	`, app.ID, app.Name, app.CreatedAt, app.UpdatedAt)
+		INSERT INTO applications (id, name, storage_bucket, storage_prefix, interpolate_manifests, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, app.ID, app.Name, app.StorageBucket, app.StoragePrefix, app.InterpolateManifests, app.CreatedAt, app.UpdatedAt)
 
+	// The check above races with concurrent registrations; the unique index
+	// on name settles it
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("application with name '%s' already exists", name)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create application: %w", err)
 	}
@@ -61,7 +74,7 @@ func (s *ApplicationStore) List(limit, offset int) ([]models.Application, int, e
 
 	// Get applications
 	rows, err := s.db.Query(`
-		SELECT id, name, created_at, updated_at
+		SELECT id, name, storage_bucket, storage_prefix, interpolate_manifests, created_at, updated_at, environment_variables, protected_environments
 		FROM applications
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
@@ -74,10 +87,17 @@ func (s *ApplicationStore) List(limit, offset int) ([]models.Application, int, e
 	apps := []models.Application{}
 	for rows.Next() {
 		var app models.Application
-		err := rows.Scan(&app.ID, &app.Name, &app.CreatedAt, &app.UpdatedAt)
+		var variables, protected sql.NullString
+		err := rows.Scan(&app.ID, &app.Name, &app.StorageBucket, &app.StoragePrefix, &app.InterpolateManifests, &app.CreatedAt, &app.UpdatedAt, &variables, &protected)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan application: %w", err)
 		}
+		if err := decodeVariables(variables, &app); err != nil {
+			return nil, 0, err
+		}
+		if err := decodeProtectedEnvironments(protected, &app); err != nil {
+			return nil, 0, err
+		}
 		apps = append(apps, app)
 	}
 
@@ -87,11 +107,12 @@ func (s *ApplicationStore) List(limit, offset int) ([]models.Application, int, e
 // GetByID gets an application by ID
 func (s *ApplicationStore) GetByID(id string) (*models.Application, error) {
 	var app models.Application
+	var variables, protected sql.NullString
 	err := s.db.QueryRow(`
-		SELECT id, name, created_at, updated_at
+		SELECT id, name, storage_bucket, storage_prefix, interpolate_manifests, created_at, updated_at, environment_variables, protected_environments
 		FROM applications
 		WHERE id = ?
-	`, id).Scan(&app.ID, &app.Name, &app.CreatedAt, &app.UpdatedAt)
+	`, id).Scan(&app.ID, &app.Name, &app.StorageBucket, &app.StoragePrefix, &app.InterpolateManifests, &app.CreatedAt, &app.UpdatedAt, &variables, &protected)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("application not found")
@@ -100,17 +121,25 @@ func (s *ApplicationStore) GetByID(id string) (*models.Application, error) {
 		return nil, fmt.Errorf("failed to get application: %w", err)
 	}
 
+	if err := decodeVariables(variables, &app); err != nil {
+		return nil, err
+	}
+	if err := decodeProtectedEnvironments(protected, &app); err != nil {
+		return nil, err
+	}
+
 	return &app, nil
 }
 
 // GetByName gets an application by name
 func (s *ApplicationStore) GetByName(name string) (*models.Application, error) {
 	var app models.Application
+	var variables, protected sql.NullString
 	err := s.db.QueryRow(`
-		SELECT id, name, created_at, updated_at
+		SELECT id, name, storage_bucket, storage_prefix, interpolate_manifests, created_at, updated_at, environment_variables, protected_environments
 		FROM applications
 		WHERE name = ?
-	`, name).Scan(&app.ID, &app.Name, &app.CreatedAt, &app.UpdatedAt)
+	`, name).Scan(&app.ID, &app.Name, &app.StorageBucket, &app.StoragePrefix, &app.InterpolateManifests, &app.CreatedAt, &app.UpdatedAt, &variables, &protected)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("application not found")
@@ -119,25 +148,182 @@ func (s *ApplicationStore) GetByName(name string) (*models.Application, error) {
 		return nil, fmt.Errorf("failed to get application: %w", err)
 	}
 
+	if err := decodeVariables(variables, &app); err != nil {
+		return nil, err
+	}
+	if err := decodeProtectedEnvironments(protected, &app); err != nil {
+		return nil, err
+	}
+
 	return &app, nil
 }
 
-// GetCurrentVersions gets the currently deployed version for each environment
-func (s *ApplicationStore) GetCurrentVersions(appID string) (map[string]string, error) {
+// SetVariables replaces the placeholder values of one environment. An empty
+// map removes the environment's values.
+func (s *ApplicationStore) SetVariables(id, environment string, variables map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var app models.Application
+	var current sql.NullString
+	err = tx.QueryRow("SELECT environment_variables FROM applications WHERE id = ?", id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("application not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get application: %w", err)
+	}
+	if err := decodeVariables(current, &app); err != nil {
+		return err
+	}
+
+	all := app.EnvironmentVariables
+	if all == nil {
+		all = make(map[string]map[string]string)
+	}
+	if len(variables) == 0 {
+		delete(all, environment)
+	} else {
+		all[environment] = variables
+	}
+
+	var data sql.NullString
+	if len(all) > 0 {
+		encoded, err := json.Marshal(all)
+		if err != nil {
+			return fmt.Errorf("failed to encode environment variables: %w", err)
+		}
+		data = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE applications SET environment_variables = ?, updated_at = ? WHERE id = ?
+	`, data, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to save environment variables: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure on
+// SQLite or Postgres
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+// decodeVariables decodes the environment_variables column into app
+func decodeVariables(variables sql.NullString, app *models.Application) error {
+	if !variables.Valid || variables.String == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(variables.String), &app.EnvironmentVariables); err != nil {
+		return fmt.Errorf("failed to decode environment variables: %w", err)
+	}
+	return nil
+}
+
+// SetRequiresApproval turns the approval gate of one environment on or off
+func (s *ApplicationStore) SetRequiresApproval(id, environment string, requiresApproval bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var app models.Application
+	var current sql.NullString
+	err = tx.QueryRow("SELECT protected_environments FROM applications WHERE id = ?", id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("application not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get application: %w", err)
+	}
+	if err := decodeProtectedEnvironments(current, &app); err != nil {
+		return err
+	}
+
+	protected := []string{}
+	for _, env := range app.ProtectedEnvironments {
+		if env != environment {
+			protected = append(protected, env)
+		}
+	}
+	if requiresApproval {
+		protected = append(protected, environment)
+		sort.Strings(protected)
+	}
+
+	var data sql.NullString
+	if len(protected) > 0 {
+		encoded, err := json.Marshal(protected)
+		if err != nil {
+			return fmt.Errorf("failed to encode protected environments: %w", err)
+		}
+		data = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE applications SET protected_environments = ?, updated_at = ? WHERE id = ?
+	`, data, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to save protected environments: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// decodeProtectedEnvironments decodes the protected_environments column into app
+func decodeProtectedEnvironments(protected sql.NullString, app *models.Application) error {
+	if !protected.Valid || protected.String == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(protected.String), &app.ProtectedEnvironments); err != nil {
+		return fmt.Errorf("failed to decode protected environments: %w", err)
+	}
+	return nil
+}
+
+// GetCurrentVersions gets the current deployment of each environment: the
+// most recently completed successful deployment. Failed and pending
+// deployments never change the current version.
+func (s *ApplicationStore) GetCurrentVersions(appID string) (map[string]models.CurrentDeployment, error) {
+	// Rank each environment's successful deployments newest first and keep
+	// the top one, so only one row per environment leaves the database
 	rows, err := s.db.Query(`
-		SELECT d.environment, v.version_id
-		FROM deployments d
-		JOIN versions v ON d.version_id = v.id
-		WHERE d.app_id = ?
-		  AND d.status = 'success'
-		  AND d.completed_at = (
-			SELECT MAX(d2.completed_at)
-			FROM deployments d2
-			WHERE d2.app_id = d.app_id
-			  AND d2.environment = d.environment
-			  AND d2.status = 'success'
-		  )
-		ORDER BY d.environment
+		SELECT environment, id, version_id, started_at, completed_at
+		FROM (
+			SELECT d.environment, d.id, v.version_id, d.started_at, d.completed_at,
+			       ROW_NUMBER() OVER (
+			           PARTITION BY d.environment
+			           ORDER BY COALESCE(d.completed_at, d.started_at) DESC, d.started_at DESC
+			       ) AS row_num
+			FROM deployments d
+			JOIN versions v ON d.version_id = v.id
+			WHERE d.app_id = ?
+			  AND d.status = 'success'
+		) ranked
+		WHERE row_num = 1
 	`, appID)
 
 	if err != nil {
@@ -145,14 +331,59 @@ func (s *ApplicationStore) GetCurrentVersions(appID string) (map[string]string,
 	}
 	defer rows.Close()
 
-	versions := make(map[string]string)
+	current := make(map[string]models.CurrentDeployment)
 	for rows.Next() {
-		var env, version string
-		if err := rows.Scan(&env, &version); err != nil {
+		var env string
+		var deployment models.CurrentDeployment
+		var completedAt sql.NullTime
+		if err := rows.Scan(&env, &deployment.DeploymentID, &deployment.VersionID, &deployment.DeployedAt, &completedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan version: %w", err)
 		}
-		versions[env] = version
+		if completedAt.Valid {
+			deployment.DeployedAt = completedAt.Time
+		}
+		current[env] = deployment
+	}
+
+	return current, nil
+}
+
+// DeleteCascade deletes an application along with its deployments, policies
+// and versions in a single transaction
+func (s *ApplicationStore) DeleteCascade(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM deployment_events WHERE deployment_id IN (SELECT id FROM deployments WHERE app_id = ?)", id); err != nil {
+		return fmt.Errorf("failed to delete deployment events: %w", err)
+	}
+
+	// Deployments reference versions and policies, so they go first
+	for _, table := range []string{"deployments", "policies", "versions"} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE app_id = ?", table), id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM applications WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("application not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return versions, nil
+	return nil
 }
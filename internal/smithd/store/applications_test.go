@@ -0,0 +1,249 @@
+package store
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func TestApplicationStore_DeleteCascade(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+
+	appStore := NewApplicationStore(database.DB)
+	if _, err := NewPolicyStore(database.DB).Create(deployment.AppID, "auto-main", "main", "staging", true, 0); err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	if _, err := NewDeploymentEventStore(database.DB).Record(deployment.ID, "created", ""); err != nil {
+		t.Fatalf("failed to record deployment event: %v", err)
+	}
+
+	if err := appStore.DeleteCascade(deployment.AppID); err != nil {
+		t.Fatalf("DeleteCascade failed: %v", err)
+	}
+
+	if _, err := appStore.GetByID(deployment.AppID); err == nil || err.Error() != "application not found" {
+		t.Errorf("expected application not found, got %v", err)
+	}
+	assertNoRows(t, database.DB, "deployment_events", "deployments", "policies", "versions")
+}
+
+func TestForeignKeysEnforced(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+
+	// Deleting the application directly cascades to everything below it
+	if _, err := database.Exec("DELETE FROM applications WHERE id = ?", deployment.AppID); err != nil {
+		t.Fatalf("failed to delete application: %v", err)
+	}
+	assertNoRows(t, database.DB, "deployments", "versions")
+
+	if _, err := NewDeploymentStore(database.DB).Create("missing", "missing", "staging", "test", nil); err == nil {
+		t.Error("expected a deployment of an unknown application to be rejected")
+	}
+}
+
+// assertNoRows fails the test if any of the tables has rows left
+func assertNoRows(t *testing.T, database *sql.DB, tables ...string) {
+	t.Helper()
+
+	for _, table := range tables {
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("expected no %s left, got %d", table, count)
+		}
+	}
+}
+
+func TestApplicationStore_DeleteCascadeUnknownApp(t *testing.T) {
+	appStore := NewApplicationStore(openTestDB(t).DB)
+
+	if err := appStore.DeleteCascade("missing"); err == nil || err.Error() != "application not found" {
+		t.Errorf("expected application not found, got %v", err)
+	}
+}
+
+func TestApplicationStore_GetCurrentVersions(t *testing.T) {
+	database := openTestDB(t)
+	first := createTestDeployment(t, database)
+	appStore := NewApplicationStore(database.DB)
+	versionStore := NewVersionStore(database.DB)
+	deploymentStore := NewDeploymentStore(database.DB)
+
+	v1, err := versionStore.GetByVersionID(first.AppID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	v2, err := versionStore.Create(first.AppID, "v2.0.0", models.VersionMetadata{Timestamp: "2025-01-02T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+
+	deploy := func(versionID, status, triggeredBy string) {
+		t.Helper()
+		d, err := deploymentStore.Create(first.AppID, versionID, "production", triggeredBy, nil)
+		if err != nil {
+			t.Fatalf("failed to create deployment: %v", err)
+		}
+		if err := deploymentStore.UpdateStatus(d.ID, status, "", ""); err != nil {
+			t.Fatalf("failed to update deployment: %v", err)
+		}
+	}
+	assertCurrent := func(want string) {
+		t.Helper()
+		current, err := appStore.GetCurrentVersions(first.AppID)
+		if err != nil {
+			t.Fatalf("GetCurrentVersions failed: %v", err)
+		}
+		if current["production"].VersionID != want {
+			t.Errorf("expected current version %s, got %v", want, current)
+		}
+		if current["production"].DeployedAt.IsZero() {
+			t.Error("expected deployedAt to be set")
+		}
+	}
+
+	if err := deploymentStore.UpdateStatus(first.ID, "success", "", ""); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+	assertCurrent("v1.0.0")
+
+	// A failed deploy does not change what is current
+	deploy(v2.ID, "failed", "test")
+	assertCurrent("v1.0.0")
+
+	deploy(v2.ID, "success", "test")
+	assertCurrent("v2.0.0")
+
+	// Rolling back makes the older version current again
+	deploy(v1.ID, "success", "rollback")
+	assertCurrent("v1.0.0")
+
+	// A pending deploy does not change what is current either
+	if _, err := deploymentStore.Create(first.AppID, v2.ID, "production", "test", nil); err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	assertCurrent("v1.0.0")
+}
+
+func TestApplicationStore_GetByName(t *testing.T) {
+	appStore := NewApplicationStore(openTestDB(t).DB)
+	app, err := appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	stored, err := appStore.GetByName("my-api")
+	if err != nil {
+		t.Fatalf("GetByName failed: %v", err)
+	}
+	if stored.ID != app.ID {
+		t.Errorf("expected app %s, got %s", app.ID, stored.ID)
+	}
+
+	if _, err := appStore.GetByName("other-api"); err == nil || err.Error() != "application not found" {
+		t.Errorf("expected application not found, got %v", err)
+	}
+}
+
+func TestApplicationStore_UniqueName(t *testing.T) {
+	database := openTestDB(t)
+	appStore := NewApplicationStore(database.DB)
+	if _, err := appStore.Create("my-api", "", "", false); err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	if _, err := appStore.Create("my-api", "", "", false); err == nil || err.Error() != "application with name 'my-api' already exists" {
+		t.Errorf("expected already exists error, got %v", err)
+	}
+
+	// The index rejects a duplicate that slips past Create's check
+	_, err := database.Exec("INSERT INTO applications (id, name) VALUES ('app-2', 'my-api')")
+	if !isUniqueViolation(err) {
+		t.Errorf("expected unique violation, got %v", err)
+	}
+}
+
+func TestApplicationStore_SetVariables(t *testing.T) {
+	appStore := NewApplicationStore(openTestDB(t).DB)
+	app, err := appStore.Create("my-api", "", "", true)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	if err := appStore.SetVariables(app.ID, "production", map[string]string{"REPLICAS": "3"}); err != nil {
+		t.Fatalf("SetVariables failed: %v", err)
+	}
+	if err := appStore.SetVariables(app.ID, "staging", map[string]string{"REPLICAS": "1"}); err != nil {
+		t.Fatalf("SetVariables failed: %v", err)
+	}
+
+	stored, err := appStore.GetByID(app.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.EnvironmentVariables["production"]["REPLICAS"] != "3" || stored.EnvironmentVariables["staging"]["REPLICAS"] != "1" {
+		t.Errorf("unexpected variables: %v", stored.EnvironmentVariables)
+	}
+
+	// An empty map removes the environment's variables
+	if err := appStore.SetVariables(app.ID, "staging", nil); err != nil {
+		t.Fatalf("SetVariables failed: %v", err)
+	}
+	stored, err = appStore.GetByName("my-api")
+	if err != nil {
+		t.Fatalf("GetByName failed: %v", err)
+	}
+	if _, ok := stored.EnvironmentVariables["staging"]; ok || len(stored.EnvironmentVariables) != 1 {
+		t.Errorf("expected only production variables, got %v", stored.EnvironmentVariables)
+	}
+
+	if err := appStore.SetVariables("missing", "staging", nil); err == nil || err.Error() != "application not found" {
+		t.Errorf("expected application not found, got %v", err)
+	}
+}
+
+func TestApplicationStore_SetRequiresApproval(t *testing.T) {
+	appStore := NewApplicationStore(openTestDB(t).DB)
+	app, err := appStore.Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	for _, environment := range []string{"production", "staging", "production"} {
+		if err := appStore.SetRequiresApproval(app.ID, environment, true); err != nil {
+			t.Fatalf("SetRequiresApproval failed: %v", err)
+		}
+	}
+
+	stored, err := appStore.GetByID(app.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if !reflect.DeepEqual(stored.ProtectedEnvironments, []string{"production", "staging"}) {
+		t.Errorf("unexpected protected environments: %v", stored.ProtectedEnvironments)
+	}
+	if !stored.RequiresApproval("production") || stored.RequiresApproval("dev") {
+		t.Errorf("RequiresApproval disagrees with %v", stored.ProtectedEnvironments)
+	}
+
+	if err := appStore.SetRequiresApproval(app.ID, "staging", false); err != nil {
+		t.Fatalf("SetRequiresApproval failed: %v", err)
+	}
+	stored, err = appStore.GetByName("my-api")
+	if err != nil {
+		t.Fatalf("GetByName failed: %v", err)
+	}
+	if !reflect.DeepEqual(stored.ProtectedEnvironments, []string{"production"}) {
+		t.Errorf("expected only production to be protected, got %v", stored.ProtectedEnvironments)
+	}
+
+	if err := appStore.SetRequiresApproval("missing", "staging", true); err == nil || err.Error() != "application not found" {
+		t.Errorf("expected application not found, got %v", err)
+	}
+}
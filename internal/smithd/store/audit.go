@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// AuditStore handles audit log database operations. The audit log is
+// append-only, so there is no way to change or remove entries.
+type AuditStore struct {
+	db *sql.DB
+}
+
+// NewAuditStore creates a new audit store
+func NewAuditStore(db *sql.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Record appends an entry to the audit log
+func (s *AuditStore) Record(actor, action, appID, target string) (*models.AuditEntry, error) {
+	entry := &models.AuditEntry{
+		Actor:     actor,
+		Action:    action,
+		AppID:     appID,
+		Target:    target,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	// RETURNING rather than LastInsertId, which Postgres doesn't support
+	err := s.db.QueryRow(`
+		INSERT INTO audit_log (actor, action, app_id, target, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, entry.Actor, entry.Action, nullString(entry.AppID), nullString(entry.Target), entry.CreatedAt).Scan(&entry.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// List lists audit entries, most recent first, with optional filtering by
+// app and actor
+func (s *AuditStore) List(appID, actor string, limit, offset int) ([]models.AuditEntry, int, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	if appID != "" {
+		where += " AND app_id = ?"
+		args = append(args, appID)
+	}
+	if actor != "" {
+		where += " AND actor = ?"
+		args = append(args, actor)
+	}
+
+	// Get total count
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT id, actor, action, app_id, target, created_at FROM audit_log`+where+
+		" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var entryAppID, target sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entryAppID, &target, &entry.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.AppID = entryAppID.String
+		entry.Target = target.String
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
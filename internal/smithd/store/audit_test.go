@@ -0,0 +1,50 @@
+package store
+
+import "testing"
+
+func TestAuditStore_RecordAndList(t *testing.T) {
+	database := openTestDB(t)
+	auditStore := NewAuditStore(database.DB)
+
+	for _, e := range []struct{ actor, action, appID, target string }{
+		{"ci", "version.draft", "app-1", "v1.0.0"},
+		{"ci", "version.publish", "app-1", "v1.0.0"},
+		{"alice", "deployment.create", "app-1", "deploy-1"},
+		{"alice", "policy.create", "app-2", "auto-main"},
+	} {
+		if _, err := auditStore.Record(e.actor, e.action, e.appID, e.target); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	entries, total, err := auditStore.List("app-1", "", 50, 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 3 || len(entries) != 3 || entries[0].Action != "deployment.create" {
+		t.Errorf("expected 3 app-1 entries, most recent first, got %d: %+v", total, entries)
+	}
+
+	entries, total, err = auditStore.List("app-1", "ci", 1, 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 2 || len(entries) != 1 || entries[0].Action != "version.publish" || entries[0].Target != "v1.0.0" {
+		t.Errorf("expected the latest of 2 ci entries, got %d: %+v", total, entries)
+	}
+}
+
+func TestAuditStore_AppendOnly(t *testing.T) {
+	database := openTestDB(t)
+	entry, err := NewAuditStore(database.DB).Record("ci", "app.register", "app-1", "my-api")
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	if _, err := database.Exec("UPDATE audit_log SET actor = 'someone-else' WHERE id = ?", entry.ID); err == nil {
+		t.Error("expected audit entries to be immutable")
+	}
+	if _, err := database.Exec("DELETE FROM audit_log WHERE id = ?", entry.ID); err == nil {
+		t.Error("expected audit entries not to be deletable")
+	}
+}
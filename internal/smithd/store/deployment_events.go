@@ -0,0 +1,67 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+// DeploymentEventStore handles deployment event database operations
+type DeploymentEventStore struct {
+	db *sql.DB
+}
+
+// NewDeploymentEventStore creates a new deployment event store
+func NewDeploymentEventStore(db *sql.DB) *DeploymentEventStore {
+	return &DeploymentEventStore{db: db}
+}
+
+// Record appends an event to a deployment's timeline
+func (s *DeploymentEventStore) Record(deploymentID, stage, message string) (*models.DeploymentEvent, error) {
+	event := &models.DeploymentEvent{
+		DeploymentID: deploymentID,
+		Stage:        stage,
+		Message:      message,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	err := s.db.QueryRow(`
+		INSERT INTO deployment_events (deployment_id, stage, message, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, event.DeploymentID, event.Stage, nullString(event.Message), event.CreatedAt).Scan(&event.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record deployment event: %w", err)
+	}
+
+	return event, nil
+}
+
+// List lists a deployment's events, oldest first
+func (s *DeploymentEventStore) List(deploymentID string) ([]models.DeploymentEvent, error) {
+	rows, err := s.db.Query(`
+		SELECT id, deployment_id, stage, message, created_at
+		FROM deployment_events
+		WHERE deployment_id = ?
+		ORDER BY id ASC
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.DeploymentEvent{}
+	for rows.Next() {
+		var event models.DeploymentEvent
+		var message sql.NullString
+		if err := rows.Scan(&event.ID, &event.DeploymentID, &event.Stage, &message, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment event: %w", err)
+		}
+		event.Message = message.String
+		events = append(events, event)
+	}
+
+	return events, nil
+}
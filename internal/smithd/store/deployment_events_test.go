@@ -0,0 +1,45 @@
+package store
+
+import "testing"
+
+func TestDeploymentEventStore_RecordAndList(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	eventStore := NewDeploymentEventStore(database.DB)
+
+	for _, e := range []struct{ stage, message string }{
+		{"created", ""},
+		{"queued", ""},
+		{"failed", "Failed to clone gitops repo: connection refused"},
+	} {
+		if _, err := eventStore.Record(deployment.ID, e.stage, e.message); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	events, err := eventStore.List(deployment.ID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(events) != 3 || events[0].Stage != "created" || events[2].Stage != "failed" {
+		t.Fatalf("expected 3 events, oldest first, got %+v", events)
+	}
+	if events[2].Message != "Failed to clone gitops repo: connection refused" {
+		t.Errorf("expected failure message to be kept, got %q", events[2].Message)
+	}
+
+	// Events go away with their deployment's version
+	if err := NewDeploymentStore(database.DB).UpdateStatus(deployment.ID, "failed", "", "connection refused"); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	if err := NewVersionStore(database.DB).Delete(deployment.VersionID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	events, err = eventStore.List(deployment.ID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected events to be deleted with the version, got %+v", events)
+	}
+}
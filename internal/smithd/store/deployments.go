@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -49,12 +50,16 @@ func (s *DeploymentStore) GetByID(id string) (*models.Deployment, error) {
 	var deployment models.Deployment
 	var completedAt sql.NullTime
 	var policyID sql.NullString
+	var gitopsSHA, errorMessage sql.NullString
+	var plan, commitMessage sql.NullString
+	var rolledBackFrom, reason sql.NullString
 
 	err := s.db.QueryRow(`
-		SELECT id, app_id, version_id, environment, status, triggered_by, policy_id, gitops_commit_sha, error_message, started_at, completed_at
-		FROM deployments
-		WHERE id = ?
-	`, id).Scan(&deployment.ID, &deployment.AppID, &deployment.VersionID, &deployment.Environment, &deployment.Status, &deployment.TriggeredBy, &policyID, &deployment.GitopsCommitSHA, &deployment.ErrorMessage, &deployment.StartedAt, &completedAt)
+		SELECT d.id, d.app_id, d.version_id, COALESCE(v.version_id, ''), d.environment, d.status, d.triggered_by, d.policy_id, d.gitops_commit_sha, d.error_message, d.started_at, d.completed_at, d.plan, d.commit_message, d.rolled_back_from, d.reason
+		FROM deployments d
+		LEFT JOIN versions v ON v.id = d.version_id
+		WHERE d.id = ?
+	`, id).Scan(&deployment.ID, &deployment.AppID, &deployment.VersionID, &deployment.Version, &deployment.Environment, &deployment.Status, &deployment.TriggeredBy, &policyID, &gitopsSHA, &errorMessage, &deployment.StartedAt, &completedAt, &plan, &commitMessage, &rolledBackFrom, &reason)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("deployment not found")
@@ -69,12 +74,23 @@ func (s *DeploymentStore) GetByID(id string) (*models.Deployment, error) {
 	if policyID.Valid {
 		deployment.PolicyID = &policyID.String
 	}
+	deployment.GitopsCommitSHA = gitopsSHA.String
+	deployment.ErrorMessage = errorMessage.String
+	deployment.CommitMessage = commitMessage.String
+	deployment.RolledBackFrom = rolledBackFrom.String
+	deployment.Reason = reason.String
+	if plan.Valid && plan.String != "" {
+		deployment.Plan = &models.DeploymentPlan{}
+		if err := json.Unmarshal([]byte(plan.String), deployment.Plan); err != nil {
+			return nil, fmt.Errorf("failed to decode deployment plan: %w", err)
+		}
+	}
 
 	return &deployment, nil
 }
 
 // List lists deployments with optional filtering by app and environment
-func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]models.Deployment, int, error) {
+func (s *DeploymentStore) List(appID, environment, status string, limit, offset int) ([]models.Deployment, int, error) {
 	// Build query with filters
 	query := "SELECT COUNT(*) FROM deployments WHERE 1=1"
 	args := []interface{}{}
@@ -87,6 +103,10 @@ func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]
 		query += " AND environment = ?"
 		args = append(args, environment)
 	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
 
 	// Get total count
 	var total int
@@ -96,17 +116,22 @@ func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]
 	}
 
 	// Get deployments
-	query = `SELECT id, app_id, version_id, environment, status, triggered_by, policy_id, gitops_commit_sha, error_message, started_at, completed_at
-		FROM deployments WHERE 1=1`
+	query = `SELECT d.id, d.app_id, d.version_id, COALESCE(v.version_id, ''), d.environment, d.status, d.triggered_by, d.policy_id, d.gitops_commit_sha, d.error_message, d.started_at, d.completed_at
+		FROM deployments d
+		LEFT JOIN versions v ON v.id = d.version_id
+		WHERE 1=1`
 
 	if appID != "" {
-		query += " AND app_id = ?"
+		query += " AND d.app_id = ?"
 	}
 	if environment != "" {
-		query += " AND environment = ?"
+		query += " AND d.environment = ?"
+	}
+	if status != "" {
+		query += " AND d.status = ?"
 	}
 
-	query += " ORDER BY started_at DESC LIMIT ? OFFSET ?"
+	query += " ORDER BY d.started_at DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
 
 	rows, err := s.db.Query(query, args...)
@@ -120,8 +145,9 @@ func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]
 		var deployment models.Deployment
 		var completedAt sql.NullTime
 		var policyID sql.NullString
+		var gitopsSHA, errorMessage sql.NullString
 
-		err := rows.Scan(&deployment.ID, &deployment.AppID, &deployment.VersionID, &deployment.Environment, &deployment.Status, &deployment.TriggeredBy, &policyID, &deployment.GitopsCommitSHA, &deployment.ErrorMessage, &deployment.StartedAt, &completedAt)
+		err := rows.Scan(&deployment.ID, &deployment.AppID, &deployment.VersionID, &deployment.Version, &deployment.Environment, &deployment.Status, &deployment.TriggeredBy, &policyID, &gitopsSHA, &errorMessage, &deployment.StartedAt, &completedAt)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan deployment: %w", err)
 		}
@@ -132,6 +158,8 @@ func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]
 		if policyID.Valid {
 			deployment.PolicyID = &policyID.String
 		}
+		deployment.GitopsCommitSHA = gitopsSHA.String
+		deployment.ErrorMessage = errorMessage.String
 
 		deployments = append(deployments, deployment)
 	}
@@ -139,6 +167,126 @@ func (s *DeploymentStore) List(appID, environment string, limit, offset int) ([]
 	return deployments, total, nil
 }
 
+// CountActive counts an application's pending, held and successful
+// deployments. A held deployment (pending_approval) can still be approved and
+// run, and a successful one still has manifests live in the gitops repo.
+func (s *DeploymentStore) CountActive(appID string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM deployments
+		WHERE app_id = ? AND status IN ('pending', 'pending_approval', 'success')
+	`, appID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active deployments: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountPendingForVersion counts a version's deployments that are waiting to
+// run or held for approval
+func (s *DeploymentStore) CountPendingForVersion(versionID string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM deployments
+		WHERE version_id = ? AND status IN ('pending', 'pending_approval')
+	`, versionID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending deployments: %w", err)
+	}
+
+	return count, nil
+}
+
+// Claim records that owner, a smithd instance, has queued a pending
+// deployment, and starts the deployment's lease
+func (s *DeploymentStore) Claim(id, owner string) error {
+	result, err := s.db.Exec(`
+		UPDATE deployments SET owner = ?, heartbeat_at = ?
+		WHERE id = ? AND status = 'pending'
+	`, owner, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to claim deployment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	return nil
+}
+
+// RenewLeases renews the leases of the pending deployments owner has claimed
+func (s *DeploymentStore) RenewLeases(owner string) error {
+	_, err := s.db.Exec(`
+		UPDATE deployments SET heartbeat_at = ?
+		WHERE owner = ? AND status = 'pending'
+	`, time.Now().UTC(), owner)
+	if err != nil {
+		return fmt.Errorf("failed to renew deployment leases: %w", err)
+	}
+
+	return nil
+}
+
+// ListExpired lists pending deployments across all applications whose lease
+// was last renewed before before, oldest first. A deployment nobody has
+// claimed yet holds a lease from when it was created or approved.
+func (s *DeploymentStore) ListExpired(before time.Time) ([]models.Deployment, error) {
+	rows, err := s.db.Query(`
+		SELECT d.id, d.app_id, d.version_id, COALESCE(v.version_id, ''), d.environment, d.triggered_by, d.started_at
+		FROM deployments d
+		LEFT JOIN versions v ON v.id = d.version_id
+		WHERE d.status = 'pending' AND COALESCE(d.heartbeat_at, d.started_at) < ?
+		ORDER BY d.started_at
+	`, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []models.Deployment{}
+	for rows.Next() {
+		var deployment models.Deployment
+		err := rows.Scan(&deployment.ID, &deployment.AppID, &deployment.VersionID, &deployment.Version, &deployment.Environment, &deployment.TriggeredBy, &deployment.StartedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployment.Status = "pending"
+		deployments = append(deployments, deployment)
+	}
+
+	return deployments, rows.Err()
+}
+
+// Expire fails a pending deployment whose lease was last renewed before
+// before. It fails with "deployment lease not expired" if the lease has
+// been renewed or the deployment finished since it was listed.
+func (s *DeploymentStore) Expire(id string, before time.Time, errorMsg string) error {
+	result, err := s.db.Exec(`
+		UPDATE deployments
+		SET status = 'failed', error_message = ?, completed_at = ?
+		WHERE id = ? AND status = 'pending' AND COALESCE(heartbeat_at, started_at) < ?
+	`, errorMsg, time.Now().UTC(), id, before.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to expire deployment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment lease not expired")
+	}
+
+	return nil
+}
+
 // UpdateStatus updates the deployment status
 func (s *DeploymentStore) UpdateStatus(id, status, gitopsSHA, errorMsg string) error {
 	now := time.Now().UTC()
@@ -163,3 +311,116 @@ func (s *DeploymentStore) UpdateStatus(id, status, gitopsSHA, errorMsg string) e
 
 	return nil
 }
+
+// HoldForApproval puts a pending deployment on hold until it is approved,
+// keeping the commit message to use once it is
+func (s *DeploymentStore) HoldForApproval(id, commitMessage string) error {
+	result, err := s.db.Exec(`
+		UPDATE deployments SET status = 'pending_approval', commit_message = ?
+		WHERE id = ? AND status = 'pending'
+	`, commitMessage, id)
+	if err != nil {
+		return fmt.Errorf("failed to hold deployment for approval: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	return nil
+}
+
+// Approve releases a deployment held for approval back to pending. Only one
+// of several concurrent approvals succeeds.
+func (s *DeploymentStore) Approve(id string) error {
+	result, err := s.db.Exec(`
+		UPDATE deployments SET status = 'pending', heartbeat_at = ?
+		WHERE id = ? AND status = 'pending_approval'
+	`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to approve deployment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment is not awaiting approval")
+	}
+
+	return nil
+}
+
+// SuccessfulVersions returns the version IDs of successful deployments of an
+// application to an environment, most recent first
+func (s *DeploymentStore) SuccessfulVersions(appID, environment string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT v.version_id
+		FROM deployments d
+		JOIN versions v ON v.id = d.version_id
+		WHERE d.app_id = ? AND d.environment = ? AND d.status = 'success'
+		ORDER BY COALESCE(d.completed_at, d.started_at) DESC, d.started_at DESC
+	`, appID, environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list successful deployments: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []string{}
+	for rows.Next() {
+		var versionID string
+		if err := rows.Scan(&versionID); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		versions = append(versions, versionID)
+	}
+
+	return versions, nil
+}
+
+// SetRollback records the version a rollback deployment replaces and why it
+// was made
+func (s *DeploymentStore) SetRollback(id, rolledBackFrom, reason string) error {
+	result, err := s.db.Exec(`UPDATE deployments SET rolled_back_from = ?, reason = ? WHERE id = ?`, rolledBackFrom, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to save rollback details: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	return nil
+}
+
+// SetPlan records the plan for a deployment
+func (s *DeploymentStore) SetPlan(id string, plan *models.DeploymentPlan) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode deployment plan: %w", err)
+	}
+
+	result, err := s.db.Exec(`UPDATE deployments SET plan = ? WHERE id = ?`, string(data), id)
+	if err != nil {
+		return fmt.Errorf("failed to save deployment plan: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	return nil
+}
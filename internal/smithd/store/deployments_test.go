@@ -0,0 +1,306 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sorenmh/deploysmith/internal/smithd/db"
+	"github.com/sorenmh/deploysmith/internal/smithd/models"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.Open("sqlite", filepath.Join(t.TempDir(), "smithd.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return database
+}
+
+func createTestDeployment(t *testing.T, database *db.DB) *models.Deployment {
+	t.Helper()
+
+	app, err := NewApplicationStore(database.DB).Create("my-api", "", "", false)
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	version, err := NewVersionStore(database.DB).Create(app.ID, "v1.0.0", models.VersionMetadata{
+		GitSHA:    "abc123",
+		GitBranch: "main",
+		Timestamp: "2025-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	deployment, err := NewDeploymentStore(database.DB).Create(app.ID, version.ID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	return deployment
+}
+
+func TestDeploymentStore_SetPlan(t *testing.T) {
+	database := openTestDB(t)
+	deploymentStore := NewDeploymentStore(database.DB)
+	deployment := createTestDeployment(t, database)
+
+	plan := &models.DeploymentPlan{
+		Bundle:     "s3://deploysmith-versions/published/my-api/v1.0.0/",
+		GitopsPath: "environments/production/apps/my-api",
+		Files: []models.PlanFile{
+			{Path: "environments/production/apps/my-api/deployment.yaml", SHA256: "0a1b2c"},
+			{Path: "environments/production/apps/my-api/service.yaml", SHA256: "3d4e5f"},
+		},
+	}
+
+	if err := deploymentStore.SetPlan(deployment.ID, plan); err != nil {
+		t.Fatalf("SetPlan failed: %v", err)
+	}
+
+	got, err := deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Plan, plan) {
+		t.Errorf("plan mismatch: got %+v, want %+v", got.Plan, plan)
+	}
+}
+
+func TestDeploymentStore_SetPlanUnknownDeployment(t *testing.T) {
+	deploymentStore := NewDeploymentStore(openTestDB(t).DB)
+
+	err := deploymentStore.SetPlan("missing", &models.DeploymentPlan{})
+	if err == nil || err.Error() != "deployment not found" {
+		t.Errorf("expected deployment not found, got %v", err)
+	}
+}
+
+func TestDeploymentStore_GetByIDWithoutPlan(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+
+	got, err := NewDeploymentStore(database.DB).GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Plan != nil {
+		t.Errorf("expected no plan, got %+v", got.Plan)
+	}
+}
+
+func TestDeploymentStore_CountActive(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	deploymentStore := NewDeploymentStore(database.DB)
+
+	count, err := deploymentStore.CountActive(deployment.AppID)
+	if err != nil {
+		t.Fatalf("CountActive failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 active deployment, got %d", count)
+	}
+
+	if err := deploymentStore.HoldForApproval(deployment.ID, "Deploy"); err != nil {
+		t.Fatalf("HoldForApproval failed: %v", err)
+	}
+	count, err = deploymentStore.CountActive(deployment.AppID)
+	if err != nil {
+		t.Fatalf("CountActive failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected the held deployment to be active, got %d", count)
+	}
+
+	if err := deploymentStore.UpdateStatus(deployment.ID, "failed", "", "boom"); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	count, err = deploymentStore.CountActive(deployment.AppID)
+	if err != nil {
+		t.Fatalf("CountActive failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no active deployments, got %d", count)
+	}
+}
+
+func TestDeploymentStore_ListIncludesVersion(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	deploymentStore := NewDeploymentStore(database.DB)
+
+	deployments, total, err := deploymentStore.List(deployment.AppID, "production", "", 50, 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 1 || len(deployments) != 1 {
+		t.Fatalf("expected 1 deployment, got total=%d len=%d", total, len(deployments))
+	}
+	if deployments[0].Version != "v1.0.0" {
+		t.Errorf("expected version v1.0.0, got %q", deployments[0].Version)
+	}
+
+	_, total, err = deploymentStore.List(deployment.AppID, "staging", "", 50, 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("expected no staging deployments, got %d", total)
+	}
+}
+
+func TestDeploymentStore_HoldForApproval(t *testing.T) {
+	database := openTestDB(t)
+	deploymentStore := NewDeploymentStore(database.DB)
+	deployment := createTestDeployment(t, database)
+
+	if err := deploymentStore.HoldForApproval(deployment.ID, "Deploy my-api version v1.0.0 to production"); err != nil {
+		t.Fatalf("HoldForApproval failed: %v", err)
+	}
+
+	got, err := deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Status != "pending_approval" || got.CommitMessage != "Deploy my-api version v1.0.0 to production" {
+		t.Errorf("unexpected held deployment: status %s, commit message %q", got.Status, got.CommitMessage)
+	}
+
+	if err := deploymentStore.Approve(deployment.ID); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	got, err = deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Status != "pending" {
+		t.Errorf("expected pending after approval, got %s", got.Status)
+	}
+
+	// A deployment can only be approved once
+	if err := deploymentStore.Approve(deployment.ID); err == nil || err.Error() != "deployment is not awaiting approval" {
+		t.Errorf("expected deployment is not awaiting approval, got %v", err)
+	}
+}
+
+func TestDeploymentStore_SetRollback(t *testing.T) {
+	database := openTestDB(t)
+	deploymentStore := NewDeploymentStore(database.DB)
+	deployment := createTestDeployment(t, database)
+
+	if err := deploymentStore.SetRollback(deployment.ID, "v2.0.0", "error rate spiked"); err != nil {
+		t.Fatalf("SetRollback failed: %v", err)
+	}
+
+	got, err := deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.RolledBackFrom != "v2.0.0" || got.Reason != "error rate spiked" {
+		t.Errorf("unexpected rollback details: from %q, reason %q", got.RolledBackFrom, got.Reason)
+	}
+
+	if err := deploymentStore.SetRollback("missing", "v2.0.0", ""); err == nil || err.Error() != "deployment not found" {
+		t.Errorf("expected deployment not found, got %v", err)
+	}
+}
+
+func TestDeploymentStore_ListByStatus(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	deploymentStore := NewDeploymentStore(database.DB)
+
+	if err := deploymentStore.UpdateStatus(deployment.ID, "failed", "", "push rejected"); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+	if _, err := deploymentStore.Create(deployment.AppID, deployment.VersionID, "production", "test", nil); err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+
+	deployments, total, err := deploymentStore.List(deployment.AppID, "", "failed", 50, 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 1 || len(deployments) != 1 || deployments[0].ID != deployment.ID {
+		t.Errorf("expected only the failed deployment, got total=%d %+v", total, deployments)
+	}
+}
+
+func TestDeploymentStore_Leases(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	deploymentStore := NewDeploymentStore(database.DB)
+
+	held, err := deploymentStore.Create(deployment.AppID, deployment.VersionID, "production", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	if err := deploymentStore.HoldForApproval(held.ID, "Deploy"); err != nil {
+		t.Fatalf("HoldForApproval failed: %v", err)
+	}
+
+	// A new deployment holds a lease from when it was created
+	deployments, err := deploymentStore.ListExpired(time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ListExpired failed: %v", err)
+	}
+	if len(deployments) != 0 {
+		t.Fatalf("expected no expired deployments, got %+v", deployments)
+	}
+	deployments, err = deploymentStore.ListExpired(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ListExpired failed: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].ID != deployment.ID || deployments[0].Version != "v1.0.0" {
+		t.Fatalf("expected only the pending deployment, got %+v", deployments)
+	}
+
+	// Only its owner renews a claimed deployment's lease
+	if err := deploymentStore.Claim(deployment.ID, "instance-a"); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if _, err := database.Exec("UPDATE deployments SET heartbeat_at = ?", time.Now().Add(-time.Hour).UTC()); err != nil {
+		t.Fatalf("failed to age lease: %v", err)
+	}
+	cutoff := time.Now().Add(-time.Minute)
+	if err := deploymentStore.RenewLeases("instance-b"); err != nil {
+		t.Fatalf("RenewLeases failed: %v", err)
+	}
+	if deployments, _ := deploymentStore.ListExpired(cutoff); len(deployments) != 1 {
+		t.Fatalf("expected the lease to stay expired, got %+v", deployments)
+	}
+	if err := deploymentStore.RenewLeases("instance-a"); err != nil {
+		t.Fatalf("RenewLeases failed: %v", err)
+	}
+	if deployments, _ := deploymentStore.ListExpired(cutoff); len(deployments) != 0 {
+		t.Fatalf("expected the lease to be renewed, got %+v", deployments)
+	}
+	if err := deploymentStore.Expire(deployment.ID, cutoff, "gone"); err == nil || err.Error() != "deployment lease not expired" {
+		t.Errorf("expected deployment lease not expired, got %v", err)
+	}
+
+	// Expiring fails the deployment once
+	later := time.Now().Add(time.Minute)
+	if err := deploymentStore.Expire(deployment.ID, later, "gone"); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	got, err := deploymentStore.GetByID(deployment.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Status != "failed" || got.ErrorMessage != "gone" || got.CompletedAt == nil {
+		t.Errorf("expected the deployment to fail, got %s: %s", got.Status, got.ErrorMessage)
+	}
+	if err := deploymentStore.Expire(deployment.ID, later, "gone"); err == nil || err.Error() != "deployment lease not expired" {
+		t.Errorf("expected deployment lease not expired, got %v", err)
+	}
+	if err := deploymentStore.Claim(deployment.ID, "instance-a"); err == nil || err.Error() != "deployment not found" {
+		t.Errorf("expected a finished deployment not to be claimed, got %v", err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sorenmh/deploysmith/internal/smithd/models"
 	"github.com/google/uuid"
@@ -20,7 +23,7 @@ func NewPolicyStore(db *sql.DB) *PolicyStore {
 }
 
 // Create creates a new policy
-func (s *PolicyStore) Create(appID, name, branchPattern, targetEnv string, enabled bool) (*models.Policy, error) {
+func (s *PolicyStore) Create(appID, name, branchPattern, targetEnv string, enabled bool, priority int) (*models.Policy, error) {
 	policy := &models.Policy{
 		ID:                uuid.New().String(),
 		AppID:             appID,
@@ -28,12 +31,14 @@ func (s *PolicyStore) Create(appID, name, branchPattern, targetEnv string, enabl
 		GitBranchPattern:  branchPattern,
 		TargetEnvironment: targetEnv,
 		Enabled:           enabled,
+		Priority:          priority,
+		CreatedAt:         time.Now().UTC(),
 	}
 
 	_, err := s.db.Exec(`
-		INSERT INTO policies (id, app_id, name, git_branch_pattern, target_environment, enabled)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, policy.ID, policy.AppID, policy.Name, policy.GitBranchPattern, policy.TargetEnvironment, policy.Enabled)
+		INSERT INTO policies (id, app_id, name, git_branch_pattern, target_environment, enabled, priority, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, policy.ID, policy.AppID, policy.Name, policy.GitBranchPattern, policy.TargetEnvironment, policy.Enabled, policy.Priority, policy.CreatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create policy: %w", err)
@@ -48,10 +53,10 @@ func (s *PolicyStore) GetByID(id string) (*models.Policy, error) {
 	var policy models.Policy
 
 	err := s.db.QueryRow(`
-		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, created_at
+		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, priority, created_at
 		FROM policies
 		WHERE id = ?
-	`, id).Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.CreatedAt)
+	`, id).Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.Priority, &policy.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("policy not found")
@@ -66,7 +71,7 @@ func (s *PolicyStore) GetByID(id string) (*models.Policy, error) {
 // List lists all policies for an application
 func (s *PolicyStore) List(appID string) ([]models.Policy, error) {
 	rows, err := s.db.Query(`
-		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, created_at
+		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, priority, created_at
 		FROM policies
 		WHERE app_id = ?
 		ORDER BY created_at DESC
@@ -79,7 +84,7 @@ func (s *PolicyStore) List(appID string) ([]models.Policy, error) {
 	policies := []models.Policy{}
 	for rows.Next() {
 		var policy models.Policy
-		err := rows.Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.CreatedAt)
+		err := rows.Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.Priority, &policy.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan policy: %w", err)
 		}
@@ -89,6 +94,40 @@ func (s *PolicyStore) List(appID string) ([]models.Policy, error) {
 	return policies, nil
 }
 
+// Update updates a policy's name, branch pattern, target environment, enabled state and priority
+func (s *PolicyStore) Update(id, name, branchPattern, targetEnv string, enabled bool, priority int) (*models.Policy, error) {
+	// Check the new name is not taken by another policy of the same app
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM policies WHERE name = ? AND id != ? AND app_id = (SELECT app_id FROM policies WHERE id = ?))
+	`, name, id, id).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if policy exists: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("policy with name '%s' already exists", name)
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE policies
+		SET name = ?, git_branch_pattern = ?, target_environment = ?, enabled = ?, priority = ?
+		WHERE id = ?
+	`, name, branchPattern, targetEnv, enabled, priority, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update policy: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	return s.GetByID(id)
+}
+
 // Delete deletes a policy
 func (s *PolicyStore) Delete(id string) error {
 	result, err := s.db.Exec("DELETE FROM policies WHERE id = ?", id)
@@ -107,13 +146,16 @@ func (s *PolicyStore) Delete(id string) error {
 	return nil
 }
 
-// FindMatchingPolicies finds all enabled policies that match the given branch
+// FindMatchingPolicies finds the enabled policies that match the given
+// branch, highest priority first. When several match the same target
+// environment only the highest priority one is returned, the oldest winning
+// ties, so one publish never starts racing deploys to an environment.
 func (s *PolicyStore) FindMatchingPolicies(appID, branch string) ([]models.Policy, error) {
 	rows, err := s.db.Query(`
-		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, created_at
+		SELECT id, app_id, name, git_branch_pattern, target_environment, enabled, priority, created_at
 		FROM policies
-		WHERE app_id = ? AND enabled = 1
-		ORDER BY created_at ASC
+		WHERE app_id = ? AND enabled = TRUE
+		ORDER BY priority DESC, created_at ASC, id ASC
 	`, appID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query policies: %w", err)
@@ -121,25 +163,40 @@ func (s *PolicyStore) FindMatchingPolicies(appID, branch string) ([]models.Polic
 	defer rows.Close()
 
 	matchingPolicies := []models.Policy{}
+	environments := map[string]bool{}
 	for rows.Next() {
 		var policy models.Policy
-		err := rows.Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.CreatedAt)
+		err := rows.Scan(&policy.ID, &policy.AppID, &policy.Name, &policy.GitBranchPattern, &policy.TargetEnvironment, &policy.Enabled, &policy.Priority, &policy.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan policy: %w", err)
 		}
 
 		// Check if branch matches the pattern
-		if matchesBranchPattern(branch, policy.GitBranchPattern) {
-			matchingPolicies = append(matchingPolicies, policy)
+		if !matchesBranchPattern(branch, policy.GitBranchPattern) || environments[policy.TargetEnvironment] {
+			continue
 		}
+		environments[policy.TargetEnvironment] = true
+		matchingPolicies = append(matchingPolicies, policy)
 	}
 
 	return matchingPolicies, nil
 }
 
-// matchesBranchPattern checks if a branch name matches a pattern
-// Supports wildcards: "main", "release/*", "feature/xyz"
+// regexPatternPrefix marks a branch pattern as a regular expression
+const regexPatternPrefix = "regex:"
+
+// matchesBranchPattern checks if a branch name matches a pattern. Patterns
+// starting with "regex:" are regular expressions that must match the whole
+// branch name; other patterns are exact names or globs.
 func matchesBranchPattern(branch, pattern string) bool {
+	if expr, ok := strings.CutPrefix(pattern, regexPatternPrefix); ok {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(branch)
+	}
+
 	// Exact match
 	if branch == pattern {
 		return true
@@ -153,3 +210,18 @@ func matchesBranchPattern(branch, pattern string) bool {
 
 	return matched
 }
+
+// ValidateBranchPattern checks that a branch pattern can be matched against
+func ValidateBranchPattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, regexPatternPrefix); ok {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid glob pattern: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyStore_Update(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	policyStore := NewPolicyStore(database.DB)
+
+	policy, err := policyStore.Create(deployment.AppID, "auto-main", "main", "staging", true, 0)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	updated, err := policyStore.Update(policy.ID, "auto-release", "release/*", "production", false, 5)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if updated.ID != policy.ID {
+		t.Errorf("expected ID %s to be kept, got %s", policy.ID, updated.ID)
+	}
+	if updated.Name != "auto-release" || updated.GitBranchPattern != "release/*" || updated.TargetEnvironment != "production" || updated.Enabled || updated.Priority != 5 {
+		t.Errorf("unexpected policy after update: %+v", updated)
+	}
+}
+
+func TestPolicyStore_UpdateDuplicateName(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	policyStore := NewPolicyStore(database.DB)
+
+	if _, err := policyStore.Create(deployment.AppID, "auto-main", "main", "staging", true, 0); err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	policy, err := policyStore.Create(deployment.AppID, "auto-release", "release/*", "production", true, 0)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	if _, err := policyStore.Update(policy.ID, "auto-main", "release/*", "production", true, 0); err == nil || err.Error() != "policy with name 'auto-main' already exists" {
+		t.Errorf("expected duplicate name error, got %v", err)
+	}
+
+	// Keeping its own name is fine
+	if _, err := policyStore.Update(policy.ID, "auto-release", "release/*", "production", false, 0); err != nil {
+		t.Errorf("expected update keeping the name to succeed, got %v", err)
+	}
+}
+
+func TestPolicyStore_UpdateUnknownPolicy(t *testing.T) {
+	policyStore := NewPolicyStore(openTestDB(t).DB)
+
+	if _, err := policyStore.Update("missing", "name", "main", "staging", true, 0); err == nil || err.Error() != "policy not found" {
+		t.Errorf("expected policy not found, got %v", err)
+	}
+}
+
+func TestPolicyStore_FindMatchingPoliciesPriority(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	policyStore := NewPolicyStore(database.DB)
+
+	// Two policies deploy main to staging; only the higher priority one runs
+	for _, p := range []struct {
+		name, pattern, env string
+		priority           int
+	}{
+		{"staging-any", "*", "staging", 0},
+		{"staging-main", "main", "staging", 10},
+		{"dev-main", "main", "dev", 0},
+		{"dev-any", "*", "dev", 0},
+	} {
+		if _, err := policyStore.Create(deployment.AppID, p.name, p.pattern, p.env, true, p.priority); err != nil {
+			t.Fatalf("failed to create policy %s: %v", p.name, err)
+		}
+	}
+
+	policies, err := policyStore.FindMatchingPolicies(deployment.AppID, "main")
+	if err != nil {
+		t.Fatalf("FindMatchingPolicies failed: %v", err)
+	}
+
+	var names []string
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	// Ties go to the oldest policy
+	if want := []string{"staging-main", "dev-main"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("matching policies = %v, want %v", names, want)
+	}
+}
+
+func TestMatchesBranchPattern(t *testing.T) {
+	tests := []struct {
+		branch  string
+		pattern string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "develop", false},
+		{"feature/login", "feature/*", true},
+		{"feature/login/v2", "feature/*", false},
+		{"release/v1.2", `regex:release/v\d+\.\d+`, true},
+		{"release/v1.2-rc1", `regex:release/v\d+\.\d+`, false},
+		{"hotfix/release/v1.2", `regex:release/v\d+\.\d+`, false},
+		{"main", "regex:main|master", true},
+		{"main", "regex:[", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesBranchPattern(tt.branch, tt.pattern); got != tt.want {
+			t.Errorf("matchesBranchPattern(%q, %q) = %v, want %v", tt.branch, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBranchPattern(t *testing.T) {
+	for _, pattern := range []string{"main", "release/*", `regex:release/v\d+\.\d+`} {
+		if err := ValidateBranchPattern(pattern); err != nil {
+			t.Errorf("ValidateBranchPattern(%q) failed: %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"regex:release/(v1", "release/["} {
+		if err := ValidateBranchPattern(pattern); err == nil {
+			t.Errorf("ValidateBranchPattern(%q): expected error", pattern)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -56,12 +57,13 @@ func (s *VersionStore) Create(appID, versionID string, metadata models.VersionMe
 func (s *VersionStore) GetByVersionID(appID, versionID string) (*models.Version, error) {
 	var version models.Version
 	var publishedAt sql.NullTime
+	var checksums sql.NullString
 
 	err := s.db.QueryRow(`
-		SELECT id, app_id, version_id, status, git_sha, git_branch, git_committer, build_number, metadata_timestamp, created_at, published_at
+		SELECT id, app_id, version_id, status, git_sha, git_branch, git_committer, build_number, metadata_timestamp, created_at, published_at, checksums, publishing
 		FROM versions
 		WHERE app_id = ? AND version_id = ?
-	`, appID, versionID).Scan(&version.ID, &version.AppID, &version.VersionID, &version.Status, &version.GitSHA, &version.GitBranch, &version.GitCommitter, &version.BuildNumber, &version.MetadataTimestamp, &version.CreatedAt, &publishedAt)
+	`, appID, versionID).Scan(&version.ID, &version.AppID, &version.VersionID, &version.Status, &version.GitSHA, &version.GitBranch, &version.GitCommitter, &version.BuildNumber, &version.MetadataTimestamp, &version.CreatedAt, &publishedAt, &checksums, &version.Publishing)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("version not found")
@@ -74,6 +76,12 @@ func (s *VersionStore) GetByVersionID(appID, versionID string) (*models.Version,
 		version.PublishedAt = &publishedAt.Time
 	}
 
+	if checksums.Valid && checksums.String != "" {
+		if err := json.Unmarshal([]byte(checksums.String), &version.Checksums); err != nil {
+			return nil, fmt.Errorf("failed to decode version checksums: %w", err)
+		}
+	}
+
 	return &version, nil
 }
 
@@ -100,6 +108,82 @@ func (s *VersionStore) UpdateStatus(id, status string) error {
 	return nil
 }
 
+// Publish marks a draft version as published with its file checksums, in a
+// single update, and flags it as publishing until FinishPublish is called
+// once its files have moved out of drafts. Publishing a version that is not a
+// draft fails, so concurrent publishes of one version cannot both succeed
+func (s *VersionStore) Publish(id string, checksums map[string]string) error {
+	data, err := json.Marshal(checksums)
+	if err != nil {
+		return fmt.Errorf("failed to encode version checksums: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE versions
+		SET status = 'published', published_at = CURRENT_TIMESTAMP, checksums = ?, publishing = ?
+		WHERE id = ? AND status = 'draft'
+	`, string(data), true, id)
+	if err != nil {
+		return fmt.Errorf("failed to publish version: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("version is not a draft")
+	}
+
+	return nil
+}
+
+// FinishPublish clears the publishing flag of a version
+func (s *VersionStore) FinishPublish(id string) error {
+	result, err := s.db.Exec(`UPDATE versions SET publishing = ? WHERE id = ?`, false, id)
+	if err != nil {
+		return fmt.Errorf("failed to finish publishing version: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("version not found")
+	}
+
+	return nil
+}
+
+// ListPublishing lists versions across all applications whose publish was
+// interrupted before their files finished moving
+func (s *VersionStore) ListPublishing() ([]models.Version, error) {
+	rows, err := s.db.Query(`
+		SELECT id, app_id, version_id
+		FROM versions
+		WHERE publishing = ?
+		ORDER BY created_at
+	`, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list publishing versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.Version{}
+	for rows.Next() {
+		var version models.Version
+		if err := rows.Scan(&version.ID, &version.AppID, &version.VersionID); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		version.Status = "published"
+		version.Publishing = true
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
 // List lists versions for an application with pagination
 func (s *VersionStore) List(appID string, limit, offset int) ([]models.Version, int, error) {
 	// Get total count
@@ -111,7 +195,7 @@ func (s *VersionStore) List(appID string, limit, offset int) ([]models.Version,
 
 	// Get versions
 	rows, err := s.db.Query(`
-		SELECT id, app_id, version_id, status, git_sha, git_branch, git_committer, build_number, metadata_timestamp, created_at, published_at
+		SELECT id, app_id, version_id, status, git_sha, git_branch, git_committer, build_number, metadata_timestamp, created_at, published_at, publishing
 		FROM versions
 		WHERE app_id = ?
 		ORDER BY created_at DESC
@@ -127,7 +211,7 @@ func (s *VersionStore) List(appID string, limit, offset int) ([]models.Version,
 		var version models.Version
 		var publishedAt sql.NullTime
 
-		err := rows.Scan(&version.ID, &version.AppID, &version.VersionID, &version.Status, &version.GitSHA, &version.GitBranch, &version.GitCommitter, &version.BuildNumber, &version.MetadataTimestamp, &version.CreatedAt, &publishedAt)
+		err := rows.Scan(&version.ID, &version.AppID, &version.VersionID, &version.Status, &version.GitSHA, &version.GitBranch, &version.GitCommitter, &version.BuildNumber, &version.MetadataTimestamp, &version.CreatedAt, &publishedAt, &version.Publishing)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan version: %w", err)
 		}
@@ -168,3 +252,49 @@ func (s *VersionStore) GetDeployedEnvironments(versionID string) ([]string, erro
 
 	return environments, nil
 }
+
+// Delete deletes a version along with its deployment history in a single
+// transaction. A version with pending or held deployments is kept.
+func (s *VersionStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var pending int
+	err = tx.QueryRow("SELECT COUNT(*) FROM deployments WHERE version_id = ? AND status IN ('pending', 'pending_approval')", id).Scan(&pending)
+	if err != nil {
+		return fmt.Errorf("failed to count pending deployments: %w", err)
+	}
+	if pending > 0 {
+		return fmt.Errorf("version has pending deployments")
+	}
+
+	if _, err := tx.Exec("DELETE FROM deployment_events WHERE deployment_id IN (SELECT id FROM deployments WHERE version_id = ?)", id); err != nil {
+		return fmt.Errorf("failed to delete deployment events: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM deployments WHERE version_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete deployments: %w", err)
+	}
+
+	result, err := tx.Exec("DELETE FROM versions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete version: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("version not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
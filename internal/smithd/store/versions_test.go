@@ -0,0 +1,83 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestVersionStore_Delete(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	versionStore := NewVersionStore(database.DB)
+
+	// A pending deployment keeps the version
+	if err := versionStore.Delete(deployment.VersionID); err == nil || err.Error() != "version has pending deployments" {
+		t.Fatalf("expected version has pending deployments, got %v", err)
+	}
+
+	if err := NewDeploymentStore(database.DB).UpdateStatus(deployment.ID, "failed", "", "boom"); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	if err := versionStore.Delete(deployment.VersionID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if _, err := versionStore.GetByVersionID(deployment.AppID, "v1.0.0"); err == nil || err.Error() != "version not found" {
+		t.Errorf("expected version not found, got %v", err)
+	}
+	if _, err := NewDeploymentStore(database.DB).GetByID(deployment.ID); err == nil || err.Error() != "deployment not found" {
+		t.Errorf("expected deployment not found, got %v", err)
+	}
+}
+
+func TestVersionStore_DeleteUnknownVersion(t *testing.T) {
+	versionStore := NewVersionStore(openTestDB(t).DB)
+
+	if err := versionStore.Delete("missing"); err == nil || err.Error() != "version not found" {
+		t.Errorf("expected version not found, got %v", err)
+	}
+}
+
+func TestVersionStore_Publish(t *testing.T) {
+	database := openTestDB(t)
+	deployment := createTestDeployment(t, database)
+	versionStore := NewVersionStore(database.DB)
+
+	checksums := map[string]string{"deployment.yml": "abc"}
+	if err := versionStore.Publish(deployment.VersionID, checksums); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	version, err := versionStore.GetByVersionID(deployment.AppID, "v1.0.0")
+	if err != nil {
+		t.Fatalf("GetByVersionID failed: %v", err)
+	}
+	if version.Status != "published" || version.PublishedAt == nil || !version.Publishing {
+		t.Errorf("expected published version still publishing, got %+v", version)
+	}
+	if version.Checksums["deployment.yml"] != "abc" {
+		t.Errorf("expected checksums to be saved, got %v", version.Checksums)
+	}
+
+	publishing, err := versionStore.ListPublishing()
+	if err != nil {
+		t.Fatalf("ListPublishing failed: %v", err)
+	}
+	if len(publishing) != 1 || publishing[0].VersionID != "v1.0.0" || publishing[0].AppID != deployment.AppID {
+		t.Errorf("expected v1.0.0 to be publishing, got %+v", publishing)
+	}
+
+	if err := versionStore.Publish(deployment.VersionID, checksums); err == nil || err.Error() != "version is not a draft" {
+		t.Errorf("expected version is not a draft, got %v", err)
+	}
+
+	if err := versionStore.FinishPublish(deployment.VersionID); err != nil {
+		t.Fatalf("FinishPublish failed: %v", err)
+	}
+	publishing, err = versionStore.ListPublishing()
+	if err != nil {
+		t.Fatalf("ListPublishing failed: %v", err)
+	}
+	if len(publishing) != 0 {
+		t.Errorf("expected no publishing versions, got %+v", publishing)
+	}
+}